@@ -2,21 +2,19 @@ package account
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
-	"slices"
+	"strconv"
 
 	"github.com/coleYab/mpesagosdk/internal/utils"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 type AccountBalanceRequest struct {
 	CommandID                types.CommandId      `json:"CommandID" validate:"required"`
-	IdentifierType           types.IdentifierType `json:"IdentifierType" validate:"required"`
+	IdentifierType           types.IdentifierType `json:"IdentifierType" validate:"required,oneof=1 2 4"`
 	Initiator                string               `json:"Initiator" validate:"required,min=1,max=255"`
-	PartyA                   int                  `json:"PartyA" validate:"required,min=1"`
+	PartyA                   int                  `json:"PartyA" validate:"required,shortcode"`
 	QueueTimeOutURL          string               `json:"QueueTimeOutURL" validate:"required,url"`
 	Remarks                  string               `json:"Remarks" validate:"max=500"`
 	ResultURL                string               `json:"ResultURL" validate:"required,url"`
@@ -51,11 +49,20 @@ func (a *AccountBalanceRequest) FillDefaults() {
 	a.CommandID = types.AccountBalanceCommand
 }
 
-func (a *AccountBalanceRequest) Validate(v *validator.Validate) error {
-	validIdentifiers := []types.IdentifierType{types.MsisdnIdentifierType, types.TillNumberIdentifierType, types.ShortCodeIdentifierType}
-	if !slices.Contains(validIdentifiers, a.IdentifierType) {
-		return fmt.Errorf("unkown identifier type %v", a.IdentifierType)
+// ApplyDefaults: fills the initiator, short code and callback urls from the
+// configured defaults when they are not set on the request.
+func (a *AccountBalanceRequest) ApplyDefaults(d types.Defaults) {
+	a.Initiator = types.OrDefault(a.Initiator, d.InitiatorName)
+	a.SecurityCredential = types.OrDefault(a.SecurityCredential, d.SecurityCredential)
+	a.QueueTimeOutURL = types.OrDefault(a.QueueTimeOutURL, d.QueueTimeOutURL)
+	a.ResultURL = types.OrDefault(a.ResultURL, d.ResultURL)
+	if a.PartyA == 0 {
+		if code, err := strconv.Atoi(d.ShortCode); err == nil {
+			a.PartyA = code
+		}
 	}
+}
 
+func (a *AccountBalanceRequest) Validate(v *types.Validator) error {
 	return utils.Validate(v, a)
 }
@@ -3,13 +3,13 @@ package account
 import (
 	"testing"
 
+	"github.com/coleYab/mpesagosdk/internal/utils"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestAccountBalanceRequestValidation(t *testing.T) {
-	v := validator.New()
+	v := utils.NewValidator()
 	tests := []struct {
 		name    string
 		req     AccountBalanceRequest
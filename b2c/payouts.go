@@ -4,24 +4,34 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 type B2CRequest struct {
 	InitiatorName            string          `json:"InitiatorName" validate:"required"`
 	SecurityCredential       string          `json:"SecurityCredential" validate:"required"`
 	CommandID                types.CommandId `json:"CommandID" validate:"required"`
-	Amount                   uint            `json:"Amount" validate:"required,gte=1"`
-	PartyA                   uint            `json:"PartyA" validate:"required"`
-	PartyB                   uint            `json:"PartyB" validate:"required"`
+	Amount                   money.Amount    `json:"Amount" validate:"required,gte=1"`
+	PartyA                   uint            `json:"PartyA" validate:"required,shortcode"`
+	PartyB                   uint            `json:"PartyB" validate:"required,msisdn_et"`
 	Remarks                  string          `json:"Remarks" validate:"required,max=200"`
 	QueueTimeOutURL          string          `json:"QueueTimeOutURL" validate:"required,url"`
 	ResultURL                string          `json:"ResultURL" validate:"required,url"`
 	Occasion                 string          `json:"Occasion" validate:"required"`
 	OriginatorConversationID string          `json:"OriginatorConversationID" validate:"required"`
+	// AllowDuplicate sends the payment even when the duplicate guard saw the same
+	// payout within its window, it is never sent to M-Pesa.
+	AllowDuplicate bool `json:"-"`
+	// ExpectedName is the name the recipient should be registered with, when set the
+	// registered name is looked up and the payment is refused with a
+	// *types.NameCheckError when it does not match (see the kyc package), it is never
+	// sent to M-Pesa.
+	ExpectedName string `json:"-"`
 }
 
 func (b *B2CRequest) DecodeResponse(res *http.Response) (types.MpesaResponse, error) {
@@ -49,7 +59,48 @@ func (b *B2CRequest) DecodeResponse(res *http.Response) (types.MpesaResponse, er
 
 func (b *B2CRequest) FillDefaults() {}
 
-func (b *B2CRequest) Validate(v *validator.Validate) error {
+// ApplyDefaults: fills the initiator, short code and callback urls from the
+// configured defaults when they are not set on the request.
+func (b *B2CRequest) ApplyDefaults(d types.Defaults) {
+	b.InitiatorName = types.OrDefault(b.InitiatorName, d.InitiatorName)
+	b.SecurityCredential = types.OrDefault(b.SecurityCredential, d.SecurityCredential)
+	b.QueueTimeOutURL = types.OrDefault(b.QueueTimeOutURL, d.QueueTimeOutURL)
+	b.ResultURL = types.OrDefault(b.ResultURL, d.ResultURL)
+	if b.PartyA == 0 {
+		if code, err := strconv.ParseUint(d.ShortCode, 10, 0); err == nil {
+			b.PartyA = uint(code)
+		}
+	}
+}
+
+// Normalize: rewrites the recipient to the 2517XXXXXXXX form, so 712345678 is sent as 251712345678.
+func (b *B2CRequest) Normalize() {
+	if m, err := msisdn.ParseUint(uint64(b.PartyB)); err == nil {
+		b.PartyB = uint(m.Uint64())
+	}
+}
+
+// Transfer: describes the payout for the transaction limits.
+func (b *B2CRequest) Transfer() types.Transfer {
+	return types.Transfer{CommandID: b.CommandID, Party: strconv.FormatUint(uint64(b.PartyB), 10), Amount: b.Amount}
+}
+
+// PayoutKey: identifies the payout for the duplicate guard.
+func (b *B2CRequest) PayoutKey() types.PayoutKey {
+	return types.PayoutKey{Recipient: strconv.FormatUint(uint64(b.PartyB), 10), Amount: b.Amount, Remarks: b.Remarks, Occasion: b.Occasion}
+}
+
+// DuplicateAllowed: reports whether AllowDuplicate is set.
+func (b *B2CRequest) DuplicateAllowed() bool {
+	return b.AllowDuplicate
+}
+
+// ExpectedRecipient: returns the recipient and ExpectedName for the name check.
+func (b *B2CRequest) ExpectedRecipient() (string, string) {
+	return strconv.FormatUint(uint64(b.PartyB), 10), b.ExpectedName
+}
+
+func (b *B2CRequest) Validate(v *types.Validator) error {
 	return utils.Validate(v, b)
 }
 
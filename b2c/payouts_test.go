@@ -3,12 +3,13 @@ package b2c
 import (
 	"testing"
 
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 func TestB2CRequestValidation(t *testing.T) {
-	validate := validator.New()
+	validate := utils.NewValidator()
 
 	tests := []struct {
 		name    string
@@ -24,7 +25,7 @@ func TestB2CRequestValidation(t *testing.T) {
 				OriginatorConversationID: "conv12345",
 				CommandID:                types.BusinessPaymentCommand,
 				Occasion:                 "Occasion",
-				Amount:                   1030,
+				Amount:                   money.Birr(1030),
 				PartyA:                   600000,
 				PartyB:                   251700404709,
 				Remarks:                  "Salary Payment",
@@ -42,7 +43,7 @@ func TestB2CRequestValidation(t *testing.T) {
 				OriginatorConversationID: "conv12345",
 				CommandID:                types.BusinessPaymentCommand,
 				Occasion:                 "Occasion",
-				Amount:                   1030,
+				Amount:                   money.Birr(1030),
 				PartyA:                   600000,
 				PartyB:                   251700404709,
 				Remarks:                  "Salary Payment",
@@ -61,7 +62,7 @@ func TestB2CRequestValidation(t *testing.T) {
 				OriginatorConversationID: "conv12345",
 				CommandID:                types.CommandId(""), // Empty CommandID
 				Occasion:                 "Occasion",
-				Amount:                   1030,
+				Amount:                   money.Birr(1030),
 				PartyA:                   600000,
 				PartyB:                   251700404709,
 				Remarks:                  "Salary Payment",
@@ -80,7 +81,7 @@ func TestB2CRequestValidation(t *testing.T) {
 				OriginatorConversationID: "conv12345",
 				CommandID:                types.BusinessPaymentCommand,
 				Occasion:                 "Occasion",
-				Amount:                   0, // Invalid Amount
+				Amount:                   money.Zero, // Invalid Amount
 				PartyA:                   600000,
 				PartyB:                   251700404709,
 				Remarks:                  "Salary Payment",
@@ -99,7 +100,7 @@ func TestB2CRequestValidation(t *testing.T) {
 				OriginatorConversationID: "conv12345",
 				CommandID:                types.BusinessPaymentCommand,
 				Occasion:                 "Occasion",
-				Amount:                   1030,
+				Amount:                   money.Birr(1030),
 				PartyB:                   251700404709,
 				Remarks:                  "Salary Payment",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -117,7 +118,7 @@ func TestB2CRequestValidation(t *testing.T) {
 				OriginatorConversationID: "conv12345",
 				CommandID:                types.BusinessPaymentCommand,
 				Occasion:                 "Occasion",
-				Amount:                   1030,
+				Amount:                   money.Birr(1030),
 				PartyA:                   600000,
 				Remarks:                  "Salary Payment",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -135,7 +136,7 @@ func TestB2CRequestValidation(t *testing.T) {
 				OriginatorConversationID: "conv12345",
 				CommandID:                types.BusinessPaymentCommand,
 				Occasion:                 "Occasion",
-				Amount:                   1030,
+				Amount:                   money.Birr(1030),
 				PartyA:                   600000,
 				PartyB:                   251700404709,
 				Remarks:                  string(make([]byte, 201)), // 201 characters
@@ -154,7 +155,7 @@ func TestB2CRequestValidation(t *testing.T) {
 				OriginatorConversationID: "conv12345",
 				CommandID:                types.BusinessPaymentCommand,
 				Occasion:                 "Occasion",
-				Amount:                   1030,
+				Amount:                   money.Birr(1030),
 				PartyA:                   600000,
 				PartyB:                   251700404709,
 				Remarks:                  "Salary Payment",
@@ -173,7 +174,7 @@ func TestB2CRequestValidation(t *testing.T) {
 				OriginatorConversationID: "conv12345",
 				CommandID:                types.BusinessPaymentCommand,
 				Occasion:                 "Occasion",
-				Amount:                   1030,
+				Amount:                   money.Birr(1030),
 				PartyA:                   600000,
 				PartyB:                   251700404709,
 				Remarks:                  "Salary Payment",
@@ -195,3 +196,25 @@ func TestB2CRequestValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestB2CRequestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		partyB   uint
+		expected uint
+	}{
+		{"Without country code", 712345678, 251712345678},
+		{"Already normalized", 251712345678, 251712345678},
+		{"Other operator is left for validation", 251912345678, 251912345678},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := B2CRequest{PartyB: tt.partyB}
+			req.Normalize()
+			if req.PartyB != tt.expected {
+				t.Errorf("expected PartyB %v, got %v", tt.expected, req.PartyB)
+			}
+		})
+	}
+}
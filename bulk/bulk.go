@@ -0,0 +1,421 @@
+// Package bulk runs batches of B2C payouts, such as payrolls (types.SalaryPaymentCommand)
+// or promotions (types.PromotionPaymentCommand), with bounded concurrency and a rate limit.
+//
+// Every item of a batch is tracked from the synchronous acknowledgement of M-Pesa to its
+// asynchronous result, and every change is saved in a Store before it is acted upon. A
+// batch interrupted by a crash is resumed by running it again with the same name: the
+// items already acknowledged are not sent again, and the items that may have been sent
+// when the process stopped are reported as StatusUnknown instead of being paid twice.
+//
+// Example usage:
+//
+//	store, _ := bulk.NewFileStore("/var/lib/payroll")
+//	runner := bulk.NewRunner(app, store)
+//	runner.Concurrency, runner.Rate = 5, 10
+//	http.Handle("/mpesa/result", callback.ResultHandler(runner.HandleResult))
+//
+//	if _, err := runner.Run(ctx, "payroll-2024-10", items); err != nil {
+//		log.Fatal(err)
+//	}
+//	report, err := runner.Wait(ctx, "payroll-2024-10") // until every result arrived
+//	fmt.Println(report)
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/internal/ratelimit"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+// Status is the progress of a single payout.
+type Status string
+
+const (
+	// StatusPending is a payout that has not been sent yet.
+	StatusPending Status = "pending"
+	// StatusSending is a payout being sent, it becomes StatusUnknown when a run stops there.
+	StatusSending Status = "sending"
+	// StatusAccepted is a payout acknowledged by M-Pesa, waiting for its result.
+	StatusAccepted Status = "accepted"
+	// StatusRejected is a payout refused before it was accepted (validation, policy, 4xx
+	// M-Pesa error, see types.Refused), nobody was paid and it is sent again when the batch
+	// is resumed.
+	StatusRejected Status = "rejected"
+	// StatusCompleted is a payout whose result reported a success.
+	StatusCompleted Status = "completed"
+	// StatusFailed is a payout whose result reported a failure, nobody was paid.
+	StatusFailed Status = "failed"
+	// StatusUnknown is a payout that may or may not have been accepted (network error,
+	// crash while sending). It is never sent again automatically, check it with a
+	// transaction status query.
+	StatusUnknown Status = "unknown"
+)
+
+// Final reports whether no further change is expected for the status.
+func (s Status) Final() bool {
+	switch s {
+	case StatusCompleted, StatusFailed, StatusRejected, StatusUnknown:
+		return true
+	}
+	return false
+}
+
+// Item is a payout of a batch.
+//
+// Fields:
+//   - ID: The identifier of the payout, unique in the batch (an employee number, a row number...).
+//   - Request: The payout. An empty OriginatorConversationID is derived from the batch and the ID.
+type Item struct {
+	ID      string
+	Request b2c.B2CRequest
+}
+
+// ItemState is the progress of a payout, as saved in the Store.
+type ItemState struct {
+	ID                       string       `json:"id"`
+	Status                   Status       `json:"status"`
+	Recipient                string       `json:"recipient"`
+	Amount                   money.Amount `json:"amount"`
+	Attempts                 int          `json:"attempts"`
+	OriginatorConversationID string       `json:"originator_conversation_id,omitempty"`
+	ConversationID           string       `json:"conversation_id,omitempty"`
+	TransactionID            string       `json:"transaction_id,omitempty"`
+	ResultCode               string       `json:"result_code,omitempty"`
+	ResultDesc               string       `json:"result_desc,omitempty"`
+	ReceiverName             string       `json:"receiver_name,omitempty"`
+	Error                    string       `json:"error,omitempty"`
+	UpdatedAt                time.Time    `json:"updated_at"`
+}
+
+// Runner sends the batches.
+type Runner struct {
+	// Client sends the payouts, usually an *mpesagosdk.App.
+	Client mpesagosdk.Client
+	// Store saves the progress of the batches.
+	Store Store
+	// Concurrency is the number of payouts sent at the same time, 1 when not positive.
+	Concurrency int
+	// Rate is the maximum number of payouts sent per second, zero does not limit the rate.
+	Rate float64
+	// RetryFailed sends the payouts of a resumed batch whose result was a failure again.
+	RetryFailed bool
+
+	mu      sync.Mutex
+	batches map[string]*batch
+	changed chan struct{}
+}
+
+// batch: the in memory progress of a batch.
+type batch struct {
+	name       string
+	order      []string
+	states     map[string]*ItemState
+	byOriginID map[string]string
+	started    time.Time
+	finished   time.Time
+}
+
+// NewRunner creates a runner sending the payouts with client, a nil store is replaced
+// by a new MemoryStore.
+func NewRunner(client mpesagosdk.Client, store Store) *Runner {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Runner{Client: client, Store: store, Concurrency: 1}
+}
+
+// Run sends the payouts of a batch that are not already accepted or final in the Store
+// and returns once every payout was acknowledged or refused. The results arrive later
+// through HandleResult, see Wait.
+//
+// Parameters:
+//   - ctx: Stops the run, the payouts not sent yet stay pending.
+//   - name: The name of the batch, running a batch with the same name resumes it.
+//   - items: The payouts, with unique IDs.
+//
+// Returns:
+//   - *Report: The progress of the batch when every payout was handled.
+//   - error: The error of the Store, of ctx, or of an invalid batch.
+func (r *Runner) Run(ctx context.Context, name string, items []Item) (*Report, error) {
+	b, err := r.load(ctx, name, items)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := r.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	limiter := ratelimit.New(r.Rate, 1)
+	work := make(chan Item)
+	errs := make(chan error, concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				if err := r.send(ctx, b, item); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var runErr error
+feed:
+	for _, item := range items {
+		if !r.shouldSend(b, item.ID) {
+			continue
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			runErr = err
+			break
+		}
+		select {
+		case work <- item:
+		case runErr = <-errs:
+			break feed
+		case <-ctx.Done():
+			runErr = ctx.Err()
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	if runErr == nil {
+		select {
+		case runErr = <-errs:
+		default:
+		}
+	}
+	return r.Report(name), runErr
+}
+
+// load: builds the batch from the items and the progress saved in the Store. The
+// payouts left sending by an interrupted run become unknown.
+func (r *Runner) load(ctx context.Context, name string, items []Item) (*batch, error) {
+	saved, err := r.Store.Load(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load batch %q: %w", name, err)
+	}
+	previous := make(map[string]ItemState, len(saved))
+	for _, state := range saved {
+		previous[state.ID] = state
+	}
+
+	b := &batch{name: name, states: map[string]*ItemState{}, byOriginID: map[string]string{}, started: time.Now()}
+	for _, item := range items {
+		if item.ID == "" {
+			return nil, errors.New("every item of a batch needs an ID")
+		}
+		if _, ok := b.states[item.ID]; ok {
+			return nil, fmt.Errorf("duplicate item ID %q in batch %q", item.ID, name)
+		}
+
+		state, ok := previous[item.ID]
+		if !ok {
+			state = ItemState{ID: item.ID, Status: StatusPending}
+		}
+		state.Recipient = strconv.FormatUint(uint64(item.Request.PartyB), 10)
+		state.Amount = item.Request.Amount
+		if state.Status == StatusSending {
+			state.Status = StatusUnknown
+			state.Error = "the run stopped while the payout was being sent"
+			state.UpdatedAt = time.Now()
+			if err := r.Store.Save(ctx, name, state); err != nil {
+				return nil, err
+			}
+		}
+
+		b.order = append(b.order, item.ID)
+		b.states[item.ID] = &state
+		if state.OriginatorConversationID != "" {
+			b.byOriginID[state.OriginatorConversationID] = item.ID
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.batches == nil {
+		r.batches = map[string]*batch{}
+	}
+	r.batches[name] = b
+	return b, nil
+}
+
+// shouldSend: reports whether a payout still has to be sent.
+func (r *Runner) shouldSend(b *batch, id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch b.states[id].Status {
+	case StatusPending, StatusRejected:
+		return true
+	case StatusFailed:
+		return r.RetryFailed
+	}
+	return false
+}
+
+// send: sends a payout and records its acknowledgement.
+func (r *Runner) send(ctx context.Context, b *batch, item Item) error {
+	req := item.Request
+
+	err := r.update(ctx, b, item.ID, func(s *ItemState) {
+		s.Status = StatusSending
+		s.Attempts++
+		s.Error, s.ResultCode, s.ResultDesc = "", "", ""
+		s.OriginatorConversationID = originatorID(b.name, item, s.Attempts)
+		b.byOriginID[s.OriginatorConversationID] = item.ID
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	req.OriginatorConversationID = b.states[item.ID].OriginatorConversationID
+	r.mu.Unlock()
+
+	res, sendErr := r.Client.MakeB2CPaymentRequest(req)
+	return r.update(ctx, b, item.ID, func(s *ItemState) {
+		switch {
+		case sendErr == nil:
+			s.ConversationID = res.ConversationID
+			// the result may have been handled before the acknowledgement
+			if s.Status == StatusSending {
+				s.Status = StatusAccepted
+			}
+		case types.Refused(sendErr):
+			s.Status = StatusRejected
+			s.Error = sendErr.Error()
+		default:
+			s.Status = StatusUnknown
+			s.Error = sendErr.Error()
+		}
+	})
+}
+
+// originatorID: the OriginatorConversationID of an attempt, derived from the batch and
+// the item so that the results can be matched after a restart.
+func originatorID(batch string, item Item, attempt int) string {
+	id := item.Request.OriginatorConversationID
+	if id == "" {
+		id = batch + "-" + item.ID
+	}
+	if attempt > 1 {
+		id += "-" + strconv.Itoa(attempt)
+	}
+	return id
+}
+
+// update: changes the state of a payout and saves it.
+func (r *Runner) update(ctx context.Context, b *batch, id string, change func(s *ItemState)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := b.states[id]
+	next := *state
+	change(&next)
+	next.UpdatedAt = time.Now()
+	if err := r.Store.Save(ctx, b.name, next); err != nil {
+		return fmt.Errorf("unable to save item %q of batch %q: %w", id, b.name, err)
+	}
+	*state = next
+	r.notify()
+	return nil
+}
+
+// notify: wakes up the callers of Wait, the caller must hold the lock.
+func (r *Runner) notify() {
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+}
+
+// HandleResult records the result of a payout, its signature matches callback.ResultHandler.
+// Results of other operations, or of payouts of batches not loaded by Run, are ignored.
+func (r *Runner) HandleResult(ctx context.Context, res *callback.Result) error {
+	r.mu.Lock()
+	var (
+		b  *batch
+		id string
+	)
+	for _, candidate := range r.batches {
+		if found, ok := candidate.byOriginID[res.Result.OriginatorConversationID]; ok {
+			b, id = candidate, found
+			break
+		}
+	}
+	r.mu.Unlock()
+	if b == nil {
+		return nil
+	}
+
+	return r.update(ctx, b, id, func(s *ItemState) {
+		if s.OriginatorConversationID != res.Result.OriginatorConversationID {
+			return // the result of a previous attempt
+		}
+		s.ConversationID = res.Result.ConversationID
+		s.TransactionID = res.Result.TransactionID
+		s.ResultCode = string(res.Result.ResultCode)
+		s.ResultDesc = res.Result.ResultDesc
+		if name, ok := res.Parameter("ReceiverPartyPublicName"); ok {
+			s.ReceiverName = name.String()
+		}
+		s.Status = StatusFailed
+		if res.Succeeded() {
+			s.Status = StatusCompleted
+		}
+	})
+}
+
+// Wait blocks until every payout of a batch has a final status or ctx is done, and
+// returns the report of the batch.
+func (r *Runner) Wait(ctx context.Context, name string) (*Report, error) {
+	for {
+		r.mu.Lock()
+		b, ok := r.batches[name]
+		if !ok {
+			r.mu.Unlock()
+			return nil, fmt.Errorf("unknown batch %q", name)
+		}
+		pending := false
+		for _, state := range b.states {
+			if !state.Status.Final() {
+				pending = true
+				break
+			}
+		}
+		if !pending {
+			if b.finished.IsZero() {
+				b.finished = time.Now()
+			}
+			r.mu.Unlock()
+			return r.Report(name), nil
+		}
+		if r.changed == nil {
+			r.changed = make(chan struct{})
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return r.Report(name), ctx.Err()
+		}
+	}
+}
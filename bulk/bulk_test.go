@@ -0,0 +1,183 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/mpesatest"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func payroll(n int) []Item {
+	items := make([]Item, n)
+	for i := range items {
+		items[i] = Item{
+			ID: fmt.Sprintf("emp-%02d", i+1),
+			Request: b2c.B2CRequest{
+				CommandID: types.SalaryPaymentCommand,
+				Amount:    money.Birr(int64(100 * (i + 1))),
+				PartyB:    uint(251712345600 + i),
+				Remarks:   "salary",
+				Occasion:  "october",
+			},
+		}
+	}
+	return items
+}
+
+func TestRun_AgainstFakeServer(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.AddRule(mpesatest.InsufficientFunds().ForMSISDN("251712345602"))
+
+	runner := NewRunner(nil, nil)
+	results := httptest.NewServer(callback.ResultHandler(runner.HandleResult))
+	defer results.Close()
+
+	app, err := mpesagosdk.New(append(srv.Options(),
+		mpesagosdk.WithShortCode("600000"),
+		mpesagosdk.WithInitiator("testapi", "security-credential"),
+		mpesagosdk.WithResultURL(results.URL+"/result"),
+		mpesagosdk.WithQueueTimeOutURL(results.URL+"/timeout"),
+	)...)
+	require.NoError(t, err)
+	runner.Client = app
+	runner.Concurrency = 3
+	runner.Rate = 200
+
+	items := payroll(6)
+	report, err := runner.Run(context.Background(), "payroll-2024-10", items)
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Counts[StatusPending])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, err = runner.Wait(ctx, "payroll-2024-10")
+	require.NoError(t, err)
+
+	assert.Equal(t, 5, report.Counts[StatusCompleted])
+	assert.Equal(t, 1, report.Counts[StatusFailed])
+	assert.Equal(t, money.Birr(100+200+400+500+600), report.Paid)
+	require.Len(t, report.NeedsAttention(), 1)
+	failed := report.NeedsAttention()[0]
+	assert.Equal(t, "emp-03", failed.ID)
+	assert.Equal(t, mpesatest.ResultInsufficientFunds, failed.ResultCode)
+	assert.Equal(t, "payroll-2024-10-emp-03", failed.OriginatorConversationID)
+	assert.Contains(t, report.String(), "5 completed")
+	assert.NotEmpty(t, report.Items[0].TransactionID)
+	assert.Contains(t, report.Items[0].ReceiverName, "251712345600 - ")
+}
+
+func TestRun_ResumeDoesNotPayTwice(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	fake := mpesatest.NewFakeClient()
+	fake.B2CPaymentFunc = func(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
+		switch req.PartyB {
+		case 251712345601:
+			return nil, &types.MpesaErrorResponse{ErrorCode: "400.002.02", ErrorMessage: "Bad Request - Invalid PartyB", StatusCode: 400}
+		case 251712345602:
+			return nil, errors.New("context deadline exceeded")
+		case 251712345603:
+			return nil, &types.MpesaErrorResponse{ErrorMessage: "Bad Gateway", StatusCode: 502}
+		}
+		return &b2c.B2CSuccessResponse{ConversationID: "AG_" + req.OriginatorConversationID, ResponseCode: "0"}, nil
+	}
+
+	items := payroll(4)
+	report, err := NewRunner(fake, store).Run(context.Background(), "payroll", items)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Counts[StatusAccepted])
+	assert.Equal(t, 1, report.Counts[StatusRejected])
+	assert.Equal(t, 2, report.Counts[StatusUnknown], "a gateway error does not prove the payout was refused")
+
+	// a new process resumes the batch, only the rejected payout is sent again
+	fake.Reset()
+	fake.B2CPaymentFunc = nil
+	report, err = NewRunner(fake, store).Run(context.Background(), "payroll", items)
+	require.NoError(t, err)
+
+	calls := fake.CallsTo(mpesatest.OperationB2CPayment)
+	require.Len(t, calls, 1)
+	resent := calls[0].Request.(b2c.B2CRequest)
+	assert.Equal(t, uint(251712345601), resent.PartyB)
+	assert.Equal(t, "payroll-emp-02-2", resent.OriginatorConversationID)
+	assert.Equal(t, 2, report.Counts[StatusAccepted])
+	assert.Equal(t, 2, report.Counts[StatusUnknown])
+}
+
+func TestRun_CrashWhileSending(t *testing.T) {
+	dir := t.TempDir()
+	journal := `{"id":"emp-01","status":"accepted","attempts":1,"originator_conversation_id":"payroll-emp-01"}` + "\n" +
+		`{"id":"emp-02","status":"sending","attempts":1,"originator_conversation_id":"payroll-emp-02"}` + "\n" +
+		`{"id":"emp-03","sta`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "payroll.jsonl"), []byte(journal), 0o600))
+
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	fake := mpesatest.NewFakeClient()
+	runner := NewRunner(fake, store)
+	report, err := runner.Run(context.Background(), "payroll", payroll(3))
+	require.NoError(t, err)
+
+	calls := fake.CallsTo(mpesatest.OperationB2CPayment)
+	require.Len(t, calls, 1, "only the payout that was never started is sent")
+	assert.Equal(t, "payroll-emp-03", calls[0].Request.(b2c.B2CRequest).OriginatorConversationID)
+	assert.Equal(t, StatusUnknown, report.Items[1].Status)
+
+	// the truncated line was cut, the journal loads again
+	states, err := store.Load(context.Background(), "payroll")
+	require.NoError(t, err)
+	assert.Len(t, states, 3)
+
+	res := &callback.Result{}
+	res.Result.OriginatorConversationID = "payroll-emp-01"
+	res.Result.ResultCode = callback.Success
+	require.NoError(t, runner.HandleResult(context.Background(), res))
+	assert.Equal(t, StatusCompleted, runner.Report("payroll").Items[0].Status)
+}
+
+func TestRun_BoundedConcurrency(t *testing.T) {
+	var inFlight, peak int32
+	var mu sync.Mutex
+	fake := mpesatest.NewFakeClient()
+	fake.B2CPaymentFunc = func(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		mu.Lock()
+		if n > peak {
+			peak = n
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return &b2c.B2CSuccessResponse{ConversationID: "AG_1", ResponseCode: "0"}, nil
+	}
+
+	runner := NewRunner(fake, nil)
+	runner.Concurrency = 2
+	report, err := runner.Run(context.Background(), "promo", payroll(10))
+	require.NoError(t, err)
+	assert.Equal(t, 10, report.Counts[StatusAccepted])
+	assert.LessOrEqual(t, peak, int32(2))
+
+	_, err = runner.Run(context.Background(), "invalid", append(payroll(2), payroll(1)...))
+	assert.ErrorContains(t, err, "duplicate item ID")
+}
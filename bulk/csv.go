@@ -0,0 +1,335 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+// Fields of a payout that can be read from a payout file, see CSV.Columns.
+const (
+	FieldID                       = "ID"
+	FieldPartyB                   = "PartyB"
+	FieldAmount                   = "Amount"
+	FieldCommandID                = "CommandID"
+	FieldRemarks                  = "Remarks"
+	FieldOccasion                 = "Occasion"
+	FieldOriginatorConversationID = "OriginatorConversationID"
+	FieldExpectedName             = "ExpectedName"
+)
+
+// defaultColumns: the headers recognized without CSV.Columns, compared after
+// lowercasing and removing spaces, dashes and underscores.
+var defaultColumns = map[string]string{
+	"id":                       FieldID,
+	"reference":                FieldID,
+	"employeeid":               FieldID,
+	"partyb":                   FieldPartyB,
+	"phone":                    FieldPartyB,
+	"phonenumber":              FieldPartyB,
+	"msisdn":                   FieldPartyB,
+	"recipient":                FieldPartyB,
+	"amount":                   FieldAmount,
+	"commandid":                FieldCommandID,
+	"command":                  FieldCommandID,
+	"remarks":                  FieldRemarks,
+	"remark":                   FieldRemarks,
+	"occasion":                 FieldOccasion,
+	"originatorconversationid": FieldOriginatorConversationID,
+	"expectedname":             FieldExpectedName,
+}
+
+// resultHeader: the columns written by CSV.WriteResults.
+var resultHeader = []string{
+	"ID", "Recipient", "Amount", "Status", "OriginatorConversationID", "ConversationID",
+	"TransactionID", "ResultCode", "ResultDesc", "ReceiverPartyPublicName", "Error",
+}
+
+// CSV reads payout files, such as the payroll exported by finance, and writes the
+// results of their batches. The first line of a file names its columns.
+//
+// Fields:
+//   - Comma: The separator, detected from the header line when zero (a tab when the
+//     header contains one, a comma otherwise).
+//   - Columns: Maps headers to the fields of a payout (FieldPartyB, FieldAmount...). Headers
+//     such as `id`, `phone`, `msisdn`, `amount`, `remarks`, `occasion` or `expected_name`
+//     (see b2c.B2CRequest.ExpectedName) are recognized without it, columns of no known
+//     field are ignored.
+//   - Template: The values of the fields missing from the file or left empty in a row,
+//     such as the CommandID or the Occasion of a payroll.
+//
+// Example usage:
+//
+//	f, _ := os.Open("payroll.csv")
+//	format := bulk.CSV{Template: b2c.B2CRequest{CommandID: types.SalaryPaymentCommand, Occasion: "October"}}
+//	items, rowErrs, err := format.Read(f)
+//	for _, rowErr := range rowErrs {
+//		log.Println(rowErr) // line 7 (emp-006): Amount must be 1 or greater
+//	}
+type CSV struct {
+	Comma    rune
+	Columns  map[string]string
+	Template b2c.B2CRequest
+}
+
+// RowError is a row of a payout file that could not be read as a payout.
+//
+// Fields:
+//   - Line: The line of the row in the file, the header is line 1.
+//   - ID: The ID of the row, when it could be read.
+//   - Err: Why the row is invalid, a *types.ValidationError when the fields failed validation.
+type RowError struct {
+	Line int
+	ID   string
+	Err  error
+}
+
+// Error returns the line, the ID and the error of the row.
+func (e *RowError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d (%v): %v", e.Line, e.ID, e.Err)
+}
+
+// Unwrap returns the error of the row.
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Read reads the payouts of a file. An invalid row does not stop the read, it is
+// reported and skipped, so that the valid payouts can be sent and the others fixed.
+// The recipients are normalized and the fields read are validated with the rules of
+// b2c.B2CRequest, the initiator, short code and URLs are left to the App.
+//
+// Parameters:
+//   - r: The file.
+//
+// Returns:
+//   - []Item: The valid payouts, in the order of the file. A row without ID column gets
+//     the ID `line-N` of its line.
+//   - []*RowError: The invalid rows.
+//   - error: An error when the file cannot be read, or has no recipient or amount column.
+func (c CSV) Read(r io.Reader) ([]Item, []*RowError, error) {
+	br := bufio.NewReader(r)
+	comma := c.Comma
+	if comma == 0 {
+		comma = detectComma(br)
+	}
+	cr := csv.NewReader(br)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("the payout file is empty")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, err := c.columns(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v := utils.NewValidator()
+	var (
+		items   []Item
+		rowErrs []*RowError
+		seen    = map[string]int{}
+	)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrs = append(rowErrs, &RowError{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if blank(record) {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+
+		item, err := c.row(v, columns, record, line)
+		if first, ok := seen[item.ID]; ok && err == nil {
+			err = fmt.Errorf("duplicate ID, first used on line %d", first)
+		}
+		if err != nil {
+			rowErrs = append(rowErrs, &RowError{Line: line, ID: item.ID, Err: err})
+			continue
+		}
+		seen[item.ID] = line
+		items = append(items, item)
+	}
+	return items, rowErrs, nil
+}
+
+// columns: returns the field of every column, empty for the ignored columns.
+func (c CSV) columns(header []string) ([]string, error) {
+	columns := make([]string, len(header))
+	found := map[string]bool{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\uFEFF") // byte order mark of spreadsheet exports
+		}
+		name = strings.TrimSpace(name)
+		field, ok := c.Columns[name]
+		if !ok {
+			field, ok = defaultColumns[headerKey(name)]
+		}
+		if !ok {
+			continue
+		}
+		if found[field] {
+			return nil, fmt.Errorf("column %q: more than one column for %v", name, field)
+		}
+		found[field] = true
+		columns[i] = field
+	}
+	for _, field := range []string{FieldPartyB, FieldAmount} {
+		if !found[field] {
+			return nil, fmt.Errorf("the payout file has no %v column", field)
+		}
+	}
+	return columns, nil
+}
+
+// row: reads a row as a payout and validates the fields read.
+func (c CSV) row(v *types.Validator, columns []string, record []string, line int) (Item, error) {
+	item := Item{ID: "line-" + strconv.Itoa(line), Request: c.Template}
+	req := &item.Request
+	validate := []string{FieldPartyB, FieldAmount, FieldCommandID, FieldRemarks, FieldOccasion}
+	var errs []error
+	for i, field := range columns {
+		if field == "" || i >= len(record) {
+			continue
+		}
+		cell := strings.TrimSpace(record[i])
+		if cell == "" && field != FieldID {
+			continue
+		}
+
+		var err error
+		switch field {
+		case FieldID:
+			item.ID = cell
+			if cell == "" {
+				err = errors.New("the ID is empty")
+			}
+		case FieldPartyB:
+			var m msisdn.MSISDN
+			if m, err = msisdn.Parse(cell); err == nil {
+				var n uint64
+				n, err = strconv.ParseUint(m.String(), 10, 0)
+				req.PartyB = uint(n)
+			}
+		case FieldAmount:
+			req.Amount, err = money.Parse(cell)
+		case FieldCommandID:
+			req.CommandID = types.CommandId(cell)
+		case FieldRemarks:
+			req.Remarks = cell
+		case FieldOccasion:
+			req.Occasion = cell
+		case FieldOriginatorConversationID:
+			req.OriginatorConversationID = cell
+		case FieldExpectedName:
+			req.ExpectedName = cell
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", field, err))
+			validate = without(validate, field)
+		}
+	}
+
+	if err := utils.ValidatePartial(v, req, validate...); err != nil {
+		errs = append(errs, err)
+	}
+	return item, errors.Join(errs...)
+}
+
+// without: returns fields without field.
+func without(fields []string, field string) []string {
+	out := fields[:0:0]
+	for _, f := range fields {
+		if f != field {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// headerKey: the form of a header compared with defaultColumns.
+func headerKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_':
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+// detectComma: returns a tab when the header line contains one, a comma otherwise.
+func detectComma(br *bufio.Reader) rune {
+	peek, _ := br.Peek(4096)
+	if i := bytes.IndexByte(peek, '\n'); i >= 0 {
+		peek = peek[:i]
+	}
+	if bytes.IndexByte(peek, '\t') >= 0 {
+		return '\t'
+	}
+	return ','
+}
+
+// blank: reports whether every cell of a record is empty.
+func blank(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteResults writes the state of every payout of a report, with its ConversationID,
+// TransactionID, ResultCode and the public name of the receiver, using the separator
+// of the CSV (a comma when zero).
+func (c CSV) WriteResults(w io.Writer, report *Report) error {
+	cw := csv.NewWriter(w)
+	if c.Comma != 0 {
+		cw.Comma = c.Comma
+	}
+	if err := cw.Write(resultHeader); err != nil {
+		return err
+	}
+	for _, item := range report.Items {
+		err := cw.Write([]string{
+			item.ID, item.Recipient, item.Amount.String(), string(item.Status), item.OriginatorConversationID,
+			item.ConversationID, item.TransactionID, item.ResultCode, item.ResultDesc, item.ReceiverName, item.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,106 @@
+package bulk
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSV_Read(t *testing.T) {
+	file := "\uFEFFEmployee ID,Phone Number,Name,Amount,Remarks\n" +
+		"emp-01,0712345678,Abebe,\"1,200.50\",October salary\n" +
+		"emp-02,+251 712 345 679,Almaz,ETB 900,\n" +
+		"\n" +
+		"emp-03,0912345678,Kebede,abc,October salary\n" +
+		"emp-04,251712345680,Sara,0.50,October salary\n" +
+		"emp-01,251712345681,Dawit,100,October salary\n"
+
+	format := CSV{Template: b2c.B2CRequest{CommandID: types.SalaryPaymentCommand, Remarks: "Salary", Occasion: "October"}}
+	items, rowErrs, err := format.Read(strings.NewReader(file))
+	require.NoError(t, err)
+
+	require.Len(t, items, 2)
+	assert.Equal(t, "emp-01", items[0].ID)
+	assert.Equal(t, uint(251712345678), items[0].Request.PartyB)
+	assert.Equal(t, money.Santim(120050), items[0].Request.Amount)
+	assert.Equal(t, "October salary", items[0].Request.Remarks)
+	assert.Equal(t, types.SalaryPaymentCommand, items[0].Request.CommandID)
+	assert.Equal(t, uint(251712345679), items[1].Request.PartyB)
+	assert.Equal(t, "Salary", items[1].Request.Remarks, "empty cells keep the template")
+
+	require.Len(t, rowErrs, 3)
+	assert.Equal(t, 5, rowErrs[0].Line)
+	assert.Equal(t, "emp-03", rowErrs[0].ID)
+	assert.ErrorContains(t, rowErrs[0], "PartyB")
+	assert.ErrorContains(t, rowErrs[0], "Amount")
+
+	var verr *types.ValidationError
+	require.True(t, errors.As(rowErrs[1], &verr), rowErrs[1])
+	fe, ok := verr.Field("Amount")
+	require.True(t, ok)
+	assert.Equal(t, "gte", fe.Tag)
+
+	assert.Equal(t, 7, rowErrs[2].Line)
+	assert.ErrorContains(t, rowErrs[2], "duplicate ID, first used on line 2")
+}
+
+func TestCSV_ReadTabSeparated(t *testing.T) {
+	file := "msisdn\tamount\tcommand\texpected_name\n" +
+		"712345678\t250\tPromotionPayment\tAbebe Kebede\n" +
+		"712345679\t300\n"
+
+	format := CSV{Template: b2c.B2CRequest{Remarks: "Promo", Occasion: "Launch"}}
+	items, rowErrs, err := format.Read(strings.NewReader(file))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "line-2", items[0].ID)
+	assert.Equal(t, types.PromotionPaymentCommand, items[0].Request.CommandID)
+	assert.Equal(t, "Abebe Kebede", items[0].Request.ExpectedName)
+
+	require.Len(t, rowErrs, 1)
+	assert.ErrorContains(t, rowErrs[0], "CommandID")
+}
+
+func TestCSV_ReadInvalidFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  CSV
+		file    string
+		wantErr string
+	}{
+		{"Empty", CSV{}, "", "empty"},
+		{"No amount column", CSV{}, "phone,salary\n712345678,100\n", "no Amount column"},
+		{"Custom columns", CSV{Columns: map[string]string{"salary": FieldAmount, "phone": FieldID}}, "phone,salary\n", "no PartyB column"},
+		{"Two amount columns", CSV{}, "phone,amount,Amount\n", "more than one column"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.format.Read(strings.NewReader(tt.file))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCSV_WriteResults(t *testing.T) {
+	report := &Report{Items: []ItemState{
+		{ID: "emp-01", Status: StatusCompleted, Recipient: "251712345678", Amount: money.Birr(1200),
+			ConversationID: "AG_1", TransactionID: "RKL1", ResultCode: "0", ReceiverName: "251712345678 - Abebe Kebede"},
+		{ID: "emp-02", Status: StatusRejected, Recipient: "251712345679", Amount: money.Santim(90050),
+			Error: "invalid B2CRequest: Remarks is required"},
+	}}
+
+	var out strings.Builder
+	require.NoError(t, CSV{Comma: '\t'}.WriteResults(&out, report))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "ID\tRecipient\tAmount\tStatus\tOriginatorConversationID\tConversationID\tTransactionID\tResultCode\tResultDesc\tReceiverPartyPublicName\tError", lines[0])
+	assert.Equal(t, "emp-01\t251712345678\t1200.00\tcompleted\t\tAG_1\tRKL1\t0\t\t251712345678 - Abebe Kebede\t", lines[1])
+	assert.Equal(t, "emp-02\t251712345679\t900.50\trejected\t\t\t\t\t\t\tinvalid B2CRequest: Remarks is required", lines[2])
+}
@@ -0,0 +1,82 @@
+package bulk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/money"
+)
+
+// Report is the progress of a batch.
+//
+// Fields:
+//   - Batch: The name of the batch.
+//   - Started, Finished: When the batch was loaded by Run and when Wait saw every payout final.
+//   - Counts: The number of payouts per status.
+//   - Paid: The total amount of the completed payouts.
+//   - Items: The state of every payout, in the order of the items given to Run.
+type Report struct {
+	Batch    string         `json:"batch"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished,omitempty"`
+	Counts   map[Status]int `json:"counts"`
+	Paid     money.Amount   `json:"paid"`
+	Items    []ItemState    `json:"items"`
+}
+
+// Report returns the current progress of a batch run by Run, nil for an unknown batch.
+func (r *Runner) Report(name string) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.batches[name]
+	if !ok {
+		return nil
+	}
+
+	report := &Report{Batch: name, Started: b.started, Finished: b.finished, Counts: map[Status]int{}}
+	for _, id := range b.order {
+		state := *b.states[id]
+		report.Items = append(report.Items, state)
+		report.Counts[state.Status]++
+		if state.Status == StatusCompleted {
+			report.Paid, _ = report.Paid.Add(state.Amount)
+		}
+	}
+	return report
+}
+
+// WithStatus returns the payouts with one of the given statuses.
+func (r *Report) WithStatus(statuses ...Status) []ItemState {
+	var items []ItemState
+	for _, item := range r.Items {
+		for _, status := range statuses {
+			if item.Status == status {
+				items = append(items, item)
+				break
+			}
+		}
+	}
+	return items
+}
+
+// NeedsAttention returns the payouts that were not paid or whose outcome is unknown.
+func (r *Report) NeedsAttention() []ItemState {
+	return r.WithStatus(StatusRejected, StatusFailed, StatusUnknown)
+}
+
+// String summarizes the report, "payroll: 98 completed, 1 failed, 1 unknown, paid ETB 49,000.00".
+func (r *Report) String() string {
+	statuses := make([]string, 0, len(r.Counts))
+	for status := range r.Counts {
+		statuses = append(statuses, string(status))
+	}
+	sort.Strings(statuses)
+
+	parts := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		parts = append(parts, fmt.Sprintf("%d %v", r.Counts[Status(status)], status))
+	}
+	return fmt.Sprintf("%v: %v, paid %v", r.Batch, strings.Join(parts, ", "), r.Paid.Format())
+}
@@ -0,0 +1,155 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists the progress of the batches, so that a run interrupted by a crash
+// can be resumed without paying anybody twice. Save is called every time an item
+// changes, before the change is acted upon.
+type Store interface {
+	// Load returns the last saved state of every item of a batch, in any order.
+	Load(ctx context.Context, batch string) ([]ItemState, error)
+	// Save records the new state of an item.
+	Save(ctx context.Context, batch string, state ItemState) error
+}
+
+// MemoryStore is a Store kept in memory, it only survives a failed run, not a crash.
+type MemoryStore struct {
+	mu      sync.Mutex
+	batches map[string]map[string]ItemState
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{batches: map[string]map[string]ItemState{}}
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load(_ context.Context, batch string) ([]ItemState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]ItemState, 0, len(s.batches[batch]))
+	for _, state := range s.batches[batch] {
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(_ context.Context, batch string, state ItemState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.batches[batch] == nil {
+		s.batches[batch] = map[string]ItemState{}
+	}
+	s.batches[batch][state.ID] = state
+	return nil
+}
+
+// FileStore is a Store writing one journal file per batch in a directory. Every
+// change is appended to the journal as a JSON line and synced to disk before the
+// run goes on, the last line of an item wins when the journal is loaded.
+type FileStore struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// NewFileStore creates a FileStore writing in dir, the directory is created when needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, files: map[string]*os.File{}}, nil
+}
+
+// path: returns the journal of a batch.
+func (s *FileStore) path(batch string) string {
+	return filepath.Join(s.dir, filepath.Base(batch)+".jsonl")
+}
+
+// Load implements Store. A truncated last line, left by a crash during a write, is ignored.
+func (s *FileStore) Load(_ context.Context, batch string) ([]ItemState, error) {
+	data, err := os.ReadFile(s.path(batch))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	// the last element is empty when the journal ends with a complete line
+	lines = lines[:len(lines)-1]
+
+	latest := map[string]int{}
+	var states []ItemState
+	for i, line := range lines {
+		var state ItemState
+		if err := json.Unmarshal(line, &state); err != nil {
+			return nil, fmt.Errorf("%v:%d: %w", s.path(batch), i+1, err)
+		}
+		if j, ok := latest[state.ID]; ok {
+			states[j] = state
+			continue
+		}
+		latest[state.ID] = len(states)
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Save implements Store.
+func (s *FileStore) Save(_ context.Context, batch string, state ItemState) error {
+	line, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[batch]
+	if !ok {
+		if f, err = s.open(batch); err != nil {
+			return err
+		}
+		s.files[batch] = f
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// open: opens the journal of a batch for appending, a truncated last line left by a
+// crash is cut so that the next line starts on a line of its own.
+func (s *FileStore) open(batch string) (*os.File, error) {
+	path := s.path(batch)
+	if data, err := os.ReadFile(path); err == nil && len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		if err := os.Truncate(path, int64(bytes.LastIndexByte(data, '\n')+1)); err != nil {
+			return nil, err
+		}
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+}
+
+// Close closes the journals.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for batch, f := range s.files {
+		errs = append(errs, f.Close())
+		delete(s.files, batch)
+	}
+	return errors.Join(errs...)
+}
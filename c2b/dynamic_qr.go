@@ -0,0 +1,142 @@
+package c2b
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+// DefaultQRSize is the width and height in pixels of the generated QR codes when the
+// request does not set one.
+const DefaultQRSize = "300"
+
+// DynamicQRRequest generates a QR code the customer scans with the M-Pesa app to pay a
+// till or a paybill, with the amount and the reference already filled in. It is the in
+// store counterpart of USSDPaymentRequest: the customer starts the payment instead of
+// receiving a prompt, and the payment is confirmed by the C2B callbacks. The qr package
+// renders a code locally, without calling the API, for a payload the caller already has.
+//
+// Fields:
+//   - MerchantName: The name shown to the customer.
+//   - RefNo: The reference of the payment, such as an invoice number.
+//   - Amount: The amount of the payment, in whole birr.
+//   - TrxCode: The transaction the code starts, see types.QRTransactionCode.
+//   - CPI: The credit party identifier, a till for BuyGoodsQRCode, a short code for
+//     PayBillQRCode and SendToBusinessQRCode, an agent store number for WithdrawCashQRCode
+//     and a customer MSISDN for SendMoneyQRCode. The configured short code when empty,
+//     except for SendMoneyQRCode.
+//   - Size: The width and height of the image in pixels, DefaultQRSize when empty.
+type DynamicQRRequest struct {
+	MerchantName string                  `json:"MerchantName" validate:"required,min=1,max=100"`
+	RefNo        string                  `json:"RefNo" validate:"required,min=1,max=20"`
+	Amount       money.Amount            `json:"Amount" validate:"required,gt=0,whole_birr"`
+	TrxCode      types.QRTransactionCode `json:"TrxCode" validate:"required,oneof=BG PB WA SM SB"`
+	CPI          string                  `json:"CPI" validate:"required"`
+	Size         string                  `json:"Size" validate:"omitempty,numeric"`
+}
+
+// DynamicQRResponse is the generated QR code.
+//
+// Fields:
+//   - ResponseCode: The code of the outcome, such as "AG_20191219_000043fdf61864fe9ff5".
+//   - RequestID: The identifier of the request assigned by M-Pesa.
+//   - ResponseDescription: The description of the outcome.
+//   - QRCode: The PNG image of the code, base64 encoded, see PNG and Image.
+type DynamicQRResponse struct {
+	ResponseCode        string `json:"ResponseCode"`
+	RequestID           string `json:"RequestID"`
+	ResponseDescription string `json:"ResponseDescription"`
+	QRCode              string `json:"QRCode"`
+}
+
+// PNG: returns the decoded PNG image of the code, to be saved or served as is.
+func (r DynamicQRResponse) PNG() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(r.QRCode)
+}
+
+// Image: returns the image of the code, to be drawn on a receipt or a poster.
+func (r DynamicQRResponse) Image() (image.Image, error) {
+	data, err := r.PNG()
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+func (d *DynamicQRRequest) DecodeResponse(res *http.Response) (types.MpesaResponse, error) {
+	bodyData, _ := io.ReadAll(res.Body)
+	defer res.Body.Close()
+
+	responseData := DynamicQRResponse{}
+	err := json.Unmarshal(bodyData, &responseData)
+	if err != nil {
+		return nil, err
+	}
+
+	if responseData.QRCode == "" {
+		errorResponseData := &types.MpesaErrorResponse{}
+		err := json.Unmarshal(bodyData, errorResponseData)
+		if err != nil {
+			return nil, err
+		}
+		if errorResponseData.ErrorCode == "" {
+			errorResponseData.RequestId = responseData.RequestID
+			errorResponseData.ErrorCode = responseData.ResponseCode
+			errorResponseData.ErrorMessage = responseData.ResponseDescription
+		}
+
+		return nil, errorResponseData
+	}
+
+	return responseData, nil
+}
+
+func (d *DynamicQRRequest) FillDefaults() {
+	if d.Size == "" {
+		d.Size = DefaultQRSize
+	}
+}
+
+// ApplyDefaults: fills the CPI from the configured short code when it is not set on the
+// request, unless the code sends money to a customer.
+func (d *DynamicQRRequest) ApplyDefaults(defaults types.Defaults) {
+	if d.TrxCode != types.SendMoneyQRCode {
+		d.CPI = types.OrDefault(d.CPI, defaults.ShortCode)
+	}
+}
+
+// Normalize: rewrites the CPI of a SendMoneyQRCode to the 2517XXXXXXXX form.
+func (d *DynamicQRRequest) Normalize() {
+	if d.TrxCode != types.SendMoneyQRCode {
+		return
+	}
+	if m, err := msisdn.Normalize(d.CPI); err == nil {
+		d.CPI = m
+	}
+}
+
+// qrCPITags: the validation tag of the CPI of each transaction code.
+var qrCPITags = map[types.QRTransactionCode]string{
+	types.BuyGoodsQRCode:       "till",
+	types.PayBillQRCode:        "shortcode",
+	types.WithdrawCashQRCode:   "shortcode|till",
+	types.SendMoneyQRCode:      "msisdn_et",
+	types.SendToBusinessQRCode: "shortcode",
+}
+
+func (d *DynamicQRRequest) Validate(v *types.Validator) error {
+	if err := utils.Validate(v, d); err != nil {
+		return err
+	}
+
+	return utils.ValidateField(v, d, "CPI", d.CPI, qrCPITags[d.TrxCode])
+}
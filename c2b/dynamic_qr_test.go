@@ -0,0 +1,127 @@
+package c2b
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicQRRequestValidation(t *testing.T) {
+	v := utils.NewValidator()
+	valid := func() DynamicQRRequest {
+		return DynamicQRRequest{
+			MerchantName: "Abebe Coffee",
+			RefNo:        "INV-001",
+			Amount:       money.Birr(150),
+			TrxCode:      types.BuyGoodsQRCode,
+			CPI:          "373132",
+			Size:         "300",
+		}
+	}
+	tests := []struct {
+		name  string
+		edit  func(r *DynamicQRRequest)
+		field string
+		tag   string
+	}{
+		{"Valid Input", func(r *DynamicQRRequest) {}, "", ""},
+		{"Pay Bill", func(r *DynamicQRRequest) { r.TrxCode, r.CPI = types.PayBillQRCode, "600000" }, "", ""},
+		{"Send Money", func(r *DynamicQRRequest) { r.TrxCode, r.CPI = types.SendMoneyQRCode, "251712345678" }, "", ""},
+		{"Invalid Transaction Code", func(r *DynamicQRRequest) { r.TrxCode = "XX" }, "TrxCode", "oneof"},
+		{"Missing Transaction Code", func(r *DynamicQRRequest) { r.TrxCode = "" }, "TrxCode", "required"},
+		{"Missing Merchant Name", func(r *DynamicQRRequest) { r.MerchantName = "" }, "MerchantName", "required"},
+		{"Missing Amount", func(r *DynamicQRRequest) { r.Amount = money.Amount{} }, "Amount", "required"},
+		{"Amount With Santim", func(r *DynamicQRRequest) { r.Amount = money.Santim(15050) }, "Amount", "whole_birr"},
+		{"Invalid Size", func(r *DynamicQRRequest) { r.Size = "large" }, "Size", "numeric"},
+		{"Till Too Short", func(r *DynamicQRRequest) { r.CPI = "1020" }, "CPI", "till"},
+		{"Phone Number For Pay Bill", func(r *DynamicQRRequest) { r.TrxCode, r.CPI = types.PayBillQRCode, "251712345678" }, "CPI", "shortcode"},
+		{"Short Code For Send Money", func(r *DynamicQRRequest) { r.TrxCode, r.CPI = types.SendMoneyQRCode, "600000" }, "CPI", "msisdn_et"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.edit(&req)
+			err := req.Validate(v)
+			if tt.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var verr *types.ValidationError
+			require.ErrorAs(t, err, &verr)
+			assert.Equal(t, "DynamicQRRequest", verr.Request)
+			fe, ok := verr.Field(tt.field)
+			require.True(t, ok, err)
+			assert.Equal(t, tt.tag, fe.Tag)
+			assert.Contains(t, fe.Message(types.LocaleAmharic), tt.field)
+			assert.NotEqual(t, fe.Message(types.LocaleEnglish), fe.Message(types.LocaleAmharic))
+		})
+	}
+}
+
+func TestDynamicQRRequestDefaults(t *testing.T) {
+	defaults := types.Defaults{ShortCode: "600000"}
+
+	req := DynamicQRRequest{TrxCode: types.PayBillQRCode}
+	req.ApplyDefaults(defaults)
+	req.FillDefaults()
+	assert.Equal(t, "600000", req.CPI)
+	assert.Equal(t, DefaultQRSize, req.Size)
+
+	req = DynamicQRRequest{TrxCode: types.BuyGoodsQRCode, CPI: "373132", Size: "500"}
+	req.ApplyDefaults(defaults)
+	req.FillDefaults()
+	assert.Equal(t, "373132", req.CPI)
+	assert.Equal(t, "500", req.Size)
+
+	req = DynamicQRRequest{TrxCode: types.SendMoneyQRCode}
+	req.ApplyDefaults(defaults)
+	assert.Empty(t, req.CPI)
+	req.CPI = "0712345678"
+	req.Normalize()
+	assert.Equal(t, "251712345678", req.CPI)
+}
+
+func TestDynamicQRDecodeResponse(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	img.SetGray(1, 1, color.Gray{Y: 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	respond := func(body string) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}
+	}
+	req := &DynamicQRRequest{}
+
+	res, err := req.DecodeResponse(respond(`{"ResponseCode":"AG_20191219_000043fdf61864fe9ff5","RequestID":"16738-27456357-1","ResponseDescription":"QR Code Successfully Generated.","QRCode":"` + encoded + `"}`))
+	require.NoError(t, err)
+	qr := res.(DynamicQRResponse)
+	data, err := qr.PNG()
+	require.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), data)
+	decoded, err := qr.Image()
+	require.NoError(t, err)
+	assert.Equal(t, img.Bounds(), decoded.Bounds())
+
+	_, err = req.DecodeResponse(respond(`{"requestId":"1","errorCode":"404.001.03","errorMessage":"Invalid Access Token"}`))
+	var mpesaErr *types.MpesaErrorResponse
+	require.ErrorAs(t, err, &mpesaErr)
+	assert.Equal(t, "404.001.03", mpesaErr.ErrorCode)
+
+	_, err = req.DecodeResponse(respond(`{"ResponseCode":"400.002.02","RequestID":"2","ResponseDescription":"Invalid CPI"}`))
+	require.ErrorAs(t, err, &mpesaErr)
+	assert.Equal(t, "400.002.02", mpesaErr.ErrorCode)
+	assert.Equal(t, "Invalid CPI", mpesaErr.ErrorMessage)
+}
@@ -5,16 +5,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"slices"
 
 	"github.com/coleYab/mpesagosdk/internal/utils"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 type RegisterC2BURLRequest struct {
-	ShortCode       string             `json:"ShortCode" validate:"required,min=5,max=20"`
-	ResponseType    types.ResponseType `json:"ResponseType" validate:"required"`
+	ShortCode       string             `json:"ShortCode" validate:"required,shortcode"`
+	ResponseType    types.ResponseType `json:"ResponseType" validate:"required,oneof=Completed Cancelled"`
 	CommandID       types.CommandId    `json:"CommandID" validate:"required"`
 	ConfirmationURL string             `json:"ConfirmationURL" validate:"required,url"`
 	ValidationURL   string             `json:"ValidationURL" validate:"required,url"`
@@ -50,7 +48,6 @@ func (s *RegisterC2BURLRequest) DecodeResponse(res *http.Response) (types.MpesaR
 		if err != nil {
 			return nil, err
 		}
-		fmt.Println(string(bodyData))
 		return nil, &errorResponse
 	}
 
@@ -64,11 +61,11 @@ func (t *RegisterC2BURLRequest) FillDefaults() {
 	t.CommandID = types.RegisterURLCommand
 }
 
-func (t *RegisterC2BURLRequest) Validate(v *validator.Validate) error {
-	validResponseType := []types.ResponseType{types.CompletedResponse, types.CancelledResponse}
-	if !slices.Contains(validResponseType, t.ResponseType) {
-		return fmt.Errorf("unkown response type: %v", t.ResponseType)
-	}
+// ApplyDefaults: fills the short code from the configured defaults when it is not set.
+func (t *RegisterC2BURLRequest) ApplyDefaults(d types.Defaults) {
+	t.ShortCode = types.OrDefault(t.ShortCode, d.ShortCode)
+}
 
+func (t *RegisterC2BURLRequest) Validate(v *types.Validator) error {
 	return utils.Validate(v, t)
 }
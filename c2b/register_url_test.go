@@ -3,12 +3,12 @@ package c2b
 import (
 	"testing"
 
+	"github.com/coleYab/mpesagosdk/internal/utils"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 func TestRegisterC2BURLRequestValidation(t *testing.T) {
-	validate := validator.New()
+	validate := utils.NewValidator()
 
 	tests := []struct {
 		name    string
@@ -2,22 +2,21 @@ package c2b
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
-	"slices"
 
 	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 type SimulateCustomerInititatedPayment struct {
-	CommandID     types.CommandId `json:"CommandID" validate:"required"`
-	Amount        uint64          `json:"Amount" validate:"required,gte=1"`
-	Msisdn        string          `json:"Msisdn" validate:"required,numeric"`
+	CommandID     types.CommandId `json:"CommandID" validate:"required,oneof=CustomerPayBillOnline CustomerBuyGoodsOnline"`
+	Amount        money.Amount    `json:"Amount" validate:"required,gte=1"`
+	Msisdn        string          `json:"Msisdn" validate:"required,msisdn_et"`
 	BillRefNumber string          `json:"BillRefNumber" validate:"required,min=6,max=20"`
-	ShortCode     string          `json:"ShortCode" validate:"required"`
+	ShortCode     string          `json:"ShortCode" validate:"required,shortcode"`
 }
 
 type SimulatePaymentSuccessResponse types.MpesaCommonResponse
@@ -44,13 +43,23 @@ func (s *SimulateCustomerInititatedPayment) DecodeResponse(res *http.Response) (
 
 func (s *SimulateCustomerInititatedPayment) FillDefaults() {}
 
-func (s *SimulateCustomerInititatedPayment) Validate(v *validator.Validate) error {
-	validCommands := []types.CommandId{
-		types.CustomerPayBillOnlineCommand, types.CustomerBuyGoodsOnlineCommand,
-	}
-	if !slices.Contains(validCommands, s.CommandID) {
-		return fmt.Errorf("unkown command %v", s.CommandID)
+// ApplyDefaults: fills the short code from the configured defaults when it is not set.
+func (s *SimulateCustomerInititatedPayment) ApplyDefaults(d types.Defaults) {
+	s.ShortCode = types.OrDefault(s.ShortCode, d.ShortCode)
+}
+
+// Normalize: rewrites the paying customer number to the 2517XXXXXXXX form.
+func (s *SimulateCustomerInititatedPayment) Normalize() {
+	if m, err := msisdn.Normalize(s.Msisdn); err == nil {
+		s.Msisdn = m
 	}
+}
+
+// Transfer: describes the payment for the transaction limits.
+func (s *SimulateCustomerInititatedPayment) Transfer() types.Transfer {
+	return types.Transfer{CommandID: s.CommandID, Party: s.Msisdn, Amount: s.Amount}
+}
 
+func (s *SimulateCustomerInititatedPayment) Validate(v *types.Validator) error {
 	return utils.Validate(v, s)
 }
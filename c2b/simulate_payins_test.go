@@ -3,12 +3,13 @@ package c2b
 import (
 	"testing"
 
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
-	validate := validator.New()
+	validate := utils.NewValidator()
 
 	tests := []struct {
 		name    string
@@ -19,9 +20,9 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 		{
 			name: "Valid Input",
 			req: SimulateCustomerInititatedPayment{
-				CommandID:     types.CommandId("SimulatePayment"),
-				Amount:        100,
-				Msisdn:        "254701234567", // Valid phone number format
+				CommandID:     types.CustomerPayBillOnlineCommand,
+				Amount:        money.Birr(100),
+				Msisdn:        "251701234567", // Valid phone number format
 				BillRefNumber: "123456789012", // Valid bill reference
 				ShortCode:     "12345",
 			},
@@ -32,8 +33,8 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 		{
 			name: "Missing CommandID",
 			req: SimulateCustomerInititatedPayment{
-				Amount:        100,
-				Msisdn:        "254701234567",
+				Amount:        money.Birr(100),
+				Msisdn:        "251701234567",
 				BillRefNumber: "123456789012",
 				ShortCode:     "12345",
 			},
@@ -44,8 +45,8 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 		{
 			name: "Missing Amount",
 			req: SimulateCustomerInititatedPayment{
-				CommandID:     types.CommandId("SimulatePayment"),
-				Msisdn:        "254701234567",
+				CommandID:     types.CustomerPayBillOnlineCommand,
+				Msisdn:        "251701234567",
 				BillRefNumber: "123456789012",
 				ShortCode:     "12345",
 			},
@@ -56,9 +57,9 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 		{
 			name: "Amount Less Than 1",
 			req: SimulateCustomerInititatedPayment{
-				CommandID:     types.CommandId("SimulatePayment"),
-				Amount:        0, // Invalid amount, should be greater than or equal to 1
-				Msisdn:        "254701234567",
+				CommandID:     types.CustomerPayBillOnlineCommand,
+				Amount:        money.Zero, // Invalid amount, should be greater than or equal to 1
+				Msisdn:        "251701234567",
 				BillRefNumber: "123456789012",
 				ShortCode:     "12345",
 			},
@@ -69,8 +70,8 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 		{
 			name: "Missing Msisdn",
 			req: SimulateCustomerInititatedPayment{
-				CommandID:     types.CommandId("SimulatePayment"),
-				Amount:        100,
+				CommandID:     types.CustomerPayBillOnlineCommand,
+				Amount:        money.Birr(100),
 				BillRefNumber: "123456789012",
 				ShortCode:     "12345",
 			},
@@ -81,8 +82,8 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 		{
 			name: "Invalid Msisdn",
 			req: SimulateCustomerInititatedPayment{
-				CommandID:     types.CommandId("SimulatePayment"),
-				Amount:        100,
+				CommandID:     types.CustomerPayBillOnlineCommand,
+				Amount:        money.Birr(100),
 				Msisdn:        "25470A12345", // Invalid phone number (contains letters)
 				BillRefNumber: "123456789012",
 				ShortCode:     "12345",
@@ -90,13 +91,26 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 			wantErr: true,
 		},
 
+		// 6b. Msisdn of another operator
+		{
+			name: "Ethio telecom Msisdn",
+			req: SimulateCustomerInititatedPayment{
+				CommandID:     types.CustomerPayBillOnlineCommand,
+				Amount:        money.Birr(100),
+				Msisdn:        "251912345678",
+				BillRefNumber: "123456789012",
+				ShortCode:     "12345",
+			},
+			wantErr: true,
+		},
+
 		// 7. Missing BillRefNumber
 		{
 			name: "Missing BillRefNumber",
 			req: SimulateCustomerInititatedPayment{
-				CommandID: types.CommandId("SimulatePayment"),
-				Amount:    100,
-				Msisdn:    "254701234567",
+				CommandID: types.CustomerPayBillOnlineCommand,
+				Amount:    money.Birr(100),
+				Msisdn:    "251701234567",
 				ShortCode: "12345",
 			},
 			wantErr: true,
@@ -106,9 +120,9 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 		{
 			name: "BillRefNumber Too Short",
 			req: SimulateCustomerInititatedPayment{
-				CommandID:     types.CommandId("SimulatePayment"),
-				Amount:        100,
-				Msisdn:        "254701234567",
+				CommandID:     types.CustomerPayBillOnlineCommand,
+				Amount:        money.Birr(100),
+				Msisdn:        "251701234567",
 				BillRefNumber: "123", // Invalid bill reference number, should be at least 6 characters
 				ShortCode:     "12345",
 			},
@@ -119,9 +133,9 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 		{
 			name: "BillRefNumber Too Long",
 			req: SimulateCustomerInititatedPayment{
-				CommandID:     types.CommandId("SimulatePayment"),
-				Amount:        100,
-				Msisdn:        "254701234567",
+				CommandID:     types.CustomerPayBillOnlineCommand,
+				Amount:        money.Birr(100),
+				Msisdn:        "251701234567",
 				BillRefNumber: "123456789012345678901", // Invalid bill reference number, should be at most 20 characters
 				ShortCode:     "12345",
 			},
@@ -132,9 +146,9 @@ func TestSimulateCustomerInititatedPaymentValidation(t *testing.T) {
 		{
 			name: "Missing ShortCode",
 			req: SimulateCustomerInititatedPayment{
-				CommandID:     types.CommandId("SimulatePayment"),
-				Amount:        100,
-				Msisdn:        "254701234567",
+				CommandID:     types.CustomerPayBillOnlineCommand,
+				Amount:        money.Birr(100),
+				Msisdn:        "251701234567",
 				BillRefNumber: "123456789012",
 			},
 			wantErr: true,
@@ -1,15 +1,16 @@
 package c2b
 
 import (
+	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
-	"slices"
+	"time"
 
 	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 type ReferenceDataRequest struct {
@@ -19,15 +20,15 @@ type ReferenceDataRequest struct {
 
 type USSDPaymentRequest struct {
 	MerchantRequestID string `json:"MerchantRequestID" validate:"required,min=1,max=50"`
-	BusinessShortCode string `json:"BusinessShortCode" validate:"required"`
+	BusinessShortCode string `json:"BusinessShortCode" validate:"required,shortcode"`
 	ReferenceData []ReferenceDataRequest `json:"ReferenceData" validate:"dive"`
-	TransactionType types.TransactionType `json:"TransactionType" validate:"required"`
+	TransactionType types.TransactionType `json:"TransactionType" validate:"required,oneof=CustomerPayBillOnline CustomerBuyGoodsOnline"`
 	Password string `json:"Password" validate:"required,min=8,max=100"`
 	Timestamp string `json:"Timestamp" validate:"required,datetime=20060102150405"`
-	Amount uint64 `json:"Amount" validate:"required,gt=0"`
-	PartyA string `json:"PartyA" validate:"required,min=1,max=20"`
-	PartyB string `json:"PartyB" validate:"required,min=1,max=20"`
-	PhoneNumber string `json:"PhoneNumber" validate:"required,numeric,min=9,max=13"`
+	Amount money.Amount `json:"Amount" validate:"required,gt=0,whole_birr"`
+	PartyA string `json:"PartyA" validate:"required,msisdn_et"`
+	PartyB string `json:"PartyB" validate:"required,shortcode|till"`
+	PhoneNumber string `json:"PhoneNumber" validate:"required,msisdn_et"`
 	CallBackURL string `json:"CallBackURL" validate:"required,url"`
 	AccountReference string `json:"AccountReference" validate:"required,min=1,max=20"`
 	TransactionDesc string `json:"TransactionDesc" validate:"required,min=1,max=100"`
@@ -53,13 +54,14 @@ func (s *USSDPaymentRequest) DecodeResponse(res *http.Response) (types.MpesaResp
 
 	switch responseData.ResponseCode {
 	case "0":
-		return &responseData, nil
+		return responseData, nil
 	case "":
 		e := types.MpesaErrorResponse{}
 		err := json.Unmarshal(bodyData, &e)
 		if err != nil {
 			return nil, err
 		}
+		return nil, &e
 	}
 
 	return nil, &types.MpesaErrorResponse{
@@ -72,15 +74,44 @@ func (s *USSDPaymentRequest) DecodeResponse(res *http.Response) (types.MpesaResp
 func (t *USSDPaymentRequest) FillDefaults() {
 }
 
-func (t *USSDPaymentRequest) Validate(v *validator.Validate) error {
-	validTransactionTypes := []types.TransactionType{
-		types.CustomerBuyGoodsOnlineTransaction,
-		types.CustomerPayBillOnlineTransaction,
+// ApplyDefaults: fills the business short code, PartyB and callback url from the
+// configured defaults when they are not set on the request. When a pass key is
+// configured and the request has no Password, the Timestamp and Password are
+// generated as well.
+func (t *USSDPaymentRequest) ApplyDefaults(d types.Defaults) {
+	t.BusinessShortCode = types.OrDefault(t.BusinessShortCode, d.ShortCode)
+	t.PartyB = types.OrDefault(t.PartyB, d.ShortCode)
+	t.CallBackURL = types.OrDefault(t.CallBackURL, d.CallBackURL)
+	if t.Password == "" && d.PassKey != "" {
+		t.Timestamp = types.OrDefault(t.Timestamp, time.Now().Format(TimestampLayout))
+		t.Password = GeneratePassword(t.BusinessShortCode, d.PassKey, t.Timestamp)
 	}
+}
 
-	if !slices.Contains(validTransactionTypes, t.TransactionType) {
-		return fmt.Errorf("invalid transaction type: %v", t.TransactionType)
+// Normalize: rewrites the customer numbers (PartyA and PhoneNumber) to the 2517XXXXXXXX form.
+func (t *USSDPaymentRequest) Normalize() {
+	if m, err := msisdn.Normalize(t.PartyA); err == nil {
+		t.PartyA = m
+	}
+	if m, err := msisdn.Normalize(t.PhoneNumber); err == nil {
+		t.PhoneNumber = m
 	}
+}
+
+// Transfer: describes the payment for the transaction limits, the command is the TransactionType.
+func (t *USSDPaymentRequest) Transfer() types.Transfer {
+	return types.Transfer{CommandID: types.CommandId(t.TransactionType), Party: t.PhoneNumber, Amount: t.Amount}
+}
+
+// TimestampLayout is the layout of the Timestamp field of a USSD push request.
+const TimestampLayout = "20060102150405"
+
+// GeneratePassword: derives the USSD push Password the way M-Pesa expects it,
+// base64(BusinessShortCode + PassKey + Timestamp).
+func GeneratePassword(shortCode, passKey, timestamp string) string {
+	return base64.StdEncoding.EncodeToString([]byte(shortCode + passKey + timestamp))
+}
 
+func (t *USSDPaymentRequest) Validate(v *types.Validator) error {
 	return utils.Validate(v, t)
 }
@@ -1,14 +1,16 @@
 package c2b
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 func TestUSSDPaymentRequestValidation(t *testing.T) {
-	validate := validator.New()
+	validate := utils.NewValidator()
 
 	tests := []struct {
 		name    string
@@ -24,7 +26,7 @@ func TestUSSDPaymentRequestValidation(t *testing.T) {
 				Password:          "M2VkZGU2YWY1Y2RhMzIyOWRjMmFkMTRiMjdjOWIwOWUxZDFlZDZiNGQ0OGYyMDRiNjg0ZDZhNWM2NTQyNTk2ZA==",
 				Timestamp:         "20240918055823",
 				TransactionType:   types.TransactionType("CustomerPayBillOnline"),
-				Amount:            20,
+				Amount:            money.Birr(20),
 				PartyA:            "251710404709",
 				PartyB:            "1020",
 				PhoneNumber:       "251700404709",
@@ -49,7 +51,7 @@ func TestUSSDPaymentRequestValidation(t *testing.T) {
 				Password:          "M2VkZGU2YWY1Y2RhMzIyOWRjMmFkMTRiMjdjOWIwOWUxZDFlZDZiNGQ0OGYyMDRiNjg0ZDZhNWM2NTQyNTk2ZA==",
 				Timestamp:         "20240918055823",
 				TransactionType:   types.TransactionType("CustomerPayBillOnline"),
-				Amount:            20,
+				Amount:            money.Birr(20),
 				PartyA:            "251710404709",
 				PartyB:            "1020",
 				PhoneNumber:       "251700404709",
@@ -99,7 +101,7 @@ func TestUSSDPaymentRequestValidation(t *testing.T) {
 				Password:          "M2VkZGU2YWY1Y2RhMzIyOWRjMmFkMTRiMjdjOWIwOWUxZDFlZDZiNGQ0OGYyMDRiNjg0ZDZhNWM2NTQyNTk2ZA==",
 				Timestamp:         "20240918055823",
 				TransactionType:   types.TransactionType("CustomerPayBillOnline"),
-				Amount:            0, // Invalid amount, should be greater than 0
+				Amount:            money.Zero, // Invalid amount, should be greater than 0
 				PartyA:            "251710404709",
 				PartyB:            "1020",
 				PhoneNumber:       "251700404709",
@@ -116,6 +118,26 @@ func TestUSSDPaymentRequestValidation(t *testing.T) {
 			wantErr: true,
 		},
 
+		// 5b. Amount with santim, USSD push only accepts whole birr
+		{
+			name: "Invalid Amount (With santim)",
+			req: USSDPaymentRequest{
+				MerchantRequestID: "MR12345",
+				BusinessShortCode: "1020",
+				Password:          "M2VkZGU2YWY1Y2RhMzIyOWRjMmFkMTRiMjdjOWIwOWUxZDFlZDZiNGQ0OGYyMDRiNjg0ZDZhNWM2NTQyNTk2ZA==",
+				Timestamp:         "20240918055823",
+				TransactionType:   types.TransactionType("CustomerPayBillOnline"),
+				Amount:            money.Santim(2050),
+				PartyA:            "251710404709",
+				PartyB:            "1020",
+				PhoneNumber:       "251700404709",
+				CallBackURL:       "https://www.myservice:8080/result",
+				AccountReference:  "Partner Unique ID",
+				TransactionDesc:   "Payment Reason",
+			},
+			wantErr: true,
+		},
+
 		// 6. Invalid PhoneNumber (Missing)
 		{
 			name: "Invalid PhoneNumber (Missing)",
@@ -125,7 +147,7 @@ func TestUSSDPaymentRequestValidation(t *testing.T) {
 				Password:          "M2VkZGU2YWY1Y2RhMzIyOWRjMmFkMTRiMjdjOWIwOWUxZDFlZDZiNGQ0OGYyMDRiNjg0ZDZhNWM2NTQyNTk2ZA==",
 				Timestamp:         "20240918055823",
 				TransactionType:   types.TransactionType("CustomerPayBillOnline"),
-				Amount:            20,
+				Amount:            money.Birr(20),
 				PartyA:            "251710404709",
 				PartyB:            "1020",
 				CallBackURL:       "https://www.myservice:8080/result",
@@ -150,7 +172,7 @@ func TestUSSDPaymentRequestValidation(t *testing.T) {
 				Password:          "M2VkZGU2YWY1Y2RhMzIyOWRjMmFkMTRiMjdjOWIwOWUxZDFlZDZiNGQ0OGYyMDRiNjg0ZDZhNWM2NTQyNTk2ZA==",
 				Timestamp:         "20240918055823",
 				TransactionType:   types.TransactionType("CustomerPayBillOnline"),
-				Amount:            20,
+				Amount:            money.Birr(20),
 				PartyA:            "251710404709",
 				PartyB:            "1020",
 				PhoneNumber:       "25170A12345", // Invalid phone number
@@ -176,7 +198,7 @@ func TestUSSDPaymentRequestValidation(t *testing.T) {
 				Password:          "M2VkZGU2YWY1Y2RhMzIyOWRjMmFkMTRiMjdjOWIwOWUxZDFlZDZiNGQ0OGYyMDRiNjg0ZDZhNWM2NTQyNTk2ZA==",
 				Timestamp:         "2024-03-05 12:00:00", // Incorrect timestamp format
 				TransactionType:   types.TransactionType("CustomerPayBillOnline"),
-				Amount:            20,
+				Amount:            money.Birr(20),
 				PartyA:            "251710404709",
 				PartyB:            "1020",
 				PhoneNumber:       "251700404709",
@@ -202,7 +224,7 @@ func TestUSSDPaymentRequestValidation(t *testing.T) {
 				Password:          "M2VkZGU2YWY1Y2RhMzIyOWRjMmFkMTRiMjdjOWIwOWUxZDFlZDZiNGQ0OGYyMDRiNjg0ZDZhNWM2NTQyNTk2ZA==",
 				Timestamp:         "20240918055823",
 				TransactionType:   types.TransactionType("CustomerPayBillOnline"),
-				Amount:            20,
+				Amount:            money.Birr(20),
 				PartyA:            "251710404709",
 				PartyB:            "1020",
 				PhoneNumber:       "251700404709",
@@ -233,3 +255,40 @@ func TestUSSDPaymentRequestValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestUSSDPaymentRequestTransactionType(t *testing.T) {
+	req := USSDPaymentRequest{
+		MerchantRequestID: "MR12345",
+		BusinessShortCode: "1020",
+		Password:          "M2VkZGU2YWY1Y2RhMzIyOWRjMmFkMTRiMjdjOWIwOWUxZDFlZDZiNGQ0OGYyMDRiNjg0ZDZhNWM2NTQyNTk2ZA==",
+		Timestamp:         "20240918055823",
+		TransactionType:   types.TransactionType("CustomerPayLater"),
+		Amount:            money.Birr(20),
+		PartyA:            "251710404709",
+		PartyB:            "1020",
+		PhoneNumber:       "251700404709",
+		CallBackURL:       "https://www.myservice:8080/result",
+		AccountReference:  "Partner Unique ID",
+		TransactionDesc:   "Payment Reason",
+	}
+
+	var verr *types.ValidationError
+	if err := req.Validate(utils.NewValidator()); !errors.As(err, &verr) {
+		t.Fatalf("expected a *types.ValidationError, got: %v", err)
+	}
+	fe, ok := verr.Field("TransactionType")
+	if !ok || fe.Tag != "oneof" {
+		t.Fatalf("expected a oneof error on TransactionType, got: %v", verr)
+	}
+	if fe.Messages[types.LocaleEnglish] == "" || fe.Messages[types.LocaleAmharic] == "" {
+		t.Errorf("expected English and Amharic messages, got: %v", fe.Messages)
+	}
+}
+
+func TestUSSDPaymentRequestNormalize(t *testing.T) {
+	req := USSDPaymentRequest{PartyA: "+251 712 345 678", PhoneNumber: "0712345678"}
+	req.Normalize()
+	if req.PartyA != "251712345678" || req.PhoneNumber != "251712345678" {
+		t.Errorf("expected normalized numbers, got PartyA %v and PhoneNumber %v", req.PartyA, req.PhoneNumber)
+	}
+}
@@ -0,0 +1,76 @@
+package c2b
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+// USSDQueryRequest queries the outcome of a USSD push (STK query), for example when
+// its callback did not arrive.
+type USSDQueryRequest struct {
+	BusinessShortCode string `json:"BusinessShortCode" validate:"required,shortcode"`
+	Password          string `json:"Password" validate:"required,min=8,max=100"`
+	Timestamp         string `json:"Timestamp" validate:"required,datetime=20060102150405"`
+	CheckoutRequestID string `json:"CheckoutRequestID" validate:"required,min=1,max=100"`
+}
+
+// USSDQueryResponse is the outcome of a USSD push. ResultCode is "0" when the customer
+// paid, it carries the same codes as the USSD push callback otherwise (1032 when the
+// customer cancelled, 1037 when the prompt timed out...).
+type USSDQueryResponse struct {
+	ResponseCode        string `json:"ResponseCode"`
+	ResponseDescription string `json:"ResponseDescription"`
+	MerchantRequestID   string `json:"MerchantRequestID"`
+	CheckoutRequestID   string `json:"CheckoutRequestID"`
+	ResultCode          string `json:"ResultCode"`
+	ResultDesc          string `json:"ResultDesc"`
+}
+
+// USSDQueryPending is the error code returned while the customer has not answered the prompt yet.
+const USSDQueryPending = "500.001.1001"
+
+func (q *USSDQueryRequest) DecodeResponse(res *http.Response) (types.MpesaResponse, error) {
+	bodyData, _ := io.ReadAll(res.Body)
+	responseData := USSDQueryResponse{}
+	err := json.Unmarshal(bodyData, &responseData)
+	if err != nil {
+		return nil, err
+	}
+
+	if responseData.ResponseCode != "0" {
+		errorResponseData := &types.MpesaErrorResponse{}
+		err := json.Unmarshal(bodyData, errorResponseData)
+		if err != nil {
+			return nil, err
+		}
+		if errorResponseData.ErrorCode == "" {
+			errorResponseData.ErrorCode = responseData.ResponseCode
+			errorResponseData.ErrorMessage = responseData.ResponseDescription
+		}
+
+		return nil, errorResponseData
+	}
+
+	return responseData, nil
+}
+
+func (q *USSDQueryRequest) FillDefaults() {}
+
+// ApplyDefaults: fills the business short code from the configured defaults and, when a
+// pass key is configured and the request has no Password, the Timestamp and Password.
+func (q *USSDQueryRequest) ApplyDefaults(d types.Defaults) {
+	q.BusinessShortCode = types.OrDefault(q.BusinessShortCode, d.ShortCode)
+	if q.Password == "" && d.PassKey != "" {
+		q.Timestamp = types.OrDefault(q.Timestamp, time.Now().Format(TimestampLayout))
+		q.Password = GeneratePassword(q.BusinessShortCode, d.PassKey, q.Timestamp)
+	}
+}
+
+func (q *USSDQueryRequest) Validate(v *types.Validator) error {
+	return utils.Validate(v, q)
+}
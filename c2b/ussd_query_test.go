@@ -0,0 +1,56 @@
+package c2b
+
+import (
+	"testing"
+
+	"github.com/coleYab/mpesagosdk/internal/utils"
+)
+
+func TestUSSDQueryRequestValidation(t *testing.T) {
+	validate := utils.NewValidator()
+
+	tests := []struct {
+		name    string
+		req     USSDQueryRequest
+		wantErr bool
+	}{
+		{
+			name: "Valid Input",
+			req: USSDQueryRequest{
+				BusinessShortCode: "1020",
+				Password:          GeneratePassword("1020", "pass-key", "20240918055823"),
+				Timestamp:         "20240918055823",
+				CheckoutRequestID: "ws_CO_18092024055823_1",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Missing CheckoutRequestID",
+			req: USSDQueryRequest{
+				BusinessShortCode: "1020",
+				Password:          GeneratePassword("1020", "pass-key", "20240918055823"),
+				Timestamp:         "20240918055823",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid Timestamp",
+			req: USSDQueryRequest{
+				BusinessShortCode: "1020",
+				Password:          GeneratePassword("1020", "pass-key", "20240918055823"),
+				Timestamp:         "2024-09-18",
+				CheckoutRequestID: "ws_CO_18092024055823_1",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate(validate)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+// Package callback defines the payloads M-Pesa sends asynchronously to the urls
+// given in requests, and HTTP handlers that decode them.
+//
+// There are three kinds of callbacks:
+//   - Result: sent to the `ResultURL` (or `QueueTimeOutURL`) of B2C payments, transaction
+//     reversals, transaction status queries and account balance queries.
+//   - STKCallback: sent to the `CallBackURL` of a USSD push (STK) payment.
+//   - C2BConfirmation: sent to the `ConfirmationURL` / `ValidationURL` registered with
+//     RegisterNewURL whenever a customer pays the short code.
+//
+// Every decoded callback keeps the exact bytes M-Pesa sent (see the Raw methods), so that
+// callbacks can be stored and replayed byte for byte.
+//
+// Example usage:
+//
+//	http.Handle("/mpesa/result", callback.ResultHandler(func(ctx context.Context, res *callback.Result) error {
+//		log.Println(res.Result.ConversationID, res.Result.ResultCode, res.Result.ResultDesc)
+//		return nil
+//	}))
+package callback
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/coleYab/mpesagosdk/money"
+)
+
+// Kind identifies the type of a callback payload.
+type Kind string
+
+const (
+	// KindResult is the payload of a ResultURL / QueueTimeOutURL callback.
+	KindResult Kind = "result"
+	// KindSTK is the payload of a USSD push CallBackURL callback.
+	KindSTK Kind = "stk"
+	// KindConfirmation is the payload of a C2B confirmation or validation callback.
+	KindConfirmation Kind = "confirmation"
+)
+
+// Value is a raw JSON value of a key/value pair, M-Pesa sends numbers and
+// strings interchangeably so the value is kept as it was received.
+type Value json.RawMessage
+
+// String returns the value as text, strings are unquoted and numbers are kept as written.
+func (v Value) String() string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+	return string(v)
+}
+
+// MarshalJSON writes the value back exactly as it was received.
+func (v Value) MarshalJSON() ([]byte, error) {
+	if len(v) == 0 {
+		return []byte("null"), nil
+	}
+	return v, nil
+}
+
+// UnmarshalJSON keeps a copy of the raw value.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	*v = append((*v)[0:0], data...)
+	return nil
+}
+
+// Amount returns the value as an amount, M-Pesa sends amounts as numbers (120) or
+// strings ("120.00").
+func (v Value) Amount() (money.Amount, error) {
+	return money.Parse(v.String())
+}
+
+// StringValue builds a Value holding a JSON string.
+func StringValue(s string) Value {
+	data, _ := json.Marshal(s)
+	return Value(data)
+}
+
+// NumberValue builds a Value holding a JSON number.
+func NumberValue(n float64) Value {
+	return Value(strconv.FormatFloat(n, 'f', -1, 64))
+}
+
+// AmountValue builds a Value holding an amount as a JSON number.
+func AmountValue(a money.Amount) Value {
+	return Value(a.Decimal())
+}
+
+// Code is a result code. M-Pesa sends most result codes as numbers (0, 1032, 2001...)
+// and some as strings ("R000002"), both are read into the same text form.
+type Code string
+
+// Success is the result code of a successful operation.
+const Success Code = "0"
+
+// MarshalJSON writes numeric codes as numbers and the other ones as strings, codes such
+// as "00" or "+1" that are not written like a JSON number stay strings.
+func (c Code) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.ParseInt(string(c), 10, 64); err == nil && strconv.FormatInt(n, 10) == string(c) {
+		return []byte(c), nil
+	}
+	return json.Marshal(string(c))
+}
+
+// UnmarshalJSON accepts both numbers and strings.
+func (c *Code) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = Code(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*c = Code(n.String())
+	return nil
+}
+
+// Parameter is a single key/value pair of a result.
+type Parameter struct {
+	Key   string `json:"Key"`
+	Value Value  `json:"Value"`
+}
+
+// ResultBody is the content of a Result callback.
+type ResultBody struct {
+	ResultType               int               `json:"ResultType"`
+	ResultCode               Code              `json:"ResultCode"`
+	ResultDesc               string            `json:"ResultDesc"`
+	OriginatorConversationID string            `json:"OriginatorConversationID"`
+	ConversationID           string            `json:"ConversationID"`
+	TransactionID            string            `json:"TransactionID"`
+	ResultParameters         *ResultParameters `json:"ResultParameters,omitempty"`
+	ReferenceData            *ReferenceData    `json:"ReferenceData,omitempty"`
+}
+
+// ResultParameters holds the key/value pairs describing the outcome of an operation.
+type ResultParameters struct {
+	ResultParameter []Parameter `json:"ResultParameter"`
+}
+
+// ReferenceData echoes reference values of the request, such as the QueueTimeoutURL.
+type ReferenceData struct {
+	ReferenceItem Parameter `json:"ReferenceItem"`
+}
+
+// Result is the callback sent to the ResultURL of B2C payments, reversals, transaction
+// status queries and account balance queries.
+type Result struct {
+	Result ResultBody `json:"Result"`
+	raw    []byte
+}
+
+// Raw returns the bytes the callback was decoded from.
+func (r *Result) Raw() []byte {
+	return r.raw
+}
+
+// Succeeded reports whether the operation completed successfully (ResultCode 0).
+func (r *Result) Succeeded() bool {
+	return r.Result.ResultCode == Success
+}
+
+// Parameter returns the value of a result parameter such as `TransactionAmount`,
+// `ReceiverPartyPublicName` or `TransactionCompletedDateTime`.
+func (r *Result) Parameter(key string) (Value, bool) {
+	if r.Result.ResultParameters == nil {
+		return nil, false
+	}
+	for _, p := range r.Result.ResultParameters.ResultParameter {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetParameter adds or replaces a result parameter.
+func (r *Result) SetParameter(key string, value Value) {
+	if r.Result.ResultParameters == nil {
+		r.Result.ResultParameters = &ResultParameters{}
+	}
+	params := &r.Result.ResultParameters.ResultParameter
+	for i := range *params {
+		if (*params)[i].Key == key {
+			(*params)[i].Value = value
+			return
+		}
+	}
+	*params = append(*params, Parameter{Key: key, Value: value})
+}
+
+// Item is a single name/value pair of a USSD push callback metadata.
+type Item struct {
+	Name  string `json:"Name"`
+	Value Value  `json:"Value,omitempty"`
+}
+
+// STKCallbackBody is the content of a USSD push callback.
+type STKCallbackBody struct {
+	MerchantRequestID string            `json:"MerchantRequestID"`
+	CheckoutRequestID string            `json:"CheckoutRequestID"`
+	ResultCode        Code              `json:"ResultCode"`
+	ResultDesc        string            `json:"ResultDesc"`
+	CallbackMetadata  *CallbackMetadata `json:"CallbackMetadata,omitempty"`
+}
+
+// CallbackMetadata holds the details of a completed USSD push payment.
+type CallbackMetadata struct {
+	Item []Item `json:"Item"`
+}
+
+// STKCallback is the callback sent to the CallBackURL of a USSD push payment.
+type STKCallback struct {
+	Body struct {
+		StkCallback STKCallbackBody `json:"stkCallback"`
+	} `json:"Body"`
+	raw []byte
+}
+
+// Raw returns the bytes the callback was decoded from.
+func (s *STKCallback) Raw() []byte {
+	return s.raw
+}
+
+// Succeeded reports whether the customer completed the payment (ResultCode 0).
+func (s *STKCallback) Succeeded() bool {
+	return s.Body.StkCallback.ResultCode == Success
+}
+
+// Metadata returns the value of a metadata item such as `Amount`, `MpesaReceiptNumber`,
+// `TransactionDate` or `PhoneNumber`.
+func (s *STKCallback) Metadata(name string) (Value, bool) {
+	if s.Body.StkCallback.CallbackMetadata == nil {
+		return nil, false
+	}
+	for _, item := range s.Body.StkCallback.CallbackMetadata.Item {
+		if item.Name == name {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetMetadata adds or replaces a metadata item.
+func (s *STKCallback) SetMetadata(name string, value Value) {
+	body := &s.Body.StkCallback
+	if body.CallbackMetadata == nil {
+		body.CallbackMetadata = &CallbackMetadata{}
+	}
+	for i := range body.CallbackMetadata.Item {
+		if body.CallbackMetadata.Item[i].Name == name {
+			body.CallbackMetadata.Item[i].Value = value
+			return
+		}
+	}
+	body.CallbackMetadata.Item = append(body.CallbackMetadata.Item, Item{Name: name, Value: value})
+}
+
+// C2BConfirmation is the callback sent to the registered ConfirmationURL (and
+// ValidationURL) when a customer pays the short code.
+type C2BConfirmation struct {
+	TransactionType   string       `json:"TransactionType"`
+	TransID           string       `json:"TransID"`
+	TransTime         string       `json:"TransTime"`
+	TransAmount       money.Amount `json:"TransAmount"`
+	BusinessShortCode string       `json:"BusinessShortCode"`
+	BillRefNumber     string       `json:"BillRefNumber"`
+	InvoiceNumber     string       `json:"InvoiceNumber"`
+	OrgAccountBalance money.Amount `json:"OrgAccountBalance"`
+	ThirdPartyTransID string       `json:"ThirdPartyTransID"`
+	MSISDN            string       `json:"MSISDN"`
+	FirstName         string       `json:"FirstName"`
+	MiddleName        string       `json:"MiddleName"`
+	LastName          string       `json:"LastName"`
+	raw               []byte
+}
+
+// Raw returns the bytes the callback was decoded from.
+func (c *C2BConfirmation) Raw() []byte {
+	return c.raw
+}
+
+// MarshalJSON writes the amounts as strings with two decimals ("10.00") like M-Pesa does.
+func (c C2BConfirmation) MarshalJSON() ([]byte, error) {
+	type plain C2BConfirmation
+	return json.Marshal(struct {
+		plain
+		TransAmount       string `json:"TransAmount"`
+		OrgAccountBalance string `json:"OrgAccountBalance"`
+	}{plain(c), c.TransAmount.String(), c.OrgAccountBalance.String()})
+}
+
+// ParseResult decodes a Result callback and keeps its raw bytes.
+func ParseResult(r io.Reader) (*Result, error) {
+	res := &Result{}
+	raw, err := decode(r, res, "Result")
+	res.raw = raw
+	return res, err
+}
+
+// ParseSTKCallback decodes a USSD push callback and keeps its raw bytes.
+func ParseSTKCallback(r io.Reader) (*STKCallback, error) {
+	res := &STKCallback{}
+	raw, err := decode(r, res, "Body")
+	res.raw = raw
+	return res, err
+}
+
+// ParseC2BConfirmation decodes a C2B confirmation or validation callback and keeps its raw bytes.
+func ParseC2BConfirmation(r io.Reader) (*C2BConfirmation, error) {
+	res := &C2BConfirmation{}
+	raw, err := decode(r, res, "TransID")
+	res.raw = raw
+	return res, err
+}
+
+// DetectKind returns the kind of a raw callback payload from its top level fields.
+func DetectKind(raw []byte) (Kind, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return "", err
+	}
+	switch {
+	case fields["Result"] != nil:
+		return KindResult, nil
+	case fields["Body"] != nil:
+		return KindSTK, nil
+	case fields["TransID"] != nil:
+		return KindConfirmation, nil
+	}
+	return "", fmt.Errorf("unknown callback payload")
+}
+
+// decode: reads the whole body, decodes it into v and checks that the field
+// identifying the callback kind is present.
+func decode(r io.Reader, v interface{}, required string) ([]byte, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return raw, err
+	}
+	if _, ok := fields[required]; !ok {
+		return raw, fmt.Errorf("invalid callback payload: missing %v", required)
+	}
+
+	return raw, json.Unmarshal(raw, v)
+}
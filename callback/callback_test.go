@@ -0,0 +1,138 @@
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const resultPayload = `{"Result":{"ResultType":0,"ResultCode":0,"ResultDesc":"The service request is processed successfully.",` +
+	`"OriginatorConversationID":"occ-1","ConversationID":"AG_1","TransactionID":"RJT0000001",` +
+	`"ResultParameters":{"ResultParameter":[{"Key":"TransactionAmount","Value":120},{"Key":"ReceiverPartyPublicName","Value":"251712345678 - John"}]}}}`
+
+func TestParseResult(t *testing.T) {
+	res, err := ParseResult(strings.NewReader(resultPayload))
+	require.NoError(t, err)
+	assert.True(t, res.Succeeded())
+	assert.Equal(t, resultPayload, string(res.Raw()))
+
+	amount, ok := res.Parameter("TransactionAmount")
+	assert.True(t, ok)
+	assert.Equal(t, "120", amount.String())
+	value, err := amount.Amount()
+	require.NoError(t, err)
+	assert.Equal(t, money.Birr(120), value)
+	name, _ := res.Parameter("ReceiverPartyPublicName")
+	assert.Equal(t, "251712345678 - John", name.String())
+
+	failed, err := ParseResult(strings.NewReader(`{"Result":{"ResultCode":"R000002"}}`))
+	require.NoError(t, err)
+	assert.False(t, failed.Succeeded())
+	assert.Equal(t, Code("R000002"), failed.Result.ResultCode)
+
+	_, err = ParseResult(strings.NewReader(`{"Body":{}}`))
+	assert.Error(t, err)
+}
+
+func TestCodeJSON(t *testing.T) {
+	tests := []struct {
+		code     Code
+		expected string
+	}{
+		{"0", `0`},
+		{"1032", `1032`},
+		{"-1", `-1`},
+		{"R000002", `"R000002"`},
+		{"00", `"00"`},
+		{"+1", `"+1"`},
+		{"", `""`},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.code)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, string(data), "code %q", tt.code)
+
+		var decoded Code
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, tt.code, decoded)
+	}
+}
+
+func TestC2BConfirmationAmounts(t *testing.T) {
+	payload := `{"TransID":"RJT0000001","TransAmount":"10.50","OrgAccountBalance":""}`
+	c, err := ParseC2BConfirmation(strings.NewReader(payload))
+	require.NoError(t, err)
+	assert.Equal(t, money.Santim(1050), c.TransAmount)
+	assert.True(t, c.OrgAccountBalance.IsZero())
+
+	data, err := json.Marshal(c)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"TransAmount":"10.50"`)
+	assert.Contains(t, string(data), `"OrgAccountBalance":"0.00"`)
+	assert.Contains(t, string(data), `"TransID":"RJT0000001"`)
+	assert.Equal(t, "12.25", string(AmountValue(money.Santim(1225))))
+}
+
+func TestDetectKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected Kind
+		wantErr  bool
+	}{
+		{"Result", resultPayload, KindResult, false},
+		{"STK", `{"Body":{"stkCallback":{"ResultCode":1032}}}`, KindSTK, false},
+		{"Confirmation", `{"TransID":"RJT0000001","TransAmount":"10.00"}`, KindConfirmation, false},
+		{"Unknown", `{"foo":1}`, "", true},
+		{"Invalid JSON", `not json`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, err := DetectKind([]byte(tt.payload))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, kind)
+		})
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	var got *STKCallback
+	h := Handlers{
+		OnSTK: func(_ context.Context, cb *STKCallback) error {
+			got = cb
+			return nil
+		},
+		OnResult: func(_ context.Context, _ *Result) error {
+			return errors.New("storage down")
+		},
+	}
+
+	post := func(body string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body)))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post(`{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_1","ResultCode":0}}}`))
+	require.NotNil(t, got)
+	assert.True(t, got.Succeeded())
+	assert.Equal(t, "ws_CO_1", got.Body.StkCallback.CheckoutRequestID)
+
+	assert.Equal(t, http.StatusInternalServerError, post(resultPayload))
+	assert.Equal(t, http.StatusOK, post(`{"TransID":"RJT0000001"}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{}`))
+}
@@ -0,0 +1,130 @@
+package callback
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// Acknowledgement is the body returned to M-Pesa after a callback was handled.
+type Acknowledgement struct {
+	ResultCode int    `json:"ResultCode"`
+	ResultDesc string `json:"ResultDesc"`
+}
+
+// ResultHandler returns an http.Handler that decodes Result callbacks and passes them to fn.
+// M-Pesa receives an "Accepted" acknowledgement when fn returns nil and an HTTP 500 otherwise.
+func ResultHandler(fn func(ctx context.Context, res *Result) error) http.Handler {
+	return handle(func(r *http.Request, body io.Reader) error {
+		res, err := ParseResult(body)
+		if err != nil {
+			return badRequest{err}
+		}
+		return fn(r.Context(), res)
+	})
+}
+
+// STKHandler returns an http.Handler that decodes USSD push callbacks and passes them to fn.
+func STKHandler(fn func(ctx context.Context, cb *STKCallback) error) http.Handler {
+	return handle(func(r *http.Request, body io.Reader) error {
+		cb, err := ParseSTKCallback(body)
+		if err != nil {
+			return badRequest{err}
+		}
+		return fn(r.Context(), cb)
+	})
+}
+
+// ConfirmationHandler returns an http.Handler that decodes C2B confirmation or validation
+// callbacks and passes them to fn. Returning an error from a validation handler rejects
+// the payment.
+func ConfirmationHandler(fn func(ctx context.Context, c *C2BConfirmation) error) http.Handler {
+	return handle(func(r *http.Request, body io.Reader) error {
+		c, err := ParseC2BConfirmation(body)
+		if err != nil {
+			return badRequest{err}
+		}
+		return fn(r.Context(), c)
+	})
+}
+
+// Handlers dispatches any callback kind to the matching function, it is useful when a
+// single url is used as ResultURL, CallBackURL and ConfirmationURL. Kinds without a
+// function are acknowledged and dropped.
+type Handlers struct {
+	OnResult       func(ctx context.Context, res *Result) error
+	OnSTK          func(ctx context.Context, cb *STKCallback) error
+	OnConfirmation func(ctx context.Context, c *C2BConfirmation) error
+}
+
+// ServeHTTP detects the callback kind and calls the matching function.
+func (h Handlers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handle(func(r *http.Request, body io.Reader) error {
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		kind, err := DetectKind(raw)
+		if err != nil {
+			return badRequest{err}
+		}
+
+		switch kind {
+		case KindResult:
+			if h.OnResult != nil {
+				res, err := ParseResult(bytes.NewReader(raw))
+				if err != nil {
+					return badRequest{err}
+				}
+				return h.OnResult(r.Context(), res)
+			}
+		case KindSTK:
+			if h.OnSTK != nil {
+				cb, err := ParseSTKCallback(bytes.NewReader(raw))
+				if err != nil {
+					return badRequest{err}
+				}
+				return h.OnSTK(r.Context(), cb)
+			}
+		case KindConfirmation:
+			if h.OnConfirmation != nil {
+				c, err := ParseC2BConfirmation(bytes.NewReader(raw))
+				if err != nil {
+					return badRequest{err}
+				}
+				return h.OnConfirmation(r.Context(), c)
+			}
+		}
+		return nil
+	}).ServeHTTP(w, r)
+}
+
+// badRequest: marks errors caused by an invalid payload.
+type badRequest struct{ error }
+
+// handle: runs fn on the request body and writes the acknowledgement.
+func handle(fn func(r *http.Request, body io.Reader) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+		err := fn(r, r.Body)
+		switch err.(type) {
+		case nil:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(Acknowledgement{ResultCode: 0, ResultDesc: "Accepted"})
+		case badRequest:
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(Acknowledgement{ResultCode: 1, ResultDesc: err.Error()})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(Acknowledgement{ResultCode: 1, ResultDesc: "Rejected"})
+		}
+	})
+}
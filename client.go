@@ -0,0 +1,49 @@
+package mpesagosdk
+
+import (
+	"github.com/coleYab/mpesagosdk/account"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/kyc"
+	"github.com/coleYab/mpesagosdk/transaction"
+)
+
+// Client: is the set of M-Pesa operations provided by App. Service code should
+// depend on Client rather than *App so that it can be unit tested with a fake,
+// such as mpesatest.FakeClient, instead of a real M-Pesa connection.
+//
+// Example Usage:
+//
+//	type PayoutService struct {
+//		mpesa mpesagosdk.Client
+//	}
+//
+//	app, err := mpesagosdk.New(mpesagosdk.WithConfig(cfg))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	svc := PayoutService{mpesa: app}
+type Client interface {
+	// MakeAccountBalanceQuery: queries the balance of the M-Pesa account.
+	MakeAccountBalanceQuery(req account.AccountBalanceRequest) (*account.AccountBalanceSuccessResponse, error)
+	// MakeB2CPaymentRequest: sends money from the business to a customer.
+	MakeB2CPaymentRequest(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error)
+	// CheckCustomerName: looks up the name registered for a customer MSISDN.
+	CheckCustomerName(req kyc.NameCheckRequest) (*kyc.NameCheckResponse, error)
+	// MakeTransactionReversalRequest: reverses a completed transaction.
+	MakeTransactionReversalRequest(req transaction.TransactionReversalRequest) (*transaction.TransactionReversalResponse, error)
+	// MakeTransactionStatusQuery: queries the status of a transaction.
+	MakeTransactionStatusQuery(req transaction.TransactionStatusRequest) (*transaction.TransactionStatusResponse, error)
+	// USSDPaymentRequest: sends a USSD push (STK) payment prompt to a customer.
+	USSDPaymentRequest(req c2b.USSDPaymentRequest) (*c2b.USSDSuccessResponse, error)
+	// USSDPaymentQuery: queries the outcome of a USSD push payment.
+	USSDPaymentQuery(req c2b.USSDQueryRequest) (*c2b.USSDQueryResponse, error)
+	// GenerateDynamicQR: generates a QR code the customer scans to pay a till or a paybill.
+	GenerateDynamicQR(req c2b.DynamicQRRequest) (*c2b.DynamicQRResponse, error)
+	// SimulateCustomerInitiatedPayment: simulates a customer paying the short code.
+	SimulateCustomerInitiatedPayment(req c2b.SimulateCustomerInititatedPayment) (*c2b.SimulatePaymentSuccessResponse, error)
+	// RegisterNewURL: registers the C2B confirmation and validation urls.
+	RegisterNewURL(req c2b.RegisterC2BURLRequest) (*c2b.RegisterURLResponse, error)
+}
+
+var _ Client = (*App)(nil)
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/coleYab/mpesagosdk/account"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/kyc"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
+	"github.com/coleYab/mpesagosdk/transaction"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/google/uuid"
+)
+
+// command: a subcommand of mpesa.
+//
+// Fields:
+//   - name: The words selecting the command, e.g. "stk push".
+//   - summary: The one line description printed by the usage.
+//   - run: Executes the command with the arguments following its name.
+type command struct {
+	name    string
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+// commands: every command, in the order of the usage.
+var commands = []*command{
+	{"token", "print an access token", runToken},
+	{"stk push", "send a USSD push (STK) payment prompt to a customer", runSTKPush},
+	{"stk query", "query the outcome of a USSD push payment", runSTKQuery},
+	{"b2c pay", "send money from the business to a customer", runB2CPay},
+	{"name-check", "print the name a customer is registered with", runNameCheck},
+	{"reversal", "reverse a completed transaction", runReversal},
+	{"status", "query the status of a transaction", runStatus},
+	{"balance", "query the balance of the account", runBalance},
+	{"c2b register-url", "register the C2B confirmation and validation urls", runRegisterURL},
+	{"c2b simulate", "simulate a customer paying the short code", runSimulate},
+	{"c2b qr", "generate a QR code the customer scans to pay", runDynamicQR},
+	{"listen", "receive the callbacks locally and print them", runListen},
+	{"replay", "send saved callbacks again to a url", runReplay},
+}
+
+// lookup: returns the command named by the first one or two args and the remaining args.
+func lookup(args []string) (*command, []string) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+// parseRequest: fills a request from the flags of a command and, when -file is given, from
+// a JSON request file. The file is read first so that the flags override its values, then
+// the flags are parsed a second time on top of it. bind must declare the flags with zero
+// defaults, the defaults of a command are applied once the request is complete.
+func parseRequest[T any](c *cli, name string, args []string, bind func(fs *flag.FlagSet, req *T)) (*T, error) {
+	newFlagSet := func(req *T) (*flag.FlagSet, *string) {
+		fs := flag.NewFlagSet("mpesa "+name, flag.ContinueOnError)
+		fs.SetOutput(c.stderr)
+		file := fs.String("file", "", `JSON request file, "-" reads the standard input, flags override its values`)
+		bind(fs, req)
+		return fs, file
+	}
+
+	req := new(T)
+	fs, file := newFlagSet(req)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if *file == "" {
+		return req, nil
+	}
+
+	data, err := c.readFile(*file)
+	if err != nil {
+		return nil, err
+	}
+	req = new(T)
+	fs, _ = newFlagSet(req)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return nil, fmt.Errorf("invalid request file %v: %w", *file, err)
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// parseFlags: parses the flags of a command, which takes no positional argument.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// readFile: reads a request file, "-" reads the standard input.
+func (c *cli) readFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(c.stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// orDefault: sets an empty value to its default.
+func orDefault[T ~string](value *T, fallback T) {
+	if *value == "" {
+		*value = fallback
+	}
+}
+
+// orNewID: sets an empty identifier to a new UUID.
+func orNewID(value *string) {
+	orDefault(value, uuid.NewString())
+}
+
+// textFlag: a flag of a string based type, such as types.CommandId.
+type textFlag[T ~string] struct{ p *T }
+
+func (f textFlag[T]) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return string(*f.p)
+}
+
+func (f textFlag[T]) Set(s string) error {
+	*f.p = T(s)
+	return nil
+}
+
+// amountVar: declares a flag parsed with money.Parse, such as "250.50".
+func amountVar(fs *flag.FlagSet, p *money.Amount, name, usage string) {
+	fs.Func(name, usage, func(s string) error {
+		amount, err := money.Parse(s)
+		if err != nil {
+			return err
+		}
+		*p = amount
+		return nil
+	})
+}
+
+func runToken(c *cli, args []string) error {
+	fs := flag.NewFlagSet("mpesa token", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	token, err := app.AccessToken()
+	if err != nil {
+		return err
+	}
+	return c.print(struct {
+		Token string `json:"token"`
+	}{token})
+}
+
+func runSTKPush(c *cli, args []string) error {
+	req, err := parseRequest(c, "stk push", args, func(fs *flag.FlagSet, req *c2b.USSDPaymentRequest) {
+		fs.Func("phone", "customer phone number, sets PartyA and PhoneNumber", func(s string) error {
+			req.PartyA, req.PhoneNumber = s, s
+			return nil
+		})
+		amountVar(fs, &req.Amount, "amount", "amount to pay, in birr")
+		fs.StringVar(&req.AccountReference, "reference", "", "account reference shown to the customer")
+		fs.StringVar(&req.TransactionDesc, "description", "", "transaction description (default the reference)")
+		fs.StringVar(&req.BusinessShortCode, "short-code", "", "business short code (default MPESA_SHORT_CODE)")
+		fs.StringVar(&req.PartyB, "party-b", "", "receiving short code or till (default the short code)")
+		fs.StringVar(&req.CallBackURL, "callback-url", "", "callback url (default MPESA_CALLBACK_URL)")
+		fs.Var(textFlag[types.TransactionType]{&req.TransactionType}, "type", "transaction type (default CustomerPayBillOnline)")
+		fs.StringVar(&req.MerchantRequestID, "merchant-request-id", "", "merchant request ID (default a new UUID)")
+	})
+	if err != nil {
+		return err
+	}
+	orDefault(&req.TransactionType, types.CustomerPayBillOnlineTransaction)
+	orDefault(&req.TransactionDesc, req.AccountReference)
+	orNewID(&req.MerchantRequestID)
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.USSDPaymentRequest(*req)
+	if err != nil {
+		return err
+	}
+	return c.print(res)
+}
+
+func runSTKQuery(c *cli, args []string) error {
+	req, err := parseRequest(c, "stk query", args, func(fs *flag.FlagSet, req *c2b.USSDQueryRequest) {
+		fs.StringVar(&req.CheckoutRequestID, "checkout-request-id", "", "checkout request ID of the USSD push")
+		fs.StringVar(&req.BusinessShortCode, "short-code", "", "business short code (default MPESA_SHORT_CODE)")
+	})
+	if err != nil {
+		return err
+	}
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.USSDPaymentQuery(*req)
+	if err != nil {
+		return err
+	}
+	return c.print(res)
+}
+
+func runB2CPay(c *cli, args []string) error {
+	req, err := parseRequest(c, "b2c pay", args, func(fs *flag.FlagSet, req *b2c.B2CRequest) {
+		fs.Func("phone", "customer phone number", func(s string) error {
+			m, err := msisdn.Parse(s)
+			if err != nil {
+				return err
+			}
+			req.PartyB = uint(m.Uint64())
+			return nil
+		})
+		amountVar(fs, &req.Amount, "amount", "amount to send, in birr")
+		fs.Var(textFlag[types.CommandId]{&req.CommandID}, "command", "BusinessPayment, SalaryPayment or PromotionPayment (default BusinessPayment)")
+		fs.StringVar(&req.Remarks, "remarks", "", "remarks (default \"Payout\")")
+		fs.StringVar(&req.Occasion, "occasion", "", "occasion (default the remarks)")
+		fs.StringVar(&req.OriginatorConversationID, "originator-conversation-id", "", "originator conversation ID (default a new UUID)")
+		fs.BoolVar(&req.AllowDuplicate, "allow-duplicate", false, "send the payout even if the duplicate guard refuses it")
+		fs.StringVar(&req.ExpectedName, "expected-name", "", "refuse the payout when the customer is not registered with a similar name")
+	})
+	if err != nil {
+		return err
+	}
+	orDefault(&req.CommandID, types.BusinessPaymentCommand)
+	orDefault(&req.Remarks, "Payout")
+	orDefault(&req.Occasion, req.Remarks)
+	orNewID(&req.OriginatorConversationID)
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.MakeB2CPaymentRequest(*req)
+	if err != nil {
+		return err
+	}
+	return c.print(res)
+}
+
+func runNameCheck(c *cli, args []string) error {
+	req, err := parseRequest(c, "name-check", args, func(fs *flag.FlagSet, req *kyc.NameCheckRequest) {
+		fs.StringVar(&req.Msisdn, "phone", "", "customer phone number")
+		fs.StringVar(&req.OriginatorConversationID, "originator-conversation-id", "", "originator conversation ID (default a new UUID)")
+	})
+	if err != nil {
+		return err
+	}
+	orNewID(&req.OriginatorConversationID)
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.CheckCustomerName(*req)
+	if err != nil {
+		return err
+	}
+	return c.print(res)
+}
+
+func runReversal(c *cli, args []string) error {
+	req, err := parseRequest(c, "reversal", args, func(fs *flag.FlagSet, req *transaction.TransactionReversalRequest) {
+		fs.StringVar(&req.TransactionID, "transaction-id", "", "ID of the transaction to reverse")
+		amountVar(fs, &req.Amount, "amount", "amount of the transaction, in birr")
+		fs.StringVar(&req.PartyA, "receiver", "", "party that received the transaction (default MPESA_SHORT_CODE)")
+		fs.Var(textFlag[types.IdentifierType]{&req.IdentifierType}, "identifier-type", "type of the receiver, 1 MSISDN, 2 till or 4 short code (default 4)")
+		fs.StringVar(&req.Remarks, "remarks", "", "remarks")
+		fs.StringVar(&req.Occasion, "occasion", "", "occasion")
+		fs.StringVar(&req.OriginatorConversationID, "originator-conversation-id", "", "originator conversation ID (default a new UUID)")
+	})
+	if err != nil {
+		return err
+	}
+	req.CommandID = types.TransactionReversalCommand
+	orDefault(&req.IdentifierType, types.ShortCodeIdentifierType)
+	orNewID(&req.OriginatorConversationID)
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.MakeTransactionReversalRequest(*req)
+	if err != nil {
+		return err
+	}
+	return c.print(res)
+}
+
+func runStatus(c *cli, args []string) error {
+	req, err := parseRequest(c, "status", args, func(fs *flag.FlagSet, req *transaction.TransactionStatusRequest) {
+		fs.StringVar(&req.TransactionID, "transaction-id", "", "ID of the transaction")
+		fs.StringVar(&req.OriginalConversationID, "original-conversation-id", "", "originator conversation ID of the request, instead of the transaction ID")
+		fs.StringVar(&req.PartyA, "party", "", "party of the transaction (default MPESA_SHORT_CODE)")
+		fs.Var(textFlag[types.IdentifierType]{&req.IdentifierType}, "identifier-type", "type of the party, 1 MSISDN, 2 till or 4 short code (default 4)")
+		fs.StringVar(&req.Remarks, "remarks", "", "remarks")
+		fs.StringVar(&req.Occasion, "occasion", "", "occasion (default \"Transaction status\")")
+		fs.StringVar(&req.OriginatorConversationID, "originator-conversation-id", "", "originator conversation ID (default a new UUID)")
+	})
+	if err != nil {
+		return err
+	}
+	req.CommandID = types.TransactionStatusCommand
+	orDefault(&req.IdentifierType, types.ShortCodeIdentifierType)
+	orDefault(&req.Occasion, "Transaction status")
+	orNewID(&req.OriginatorConversationID)
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.MakeTransactionStatusQuery(*req)
+	if err != nil {
+		return err
+	}
+	return c.print(res)
+}
+
+func runBalance(c *cli, args []string) error {
+	req, err := parseRequest(c, "balance", args, func(fs *flag.FlagSet, req *account.AccountBalanceRequest) {
+		fs.Var(textFlag[types.IdentifierType]{&req.IdentifierType}, "identifier-type", "type of the party, 2 till or 4 short code (default 4)")
+		fs.StringVar(&req.Remarks, "remarks", "", "remarks")
+		fs.StringVar(&req.OriginatorConversationID, "originator-conversation-id", "", "originator conversation ID (default a new UUID)")
+	})
+	if err != nil {
+		return err
+	}
+	req.CommandID = types.AccountBalanceCommand
+	orDefault(&req.IdentifierType, types.ShortCodeIdentifierType)
+	orNewID(&req.OriginatorConversationID)
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.MakeAccountBalanceQuery(*req)
+	if err != nil {
+		return err
+	}
+	return c.print(res)
+}
+
+func runRegisterURL(c *cli, args []string) error {
+	req, err := parseRequest(c, "c2b register-url", args, func(fs *flag.FlagSet, req *c2b.RegisterC2BURLRequest) {
+		fs.StringVar(&req.ConfirmationURL, "confirmation-url", "", "confirmation url")
+		fs.StringVar(&req.ValidationURL, "validation-url", "", "validation url")
+		fs.Var(textFlag[types.ResponseType]{&req.ResponseType}, "response-type", "outcome when the validation url is unreachable, Completed or Cancelled (default Completed)")
+		fs.StringVar(&req.ShortCode, "short-code", "", "short code (default MPESA_SHORT_CODE)")
+	})
+	if err != nil {
+		return err
+	}
+	req.CommandID = types.RegisterURLCommand
+	orDefault(&req.ResponseType, types.CompletedResponse)
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.RegisterNewURL(*req)
+	if err != nil {
+		return err
+	}
+	return c.print(res)
+}
+
+func runSimulate(c *cli, args []string) error {
+	req, err := parseRequest(c, "c2b simulate", args, func(fs *flag.FlagSet, req *c2b.SimulateCustomerInititatedPayment) {
+		fs.StringVar(&req.Msisdn, "phone", "", "paying customer phone number")
+		amountVar(fs, &req.Amount, "amount", "amount to pay, in birr")
+		fs.StringVar(&req.BillRefNumber, "bill-ref", "", "bill reference number")
+		fs.Var(textFlag[types.CommandId]{&req.CommandID}, "command", "CustomerPayBillOnline or CustomerBuyGoodsOnline (default CustomerPayBillOnline)")
+		fs.StringVar(&req.ShortCode, "short-code", "", "short code (default MPESA_SHORT_CODE)")
+	})
+	if err != nil {
+		return err
+	}
+	orDefault(&req.CommandID, types.CustomerPayBillOnlineCommand)
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.SimulateCustomerInitiatedPayment(*req)
+	if err != nil {
+		return err
+	}
+	return c.print(res)
+}
+
+func runDynamicQR(c *cli, args []string) error {
+	var out string
+	req, err := parseRequest(c, "c2b qr", args, func(fs *flag.FlagSet, req *c2b.DynamicQRRequest) {
+		fs.StringVar(&req.MerchantName, "merchant-name", "", "merchant name shown to the customer")
+		fs.StringVar(&req.RefNo, "reference", "", "reference of the payment")
+		amountVar(fs, &req.Amount, "amount", "amount to pay, in birr")
+		fs.Var(textFlag[types.QRTransactionCode]{&req.TrxCode}, "code", "transaction code, BG, PB, WA, SM or SB (default PB)")
+		fs.StringVar(&req.CPI, "cpi", "", "till, short code or phone number receiving the payment (default MPESA_SHORT_CODE)")
+		fs.StringVar(&req.Size, "size", "", "width of the image in pixels (default 300)")
+		fs.StringVar(&out, "out", "", "write the PNG image to a file, the printed QRCode is then the file")
+	})
+	if err != nil {
+		return err
+	}
+	orDefault(&req.TrxCode, types.PayBillQRCode)
+
+	app, err := c.app()
+	if err != nil {
+		return err
+	}
+	res, err := app.GenerateDynamicQR(*req)
+	if err != nil {
+		return err
+	}
+	if out != "" {
+		data, err := res.PNG()
+		if err != nil {
+			return fmt.Errorf("invalid QR code image: %w", err)
+		}
+		if err := os.WriteFile(out, data, 0o644); err != nil {
+			return fmt.Errorf("unable to save the QR code: %w", err)
+		}
+		res.QRCode = out
+	}
+	return c.print(res)
+}
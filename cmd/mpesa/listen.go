@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/store"
+)
+
+// listener: receives the callbacks of `mpesa listen`.
+//
+// Fields:
+//   - c: The invocation, the callbacks are printed on its stdout.
+//   - session: The requests sent from the CLI, nil when the session is disabled.
+//   - forward: The url of the local application receiving a copy of every callback, nil when not set.
+//   - saveDir: The directory of the raw callbacks, empty when they are not saved.
+//   - client: Forwards the callbacks.
+//   - now: Returns the current time.
+type listener struct {
+	c       *cli
+	session *session
+	forward *url.URL
+	saveDir string
+	client  *http.Client
+	now     func() time.Time
+
+	mu  sync.Mutex
+	seq int
+}
+
+// received: a callback printed by the listener, it is also the JSON output.
+type received struct {
+	Received  time.Time     `json:"received"`
+	Path      string        `json:"path"`
+	Kind      callback.Kind `json:"kind"`
+	Code      string        `json:"code,omitempty"`
+	Keys      store.Keys    `json:"keys"`
+	Request   *store.Record `json:"request,omitempty"`
+	File      string        `json:"file,omitempty"`
+	Forwarded string        `json:"forwarded,omitempty"`
+	Callback  interface{}   `json:"callback"`
+	raw       []byte
+}
+
+func runListen(c *cli, args []string) error {
+	fs := flag.NewFlagSet("mpesa listen", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	forward := fs.String("forward", "", "url of a local application receiving a copy of every callback, its path is the one of the callback when empty")
+	saveDir := fs.String("save", "", "directory saving the raw callbacks, for replay")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	l := &listener{c: c, saveDir: *saveDir, client: &http.Client{Timeout: 30 * time.Second}, now: time.Now}
+	if c.session != "" {
+		l.session = &session{path: c.session}
+	}
+	if *forward != "" {
+		u, err := url.Parse(*forward)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid forward url %q", *forward)
+		}
+		l.forward = u
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stderr, "listening for callbacks on http://%v, press Ctrl+C to stop\n", ln.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	srv := &http.Server{Handler: l, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP decodes the callback with the SDK handlers, then saves, forwards and prints
+// it. M-Pesa gets the acknowledgement of the SDK handlers, or a 500 when the callback
+// cannot be saved or the application it is forwarded to rejects it, so that it is sent
+// again.
+func (l *listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		callback.Handlers{}.ServeHTTP(w, r)
+		return
+	}
+	raw, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, "unable to read the callback", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+
+	rec := &received{Received: l.now(), Path: r.URL.RequestURI(), raw: raw}
+	handlers := callback.Handlers{
+		OnResult: func(ctx context.Context, res *callback.Result) error {
+			rec.Kind, rec.Callback = callback.KindResult, res
+			return l.handle(ctx, rec)
+		},
+		OnSTK: func(ctx context.Context, cb *callback.STKCallback) error {
+			rec.Kind, rec.Callback = callback.KindSTK, cb
+			return l.handle(ctx, rec)
+		},
+		OnConfirmation: func(ctx context.Context, c *callback.C2BConfirmation) error {
+			rec.Kind, rec.Callback = callback.KindConfirmation, c
+			return l.handle(ctx, rec)
+		},
+	}
+	handlers.ServeHTTP(w, r)
+	if rec.Kind == "" {
+		fmt.Fprintf(l.c.stderr, "%v ignored a payload on %v that is not a callback\n", rec.Received.Format(time.TimeOnly), rec.Path)
+	}
+}
+
+// handle: matches, saves, forwards and prints a decoded callback.
+func (l *listener) handle(ctx context.Context, rec *received) error {
+	if r, err := store.CallbackRecord(rec.raw, nil); err == nil {
+		rec.Keys, rec.Code = r.Keys, r.Code
+	}
+	if l.session != nil {
+		request, err := l.session.request(ctx, rec.Keys)
+		if err != nil {
+			fmt.Fprintf(l.c.stderr, "unable to read the session: %v\n", err)
+		}
+		if request != nil {
+			// the redacted body is of no use next to the callback
+			request.Body = nil
+		}
+		rec.Request = request
+	}
+
+	var errs []error
+	if l.saveDir != "" {
+		file, err := l.save(rec)
+		rec.File = file
+		errs = append(errs, err)
+	}
+	if l.forward != nil {
+		status, err := l.forwardTo(ctx, rec)
+		rec.Forwarded = status
+		errs = append(errs, err)
+	}
+	l.print(rec)
+	return errors.Join(errs...)
+}
+
+// save: writes the raw callback to a new file of the save directory, named after its
+// reception time and kind so that the files sort in reception order.
+func (l *listener) save(rec *received) (string, error) {
+	l.mu.Lock()
+	l.seq++
+	seq := l.seq
+	l.mu.Unlock()
+
+	if err := os.MkdirAll(l.saveDir, 0o700); err != nil {
+		return "", fmt.Errorf("unable to create the save directory: %w", err)
+	}
+	name := fmt.Sprintf("%v-%04d-%v.json", rec.Received.UTC().Format("20060102T150405.000000000"), seq, rec.Kind)
+	path := filepath.Join(l.saveDir, name)
+	if err := os.WriteFile(path, rec.raw, 0o600); err != nil {
+		return "", fmt.Errorf("unable to save the callback: %w", err)
+	}
+	return path, nil
+}
+
+// forwardTo: posts the raw callback to the local application, to the path of the
+// callback when the forward url has none. It returns the HTTP status of the application.
+func (l *listener) forwardTo(ctx context.Context, rec *received) (string, error) {
+	target := *l.forward
+	if target.Path == "" || target.Path == "/" {
+		path, query, _ := strings.Cut(rec.Path, "?")
+		target.Path, target.RawQuery = path, query
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(rec.raw))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := l.client.Do(req)
+	if err != nil {
+		return "failed", fmt.Errorf("unable to forward the callback: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return res.Status, fmt.Errorf("the application answered %v", res.Status)
+	}
+	return res.Status, nil
+}
+
+// print: writes a callback to stdout, as a summary followed by the indented callback, or
+// as a JSON line with -output json.
+func (l *listener) print(rec *received) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := l.c.stdout
+
+	if l.c.output == "json" {
+		_ = json.NewEncoder(out).Encode(rec)
+		return
+	}
+
+	fmt.Fprintf(out, "%v %v callback on %v", rec.Received.Format(time.TimeOnly), rec.Kind, rec.Path)
+	if rec.Code != "" {
+		fmt.Fprintf(out, ", ResultCode %v", rec.Code)
+	}
+	fmt.Fprintln(out)
+	if rec.Request != nil {
+		fmt.Fprintf(out, "  answers %v sent at %v\n", rec.Request.Operation, rec.Request.CreatedAt.Format(time.TimeOnly))
+	} else if l.session != nil {
+		fmt.Fprintln(out, "  answers no request of the session")
+	}
+	if rec.File != "" {
+		fmt.Fprintf(out, "  saved to %v\n", rec.File)
+	}
+	if rec.Forwarded != "" {
+		fmt.Fprintf(out, "  forwarded to %v: %v\n", l.forward, rec.Forwarded)
+	}
+	data, err := json.MarshalIndent(rec.Callback, "  ", "  ")
+	if err != nil {
+		data = rec.raw
+	}
+	fmt.Fprintf(out, "  %s\n\n", data)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// app: a local application receiving the forwarded callbacks.
+type app struct {
+	*httptest.Server
+	status int
+	mu     sync.Mutex
+	paths  []string
+	bodies [][]byte
+}
+
+func newApp(t *testing.T, status int) *app {
+	a := &app{status: status}
+	a.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		a.mu.Lock()
+		a.paths = append(a.paths, r.URL.Path)
+		a.bodies = append(a.bodies, body)
+		a.mu.Unlock()
+		w.WriteHeader(a.status)
+	}))
+	t.Cleanup(a.Close)
+	return a
+}
+
+// syncBuffer: a buffer written by the listener while the test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	return u
+}
+
+func TestListen(t *testing.T) {
+	srv := setup(t)
+	forward := newApp(t, http.StatusOK)
+	saveDir := t.TempDir()
+
+	var stdout, stderr syncBuffer
+	c := &cli{stdout: &stdout, stderr: &stderr, output: "table", session: os.Getenv(sessionEnv)}
+	l := &listener{c: c, session: &session{path: c.session}, saveDir: saveDir, client: http.DefaultClient, now: time.Now}
+	l.forward = mustParseURL(t, forward.URL)
+	ln := httptest.NewServer(l)
+	defer ln.Close()
+	t.Setenv("MPESA_CALLBACK_URL", ln.URL+"/mpesa/stk")
+
+	code, out, errOut := execute("", "-output", "json", "stk", "push", "-phone", "0712345678", "-amount", "10", "-reference", "INV-42")
+	require.Equal(t, exitOK, code, errOut)
+	var res struct{ CheckoutRequestID string }
+	require.NoError(t, json.Unmarshal([]byte(out), &res))
+	srv.WaitForCallbacks()
+
+	printed := stdout.String()
+	assert.Contains(t, printed, "stk callback on /mpesa/stk, ResultCode 0")
+	assert.Contains(t, printed, "answers ussd_push sent at")
+	assert.Contains(t, printed, res.CheckoutRequestID)
+	assert.Contains(t, printed, "forwarded to "+forward.URL+": 200 OK")
+
+	// the saved and forwarded payloads are the bytes M-Pesa sent
+	deliveries := srv.Deliveries()
+	require.Len(t, deliveries, 1)
+	files, err := filepath.Glob(filepath.Join(saveDir, "*-stk.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	saved, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, deliveries[0].Body, saved)
+	forward.mu.Lock()
+	defer forward.mu.Unlock()
+	require.Len(t, forward.bodies, 1)
+	assert.Equal(t, deliveries[0].Body, forward.bodies[0])
+	assert.Equal(t, "/mpesa/stk", forward.paths[0])
+}
+
+func TestListener_ServeHTTP(t *testing.T) {
+	result := `{"Result":{"ResultType":0,"ResultCode":2001,"ResultDesc":"The initiator information is invalid.",` +
+		`"OriginatorConversationID":"ocid-1","ConversationID":"AG_1","TransactionID":"RBL81HI0TQ"}}`
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		forward int
+		stdout  []string
+		stderr  string
+	}{
+		{name: "unknown request", body: result, status: http.StatusOK,
+			stdout: []string{"result callback on /result, ResultCode 2001", "answers no request of the session", "RBL81HI0TQ"}},
+		{name: "rejected by the application", body: result, status: http.StatusInternalServerError, forward: http.StatusBadGateway,
+			stdout: []string{"502 Bad Gateway"}},
+		{name: "not a callback", body: `{"hello":"world"}`, status: http.StatusBadRequest, stderr: "not a callback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			c := &cli{stdout: &stdout, stderr: &stderr, output: "table"}
+			l := &listener{c: c, session: &session{path: filepath.Join(t.TempDir(), "session.jsonl")}, client: http.DefaultClient, now: time.Now}
+			if tt.forward != 0 {
+				l.forward = mustParseURL(t, newApp(t, tt.forward).URL)
+			}
+
+			w := httptest.NewRecorder()
+			l.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/result", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.status, w.Code)
+			for _, want := range tt.stdout {
+				assert.Contains(t, stdout.String(), want)
+			}
+			assert.Contains(t, stderr.String(), tt.stderr)
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var stdout bytes.Buffer
+		l := &listener{c: &cli{stdout: &stdout, stderr: io.Discard, output: "json"}, client: http.DefaultClient, now: time.Now}
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/result", strings.NewReader(result)))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var line struct {
+			Kind     callback.Kind
+			Code     string
+			Callback callback.Result
+		}
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &line))
+		assert.Equal(t, callback.KindResult, line.Kind)
+		assert.Equal(t, "2001", line.Code)
+		assert.Equal(t, "AG_1", line.Callback.Result.ConversationID)
+	})
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	stk := `{"Body":{"stkCallback":{"MerchantRequestID":"m-1","CheckoutRequestID":"ws_CO_1","ResultCode":1032,"ResultDesc":"Request cancelled by user"}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1-stk.json"), []byte(stk), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2-result.json"), []byte(`{"Result":{"ResultCode":0,"ConversationID":"AG_1"}}`), 0o600))
+	target := newApp(t, http.StatusOK)
+
+	code, stdout, stderr := execute("", "replay", "-from", dir, "-code", "1032", "-dry-run")
+	require.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "1-stk.json")
+	assert.Contains(t, stdout, "dry run")
+	assert.NotContains(t, stdout, "2-result.json")
+	assert.Empty(t, target.bodies)
+
+	code, stdout, stderr = execute("", "replay", "-from", dir, "-operation", "stk,result", "-to", target.URL)
+	require.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, "delivered (200)")
+	target.mu.Lock()
+	assert.Len(t, target.bodies, 2)
+	assert.Contains(t, target.bodies, []byte(stk))
+	target.mu.Unlock()
+
+	code, _, stderr = execute("", "replay", "-from", dir)
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "-to or -dry-run")
+}
@@ -0,0 +1,165 @@
+// Command mpesa calls the M-Pesa API from the command line, it is meant for support and
+// operations staff investigating a payment without writing Go.
+//
+// Usage:
+//
+//	mpesa [global flags] <command> [flags]
+//
+// Commands:
+//   - token: prints an access token, useful to check the credentials.
+//   - stk push / stk query: sends a USSD push (STK) payment prompt, queries its outcome.
+//   - b2c pay: sends money from the business to a customer.
+//   - name-check: prints the name a customer is registered with.
+//   - reversal: reverses a completed transaction.
+//   - status: queries the status of a transaction.
+//   - balance: queries the balance of the account.
+//   - c2b register-url / c2b simulate: registers the C2B urls, simulates a customer payment.
+//   - c2b qr: generates a QR code the customer scans to pay a till or a paybill.
+//
+// The configuration is the one of config.NewFromEnv, the `MPESA_` prefixed environment
+// variables, or a profile of a configuration file given with -config (see config.LoadFile).
+// Every request command takes its fields as flags or as a JSON request file with -file
+// ("-" reads the standard input), flags override the values of the file. The response is
+// printed as a table, or as JSON with -output json.
+//
+// The requests sent are recorded, redacted, in a session file (see -session) so that
+// `mpesa listen`, a local callback receiver for development, can tell which request each
+// callback answers.
+//
+// Example:
+//
+//	export MPESA_CONSUMER_KEY=... MPESA_CONSUMER_SECRET=... MPESA_SHORT_CODE=1020
+//	mpesa stk push -phone 0712345678 -amount 10 -reference INV-42
+//	mpesa -output json status -transaction-id RBL81HI0TQ
+//	mpesa b2c pay -file payout.json -amount 250.50
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/config"
+)
+
+// Exit codes of the command.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errUsage: returned by a command whose arguments are invalid, the usage is already printed.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// cli: the state shared by the commands of one invocation.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	// output is the format of the responses, "table" or "json".
+	output string
+	// configFile and profile select a configuration file instead of the environment.
+	configFile, profile string
+	// baseURL replaces the environment URL when set.
+	baseURL string
+	// session is the file recording the requests sent, for `mpesa listen`, empty to disable.
+	session string
+	// verbose sends the SDK logs to stderr at the configured level, only the output is
+	// printed otherwise.
+	verbose bool
+}
+
+// run: executes the command line args and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet("mpesa", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&c.output, "output", "table", `output format, "table" or "json"`)
+	fs.StringVar(&c.configFile, "config", "", "configuration file, the environment is used when empty")
+	fs.StringVar(&c.profile, "profile", "", "profile of the configuration file")
+	fs.StringVar(&c.baseURL, "base-url", os.Getenv(config.EnvPrefix+"BASE_URL"), "base URL replacing the one of the environment (MPESA_BASE_URL)")
+	fs.StringVar(&c.session, "session", defaultSession(), "file recording the requests sent, matched by listen to the callbacks (MPESA_SESSION), empty to disable")
+	fs.BoolVar(&c.verbose, "v", false, "print the SDK logs on stderr")
+	fs.Usage = func() { c.usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if c.output != "table" && c.output != "json" {
+		fmt.Fprintf(stderr, "mpesa: unknown output format %q\n", c.output)
+		return exitUsage
+	}
+
+	cmd, rest := lookup(fs.Args())
+	if cmd == nil {
+		c.usage(fs)
+		return exitUsage
+	}
+	if err := cmd.run(c, rest); err != nil {
+		if errors.Is(err, errUsage) {
+			return exitUsage
+		}
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		fmt.Fprintf(stderr, "mpesa %v: %v\n", cmd.name, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// usage: prints the global flags and the commands.
+func (c *cli) usage(fs *flag.FlagSet) {
+	fmt.Fprintln(c.stderr, "Usage: mpesa [global flags] <command> [flags]")
+	fmt.Fprintln(c.stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "  %-18v %v\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(c.stderr, "\nGlobal flags:")
+	fs.PrintDefaults()
+	fmt.Fprintln(c.stderr, "\nRun \"mpesa <command> -h\" for the flags of a command.")
+}
+
+// config: loads the configuration of the environment or of the configuration file.
+func (c *cli) config() (*config.Config, error) {
+	if c.configFile != "" {
+		return config.LoadFile(c.configFile, c.profile)
+	}
+	return config.NewFromEnv()
+}
+
+// app: creates the App of the configuration. The SDK logs go to stderr so that they
+// never mix with the output, and only when -v is set.
+func (c *cli) app() (*mpesagosdk.App, error) {
+	cfg, err := c.config()
+	if err != nil {
+		return nil, err
+	}
+
+	level := slog.LevelError + 1
+	if c.verbose && level.UnmarshalText([]byte(cfg.LogLevel)) != nil {
+		level = slog.LevelInfo
+	}
+	opts := []mpesagosdk.Option{
+		mpesagosdk.WithConfig(cfg),
+		mpesagosdk.WithLogHandler(slog.NewTextHandler(c.stderr, &slog.HandlerOptions{Level: level})),
+	}
+	if c.baseURL != "" {
+		opts = append(opts, mpesagosdk.WithBaseURL(strings.TrimRight(c.baseURL, "/")))
+	}
+	if c.session != "" {
+		opts = append(opts, mpesagosdk.WithStore(&session{path: c.session}))
+	}
+	return mpesagosdk.New(opts...)
+}
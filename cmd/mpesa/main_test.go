@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/mpesatest"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setup: starts a fake server and sets the environment of config.NewFromEnv for it.
+func setup(t *testing.T) *mpesatest.Server {
+	srv := mpesatest.NewServer()
+	t.Cleanup(srv.Close)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	t.Cleanup(sink.Close)
+
+	for key, value := range map[string]string{
+		"MPESA_CONSUMER_KEY":        srv.ConsumerKey,
+		"MPESA_CONSUMER_SECRET":     srv.ConsumerSecret,
+		"MPESA_BASE_URL":            srv.URL,
+		"MPESA_MAX_RETRIES":         "0",
+		"MPESA_SHORT_CODE":          "1020",
+		"MPESA_INITIATOR_NAME":      "apitest",
+		"MPESA_SECURITY_CREDENTIAL": "security-credential",
+		"MPESA_PASSKEY":             "passkey",
+		"MPESA_RESULT_URL":          sink.URL + "/result",
+		"MPESA_QUEUE_TIMEOUT_URL":   sink.URL + "/timeout",
+		"MPESA_CALLBACK_URL":        sink.URL + "/stk",
+		"MPESA_SESSION":             filepath.Join(t.TempDir(), "session.jsonl"),
+		"MPESA_NAME_CHECK_ENDPOINT": mpesatest.NameCheckPath,
+	} {
+		t.Setenv(key, value)
+	}
+	return srv
+}
+
+// execute: runs the command and returns its exit code, stdout and stderr.
+func execute(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		stdout   []string
+		stderr   string
+		endpoint string
+	}{
+		{name: "token", args: []string{"token"}, stdout: []string{"token", "Bearer "}},
+		{name: "stk push", args: []string{"stk", "push", "-phone", "0712345678", "-amount", "10", "-reference", "INV-42"},
+			stdout: []string{"CheckoutRequestID", "ResponseCode"}, endpoint: mpesatest.EndpointSTKPush},
+		{name: "b2c pay", args: []string{"b2c", "pay", "-phone", "0712345678", "-amount", "250.50"},
+			stdout: []string{"ConversationID", "OriginatorConversationID"}, endpoint: mpesatest.EndpointB2C},
+		{name: "name-check", args: []string{"name-check", "-phone", "0712345678"},
+			stdout: []string{"CustomerName", mpesatest.DefaultCustomerName}, endpoint: mpesatest.EndpointNameCheck},
+		{name: "b2c pay to another name", args: []string{"b2c", "pay", "-phone", "0712345678", "-amount", "10", "-expected-name", "Almaz Tesfaye"},
+			code: exitError, stderr: "name check: 251712345678 is registered to"},
+		{name: "status", args: []string{"status", "-transaction-id", "RBL81HI0TQ"}, stdout: []string{"ConversationID"},
+			endpoint: mpesatest.EndpointStatus},
+		{name: "reversal", args: []string{"reversal", "-transaction-id", "RBL81HI0TQ", "-amount", "100"},
+			stdout: []string{"ConversationID"}, endpoint: mpesatest.EndpointReversal},
+		{name: "balance", args: []string{"balance"}, stdout: []string{"ConversationID"}, endpoint: mpesatest.EndpointBalance},
+		{name: "c2b register-url", args: []string{"c2b", "register-url", "-confirmation-url", "https://example.com/confirm",
+			"-validation-url", "https://example.com/validate"}, endpoint: mpesatest.EndpointRegisterURL},
+		{name: "c2b simulate", args: []string{"c2b", "simulate", "-phone", "0712345678", "-amount", "100", "-bill-ref", "INV-0042"},
+			stdout: []string{"ConversationID"}, endpoint: mpesatest.EndpointSimulate},
+		{name: "c2b qr", args: []string{"c2b", "qr", "-merchant-name", "Abebe Coffee", "-reference", "INV-42", "-amount", "150"},
+			stdout: []string{"QRCode", "QR Code Successfully Generated."}, endpoint: mpesatest.EndpointDynamicQR},
+		{name: "c2b qr invalid code", args: []string{"c2b", "qr", "-merchant-name", "Abebe Coffee", "-reference", "INV-42", "-amount", "150", "-code", "XX"},
+			code: exitError, stderr: "TrxCode must be one of [BG PB WA SM SB]"},
+		{name: "validation error", args: []string{"b2c", "pay", "-amount", "10"}, code: exitError, stderr: "mpesa b2c pay:"},
+		{name: "mpesa error", args: []string{"stk", "query", "-checkout-request-id", "ws_CO_unknown"}, code: exitError,
+			stderr: "Invalid CheckoutRequestID"},
+		{name: "unknown command", args: []string{"refund"}, code: exitUsage, stderr: "Usage: mpesa"},
+		{name: "unknown flag", args: []string{"balance", "-nope"}, code: exitUsage, stderr: "flag provided but not defined"},
+		{name: "unexpected argument", args: []string{"token", "extra"}, code: exitUsage, stderr: `unexpected argument "extra"`},
+		{name: "unknown output", args: []string{"-output", "xml", "token"}, code: exitUsage, stderr: `unknown output format "xml"`},
+		{name: "help", args: []string{"status", "-h"}, code: exitOK, stderr: "-transaction-id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := setup(t)
+			srv.AddTransaction(mpesatest.Transaction{TransactionID: "RBL81HI0TQ", CommandID: string(types.BusinessPaymentCommand),
+				Amount: money.Birr(100), DebitParty: "1020", CreditParty: "251712345678"})
+			code, stdout, stderr := execute("", tt.args...)
+			require.Equal(t, tt.code, code, stderr)
+			for _, want := range tt.stdout {
+				assert.Contains(t, stdout, want)
+			}
+			assert.Contains(t, stderr, tt.stderr)
+			if tt.endpoint != "" {
+				var endpoints []string
+				for _, req := range srv.Requests() {
+					endpoints = append(endpoints, req.Endpoint)
+				}
+				assert.Contains(t, endpoints, tt.endpoint)
+			}
+		})
+	}
+}
+
+func TestRun_RequestFile(t *testing.T) {
+	srv := setup(t)
+	file := filepath.Join(t.TempDir(), "payout.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{
+	"CommandID": "SalaryPayment",
+	"Amount": 100,
+	"PartyB": 251712345678,
+	"Remarks": "Salary",
+	"Occasion": "March",
+	"OriginatorConversationID": "payroll-2024-03-0001"
+}`), 0o600))
+
+	code, stdout, stderr := execute("", "-output", "json", "b2c", "pay", "-file", file, "-amount", "250.50")
+	require.Equal(t, exitOK, code, stderr)
+
+	var res b2c.B2CSuccessResponse
+	require.NoError(t, json.Unmarshal([]byte(stdout), &res))
+	assert.Equal(t, "payroll-2024-03-0001", res.OriginatorConversatonId)
+
+	calls := srv.Requests()
+	var sent b2c.B2CRequest
+	require.NoError(t, json.Unmarshal(calls[len(calls)-1].Body, &sent))
+	assert.Equal(t, types.SalaryPaymentCommand, sent.CommandID)
+	assert.Equal(t, money.MustParse("250.50"), sent.Amount)
+	assert.Equal(t, "March", sent.Occasion)
+	assert.Equal(t, "apitest", sent.InitiatorName)
+
+	t.Run("stdin", func(t *testing.T) {
+		code, _, stderr := execute(`{"Amount": 10, "PartyB": 251712345678}`, "b2c", "pay", "-file", "-")
+		require.Equal(t, exitOK, code, stderr)
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		code, _, stderr := execute(`{"Amount": 10, "Phone": "0712345678"}`, "b2c", "pay", "-file", "-")
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, stderr, `unknown field "Phone"`)
+	})
+}
+
+func TestRun_DynamicQRFile(t *testing.T) {
+	setup(t)
+	out := filepath.Join(t.TempDir(), "till.png")
+
+	code, stdout, stderr := execute("", "c2b", "qr", "-merchant-name", "Abebe Coffee", "-reference", "INV-42",
+		"-amount", "150", "-code", "BG", "-cpi", "373132", "-out", out)
+	require.Equal(t, exitOK, code, stderr)
+	assert.Contains(t, stdout, out)
+
+	f, err := os.Open(out)
+	require.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	require.NoError(t, err)
+	assert.Equal(t, img.Bounds().Dx(), img.Bounds().Dy())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/replay"
+)
+
+func runReplay(c *cli, args []string) error {
+	fs := flag.NewFlagSet("mpesa replay", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	var paths []string
+	var filter replay.Filter
+	fs.Func("from", "callback file or directory of callback files, such as the -save directory of listen (repeatable)", func(s string) error {
+		paths = append(paths, s)
+		return nil
+	})
+	to := fs.String("to", "", "url receiving the callbacks")
+	dryRun := fs.Bool("dry-run", false, "list the callbacks without sending them")
+	fs.Func("since", "oldest reception time, RFC 3339 or 2006-01-02", timeFlag(&filter.Since))
+	fs.Func("until", "reception time the callbacks must be older than, RFC 3339 or 2006-01-02", timeFlag(&filter.Until))
+	fs.Func("operation", "comma separated callback kinds (result, stk, confirmation) to replay", listFlag(&filter.Operations))
+	fs.Func("code", "comma separated ResultCodes to replay", listFlag(&filter.ResultCodes))
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if len(paths) == 0 || (*to == "" && !*dryRun) {
+		fmt.Fprintln(c.stderr, "-from and either -to or -dry-run are required")
+		fs.Usage()
+		return errUsage
+	}
+
+	callbacks, loadErr := replay.FromFiles(filter, paths...)
+	if loadErr != nil && callbacks == nil {
+		return loadErr
+	}
+	if loadErr != nil {
+		fmt.Fprintf(c.stderr, "skipped: %v\n", loadErr)
+	}
+
+	r := &replay.Replayer{URL: *to, DryRun: *dryRun}
+	outcomes, err := r.Replay(context.Background(), callbacks)
+	if err != nil {
+		return err
+	}
+	if err := c.printOutcomes(outcomes); err != nil {
+		return err
+	}
+	for _, o := range outcomes {
+		if o.Error != "" {
+			return errors.New("some callbacks were not delivered")
+		}
+	}
+	return nil
+}
+
+// printOutcomes: writes the outcome of every replayed callback.
+func (c *cli) printOutcomes(outcomes []replay.Outcome) error {
+	if c.output == "json" {
+		if outcomes == nil {
+			outcomes = []replay.Outcome{}
+		}
+		data, err := json.MarshalIndent(outcomes, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(c.stdout, string(data))
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tKIND\tCODE\tRECEIVED\tOUTCOME")
+	for _, o := range outcomes {
+		outcome := "dry run"
+		switch {
+		case o.Error != "":
+			outcome = o.Error
+		case !o.DryRun:
+			outcome = fmt.Sprintf("delivered (%d)", o.Status)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", o.Callback.Source, o.Callback.Kind, o.Callback.Code,
+			o.Callback.ReceivedAt.Format(time.RFC3339), outcome)
+	}
+	return w.Flush()
+}
+
+// timeFlag: parses an RFC 3339 time or a date into p.
+func timeFlag(p *time.Time) func(string) error {
+	return func(s string) error {
+		for _, layout := range []string{time.RFC3339, time.DateOnly} {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				*p = t
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid time %q", s)
+	}
+}
+
+// listFlag: parses a comma separated list into p.
+func listFlag(p *[]string) func(string) error {
+	return func(s string) error {
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/coleYab/mpesagosdk/store"
+)
+
+// sessionEnv: the environment variable of the session file, see defaultSession.
+const sessionEnv = "MPESA_SESSION"
+
+// defaultSession: returns the session file of the environment, or the one of the user
+// cache directory. It is empty, disabling the session, when neither is known.
+func defaultSession() string {
+	if path, ok := os.LookupEnv(sessionEnv); ok {
+		return path
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mpesa", "session.jsonl")
+}
+
+// session is a store.Store appending the records to a JSON lines file, it is how the
+// requests sent by one invocation are found by `mpesa listen` running in another. The
+// records are redacted by the App before they are saved.
+type session struct {
+	mu   sync.Mutex
+	path string
+}
+
+// Save appends the record to the file.
+func (s *session) Save(_ context.Context, r *store.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("unable to create the session directory: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open the session: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to save the record: %w", err)
+	}
+	return f.Close()
+}
+
+// Find reads the file and returns the records selected by the query, a missing file has
+// no record. The file is read on every call so that the records saved by other
+// invocations are found.
+func (s *session) Find(ctx context.Context, q store.Query) ([]store.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the session: %w", err)
+	}
+	defer f.Close()
+
+	records := store.NewMemoryStore()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var r store.Record
+		// a line cut by a concurrent write is skipped
+		if json.Unmarshal(scanner.Bytes(), &r) != nil {
+			continue
+		}
+		if err := records.Save(ctx, &r); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read the session: %w", err)
+	}
+	return records.Find(ctx, q)
+}
+
+// request: returns the first record, the request or its response, of the session sharing
+// an identifier with keys. It is nil when the request was not sent from the session.
+func (s *session) request(ctx context.Context, keys store.Keys) (*store.Record, error) {
+	for _, key := range []store.Keys{
+		{OriginatorConversationID: keys.OriginatorConversationID},
+		{ConversationID: keys.ConversationID},
+		{MerchantRequestID: keys.MerchantRequestID},
+		{CheckoutRequestID: keys.CheckoutRequestID},
+	} {
+		if key == (store.Keys{}) {
+			continue
+		}
+		found, err := s.Find(ctx, store.Query{Keys: key, Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			return &found[0], nil
+		}
+	}
+	return nil, nil
+}
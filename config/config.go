@@ -4,6 +4,7 @@
 // The package supports the following features:
 //	- Creates a default configuration via the `New` function.
 //	- Loads configuration from environment variables via the `NewFromEnv` function.
+//	- Loads configuration profiles from YAML or JSON files via the `LoadFile` function.
 //	- Provides functions to read environment variables safely with fallback values for various types (string, int).
 //	- Validates important configuration fields like the consumer key and secret.
 //
@@ -13,6 +14,11 @@
 //	config := config.New("your-consumer-secret", "your-consumer-key", "DEBUG")
 //	fmt.Println(config.MaxRetries)
 //
+//	// Validating a hand written configuration, every problem is reported at once
+//	if err := config.Validate(); err != nil {
+//	    log.Fatalf("invalid config: %v", err)
+//	}
+//
 //	// Loading configuration from environment variables
 //	config, err := config.NewFromEnv()
 //	if err != nil {
@@ -21,22 +27,56 @@
 //	fmt.Println(config.Timeout)
 //
 // Environment Variables:
-// The `NewFromEnv` function will automatically load the following environment variables:
-//	- `MAX_CONCURRENT_CONN`: The maximum number of concurrent connections (default: 1000).
-//	- `MAX_RETRIES`: The maximum number of retries for failed requests (default: 3).
-//	- `TIMEOUT`: The timeout duration for requests in seconds (default: 5).
-//	- `CONSUMER_SECRET`: The consumer secret for authentication (must be set).
-//	- `CONSUMER_KEY`: The consumer key for authentication (must be set).
-//	- `LOG_LEVEL`: The logging level (default: "DEBUG").
-//	- `ENVIROMENT`: The environment ("SANDBOX" or "PRODUCTION", default: "SANDBOX").
+// The `NewFromEnv` function will automatically load the following environment variables, the
+// `MPESA_` prefixed name wins over the legacy unprefixed one when both are set:
+//	- `MPESA_MAX_CONCURRENT_CONN` (`MAX_CONCURRENT_CONN`): The maximum number of concurrent connections (default: 1000).
+//	- `MPESA_MAX_RETRIES` (`MAX_RETRIES`): The maximum number of retries for failed requests (default: 3).
+//	- `MPESA_TIMEOUT` (`TIMEOUT`): The timeout for requests, in seconds or as a Go duration like "1500ms" (default: 5).
+//	- `MPESA_CONSUMER_SECRET` (`CONSUMER_SECRET`): The consumer secret for authentication (must be set).
+//	- `MPESA_CONSUMER_KEY` (`CONSUMER_KEY`): The consumer key for authentication (must be set).
+//	- `MPESA_LOG_LEVEL` (`LOG_LEVEL`): The logging level (default: "INFO", as Default).
+//	- `MPESA_ENVIRONMENT` (`ENVIROMENT`): The environment ("SANDBOX" or "PRODUCTION", default: "SANDBOX").
+//	- `MPESA_DUPLICATE_WINDOW`: The duplicate payout window, in seconds or as a Go duration like "24h" (default: disabled).
+//	- `MPESA_NAME_CHECK_ENDPOINT`: The path of the customer name check API, it has no default (see kyc.ErrNoEndpoint).
+//	- `MPESA_SHORT_CODE`, `MPESA_INITIATOR_NAME`, `MPESA_SECURITY_CREDENTIAL`, `MPESA_PASSKEY`,
+//	  `MPESA_RESULT_URL`, `MPESA_QUEUE_TIMEOUT_URL`, `MPESA_CALLBACK_URL`: The request defaults (optional).
+//	- `MPESA_LIMITS`: The transaction limits as JSON, such as `{"daily_cap": 300000}` (see types.Limits).
+//
+// Configuration Files:
+// The `LoadFile` function reads YAML or JSON files with named profiles (sandbox, production,
+// one per merchant...). Any value of a profile can be overridden with the `MPESA_` prefixed
+// environment variables above and secrets can be given as `file:/path` or `env:NAME` references.
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/dedupe"
+	"github.com/coleYab/mpesagosdk/redact"
+	"github.com/coleYab/mpesagosdk/store"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+const (
+	// Sandbox selects the M-Pesa sandbox environment.
+	Sandbox = "SANDBOX"
+	// Production selects the M-Pesa production environment.
+	Production = "PRODUCTION"
 )
 
+// redacted is printed in place of secrets by String and LogValue.
+const redacted = "[REDACTED]"
+
 // Config holds the configuration values for the SDK.
 // It includes fields for authentication, retries, timeouts,
 // logging, and environment settings.
@@ -45,8 +85,8 @@ type Config struct {
 	MaxConcurrentConn int
 	// Maximum number of retry attempts for failed requests
 	MaxRetries int
-	// Timeout duration for requests in seconds
-	Timeout int
+	// Timeout for a single request attempt
+	Timeout time.Duration
 	// Consumer secret for authentication
 	ConsumerSecret string
 	// Consumer key for authentication
@@ -55,13 +95,56 @@ type Config struct {
 	LogLevel string
 	// Environment ("PRODUCTION" or "SANDBOX")
 	Enviroment string
+	// BaseURL replaces the environment URL when set, e.g. to point the SDK to a proxy
+	// or to the mpesatest fake server
+	BaseURL string
+	// HTTPClient is used for every request when set, otherwise a client is built
+	// from Timeout and MaxConcurrentConn
+	HTTPClient *http.Client
+	// Logger receives every SDK log line when set, LogLevel is then ignored and the
+	// level, format and destination are the ones of its handler
+	Logger *slog.Logger
+	// Redactor masks phone numbers and secrets in logs and dumps, redact.Default() is used when nil
+	Redactor *redact.Redactor
+	// DumpWire logs every HTTP request and response, redacted, at DEBUG level
+	DumpWire bool
+	// Defaults are the party and callback settings applied to requests that leave them empty
+	Defaults types.Defaults
+	// Limits are the transaction limits checked before a transfer is sent, the zero value checks nothing
+	Limits types.Limits
+	// DuplicateWindow enables the duplicate payout guard when positive, a payout repeating
+	// one sent within the window is refused (see the dedupe package)
+	DuplicateWindow time.Duration
+	// DuplicateStore keeps the payout fingerprints of the guard, a dedupe.MemoryStore is used when nil
+	DuplicateStore dedupe.Store
+	// Store records the requests, their responses and errors, redacted, nothing is recorded when nil
+	Store store.Store
+	// NameCheckEndpoint is the path of the customer name check API, the name checks fail when empty
+	NameCheckEndpoint string
+	// NameMatchThreshold is the minimum similarity of the expected and registered names of a
+	// checked payout recipient, kyc.DefaultThreshold when zero
+	NameMatchThreshold float64
 }
 
-// New creates a new configuration instance with the provided consumer key, secret, and log level.
-// It uses default values for the other configuration parameters:
+// Default creates a configuration with every optional value set to its default and
+// no credentials. It is the starting point used by the functional options of the SDK.
 //	- Timeout: 5 seconds
 //	- MaxRetries: 3
 //	- MaxConcurrentConn: 1000
+//	- LogLevel: "INFO"
+//	- Enviroment: "SANDBOX"
+func Default() *Config {
+	return &Config{
+		LogLevel:          "INFO",
+		Enviroment:        Sandbox,
+		Timeout:           5 * time.Second,
+		MaxRetries:        3,
+		MaxConcurrentConn: 1000,
+	}
+}
+
+// New creates a new configuration instance with the provided consumer key, secret, and log level.
+// It uses the values of Default for the other configuration parameters.
 //
 // Parameters:
 //	- consumerSecret: The consumer secret for API authentication.
@@ -71,14 +154,11 @@ type Config struct {
 // Returns:
 //	- A pointer to the Config instance with the provided and default values.
 func New(consumerSecret, consumerKey string, logLevel string) *Config {
-	return &Config{
-		ConsumerSecret:    consumerSecret,
-		ConsumerKey:       consumerKey,
-		LogLevel:          logLevel,
-		Timeout:           5,
-		MaxRetries:        3,
-		MaxConcurrentConn: 1000,
-	}
+	cfg := Default()
+	cfg.ConsumerSecret = consumerSecret
+	cfg.ConsumerKey = consumerKey
+	cfg.LogLevel = logLevel
+	return cfg
 }
 
 // getEnv: is a helper function that retrieves an environment variable's value
@@ -117,6 +197,25 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+// getEnvDuration: is a helper function that retrieves an environment variable's value
+// as a duration. Plain integers are read as seconds and anything else is parsed with
+// time.ParseDuration. If the parsing fails or the variable is not set, it returns the fallback value.
+//
+// Parameters:
+//	- key: The environment variable key.
+//	- fallback: The fallback duration to return if the environment variable is not found or invalid.
+//
+// Returns:
+//	- The duration value of the environment variable or the fallback value if not found or invalid.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(key); ok {
+		if d, err := parseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
 // NewFromEnv creates a new configuration instance by loading values from environment variables.
 // It supports configuration of concurrent connections, retries, timeouts, authentication keys,
 // log level, and environment. It validates the required values (consumer key and secret) and
@@ -136,22 +235,199 @@ func getEnvInt(key string, fallback int) int {
 //	fmt.Println(config.ConsumerKey)
 func NewFromEnv() (*Config, error) {
 	config := &Config{
-		MaxConcurrentConn: getEnvInt("MAX_CONCURRENT_CONN", 1000),
-		MaxRetries:        getEnvInt("MAX_RETRIES", 3),
-		Timeout:           getEnvInt("TIMEOUT", 5),
-		ConsumerSecret:    getEnv("CONSUMER_SECRET", ""),
-		ConsumerKey:       getEnv("CONSUMER_KEY", ""),
-		LogLevel:          getEnv("LOG_LEVEL", "DEBUG"),
-		Enviroment:        getEnv("ENVIROMENT", "SANDBOX"),
+		MaxConcurrentConn: getEnvInt(EnvPrefix+"MAX_CONCURRENT_CONN", getEnvInt("MAX_CONCURRENT_CONN", 1000)),
+		MaxRetries:        getEnvInt(EnvPrefix+"MAX_RETRIES", getEnvInt("MAX_RETRIES", 3)),
+		Timeout:           getEnvDuration(EnvPrefix+"TIMEOUT", getEnvDuration("TIMEOUT", 5*time.Second)),
+		ConsumerSecret:    getEnv(EnvPrefix+"CONSUMER_SECRET", getEnv("CONSUMER_SECRET", "")),
+		ConsumerKey:       getEnv(EnvPrefix+"CONSUMER_KEY", getEnv("CONSUMER_KEY", "")),
+		LogLevel:          getEnv(EnvPrefix+"LOG_LEVEL", getEnv("LOG_LEVEL", "INFO")),
+		Enviroment:        getEnv(EnvPrefix+"ENVIRONMENT", getEnv("ENVIROMENT", Sandbox)),
+		DuplicateWindow:   getEnvDuration(EnvPrefix+"DUPLICATE_WINDOW", 0),
+		NameCheckEndpoint: getEnv(EnvPrefix+"NAME_CHECK_ENDPOINT", ""),
+		Defaults: types.Defaults{
+			ShortCode:          getEnv(EnvPrefix+"SHORT_CODE", ""),
+			InitiatorName:      getEnv(EnvPrefix+"INITIATOR_NAME", ""),
+			SecurityCredential: getEnv(EnvPrefix+"SECURITY_CREDENTIAL", ""),
+			PassKey:            getEnv(EnvPrefix+"PASSKEY", ""),
+			ResultURL:          getEnv(EnvPrefix+"RESULT_URL", ""),
+			QueueTimeOutURL:    getEnv(EnvPrefix+"QUEUE_TIMEOUT_URL", ""),
+			CallBackURL:        getEnv(EnvPrefix+"CALLBACK_URL", ""),
+		},
 	}
 
-	if config.ConsumerKey == "" || config.ConsumerSecret == "" {
-		return nil, fmt.Errorf("consumer Secret or consumer key is requried")
+	var errs []error
+	for _, secret := range []*string{&config.ConsumerSecret, &config.Defaults.SecurityCredential, &config.Defaults.PassKey} {
+		resolved, err := ResolveSecret(*secret)
+		errs = append(errs, err)
+		*secret = resolved
+	}
+	if limits, ok := os.LookupEnv(EnvPrefix + "LIMITS"); ok {
+		if err := json.Unmarshal([]byte(limits), &config.Limits); err != nil {
+			errs = append(errs, fmt.Errorf("%vLIMITS: %w", EnvPrefix, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
 	}
 
-	if config.Timeout == 0 {
-		return nil, fmt.Errorf("timout has to be greater than 0")
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
 	return config, nil
 }
+
+// Validate checks the configuration and reports every problem it finds at once,
+// instead of stopping at the first one. The returned error wraps one error per
+// problem (see errors.Join) and is nil when the configuration is usable.
+//
+// Returns:
+//	- An error describing all the invalid fields, or nil.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.ConsumerKey == "" {
+		errs = append(errs, errors.New("consumer key is required"))
+	}
+	if c.ConsumerSecret == "" {
+		errs = append(errs, errors.New("consumer secret is required"))
+	}
+	if c.Enviroment != Sandbox && c.Enviroment != Production {
+		errs = append(errs, fmt.Errorf("environment has to be %v or %v, got %q", Sandbox, Production, c.Enviroment))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("timeout has to be greater than 0, got %v", c.Timeout))
+	}
+	if c.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("max retries can not be negative, got %v", c.MaxRetries))
+	}
+	if c.MaxConcurrentConn <= 0 {
+		errs = append(errs, fmt.Errorf("max concurrent connections has to be greater than 0, got %v", c.MaxConcurrentConn))
+	}
+	switch strings.ToUpper(c.LogLevel) {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+	default:
+		errs = append(errs, fmt.Errorf("unknown log level %q", c.LogLevel))
+	}
+
+	urls := []struct{ name, value string }{
+		{"base url", c.BaseURL},
+		{"default result url", c.Defaults.ResultURL},
+		{"default queue timeout url", c.Defaults.QueueTimeOutURL},
+		{"default callback url", c.Defaults.CallBackURL},
+	}
+	for _, u := range urls {
+		if err := validateURL(u.value); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", u.name, err))
+		}
+	}
+
+	if c.Defaults.ShortCode != "" {
+		if _, err := strconv.ParseUint(c.Defaults.ShortCode, 10, 64); err != nil {
+			errs = append(errs, fmt.Errorf("default short code has to be numeric, got %q", c.Defaults.ShortCode))
+		}
+	}
+
+	if c.DuplicateWindow < 0 {
+		errs = append(errs, fmt.Errorf("duplicate window can not be negative, got %v", c.DuplicateWindow))
+	}
+	if c.NameMatchThreshold < 0 || c.NameMatchThreshold > 1 {
+		errs = append(errs, fmt.Errorf("name match threshold has to be between 0 and 1, got %v", c.NameMatchThreshold))
+	}
+	errs = append(errs, validateLimits(c.Limits)...)
+
+	return errors.Join(errs...)
+}
+
+// validateLimits: checks that the limits are not negative and that every range is ordered.
+func validateLimits(l types.Limits) []error {
+	var errs []error
+	commands := make([]string, 0, len(l.Commands))
+	for command := range l.Commands {
+		commands = append(commands, string(command))
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		r := l.Commands[types.CommandId(command)]
+		if r.Min.Sign() < 0 || r.Max.Sign() < 0 {
+			errs = append(errs, fmt.Errorf("limits of %v can not be negative", command))
+		}
+		if !r.Max.IsZero() && r.Min.Cmp(r.Max) > 0 {
+			errs = append(errs, fmt.Errorf("minimum amount of %v is above its maximum, %v > %v", command, r.Min, r.Max))
+		}
+	}
+	if l.DailyCap.Sign() < 0 {
+		errs = append(errs, fmt.Errorf("daily cap can not be negative, got %v", l.DailyCap))
+	}
+	parties := make([]string, 0, len(l.PartyDailyCaps))
+	for party := range l.PartyDailyCaps {
+		parties = append(parties, party)
+	}
+	sort.Strings(parties)
+	for _, party := range parties {
+		if limit := l.PartyDailyCaps[party]; limit.Sign() < 0 {
+			errs = append(errs, fmt.Errorf("daily cap of %v can not be negative, got %v", party, limit))
+		}
+	}
+	return errs
+}
+
+// validateURL: checks that an optional url is absolute when it is set.
+func validateURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute url", raw)
+	}
+	return nil
+}
+
+// String returns a human readable form of the configuration with the consumer
+// secret and security credential redacted, so it is safe to print or log.
+func (c *Config) String() string {
+	return fmt.Sprintf(
+		"Config{Enviroment: %v, ConsumerKey: %v, ConsumerSecret: %v, Timeout: %v, MaxRetries: %v, MaxConcurrentConn: %v, LogLevel: %v, ShortCode: %v, InitiatorName: %v, SecurityCredential: %v}",
+		c.Enviroment, maskKey(c.ConsumerKey), redactSecret(c.ConsumerSecret), c.Timeout, c.MaxRetries,
+		c.MaxConcurrentConn, c.LogLevel, c.Defaults.ShortCode, c.Defaults.InitiatorName, redactSecret(c.Defaults.SecurityCredential),
+	)
+}
+
+// LogValue implements slog.LogValuer so that logging a configuration never
+// leaks the consumer secret or the security credential.
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("enviroment", c.Enviroment),
+		slog.String("consumer_key", maskKey(c.ConsumerKey)),
+		slog.String("consumer_secret", redactSecret(c.ConsumerSecret)),
+		slog.Duration("timeout", c.Timeout),
+		slog.Int("max_retries", c.MaxRetries),
+		slog.Int("max_concurrent_conn", c.MaxConcurrentConn),
+		slog.String("log_level", c.LogLevel),
+		slog.String("short_code", c.Defaults.ShortCode),
+		slog.String("initiator_name", c.Defaults.InitiatorName),
+		slog.String("security_credential", redactSecret(c.Defaults.SecurityCredential)),
+	)
+}
+
+// redactSecret: hides a secret completely, empty secrets stay empty so that
+// missing values are still visible.
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// maskKey: keeps the last four characters of a key so that different keys can
+// still be told apart in logs.
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return redactSecret(key)
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
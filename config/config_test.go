@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate_Defaults(t *testing.T) {
+	cfg := New("secret", "key", "DEBUG")
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, Sandbox, cfg.Enviroment)
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+}
+
+func TestNewFromEnv_DefaultsLikeDefault(t *testing.T) {
+	t.Setenv("MPESA_CONSUMER_KEY", "key")
+	t.Setenv("MPESA_CONSUMER_SECRET", "secret")
+	for _, key := range []string{"MPESA_LOG_LEVEL", "LOG_LEVEL"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+
+	cfg, err := NewFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Default().LogLevel, cfg.LogLevel)
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	cfg := &Config{
+		Enviroment: "STAGING",
+		LogLevel:   "TRACE",
+		MaxRetries: -1,
+	}
+	cfg.Defaults.ResultURL = "not-a-url"
+	cfg.Defaults.ShortCode = "12ab"
+	cfg.Limits.Commands = map[types.CommandId]types.AmountLimits{
+		types.BusinessPaymentCommand: {Min: money.Birr(100), Max: money.Birr(10)},
+	}
+	cfg.Limits.DailyCap = money.Birr(-1)
+	cfg.NameMatchThreshold = 1.5
+
+	err := cfg.Validate()
+	assert.Error(t, err)
+	for _, want := range []string{
+		"consumer key is required",
+		"consumer secret is required",
+		"environment has to be",
+		"timeout has to be greater than 0",
+		"max retries can not be negative",
+		"max concurrent connections",
+		"unknown log level",
+		"default result url",
+		"default short code",
+		"minimum amount of BusinessPayment is above its maximum",
+		"daily cap can not be negative",
+		"name match threshold",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestString_RedactsSecrets(t *testing.T) {
+	cfg := New("super-secret", "consumer-key-1234", "INFO")
+	cfg.Defaults.SecurityCredential = "encrypted-credential"
+
+	out := cfg.String()
+	assert.NotContains(t, out, "super-secret")
+	assert.NotContains(t, out, "encrypted-credential")
+	assert.NotContains(t, out, "consumer-key-1234")
+	assert.Contains(t, out, "1234")
+
+	logged := fmt.Sprint(slog.AnyValue(cfg).Resolve())
+	assert.NotContains(t, logged, "super-secret")
+	assert.NotContains(t, logged, "encrypted-credential")
+}
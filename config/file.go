@@ -0,0 +1,349 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/types"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of every environment variable read by the SDK. Using a
+// prefix keeps the SDK from picking up generic names like `TIMEOUT` that belong to
+// other libraries.
+const EnvPrefix = "MPESA_"
+
+// ProfileEnv is the environment variable that selects the profile when LoadFile is
+// called without an explicit profile name.
+const ProfileEnv = EnvPrefix + "PROFILE"
+
+// Profile is a single named set of settings inside a configuration file. Every
+// field can be overridden by the environment variable named in its `env` tag, and
+// every string value can point to a secret instead of holding it:
+//	- `file:/run/secrets/mpesa_secret` reads the trimmed content of the file.
+//	- `env:SOME_VARIABLE` reads the value of another environment variable.
+//
+// Timeout accepts either a number of seconds or a Go duration like "1500ms".
+type Profile struct {
+	Enviroment         string `yaml:"environment" json:"environment" env:"ENVIRONMENT"`
+	ConsumerKey        string `yaml:"consumer_key" json:"consumer_key" env:"CONSUMER_KEY"`
+	ConsumerSecret     string `yaml:"consumer_secret" json:"consumer_secret" env:"CONSUMER_SECRET"`
+	Timeout            Value  `yaml:"timeout" json:"timeout" env:"TIMEOUT"`
+	MaxRetries         Value  `yaml:"max_retries" json:"max_retries" env:"MAX_RETRIES"`
+	MaxConcurrentConn  Value  `yaml:"max_concurrent_conn" json:"max_concurrent_conn" env:"MAX_CONCURRENT_CONN"`
+	LogLevel           string `yaml:"log_level" json:"log_level" env:"LOG_LEVEL"`
+	ShortCode          string `yaml:"short_code" json:"short_code" env:"SHORT_CODE"`
+	InitiatorName      string `yaml:"initiator_name" json:"initiator_name" env:"INITIATOR_NAME"`
+	SecurityCredential string `yaml:"security_credential" json:"security_credential" env:"SECURITY_CREDENTIAL"`
+	PassKey            string `yaml:"passkey" json:"passkey" env:"PASSKEY"`
+	ResultURL          string `yaml:"result_url" json:"result_url" env:"RESULT_URL"`
+	QueueTimeOutURL    string `yaml:"queue_timeout_url" json:"queue_timeout_url" env:"QUEUE_TIMEOUT_URL"`
+	CallBackURL        string `yaml:"callback_url" json:"callback_url" env:"CALLBACK_URL"`
+	DuplicateWindow    Value  `yaml:"duplicate_window" json:"duplicate_window" env:"DUPLICATE_WINDOW"`
+	NameCheckEndpoint  string `yaml:"name_check_endpoint" json:"name_check_endpoint" env:"NAME_CHECK_ENDPOINT"`
+	// Limits are the transaction limits of the profile, `MPESA_LIMITS` replaces them with
+	// a JSON document of the same shape.
+	Limits types.Limits `yaml:"limits" json:"limits" env:"LIMITS"`
+}
+
+// Value is a profile setting written either as a string or as a number, so that both
+// `timeout: 30` and `timeout: "30s"` are accepted in YAML and JSON files.
+type Value string
+
+// UnmarshalJSON accepts a JSON string, number or boolean, null is the empty value.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = Value(s)
+		return nil
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch raw.(type) {
+	case nil:
+		*v = ""
+	case float64, bool:
+		*v = Value(data)
+	default:
+		return fmt.Errorf("expected a string or a number, got %s", data)
+	}
+	return nil
+}
+
+// UnmarshalYAML accepts any YAML scalar, such as 30, 1.5 or "30s".
+func (v *Value) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %v: expected a string or a number", node.Line)
+	}
+	*v = Value(node.Value)
+	return nil
+}
+
+// File is the content of a configuration file. It holds any number of named
+// profiles (for example `sandbox`, `production` or one per merchant) and the name
+// of the profile to use when none is requested.
+//
+// Example (YAML):
+//
+//	default_profile: sandbox
+//	profiles:
+//	  sandbox:
+//	    environment: SANDBOX
+//	    consumer_key: my-key
+//	    consumer_secret: file:/run/secrets/mpesa_sandbox_secret
+//	    timeout: 5s
+//	    short_code: "1020"
+//	    passkey: env:SANDBOX_PASSKEY
+//	    callback_url: https://example.com/mpesa/callback
+//	    limits:
+//	      commands:
+//	        BusinessPayment: {min: 10, max: 150000}
+//	      daily_cap: 300000
+//	  production:
+//	    environment: PRODUCTION
+//	    ...
+type File struct {
+	DefaultProfile string             `yaml:"default_profile" json:"default_profile"`
+	Profiles       map[string]Profile `yaml:"profiles" json:"profiles"`
+}
+
+// LoadFile reads a YAML (.yaml, .yml) or JSON (.json) configuration file and builds
+// the configuration of one of its profiles. The profile is chosen in this order:
+//	1. The profile argument when it is not empty.
+//	2. The `MPESA_PROFILE` environment variable.
+//	3. The `default_profile` of the file.
+//	4. The only profile of the file, when there is exactly one.
+//
+// The values of the profile are applied on top of Default(), then every `MPESA_`
+// prefixed environment variable overrides its field (e.g. `MPESA_CONSUMER_SECRET`,
+// `MPESA_TIMEOUT`, `MPESA_SHORT_CODE`), secret references are resolved, and the
+// result is validated with Validate.
+//
+// Parameters:
+//	- path: The path of the configuration file.
+//	- profile: The name of the profile to load, may be empty.
+//
+// Returns:
+//	- A pointer to the Config instance built from the profile.
+//	- An error if the file can not be read, the profile does not exist or the result is invalid.
+//
+// Example usage:
+//
+//	cfg, err := config.LoadFile("mpesa.yaml", "production")
+//	if err != nil {
+//	    log.Fatalf("Error loading config: %v", err)
+//	}
+func LoadFile(path string, profile string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &file)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q, use .yaml, .yml or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", path, err)
+	}
+
+	return file.Load(profile)
+}
+
+// Load builds the configuration of the named profile, see LoadFile for how the
+// profile is selected and how the environment overrides are applied.
+func (f *File) Load(profile string) (*Config, error) {
+	name, err := f.profileName(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	p := f.Profiles[name]
+	if err := p.applyEnv(); err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+	if err := p.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	cfg, err := p.toConfig()
+	if err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+	return cfg, nil
+}
+
+// profileName: picks the profile to load following the order documented on LoadFile.
+func (f *File) profileName(profile string) (string, error) {
+	name := profile
+	if name == "" {
+		name = os.Getenv(ProfileEnv)
+	}
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if name == "" && len(f.Profiles) == 1 {
+		for only := range f.Profiles {
+			name = only
+		}
+	}
+	if name == "" {
+		return "", errors.New("no profile selected, pass a profile name or set " + ProfileEnv)
+	}
+
+	if _, ok := f.Profiles[name]; !ok {
+		known := make([]string, 0, len(f.Profiles))
+		for k := range f.Profiles {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return "", fmt.Errorf("unknown profile %q, available profiles: %v", name, strings.Join(known, ", "))
+	}
+	return name, nil
+}
+
+// applyEnv: overrides every field whose `MPESA_` prefixed environment variable is set,
+// the fields that are not strings, such as Limits, are read as JSON.
+func (p *Profile) applyEnv() error {
+	v := reflect.ValueOf(p).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := EnvPrefix + t.Field(i).Tag.Get("env")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if v.Field(i).Kind() == reflect.String {
+			v.Field(i).SetString(value)
+			continue
+		}
+		field := reflect.New(v.Field(i).Type())
+		if err := json.Unmarshal([]byte(value), field.Interface()); err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		v.Field(i).Set(field.Elem())
+	}
+	return nil
+}
+
+// resolveSecrets: replaces `file:` and `env:` references with the value they point to.
+func (p *Profile) resolveSecrets() error {
+	v := reflect.ValueOf(p).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if v.Field(i).Kind() != reflect.String {
+			continue
+		}
+		resolved, err := ResolveSecret(v.Field(i).String())
+		if err != nil {
+			return fmt.Errorf("%v: %w", t.Field(i).Tag.Get("yaml"), err)
+		}
+		v.Field(i).SetString(resolved)
+	}
+	return nil
+}
+
+// ResolveSecret returns the value a secret reference points to. Values starting with
+// `file:` are read from the named file (surrounding whitespace is trimmed), values
+// starting with `env:` are read from the named environment variable, anything else
+// is returned unchanged.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %v is not set", name)
+		}
+		return secret, nil
+	}
+	return value, nil
+}
+
+// toConfig: converts the values of a profile into a Config.
+func (p *Profile) toConfig() (*Config, error) {
+	cfg := Default()
+	var errs []error
+
+	cfg.ConsumerKey = p.ConsumerKey
+	cfg.ConsumerSecret = p.ConsumerSecret
+	if p.Enviroment != "" {
+		cfg.Enviroment = strings.ToUpper(p.Enviroment)
+	}
+	if p.LogLevel != "" {
+		cfg.LogLevel = strings.ToUpper(p.LogLevel)
+	}
+	if p.Timeout != "" {
+		d, err := parseDuration(string(p.Timeout))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("timeout: %w", err))
+		}
+		cfg.Timeout = d
+	}
+	if p.MaxRetries != "" {
+		n, err := strconv.Atoi(string(p.MaxRetries))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("max_retries: %w", err))
+		}
+		cfg.MaxRetries = n
+	}
+	if p.MaxConcurrentConn != "" {
+		n, err := strconv.Atoi(string(p.MaxConcurrentConn))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("max_concurrent_conn: %w", err))
+		}
+		cfg.MaxConcurrentConn = n
+	}
+
+	if p.DuplicateWindow != "" {
+		d, err := parseDuration(string(p.DuplicateWindow))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("duplicate_window: %w", err))
+		}
+		cfg.DuplicateWindow = d
+	}
+
+	cfg.Defaults.ShortCode = p.ShortCode
+	cfg.Defaults.InitiatorName = p.InitiatorName
+	cfg.Defaults.SecurityCredential = p.SecurityCredential
+	cfg.Defaults.PassKey = p.PassKey
+	cfg.Defaults.ResultURL = p.ResultURL
+	cfg.Defaults.QueueTimeOutURL = p.QueueTimeOutURL
+	cfg.Defaults.CallBackURL = p.CallBackURL
+	cfg.Limits = p.Limits
+	cfg.NameCheckEndpoint = p.NameCheckEndpoint
+
+	return cfg, errors.Join(errs...)
+}
+
+// parseDuration: reads plain integers as seconds and anything else with time.ParseDuration.
+func parseDuration(value string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testYAML = `
+default_profile: sandbox
+profiles:
+  sandbox:
+    environment: sandbox
+    consumer_key: sandbox-key
+    consumer_secret: file:%s
+    timeout: 1500ms
+    short_code: "1020"
+    passkey: env:TEST_MPESA_PASSKEY
+    callback_url: https://example.com/callback
+  production:
+    environment: PRODUCTION
+    consumer_key: production-key
+    consumer_secret: production-secret
+    timeout: 10
+    duplicate_window: 24h
+    limits:
+      commands:
+        BusinessPayment: {min: 10, max: "150,000.00"}
+      daily_cap: 300000
+      party_daily_caps:
+        "0712345678": 500
+      deny: ["251799999999"]
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile_YAMLDefaultProfile(t *testing.T) {
+	secret := writeFile(t, "secret", "sandbox-secret\n")
+	path := writeFile(t, "mpesa.yaml", fmt.Sprintf(testYAML, secret))
+	t.Setenv("TEST_MPESA_PASSKEY", "pass-key")
+
+	cfg, err := LoadFile(path, "")
+	assert.NoError(t, err)
+	assert.Equal(t, Sandbox, cfg.Enviroment)
+	assert.Equal(t, "sandbox-key", cfg.ConsumerKey)
+	assert.Equal(t, "sandbox-secret", cfg.ConsumerSecret)
+	assert.Equal(t, 1500*time.Millisecond, cfg.Timeout)
+	assert.Equal(t, "1020", cfg.Defaults.ShortCode)
+	assert.Equal(t, "pass-key", cfg.Defaults.PassKey)
+	assert.Equal(t, "https://example.com/callback", cfg.Defaults.CallBackURL)
+}
+
+func TestLoadFile_ProfileFromEnvAndOverrides(t *testing.T) {
+	path := writeFile(t, "mpesa.yaml", fmt.Sprintf(testYAML, "unused"))
+	t.Setenv(ProfileEnv, "production")
+	t.Setenv("MPESA_CONSUMER_SECRET", "overridden")
+	t.Setenv("MPESA_SHORT_CODE", "600000")
+
+	cfg, err := LoadFile(path, "")
+	assert.NoError(t, err)
+	assert.Equal(t, Production, cfg.Enviroment)
+	assert.Equal(t, "overridden", cfg.ConsumerSecret)
+	assert.Equal(t, 10*time.Second, cfg.Timeout)
+	assert.Equal(t, "600000", cfg.Defaults.ShortCode)
+	assert.Equal(t, 24*time.Hour, cfg.DuplicateWindow)
+
+	limits := cfg.Limits.Commands[types.BusinessPaymentCommand]
+	assert.Equal(t, money.Birr(10), limits.Min)
+	assert.Equal(t, money.Birr(150000), limits.Max)
+	assert.Equal(t, money.Birr(300000), cfg.Limits.DailyCap)
+	assert.Equal(t, money.Birr(500), cfg.Limits.PartyDailyCaps["0712345678"])
+	assert.Equal(t, []string{"251799999999"}, cfg.Limits.Deny)
+}
+
+func TestLoadFile_JSON(t *testing.T) {
+	path := writeFile(t, "mpesa.json", `{"profiles": {"merchant-a": {"consumer_key": "k", "consumer_secret": "s", "max_retries": "1"}}}`)
+
+	cfg, err := LoadFile(path, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "k", cfg.ConsumerKey)
+	assert.Equal(t, 1, cfg.MaxRetries)
+}
+
+func TestLoadFile_UnquotedNumbers(t *testing.T) {
+	json := writeFile(t, "mpesa.json", `{"profiles": {"p": {"consumer_key": "k", "consumer_secret": "s",
+		"timeout": 30, "max_retries": 0, "max_concurrent_conn": 50, "duplicate_window": 3600}}}`)
+	yaml := writeFile(t, "mpesa.yaml", `
+profiles:
+  p:
+    consumer_key: k
+    consumer_secret: s
+    timeout: 30
+    max_retries: 0
+    max_concurrent_conn: 50
+    duplicate_window: 1h
+`)
+	for _, path := range []string{json, yaml} {
+		cfg, err := LoadFile(path, "")
+		assert.NoError(t, err, path)
+		assert.Equal(t, 30*time.Second, cfg.Timeout)
+		assert.Equal(t, 0, cfg.MaxRetries)
+		assert.Equal(t, 50, cfg.MaxConcurrentConn)
+		assert.Equal(t, time.Hour, cfg.DuplicateWindow)
+	}
+
+	_, err := LoadFile(writeFile(t, "bad.json", `{"profiles": {"p": {"timeout": [30]}}}`), "")
+	assert.ErrorContains(t, err, "expected a string or a number")
+}
+
+func TestLoadFile_LimitsFromEnv(t *testing.T) {
+	path := writeFile(t, "mpesa.yaml", fmt.Sprintf(testYAML, "unused"))
+	t.Setenv("MPESA_LIMITS", `{"daily_cap": 1000, "deny": ["251788888888"]}`)
+
+	cfg, err := LoadFile(path, "production")
+	assert.NoError(t, err)
+	assert.Equal(t, money.Birr(1000), cfg.Limits.DailyCap)
+	assert.Equal(t, []string{"251788888888"}, cfg.Limits.Deny)
+	assert.Empty(t, cfg.Limits.Commands, "the environment replaces the limits of the profile")
+
+	t.Setenv("MPESA_LIMITS", `{"daily_cap": "lots"}`)
+	_, err = LoadFile(path, "production")
+	assert.ErrorContains(t, err, "MPESA_LIMITS")
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	path := writeFile(t, "mpesa.yaml", fmt.Sprintf(testYAML, "/does/not/exist"))
+
+	_, err := LoadFile(path, "staging")
+	assert.ErrorContains(t, err, "unknown profile")
+
+	_, err = LoadFile(path, "sandbox")
+	assert.Error(t, err)
+
+	_, err = LoadFile(writeFile(t, "mpesa.toml", ""), "")
+	assert.ErrorContains(t, err, "unsupported config file extension")
+}
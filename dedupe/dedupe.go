@@ -0,0 +1,133 @@
+// Package dedupe guards against paying the same recipient twice, for example when a
+// payout job is re-run. Payouts are identified by their fingerprint (recipient, amount,
+// remarks and occasion, see types.PayoutKey) and a payout with the fingerprint of one
+// sent within the window is refused with a *types.DuplicateError.
+//
+// The fingerprints are kept in a Store, MemoryStore is used by default and a shared
+// store (a database, Redis...) makes the guard work across several processes.
+//
+// Example usage:
+//
+//	app, err := mpesagosdk.New(
+//		mpesagosdk.WithConfig(cfg),
+//		mpesagosdk.WithDuplicateGuard(24*time.Hour, nil), // nil uses a MemoryStore
+//	)
+package dedupe
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+// Store keeps the fingerprints of the payouts sent recently. Implementations must
+// be safe for concurrent use and Claim must be atomic, so that two concurrent
+// payouts with the same fingerprint cannot both be claimed.
+type Store interface {
+	// Claim records the fingerprint as sent at `at` unless it was already recorded
+	// less than `window` before `at`. It returns whether the fingerprint was claimed
+	// and, when it was not, when it was first recorded.
+	Claim(ctx context.Context, fingerprint string, at time.Time, window time.Duration) (claimed bool, first time.Time, err error)
+	// Release forgets the claim made at `at`, it is called when M-Pesa refused the payout
+	// so that it can be retried (see types.Refused). A payout whose outcome is unknown,
+	// such as a timeout, keeps its claim. A newer claim is left untouched.
+	Release(ctx context.Context, fingerprint string, at time.Time) error
+}
+
+// Guard refuses payouts repeating one sent within Window.
+type Guard struct {
+	// Window is how long a fingerprint is remembered.
+	Window time.Duration
+	// Store keeps the fingerprints.
+	Store Store
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+// New creates a guard, a nil store is replaced by a new MemoryStore.
+func New(window time.Duration, store Store) *Guard {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Guard{Window: window, Store: store}
+}
+
+// Claim checks a payout and records its fingerprint. Payouts with DuplicateAllowed
+// are neither checked nor recorded.
+//
+// Returns:
+//   - func(): releases the claim when M-Pesa refused the payout, it is safe to call it more
+//     than once. It must not be called when the outcome is unknown, such as after a timeout.
+//   - error: a *types.DuplicateError for a duplicate, or the error of the store.
+func (g *Guard) Claim(ctx context.Context, p types.Payout) (func(), error) {
+	if p.DuplicateAllowed() {
+		return func() {}, nil
+	}
+
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+	key := p.PayoutKey()
+	fingerprint := key.Fingerprint()
+	at := now()
+
+	claimed, first, err := g.Store.Claim(ctx, fingerprint, at, g.Window)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, &types.DuplicateError{Payout: key, Fingerprint: fingerprint, FirstSeen: first, Window: g.Window}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { _ = g.Store.Release(context.WithoutCancel(ctx), fingerprint, at) })
+	}, nil
+}
+
+// MemoryStore is a Store kept in memory, it only protects a single process.
+type MemoryStore struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	sweepN int
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{seen: map[string]time.Time{}, sweepN: 1024}
+}
+
+// Claim implements Store.
+func (s *MemoryStore) Claim(_ context.Context, fingerprint string, at time.Time, window time.Duration) (bool, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if first, ok := s.seen[fingerprint]; ok && at.Sub(first) < window {
+		return false, first, nil
+	}
+	s.seen[fingerprint] = at
+
+	// forget the expired fingerprints once the map doubled since the last sweep
+	if len(s.seen) >= s.sweepN {
+		for f, t := range s.seen {
+			if at.Sub(t) >= window {
+				delete(s.seen, f)
+			}
+		}
+		s.sweepN = max(1024, 2*len(s.seen))
+	}
+	return true, at, nil
+}
+
+// Release implements Store.
+func (s *MemoryStore) Release(_ context.Context, fingerprint string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if first, ok := s.seen[fingerprint]; ok && first.Equal(at) {
+		delete(s.seen, fingerprint)
+	}
+	return nil
+}
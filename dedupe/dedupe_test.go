@@ -0,0 +1,107 @@
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type payout struct {
+	key      types.PayoutKey
+	override bool
+}
+
+func (p payout) PayoutKey() types.PayoutKey { return p.key }
+func (p payout) DuplicateAllowed() bool     { return p.override }
+
+func supplier(amount int64, remarks string) payout {
+	return payout{key: types.PayoutKey{Recipient: "251712345678", Amount: money.Birr(amount), Remarks: remarks, Occasion: "October"}}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := supplier(100, "Invoice 42").key
+
+	tests := []struct {
+		name  string
+		key   types.PayoutKey
+		equal bool
+	}{
+		{"Same payout", base, true},
+		{"Case and spaces", types.PayoutKey{Recipient: "251712345678", Amount: money.Birr(100), Remarks: " invoice   42", Occasion: "october"}, true},
+		{"Other amount", supplier(101, "Invoice 42").key, false},
+		{"Other remarks", supplier(100, "Invoice 43").key, false},
+		{"Other recipient", types.PayoutKey{Recipient: "251722222222", Amount: money.Birr(100), Remarks: "Invoice 42", Occasion: "October"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.equal, base.Fingerprint() == tt.key.Fingerprint())
+		})
+	}
+}
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	g := New(time.Hour, nil)
+	g.Now = func() time.Time { return now }
+
+	_, err := g.Claim(ctx, supplier(100, "Invoice 42"))
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Minute)
+	_, err = g.Claim(ctx, supplier(100, "invoice 42"))
+	var derr *types.DuplicateError
+	require.True(t, errors.As(err, &derr), err)
+	assert.Equal(t, now.Add(-30*time.Minute), derr.FirstSeen)
+	assert.Equal(t, time.Hour, derr.Window)
+
+	_, err = g.Claim(ctx, payout{key: supplier(100, "Invoice 42").key, override: true})
+	assert.NoError(t, err, "the override skips the guard")
+
+	release, err := g.Claim(ctx, supplier(200, "Invoice 42"))
+	require.NoError(t, err)
+	release()
+	release()
+	_, err = g.Claim(ctx, supplier(200, "Invoice 42"))
+	assert.NoError(t, err, "a released payout can be retried")
+
+	now = now.Add(31 * time.Minute)
+	_, err = g.Claim(ctx, supplier(100, "Invoice 42"))
+	assert.NoError(t, err, "the window expired")
+}
+
+func TestMemoryStore_Concurrent(t *testing.T) {
+	store := NewMemoryStore()
+	at := time.Now()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := store.Claim(context.Background(), "fingerprint", at, time.Minute)
+			assert.NoError(t, err)
+			if ok {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, claimed)
+
+	assert.NoError(t, store.Release(context.Background(), "fingerprint", at.Add(time.Second)))
+	ok, _, _ := store.Claim(context.Background(), "fingerprint", at, time.Minute)
+	assert.False(t, ok, "releasing another claim keeps the fingerprint")
+}
@@ -64,6 +64,8 @@ type AuthToken struct {
 	createdAt      time.Time
 	expiresAt      time.Time
 	token          string
+	client         *http.Client
+	baseURL        string
 }
 
 // New initializes and returns a new instance of AuthToken using the
@@ -74,10 +76,23 @@ func New(consumerKey, consumerSecret string) *AuthToken {
 		consumerKey:    consumerKey,
 		consumerSecret: consumerSecret,
 		locker:			locker,
+		client:         http.DefaultClient,
 	}
 	return token
 }
 
+// NewWithClient works like New but fetches tokens through the given HTTP client,
+// so that token generation shares the transport and timeouts of the API requests.
+// A non empty baseURL replaces the environment URL (see utils.ConstructURLWithBase).
+func NewWithClient(consumerKey, consumerSecret string, client *http.Client, baseURL string) *AuthToken {
+	token := New(consumerKey, consumerSecret)
+	if client != nil {
+		token.client = client
+	}
+	token.baseURL = baseURL
+	return token
+}
+
 // GetToken returns a valid authorization token. If the current token is expired
 // or not yet fetched, it automatically fetches a new one from the API.
 //
@@ -116,7 +131,7 @@ func (a *AuthToken) setAuthToken(tokenType, token string, expiresIn int) {
 // It constructs the appropriate URL based on the environment, and uses Basic Auth
 // for authentication. The token response is parsed and stored.
 func (a *AuthToken) fetchAuthToken(env string) error {
-	url := utils.ConstructURL(env, "/v1/token/generate?grant_type=client_credentials")
+	url := utils.ConstructURLWithBase(a.baseURL, env, "/v1/token/generate?grant_type=client_credentials")
 	method := "GET"
 
 	req, err := http.NewRequest(method, url, nil)
@@ -127,8 +142,7 @@ func (a *AuthToken) fetchAuthToken(env string) error {
 	req.Header.Add("Content-Type", "application/json")
 	req.SetBasicAuth(a.consumerKey, a.consumerSecret)
 
-	client := http.DefaultClient
-	res, err := client.Do(req)
+	res, err := a.client.Do(req)
 	if err != nil {
 		return err
 	}
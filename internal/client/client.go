@@ -10,6 +10,8 @@
 //	- Supports multiple authentication schemes: Bearer and Basic.
 //	- Provides a configurable client with timeout and maximum concurrent connections.
 //	- Handles exponential backoff for retries to avoid server overload.
+//	- Optionally dumps every request and response at DEBUG level, redacted so that
+//	  phone numbers, credentials and tokens never reach the logs.
 // 
 // This package makes it easier to interact with an external API while managing
 // important aspects of HTTP communication, such as retries, authentication, and connection limits.
@@ -20,11 +22,12 @@
 //	    ConsumerSecret:   "consumer-secret",
 //	    MaxRetries:       3,
 //	    MaxConcurrentConn: 10,
-//	    Timeout:           30,
+//	    Timeout:           30 * time.Second,
 //	}
 // 
 //	client := client.New(cfg)
-//	response, err := client.ApiRequest("PRODUCTION", "/v1/resource", "GET", nil, auth.AuthTypeBearer)
+//	log := logger.NewLogger(logger.INFO)
+//	response, err := client.ApiRequest(log, "PRODUCTION", "/v1/resource", "GET", nil, auth.AuthTypeBearer)
 //
 //	if err != nil {
 //	    log.Fatalf("API request failed: %v", err)
@@ -46,7 +49,9 @@ import (
 
 	"github.com/coleYab/mpesagosdk/config"
 	"github.com/coleYab/mpesagosdk/internal/auth"
+	"github.com/coleYab/mpesagosdk/internal/logger"
 	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/redact"
 )
 
 // HttpClient is a wrapper over the standard HTTP client that manages retries, timeouts,
@@ -56,25 +61,37 @@ import (
 type HttpClient struct {
 	maxRetries int
 	maxConn    int
-	timeout    int
+	timeout    time.Duration
 	client     *http.Client
 	token      *auth.AuthToken
+	redactor   *redact.Redactor
+	dumpWire   bool
+	baseURL    string
 }
 
 // New constructs a new HttpClient based on the provided configuration settings.
 // It sets up the underlying HTTP client, including transport settings and token management.
+// When the configuration carries its own `HTTPClient` that client is used as is.
 func New(cfg *config.Config) *HttpClient {
-	transport := &http.Transport{
-		MaxIdleConns:        int(cfg.MaxConcurrentConn),
-		MaxIdleConnsPerHost: int(cfg.MaxConcurrentConn),
-	}
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   time.Duration(cfg.Timeout) * time.Second,
+	client := cfg.HTTPClient
+	if client == nil {
+		transport := &http.Transport{
+			MaxIdleConns:        int(cfg.MaxConcurrentConn),
+			MaxIdleConnsPerHost: int(cfg.MaxConcurrentConn),
+		}
+		client = &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+		}
 	}
 
 	// Authorization token that will be used by the application
-	token := auth.New(cfg.ConsumerKey, cfg.ConsumerSecret)
+	token := auth.NewWithClient(cfg.ConsumerKey, cfg.ConsumerSecret, client, cfg.BaseURL)
+
+	redactor := cfg.Redactor
+	if redactor == nil {
+		redactor = redact.Default()
+	}
 
 	return &HttpClient{
 		maxRetries: cfg.MaxRetries,
@@ -82,6 +99,9 @@ func New(cfg *config.Config) *HttpClient {
 		timeout:    cfg.Timeout,
 		client:     client,
 		token:      token,
+		redactor:   redactor,
+		dumpWire:   cfg.DumpWire,
+		baseURL:    cfg.BaseURL,
 	}
 }
 
@@ -96,26 +116,51 @@ func New(cfg *config.Config) *HttpClient {
 //	-	Retries: retries are only done if the issue is timeout error or context DeadlineExceeded
 //	 errors. We don't want to retiry other errors because it is useless in to retry in most
 //	 of the other cases. We are using (Exponential backoff)[https://en.wikipedia.org/wiki/Exponential_backoff]
+//	 A timeout does not prove that M-Pesa did not process the request, so only the requests
+//	 that are safe to repeat, such as queries, should be sent with ApiRequest, the ones that
+//	 move money are sent with ApiRequestOnce.
+//
+//	-	Logging: every attempt is logged on `log` with its attempt number, latency and HTTP status,
+//	 callers are expected to pass a logger that already carries the operation and endpoint.
 //
 // Returns the HTTP response and an error, if any.
-func (c *HttpClient) ApiRequest(env string, endpoint, method string, payload interface{}, authType string) (*http.Response, error) {
-	url := utils.ConstructURL(env, endpoint)
+func (c *HttpClient) ApiRequest(log *logger.Logger, env string, endpoint, method string, payload interface{}, authType string) (*http.Response, error) {
+	return c.apiRequest(log, env, endpoint, method, payload, authType, c.maxRetries)
+}
 
-	var body io.Reader
+// ApiRequestOnce sends an HTTP request like ApiRequest but never retries it, a timed out
+// request may still have been processed and sending it again could repeat a payment.
+func (c *HttpClient) ApiRequestOnce(log *logger.Logger, env string, endpoint, method string, payload interface{}, authType string) (*http.Response, error) {
+	return c.apiRequest(log, env, endpoint, method, payload, authType, 0)
+}
+
+// apiRequest: sends the request, retrying it up to maxRetries times on timeouts.
+func (c *HttpClient) apiRequest(log *logger.Logger, env string, endpoint, method string, payload interface{}, authType string, maxRetries int) (*http.Response, error) {
+	url := utils.ConstructURLWithBase(c.baseURL, env, endpoint)
+
+	var jsonData []byte
 	if payload != nil {
-		jsonData, err := json.Marshal(payload)
+		var err error
+		jsonData, err = json.Marshal(payload)
 		if err != nil {
 			return nil, err
 		}
-		body = bytes.NewReader(jsonData)
 	}
 
 	var res *http.Response
 	var err error
 
 	// Retries
-	for attempt := 0; attempt <= c.maxRetries; attempt++ {
-		res, err = c.makeRequest(url, method, body, authType, env)
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		start := time.Now()
+		res, err = c.makeRequest(log, url, method, jsonData, authType, env)
+		latency := time.Since(start)
+		if err != nil {
+			log.Debug("attempt failed", "attempt", attempt+1, "latency", latency, "error", err.Error())
+		} else {
+			log.Debug("attempt completed", "attempt", attempt+1, "latency", latency, "status", res.StatusCode)
+		}
+
 		if err == nil || !isTimeoutError(err) {
 			break
 		}
@@ -127,9 +172,22 @@ func (c *HttpClient) ApiRequest(env string, endpoint, method string, payload int
 	return res, err
 }
 
+// Token returns the authorization header value used by Bearer requests, a cached
+// token is reused until it is about to expire.
+func (c *HttpClient) Token(env string) (string, error) {
+	return c.token.GetToken(env)
+}
+
 // makeRequest: sends the HTTP request with the given method, URL, body, and authentication.
-// It returns the HTTP response or an error if something goes wrong.
-func (c *HttpClient) makeRequest(url, method string, body io.Reader, authType string, env string) (*http.Response, error) {
+// It returns the HTTP response or an error if something goes wrong. The body reader is
+// rebuilt on every call because a reader can only be consumed once. When wire dumps are
+// enabled the redacted request and response are logged at DEBUG level.
+func (c *HttpClient) makeRequest(log *logger.Logger, url, method string, payload []byte, authType string, env string) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
@@ -148,7 +206,25 @@ func (c *HttpClient) makeRequest(url, method string, body io.Reader, authType st
 		req.SetBasicAuth(c.token.GetUserCredentials())
 	}
 
-	return c.client.Do(req)
+	dump := c.dumpWire && log.Enabled(logger.DEBUG)
+	if dump {
+		log.Debug("http request", "dump", c.redactor.DumpRequest(req, payload))
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil || !dump {
+		return res, err
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	log.Debug("http response", "dump", c.redactor.DumpResponse(res, resBody))
+
+	return res, nil
 }
 
 // isTimeoutError checks if an error is due to a network timeout
@@ -1,8 +1,19 @@
+// Package logger provides the structured logger used by the SDK. It is a thin
+// wrapper around log/slog so that the SDK can either log on its own (text to
+// stdout at the configured level) or through an `*slog.Logger`/`slog.Handler`
+// supplied by the application, in which case the application decides the format,
+// the destination and the level.
+//
+// Every SDK log line carries structured attributes (operation, endpoint, attempt,
+// latency, ResponseCode and the M-Pesa correlation identifiers) so that the lines
+// of a single request can be found and aggregated.
 package logger
 
 import (
+	"context"
 	"log/slog"
 	"os"
+	"reflect"
 	"strings"
 )
 
@@ -15,58 +26,137 @@ const (
 	ERROR                 // Logs error messages indicating failures or significant issues.
 )
 
+// Logger is the logger used across the SDK.
 type Logger struct {
-	level  LogLevel
+	level  *slog.LevelVar
 	logger *slog.Logger
 }
 
+// NewLogger creates a logger that writes text lines to os.Stdout, dropping the
+// lines below the given level.
 func NewLogger(level LogLevel) *Logger {
-	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})
-	logger := slog.New(handler)
+	lvl := &slog.LevelVar{}
+	lvl.Set(level.slogLevel())
+	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: lvl})
 
 	return &Logger{
-		level:  level,
-		logger: logger,
+		level:  lvl,
+		logger: slog.New(handler),
 	}
 }
 
+// New wraps a caller supplied slog.Logger, the level and the output format are
+// the ones of its handler.
+func New(l *slog.Logger) *Logger {
+	return &Logger{logger: l}
+}
+
+// Wrap returns a logger whose handler is wrap applied to the current handler, it is
+// used to add handler middlewares such as redaction.
+func (l *Logger) Wrap(wrap func(slog.Handler) slog.Handler) *Logger {
+	return &Logger{level: l.level, logger: slog.New(wrap(l.logger.Handler()))}
+}
+
+// SetLevel changes the level of a logger created with NewLogger, it has no effect
+// on caller supplied loggers.
 func (l *Logger) SetLevel(level LogLevel) {
-	l.level = level
+	if l.level != nil {
+		l.level.Set(level.slogLevel())
+	}
+}
+
+// With returns a logger that adds the given attributes to every line.
+func (l *Logger) With(args ...interface{}) *Logger {
+	return &Logger{level: l.level, logger: l.logger.With(args...)}
+}
+
+// Enabled reports whether lines at the given level are written.
+func (l *Logger) Enabled(level LogLevel) bool {
+	return l.logger.Enabled(context.Background(), level.slogLevel())
 }
 
 func (l *Logger) Debug(msg string, args ...interface{}) {
-	if l.level <= DEBUG {
-		l.logger.Debug(msg, args...)
-	}
+	l.logger.Debug(msg, args...)
 }
 
 func (l *Logger) Info(msg string, args ...interface{}) {
-	if l.level <= INFO {
-		l.logger.Info(msg, args...)
-	}
+	l.logger.Info(msg, args...)
 }
 
 func (l *Logger) Warn(msg string, args ...interface{}) {
-	if l.level <= WARN {
-		l.logger.Warn(msg, args...)
-	}
+	l.logger.Warn(msg, args...)
 }
 
 func (l *Logger) Error(msg string, args ...interface{}) {
-	if l.level <= ERROR {
-		l.logger.Error(msg, args...)
-	}
+	l.logger.Error(msg, args...)
 }
 
+// ParseLevel converts a level name to a LogLevel, unknown names fall back to INFO.
 func ParseLevel(level string) LogLevel {
 	switch strings.ToUpper(level) {
-	case "INFO":
-		return INFO
 	case "DEBUG":
 		return DEBUG
+	case "WARN":
+		return WARN
 	case "ERROR":
 		return ERROR
 	default:
-		return WARN
+		return INFO
+	}
+}
+
+// slogLevel: maps a LogLevel to its slog.Level.
+func (l LogLevel) slogLevel() slog.Level {
+	switch l {
+	case DEBUG:
+		return slog.LevelDebug
+	case WARN:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// correlationFields are the json names of the fields that identify a request or
+// its result on the M-Pesa side.
+var correlationFields = []string{
+	"OriginatorConversationID",
+	"ConversationID",
+	"MerchantRequestID",
+	"CheckoutRequestID",
+	"TransactionID",
+	"ResponseCode",
+}
+
+// CorrelationAttrs returns the non empty correlation identifiers and the ResponseCode
+// of a request or response struct as key/value pairs, keyed by their M-Pesa (json) name.
+// Values that are not structs or pointers to structs yield no attributes.
+func CorrelationAttrs(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var attrs []interface{}
+	rt := rv.Type()
+	for _, name := range correlationFields {
+		for i := 0; i < rt.NumField(); i++ {
+			tag := strings.Split(rt.Field(i).Tag.Get("json"), ",")[0]
+			if tag != name || rv.Field(i).Kind() != reflect.String {
+				continue
+			}
+			if value := rv.Field(i).String(); value != "" {
+				attrs = append(attrs, name, value)
+			}
+		}
 	}
+	return attrs
 }
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, DEBUG, ParseLevel("debug"))
+	assert.Equal(t, WARN, ParseLevel("WARN"))
+	assert.Equal(t, ERROR, ParseLevel("error"))
+	assert.Equal(t, INFO, ParseLevel("INFO"))
+	assert.Equal(t, INFO, ParseLevel("verbose"))
+}
+
+func TestCorrelationAttrs(t *testing.T) {
+	type response struct {
+		ConversationID          string `json:"ConversationID"`
+		OriginatorConversatonId string `json:"OriginatorConversationID"`
+		ResponseCode            string `json:"ResponseCode"`
+		Remarks                 string `json:"Remarks"`
+	}
+
+	attrs := CorrelationAttrs(&response{ConversationID: "AG_1", OriginatorConversatonId: "oc-1", ResponseCode: "0", Remarks: "x"})
+	assert.Equal(t, []interface{}{"OriginatorConversationID", "oc-1", "ConversationID", "AG_1", "ResponseCode", "0"}, attrs)
+	assert.Nil(t, CorrelationAttrs(nil))
+	assert.Nil(t, CorrelationAttrs("not a struct"))
+}
+
+func TestNew_UsesCallerHandler(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	l.Info("dropped")
+	l.With("operation", "b2c_payment").Warn("kept", "attempt", 1)
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "kept", line["msg"])
+	assert.Equal(t, "b2c_payment", line["operation"])
+	assert.Equal(t, float64(1), line["attempt"])
+}
@@ -0,0 +1,148 @@
+// Package policy checks the transfers of the SDK against the configured transaction
+// limits before they are sent to M-Pesa, see types.Limits.
+package policy
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+// Zone is the time zone the daily caps are counted in, M-Pesa Ethiopia days start
+// at midnight East Africa Time.
+var Zone = time.FixedZone("EAT", 3*60*60)
+
+// Policy checks transfers against types.Limits and keeps the daily total of every
+// party in memory. It is safe for concurrent use.
+type Policy struct {
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+
+	limits types.Limits
+	allow  map[string]bool
+	deny   map[string]bool
+	caps   map[string]money.Amount
+
+	mu   sync.Mutex
+	day  string
+	used map[string]money.Amount
+}
+
+// New creates a policy enforcing limits, the parties of the lists and caps are
+// normalized like the requests so that `0712345678` matches `251712345678`.
+func New(limits types.Limits) *Policy {
+	p := &Policy{
+		limits: limits,
+		allow:  partySet(limits.Allow),
+		deny:   partySet(limits.Deny),
+		caps:   map[string]money.Amount{},
+		used:   map[string]money.Amount{},
+	}
+	for party, limit := range limits.PartyDailyCaps {
+		p.caps[normalizeParty(party)] = limit
+	}
+	return p
+}
+
+// Reserve checks a transfer and, when it is allowed, counts its amount in the daily
+// total of its party. The returned release function takes the amount back out, it is
+// called when M-Pesa refused the request, a transfer whose outcome is unknown keeps
+// counting.
+//
+// Returns:
+//   - func(): releases the reservation, it is safe to call it more than once.
+//   - error: a *types.PolicyError when the transfer breaks a limit.
+func (p *Policy) Reserve(t types.Transfer) (func(), error) {
+	party := normalizeParty(t.Party)
+
+	if p.deny[party] {
+		return nil, &types.PolicyError{Rule: types.PolicyDenied, Transfer: t}
+	}
+	if len(p.allow) > 0 && !p.allow[party] {
+		return nil, &types.PolicyError{Rule: types.PolicyNotAllowed, Transfer: t}
+	}
+
+	if limits, ok := p.limits.Commands[t.CommandID]; ok {
+		if !limits.Min.IsZero() && t.Amount.Cmp(limits.Min) < 0 {
+			return nil, &types.PolicyError{Rule: types.PolicyMinAmount, Transfer: t, Limit: limits.Min}
+		}
+		if !limits.Max.IsZero() && t.Amount.Cmp(limits.Max) > 0 {
+			return nil, &types.PolicyError{Rule: types.PolicyMaxAmount, Transfer: t, Limit: limits.Max}
+		}
+	}
+
+	limit, ok := p.caps[party]
+	if !ok {
+		limit = p.limits.DailyCap
+	}
+	if limit.IsZero() {
+		return func() {}, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	day := p.today()
+	used := p.used[party]
+	total, err := used.Add(t.Amount)
+	if err != nil || total.Cmp(limit) > 0 {
+		return nil, &types.PolicyError{Rule: types.PolicyDailyCap, Transfer: t, Limit: limit, Used: used}
+	}
+	p.used[party] = total
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.today() == day {
+				p.used[party], _ = p.used[party].Sub(t.Amount)
+			}
+		})
+	}, nil
+}
+
+// Used returns what a party transferred today.
+func (p *Policy) Used(party string) money.Amount {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.today()
+	return p.used[normalizeParty(party)]
+}
+
+// today: returns the current day and forgets the totals of the previous days, the
+// caller must hold the lock.
+func (p *Policy) today() string {
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+	day := now().In(Zone).Format("2006-01-02")
+	if day != p.day {
+		p.day = day
+		p.used = map[string]money.Amount{}
+	}
+	return day
+}
+
+// normalizeParty: rewrites phone numbers to the 2517XXXXXXXX form, short codes and
+// tills are kept as they are.
+func normalizeParty(party string) string {
+	party = strings.TrimSpace(party)
+	if normalized, err := msisdn.Normalize(party); err == nil {
+		return normalized
+	}
+	return party
+}
+
+// partySet: builds a set of normalized parties.
+func partySet(parties []string) map[string]bool {
+	set := make(map[string]bool, len(parties))
+	for _, party := range parties {
+		set[normalizeParty(party)] = true
+	}
+	return set
+}
@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var limits = types.Limits{
+	Commands: map[types.CommandId]types.AmountLimits{
+		types.BusinessPaymentCommand: {Min: money.Birr(10), Max: money.Birr(1000)},
+	},
+	DailyCap:       money.Birr(1500),
+	PartyDailyCaps: map[string]money.Amount{"0733333333": money.Birr(100)},
+	Deny:           []string{"0799999999"},
+}
+
+func payout(party string, amount int64) types.Transfer {
+	return types.Transfer{CommandID: types.BusinessPaymentCommand, Party: party, Amount: money.Birr(amount)}
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		transfer types.Transfer
+		rule     string
+	}{
+		{"Allowed", payout("251712345678", 500), ""},
+		{"Below minimum", payout("251712345678", 5), types.PolicyMinAmount},
+		{"Above maximum", payout("251712345678", 5000), types.PolicyMaxAmount},
+		{"Denied party", payout("251799999999", 50), types.PolicyDenied},
+		{"Party cap", payout("251733333333", 200), types.PolicyDailyCap},
+		{"Other command", types.Transfer{CommandID: types.SalaryPaymentCommand, Party: "251712345678", Amount: money.Birr(5)}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(limits).Reserve(tt.transfer)
+			if tt.rule == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var perr *types.PolicyError
+			require.True(t, errors.As(err, &perr), err)
+			assert.Equal(t, tt.rule, perr.Rule)
+		})
+	}
+}
+
+func TestReserve_DailyCap(t *testing.T) {
+	now := time.Date(2024, 10, 1, 20, 0, 0, 0, time.UTC) // 23:00 in Addis Ababa
+	p := New(limits)
+	p.Now = func() time.Time { return now }
+
+	_, err := p.Reserve(payout("0712345678", 1000))
+	require.NoError(t, err)
+	release, err := p.Reserve(payout("251712345678", 400))
+	require.NoError(t, err)
+	assert.Equal(t, money.Birr(1400), p.Used("712345678"))
+
+	_, err = p.Reserve(payout("251712345678", 200))
+	var perr *types.PolicyError
+	require.True(t, errors.As(err, &perr))
+	assert.Equal(t, money.Birr(1400), perr.Used)
+	assert.Equal(t, money.Birr(1500), perr.Limit)
+	assert.Contains(t, err.Error(), "daily cap")
+
+	release()
+	release()
+	assert.Equal(t, money.Birr(1000), p.Used("251712345678"))
+
+	now = now.Add(2 * time.Hour) // the next day in Addis Ababa
+	assert.True(t, p.Used("251712345678").IsZero())
+	_, err = p.Reserve(payout("251712345678", 1000))
+	assert.NoError(t, err)
+}
+
+func TestReserve_AllowList(t *testing.T) {
+	p := New(types.Limits{Allow: []string{"+251712345678", "600000"}})
+
+	_, err := p.Reserve(payout("251712345678", 10))
+	assert.NoError(t, err)
+	_, err = p.Reserve(payout("600000", 10))
+	assert.NoError(t, err)
+
+	_, err = p.Reserve(payout("251722222222", 10))
+	var perr *types.PolicyError
+	require.True(t, errors.As(err, &perr))
+	assert.Equal(t, types.PolicyNotAllowed, perr.Rule)
+}
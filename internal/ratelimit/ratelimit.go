@@ -0,0 +1,61 @@
+// Package ratelimit spaces out calls to the M-Pesa API so that batch jobs stay
+// below the throughput the API accepts.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter lets at most Rate calls per second through, with bursts of up to Burst
+// calls after an idle period. A nil Limiter or a zero rate does not limit anything.
+// It is safe for concurrent use.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	next     time.Time
+}
+
+// New creates a limiter of perSecond calls per second and the given burst, a burst
+// below 1 is read as 1.
+func New(perSecond float64, burst int) *Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{interval: time.Duration(float64(time.Second) / perSecond), burst: burst}
+}
+
+// Wait blocks until the next call is allowed or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	// an idle limiter accumulates at most burst calls
+	if earliest := now.Add(-time.Duration(l.burst-1) * l.interval); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(100, 2)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, l.Wait(context.Background()))
+	}
+	// 2 calls go through at once, the 4 others are spaced by 10ms
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 35*time.Millisecond)
+	assert.Less(t, elapsed, 500*time.Millisecond)
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	var l *Limiter = New(0, 1)
+	assert.Nil(t, l)
+	assert.NoError(t, l.Wait(context.Background()))
+}
+
+func TestLimiter_Cancelled(t *testing.T) {
+	l := New(1, 1)
+	assert.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(ctx), context.DeadlineExceeded)
+}
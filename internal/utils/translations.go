@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/go-playground/locales/am"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+)
+
+// englishMessages are the English messages of the SDK specific tags, the other tags
+// use the go-playground English translations.
+var englishMessages = map[string]string{
+	"msisdn_et":           "{0} must be a Safaricom Ethiopia phone number in the 2517XXXXXXXX form",
+	"shortcode":           "{0} must be a short code of 4 to 7 digits",
+	"till":                "{0} must be a till number of 5 to 8 digits",
+	"shortcode|msisdn_et": "{0} must be a short code or a Safaricom Ethiopia phone number",
+	"shortcode|till":      "{0} must be a short code or a till number",
+	"whole_birr":          "{0} must be a whole amount of birr, without santim",
+}
+
+// amharicMessages are the Amharic messages. The rules depending on the size of the
+// value have a `-string` and a `-number` variant.
+var amharicMessages = map[string]string{
+	"required":            "{0} ያስፈልጋል",
+	"min-string":          "{0} ቢያንስ {1} ፊደላት ሊኖሩት ይገባል",
+	"min-number":          "{0} ቢያንስ {1} መሆን አለበት",
+	"max-string":          "{0} ከ{1} ፊደላት መብለጥ የለበትም",
+	"max-number":          "{0} ከ{1} መብለጥ የለበትም",
+	"len-string":          "{0} ርዝመቱ {1} ፊደላት መሆን አለበት",
+	"len-number":          "{0} ከ{1} ጋር እኩል መሆን አለበት",
+	"gte-string":          "{0} ቢያንስ {1} ፊደላት ሊኖሩት ይገባል",
+	"gte-number":          "{0} {1} ወይም ከዚያ በላይ መሆን አለበት",
+	"gt-string":           "{0} ከ{1} በላይ ፊደላት ሊኖሩት ይገባል",
+	"gt-number":           "{0} ከ{1} በላይ መሆን አለበት",
+	"url":                 "{0} ትክክለኛ URL መሆን አለበት",
+	"email":               "{0} ትክክለኛ የኢሜይል አድራሻ መሆን አለበት",
+	"numeric":             "{0} ቁጥር ብቻ መሆን አለበት",
+	"datetime":            "{0} ከ{1} ቅርጸት ጋር አይዛመድም",
+	"oneof":               "{0} ከሚከተሉት አንዱ መሆን አለበት፦ {1}",
+	"msisdn_et":           "{0} 2517XXXXXXXX ቅርጸት ያለው የሳፋሪኮም ኢትዮጵያ ስልክ ቁጥር መሆን አለበት",
+	"shortcode":           "{0} ከ4 እስከ 7 አሃዝ ያለው አጭር ኮድ መሆን አለበት",
+	"till":                "{0} ከ5 እስከ 8 አሃዝ ያለው የቲል ቁጥር መሆን አለበት",
+	"shortcode|msisdn_et": "{0} አጭር ኮድ ወይም የሳፋሪኮም ኢትዮጵያ ስልክ ቁጥር መሆን አለበት",
+	"shortcode|till":      "{0} አጭር ኮድ ወይም የቲል ቁጥር መሆን አለበት",
+	"whole_birr":          "{0} ሳንቲም የሌለው ሙሉ ብር መሆን አለበት",
+}
+
+// sizedTags are the Amharic rules with a `-string` and a `-number` message.
+var sizedTags = []string{"min", "max", "len", "gte", "gt"}
+
+// registerTranslations: registers the English and Amharic messages on v and makes the
+// validator report the JSON names of the fields. The translations are registered per
+// translator instance, the returned translators must be used with v.
+func registerTranslations(v *validator.Validate) *ut.UniversalTranslator {
+	v.RegisterTagNameFunc(jsonFieldName)
+	uni := ut.New(en.New(), en.New(), am.New())
+
+	enTrans, _ := uni.GetTranslator(types.LocaleEnglish)
+	_ = en_translations.RegisterDefaultTranslations(v, enTrans)
+	for tag, msg := range englishMessages {
+		_ = enTrans.Add(tag, msg, true)
+		registerMessage(v, enTrans, tag, false)
+	}
+
+	amTrans, _ := uni.GetTranslator(types.LocaleAmharic)
+	for key, msg := range amharicMessages {
+		_ = amTrans.Add(key, msg, true)
+		if !strings.HasSuffix(key, "-string") && !strings.HasSuffix(key, "-number") {
+			registerMessage(v, amTrans, key, false)
+		}
+	}
+	for _, tag := range sizedTags {
+		registerMessage(v, amTrans, tag, true)
+	}
+	return uni
+}
+
+// registerMessage: registers the translation of tag, the message key is the tag or,
+// for sized rules, the tag with the `-string` or `-number` suffix.
+func registerMessage(v *validator.Validate, trans ut.Translator, tag string, sized bool) {
+	_ = v.RegisterTranslation(tag, trans, func(ut.Translator) error { return nil },
+		func(t ut.Translator, fe validator.FieldError) string {
+			key := tag
+			if sized {
+				key = tag + "-number"
+				if kind := fe.Kind(); kind == reflect.String || kind == reflect.Slice || kind == reflect.Map {
+					key = tag + "-string"
+				}
+			}
+			s, err := t.T(key, fe.Field(), fe.Param())
+			if err != nil {
+				return fe.Error()
+			}
+			return s
+		})
+}
+
+// jsonFieldName: returns the JSON name of a struct field.
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+// toValidationError: converts the errors of the validator into a types.ValidationError
+// with the English and Amharic messages. Validators without a Translator only get the
+// default English message of the validator package.
+func toValidationError(v *types.Validator, data any, errs validator.ValidationErrors) *types.ValidationError {
+	uni := v.Translator
+
+	out := &types.ValidationError{Request: requestName(data), Fields: make([]types.FieldError, 0, len(errs))}
+	for _, fe := range errs {
+		field := fe.Namespace()
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest
+		}
+
+		messages := map[string]string{}
+		for _, locale := range []string{types.LocaleEnglish, types.LocaleAmharic} {
+			if uni == nil {
+				break
+			}
+			trans, _ := uni.GetTranslator(locale)
+			if msg := fe.Translate(trans); msg != fe.Error() {
+				messages[locale] = msg
+			}
+		}
+		if _, ok := messages[types.LocaleEnglish]; !ok {
+			messages[types.LocaleEnglish] = fe.Error()
+		}
+
+		out.Fields = append(out.Fields, types.FieldError{
+			Field:    field,
+			Tag:      fe.Tag(),
+			Param:    fe.Param(),
+			Messages: messages,
+		})
+	}
+	return out
+}
+
+// toFieldError: converts the errors of the validator on a single value into a
+// types.ValidationError reporting them under field. The messages are the ones of the tags
+// registered by NewValidator, other tags only get the default English message.
+func toFieldError(v *types.Validator, data any, field string, errs validator.ValidationErrors) *types.ValidationError {
+	out := &types.ValidationError{Request: requestName(data), Fields: make([]types.FieldError, 0, len(errs))}
+	for _, fe := range errs {
+		messages := map[string]string{}
+		for _, locale := range []string{types.LocaleEnglish, types.LocaleAmharic} {
+			if v.Translator == nil {
+				break
+			}
+			trans, _ := v.Translator.GetTranslator(locale)
+			if msg, err := trans.T(fe.Tag(), field, fe.Param()); err == nil {
+				messages[locale] = msg
+			}
+		}
+		if _, ok := messages[types.LocaleEnglish]; !ok {
+			messages[types.LocaleEnglish] = field + " failed on the '" + fe.Tag() + "' tag"
+		}
+
+		out.Fields = append(out.Fields, types.FieldError{
+			Field:    field,
+			Tag:      fe.Tag(),
+			Param:    fe.Param(),
+			Messages: messages,
+		})
+	}
+	return out
+}
+
+// requestName: returns the name of the type of a request, without the pointers.
+func requestName(data any) string {
+	t := reflect.TypeOf(data)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
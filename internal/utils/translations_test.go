@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type PaymentStruct struct {
+	Remarks string      `json:"Remarks" validate:"required,max=10"`
+	Amount  uint        `json:"amount_value" validate:"gte=1"`
+	PartyB  uint        `json:"PartyB" validate:"msisdn_et"`
+	Items   []ItemValue `json:"Items" validate:"dive"`
+}
+
+type ItemValue struct {
+	Key string `json:"Key" validate:"required"`
+}
+
+func TestValidate_StructuredErrors(t *testing.T) {
+	err := Validate(NewValidator(), &PaymentStruct{
+		Remarks: "a remark that is too long",
+		PartyB:  251912345678,
+		Items:   []ItemValue{{}},
+	})
+
+	var verr *types.ValidationError
+	require.True(t, errors.As(err, &verr), err)
+	assert.Equal(t, "PaymentStruct", verr.Request)
+
+	tests := []struct {
+		field   string
+		tag     string
+		english string
+		amharic string
+	}{
+		{"Remarks", "max", "Remarks must be a maximum of 10 characters in length", "Remarks ከ10 ፊደላት መብለጥ የለበትም"},
+		{"amount_value", "gte", "amount_value must be 1 or greater", "amount_value 1 ወይም ከዚያ በላይ መሆን አለበት"},
+		{"PartyB", "msisdn_et", "PartyB must be a Safaricom Ethiopia phone number in the 2517XXXXXXXX form",
+			"PartyB 2517XXXXXXXX ቅርጸት ያለው የሳፋሪኮም ኢትዮጵያ ስልክ ቁጥር መሆን አለበት"},
+		{"Items[0].Key", "required", "Key is a required field", "Key ያስፈልጋል"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			fe, ok := verr.Field(tt.field)
+			require.True(t, ok)
+			assert.Equal(t, tt.tag, fe.Tag)
+			assert.Equal(t, tt.english, fe.Message(types.LocaleEnglish))
+			assert.Equal(t, tt.amharic, fe.Message(types.LocaleAmharic))
+		})
+	}
+
+	assert.Contains(t, verr.Error(), "invalid PaymentStruct: Remarks must be a maximum of 10 characters in length")
+	assert.Equal(t, "Key ያስፈልጋል", verr.Messages(types.LocaleAmharic)["Items[0].Key"])
+
+	data, err := json.Marshal(verr)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"field":"PartyB"`)
+}
+
+func TestValidate_PlainValidator(t *testing.T) {
+	err := Validate(&types.Validator{Validate: validator.New()}, TestStruct{Email: "john@example.com", Age: 25})
+
+	var verr *types.ValidationError
+	require.True(t, errors.As(err, &verr))
+	fe, ok := verr.Field("Name")
+	require.True(t, ok)
+	assert.Contains(t, fe.Message(types.LocaleAmharic), "'required' tag")
+}
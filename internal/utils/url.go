@@ -23,7 +23,10 @@
 // Output: /v1/someendpoint?apikey=*****************
 package utils
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
 
 const ProductionURL = "https://api.safaricom.et"
 const SandboxURL = "https://apisandbox.safaricom.et"
@@ -49,6 +52,22 @@ func ConstructURL(env string, endpoint string) string {
 	return finUrl
 }
 
+// ConstructURLWithBase works like ConstructURL but uses base instead of the environment
+// URL when base is not empty. It is used to point the SDK to a proxy or a fake server.
+//
+// Example usage:
+//
+//	url := ConstructURLWithBase("http://127.0.0.1:8080", "PRODUCTION", "/v1/endpoint")
+//	fmt.Println(url)
+//
+// Output: http://127.0.0.1:8080/v1/endpoint
+func ConstructURLWithBase(base string, env string, endpoint string) string {
+	if base == "" {
+		return ConstructURL(env, endpoint)
+	}
+	return strings.TrimSuffix(base, "/") + endpoint
+}
+
 // baseUrl: determines and returns the correct base URL based on the environment.
 //
 // Parameters:
@@ -1,25 +1,158 @@
 package utils
 
-import "github.com/go-playground/validator/v10"
+import (
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/go-playground/validator/v10"
+)
+
+// NewValidator creates the validator instance used by the SDK to validate requests.
+// It is shared by the App and by the fake server of the mpesatest package so that
+// both apply the same rules. On top of the built in tags it registers:
+//
+//	- `msisdn_et`: a normalized Safaricom Ethiopia phone number, `2517XXXXXXXX` (see the msisdn package).
+//	- `shortcode`: an organization short code, 4 to 7 digits.
+//	- `till`: a buy goods till number, 5 to 8 digits.
+//	- `whole_birr`: a money.Amount without santim.
+//
+// The tags accept string and integer fields. money.Amount fields are validated as their
+// value in birr, so that `gte=1` means at least 1.00 ETB. Errors report the JSON names of the fields
+// and carry English and Amharic messages, see Validate. The translators of the messages are kept
+// in the returned types.Validator, they are released with it.
+func NewValidator() *types.Validator {
+	v := validator.New()
+	uni := registerTranslations(v)
+	_ = v.RegisterValidation("msisdn_et", digitsValidation(msisdn.Valid))
+	_ = v.RegisterValidation("shortcode", digitsValidation(func(s string) bool { return numberOfDigits(s, 4, 7) }))
+	_ = v.RegisterValidation("till", digitsValidation(func(s string) bool { return numberOfDigits(s, 5, 8) }))
+	_ = v.RegisterValidation("whole_birr", wholeBirr)
+	v.RegisterCustomTypeFunc(amountInBirr, money.Amount{})
+	return &types.Validator{Validate: v, Translator: uni}
+}
+
+// amountInBirr: exposes money.Amount fields to the validator as their value in birr.
+func amountInBirr(field reflect.Value) interface{} {
+	if a, ok := field.Interface().(money.Amount); ok {
+		return a.Float64()
+	}
+	return nil
+}
+
+// wholeBirr: reports whether an amount, seen in birr, has no santim.
+func wholeBirr(fl validator.FieldLevel) bool {
+	f := fl.Field()
+	switch f.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return f.Float() == math.Trunc(f.Float())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// digitsValidation: adapts a check on the decimal form of a string or integer field
+// to a validator function.
+func digitsValidation(valid func(s string) bool) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		f := fl.Field()
+		switch f.Kind() {
+		case reflect.String:
+			return valid(f.String())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return valid(strconv.FormatInt(f.Int(), 10))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return valid(strconv.FormatUint(f.Uint(), 10))
+		}
+		return false
+	}
+}
+
+// numberOfDigits: reports whether s is a number of min to max digits without a leading zero.
+func numberOfDigits(s string, min, max int) bool {
+	if len(s) < min || len(s) > max || s[0] == '0' {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
 
 // Validate performs struct-level validation using the provided validator instance.
 //
 // It takes a validator from the `go-playground/validator` package and a struct `data`
-// to be validated. If the struct fails validation, it returns a `ValidationErrors` type
-// containing all the validation errors. If the error is of another kind, it returns that error directly.
-// If the struct passes validation, it returns nil.
+// to be validated. If the struct fails validation, it returns a `*types.ValidationError`
+// listing every invalid field by its JSON name with English and Amharic messages. If the
+// error is of another kind, it returns that error directly. If the struct passes validation,
+// it returns nil.
 //
 // Parameters:
-//	- v: an initialized *validator.Validate instance.
+//	- v: a validator created by NewValidator.
 //	- data: the struct to be validated.
 //
 // Returns:
 //	- error: nil if the struct is valid, otherwise a detailed validation error.
-func Validate(v *validator.Validate, data any) error {
+func Validate(v *types.Validator, data any) error {
 	if err := v.Struct(data); err != nil {
 		errCasted, ok := err.(validator.ValidationErrors)
 		if ok {
-			return errCasted
+			return toValidationError(v, data, errCasted)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ValidatePartial validates only the given fields of a struct, named as Go fields (`PartyB`),
+// for callers holding part of a request, such as a row of a payout file. Errors are
+// reported as by Validate.
+//
+// Parameters:
+//	- v: a validator created by NewValidator.
+//	- data: the struct to be validated.
+//	- fields: the names of the fields to validate.
+//
+// Returns:
+//	- error: nil if the fields are valid, otherwise a detailed validation error.
+func ValidatePartial(v *types.Validator, data any, fields ...string) error {
+	if err := v.StructPartial(data, fields...); err != nil {
+		errCasted, ok := err.(validator.ValidationErrors)
+		if ok {
+			return toValidationError(v, data, errCasted)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ValidateField validates a single value of a struct against rules chosen at run time,
+// for the fields whose rules depend on other fields, such as the CPI of a dynamic QR code.
+// Errors are reported as by Validate, under the given JSON name of the field.
+//
+// Parameters:
+//	- v: a validator created by NewValidator.
+//	- data: the struct holding the value, it names the request in the error.
+//	- field: the JSON name of the field.
+//	- value: the value to be validated.
+//	- tag: the rules, such as `till` or `shortcode|till`.
+//
+// Returns:
+//	- error: nil if the value is valid, otherwise a detailed validation error.
+func ValidateField(v *types.Validator, data any, field string, value any, tag string) error {
+	if err := v.Var(value, tag); err != nil {
+		errCasted, ok := err.(validator.ValidationErrors)
+		if ok {
+			return toFieldError(v, data, field, errCasted)
 		}
 		return err
 	}
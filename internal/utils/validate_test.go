@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
 	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type TestStruct struct {
@@ -14,7 +18,7 @@ type TestStruct struct {
 }
 
 func TestValidate_Success(t *testing.T) {
-	validate := validator.New()
+	validate := &types.Validator{Validate: validator.New()}
 
 	data := TestStruct{
 		Name:  "John Doe",
@@ -28,7 +32,7 @@ func TestValidate_Success(t *testing.T) {
 }
 
 func TestValidate_InvalidName(t *testing.T) {
-	validate := validator.New()
+	validate := &types.Validator{Validate: validator.New()}
 
 	data := TestStruct{
 		Name:  "",
@@ -42,7 +46,7 @@ func TestValidate_InvalidName(t *testing.T) {
 }
 
 func TestValidate_InvalidEmail(t *testing.T) {
-	validate := validator.New()
+	validate := &types.Validator{Validate: validator.New()}
 
 	data := TestStruct{
 		Name:  "John Doe",
@@ -57,7 +61,7 @@ func TestValidate_InvalidEmail(t *testing.T) {
 }
 
 func TestValidate_InvalidAge(t *testing.T) {
-	validate := validator.New()
+	validate := &types.Validator{Validate: validator.New()}
 
 	data := TestStruct{
 		Name:  "John Doe",
@@ -70,3 +74,100 @@ func TestValidate_InvalidAge(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "Age")
 }
+
+type PartiesStruct struct {
+	Phone     string `validate:"msisdn_et"`
+	PhoneUint uint   `validate:"msisdn_et"`
+	ShortCode int    `validate:"shortcode"`
+	Till      string `validate:"till"`
+}
+
+func TestNewValidator_CustomTags(t *testing.T) {
+	validate := NewValidator()
+
+	valid := PartiesStruct{Phone: "251712345678", PhoneUint: 251712345678, ShortCode: 600000, Till: "123456"}
+	assert.NoError(t, Validate(validate, valid))
+
+	tests := []struct {
+		name  string
+		field string
+		data  PartiesStruct
+	}{
+		{"Local phone", "Phone", PartiesStruct{Phone: "0712345678", PhoneUint: 251712345678, ShortCode: 600000, Till: "123456"}},
+		{"Other operator", "PhoneUint", PartiesStruct{Phone: "251712345678", PhoneUint: 251912345678, ShortCode: 600000, Till: "123456"}},
+		{"Short code too long", "ShortCode", PartiesStruct{Phone: "251712345678", PhoneUint: 251712345678, ShortCode: 60000000, Till: "123456"}},
+		{"Till with letters", "Till", PartiesStruct{Phone: "251712345678", PhoneUint: 251712345678, ShortCode: 600000, Till: "12A456"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(validate, tt.data)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.field)
+		})
+	}
+}
+
+type AmountStruct struct {
+	Amount money.Amount `json:"Amount" validate:"required,gte=1,whole_birr"`
+}
+
+func TestNewValidator_Amounts(t *testing.T) {
+	validate := NewValidator()
+	assert.NoError(t, Validate(validate, AmountStruct{Amount: money.Birr(10)}))
+
+	tests := []struct {
+		name   string
+		amount money.Amount
+		tag    string
+	}{
+		{"Zero", money.Zero, "required"},
+		{"Below one birr", money.Santim(50), "gte"},
+		{"With santim", money.Santim(1050), "whole_birr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(validate, AmountStruct{Amount: tt.amount})
+			var verr *types.ValidationError
+			require.True(t, errors.As(err, &verr), err)
+			fe, ok := verr.Field("Amount")
+			require.True(t, ok)
+			assert.Equal(t, tt.tag, fe.Tag)
+		})
+	}
+}
+
+func TestValidatePartial(t *testing.T) {
+	validate := NewValidator()
+	data := TestStruct{Name: "John Doe", Email: "notanemail"}
+
+	assert.NoError(t, ValidatePartial(validate, data, "Name"))
+
+	err := ValidatePartial(validate, data, "Name", "Email")
+	var verr *types.ValidationError
+	require.True(t, errors.As(err, &verr), err)
+	require.Len(t, verr.Fields, 1)
+	assert.Equal(t, "Email", verr.Fields[0].Field)
+}
+
+func TestValidateField(t *testing.T) {
+	validate := NewValidator()
+	data := PartiesStruct{}
+
+	assert.NoError(t, ValidateField(validate, data, "Party", "123456", "till"))
+
+	err := ValidateField(validate, data, "Party", "251712345678", "shortcode|till")
+	var verr *types.ValidationError
+	require.True(t, errors.As(err, &verr), err)
+	assert.Equal(t, "PartiesStruct", verr.Request)
+	fe, ok := verr.Field("Party")
+	require.True(t, ok)
+	assert.Equal(t, "shortcode|till", fe.Tag)
+	assert.Equal(t, "Party must be a short code or a till number", fe.Message(types.LocaleEnglish))
+	assert.Equal(t, "Party አጭር ኮድ ወይም የቲል ቁጥር መሆን አለበት", fe.Message(types.LocaleAmharic))
+
+	err = ValidateField(&types.Validator{Validate: validator.New()}, data, "Party", "x", "numeric")
+	require.True(t, errors.As(err, &verr), err)
+	assert.Equal(t, "Party failed on the 'numeric' tag", verr.Fields[0].Message(types.LocaleEnglish))
+}
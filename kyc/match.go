@@ -0,0 +1,104 @@
+package kyc
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultThreshold is the Similarity from which two names are considered the same person.
+const DefaultThreshold = 0.8
+
+// initialScore is the similarity of an initial, such as "K.", and a word starting with it.
+const initialScore = 0.75
+
+// Match reports whether the registered name of a customer is similar enough to the
+// expected one, see Similarity and DefaultThreshold.
+func Match(expected, registered string) bool {
+	return Similarity(expected, registered) >= DefaultThreshold
+}
+
+// Similarity returns how close two person names are, from 0 when they have nothing in
+// common to 1 when they are the same. The names are compared word by word, ignoring
+// case, punctuation, digits and the order of the words, so "KEBEDE, Abebe" is the same
+// as "Abebe Kebede". Each word of the shorter name is paired with the most similar word
+// left in the longer one, by edit distance, and the score is the average similarity of
+// the pairs:
+//   - a missing word of the longer name does not lower the score, "Abebe Kebede" is
+//     the same as "Abebe Kebede Tesfaye", but a single word is compared to two words of
+//     the longer name so "Abebe" alone scores 0.5 against "Abebe Kebede";
+//   - a typo only lowers the score of its word, "Abebe Kebde" scores 0.92;
+//   - an initial scores 0.75 against a word starting with it, "A. Kebede" scores 0.88.
+func Similarity(a, b string) float64 {
+	wa, wb := words(a), words(b)
+	if len(wa) > len(wb) {
+		wa, wb = wb, wa
+	}
+	if len(wa) == 0 {
+		return 0
+	}
+
+	used := make([]bool, len(wb))
+	var total float64
+	for _, w := range wa {
+		best, at := 0.0, -1
+		for i, candidate := range wb {
+			if used[i] {
+				continue
+			}
+			if s := wordSimilarity(w, candidate); s > best {
+				best, at = s, i
+			}
+		}
+		if at >= 0 {
+			used[at] = true
+			total += best
+		}
+	}
+	return total / float64(max(len(wa), min(2, len(wb))))
+}
+
+// words: splits a name into lower case words of letters.
+func words(name string) [][]rune {
+	var out [][]rune
+	for _, w := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsMark(r)
+	}) {
+		out = append(out, []rune(w))
+	}
+	return out
+}
+
+// wordSimilarity: returns 1 minus the edit distance of two words relative to the longer one.
+func wordSimilarity(a, b []rune) float64 {
+	if len(a) == 1 || len(b) == 1 {
+		if a[0] == b[0] {
+			if len(a) == len(b) {
+				return 1
+			}
+			return initialScore
+		}
+		return 0
+	}
+	return 1 - float64(distance(a, b))/float64(max(len(a), len(b)))
+}
+
+// distance: returns the Levenshtein distance of two words.
+func distance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,37 @@
+package kyc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name       string
+		expected   string
+		registered string
+		want       float64
+		match      bool
+	}{
+		{"Same name", "Abebe Kebede", "Abebe Kebede", 1, true},
+		{"Case and punctuation", "KEBEDE, Abebe", "abebe kebede", 1, true},
+		{"Grandfather name missing", "Abebe Kebede", "Abebe Kebede Tesfaye", 1, true},
+		{"Public name with msisdn", "Abebe Kebede", "251712345678 - Abebe Kebede", 1, true},
+		{"Typo", "Abebe Kebde", "Abebe Kebede", 0.92, true},
+		{"Initial", "A. Kebede", "Abebe Kebede", 0.88, true},
+		{"Two initials", "A K", "Abebe Kebede", 0.75, false},
+		{"Given name only", "Abebe", "Abebe Kebede", 0.5, false},
+		{"Other father", "Abebe Kebede", "Abebe Tesfaye", 0.64, false},
+		{"Other person", "Almaz Tesfaye", "Abebe Kebede Tesfaye", 0.6, false},
+		{"Ethiopic script", "አበበ ከበደ", "ከበደ አበበ", 1, true},
+		{"Empty", "", "Abebe Kebede", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, Similarity(tt.expected, tt.registered), 0.01)
+			assert.InDelta(t, Similarity(tt.expected, tt.registered), Similarity(tt.registered, tt.expected), 1e-9, "symmetric")
+			assert.Equal(t, tt.match, Match(tt.expected, tt.registered))
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Package kyc confirms who an MSISDN belongs to before money is paid out to it.
+//
+// NameCheckRequest asks M-Pesa for the name registered for an MSISDN and Similarity
+// compares that name with the one the organization expects, so that a payout to a
+// mistyped number is refused instead of paying the wrong person. The SDK runs the check
+// on its own before a B2C payment when b2c.B2CRequest.ExpectedName is set.
+//
+// The name check API is enabled per organization by Safaricom and is not part of the
+// public M-Pesa API reference, so the SDK has no default path for it: confirm the path
+// with the account manager of the organization and set it with
+// mpesagosdk.WithNameCheckEndpoint. Until then the checks fail with ErrNoEndpoint.
+//
+// Example usage:
+//
+//	res, err := app.CheckCustomerName(kyc.NameCheckRequest{
+//		Msisdn:                   "0712345678",
+//		OriginatorConversationID: uuid.NewString(),
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if !kyc.Match("Abebe Kebede", res.CustomerName) {
+//		log.Fatalf("%v is registered to %v", res.Msisdn, res.CustomerName)
+//	}
+package kyc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/msisdn"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+// ErrNoEndpoint is returned by the name checks when the path of the name check API is not
+// configured, nothing is sent to M-Pesa.
+var ErrNoEndpoint = errors.New("kyc: the name check endpoint is not configured, set the path Safaricom " +
+	"enabled for the organization with WithNameCheckEndpoint or MPESA_NAME_CHECK_ENDPOINT")
+
+// NameCheckRequest asks for the name registered for an MSISDN, the answer is synchronous.
+//
+// Fields:
+//   - InitiatorName: The API operator username, the configured default when empty.
+//   - SecurityCredential: The encrypted initiator password, the configured default when empty.
+//   - PartyA: The organization short code, the configured default when empty.
+//   - Msisdn: The checked customer, rewritten to the 2517XXXXXXXX form.
+//   - OriginatorConversationID: The unique identifier of the request.
+type NameCheckRequest struct {
+	InitiatorName            string `json:"InitiatorName" validate:"required"`
+	SecurityCredential       string `json:"SecurityCredential" validate:"required"`
+	PartyA                   string `json:"PartyA" validate:"required,shortcode"`
+	Msisdn                   string `json:"Msisdn" validate:"required,msisdn_et"`
+	OriginatorConversationID string `json:"OriginatorConversationID" validate:"required,max=255"`
+}
+
+// NameCheckResponse is the name registered for an MSISDN.
+//
+// Fields:
+//   - ConversationID: The identifier of the request assigned by M-Pesa.
+//   - OriginatorConversationID: The identifier of the request.
+//   - ResponseCode: "0" when the customer was found.
+//   - ResponseDescription: The description of the ResponseCode.
+//   - Msisdn: The checked customer.
+//   - CustomerName: The name the customer registered with, as M-Pesa shows it.
+type NameCheckResponse struct {
+	ConversationID           string `json:"ConversationID"`
+	OriginatorConversationID string `json:"OriginatorConversationID"`
+	ResponseCode             string `json:"ResponseCode"`
+	ResponseDescription      string `json:"ResponseDescription"`
+	Msisdn                   string `json:"Msisdn"`
+	CustomerName             string `json:"CustomerName"`
+}
+
+func (n *NameCheckRequest) DecodeResponse(res *http.Response) (types.MpesaResponse, error) {
+	bodyData, _ := io.ReadAll(res.Body)
+	defer res.Body.Close()
+
+	responseData := NameCheckResponse{}
+	err := json.Unmarshal(bodyData, &responseData)
+	if err != nil {
+		return nil, err
+	}
+
+	if responseData.ResponseCode != "0" {
+		errorResponseData := &types.MpesaErrorResponse{}
+		err := json.Unmarshal(bodyData, &errorResponseData)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, errorResponseData
+	}
+
+	return responseData, nil
+}
+
+func (n *NameCheckRequest) FillDefaults() {}
+
+// ApplyDefaults: fills the initiator and short code from the configured defaults when
+// they are not set on the request.
+func (n *NameCheckRequest) ApplyDefaults(d types.Defaults) {
+	n.InitiatorName = types.OrDefault(n.InitiatorName, d.InitiatorName)
+	n.SecurityCredential = types.OrDefault(n.SecurityCredential, d.SecurityCredential)
+	n.PartyA = types.OrDefault(n.PartyA, d.ShortCode)
+}
+
+// Normalize: rewrites the customer to the 2517XXXXXXXX form, so 0712345678 is sent as 251712345678.
+func (n *NameCheckRequest) Normalize() {
+	if m, err := msisdn.Normalize(n.Msisdn); err == nil {
+		n.Msisdn = m
+	}
+}
+
+func (n *NameCheckRequest) Validate(v *types.Validator) error {
+	return utils.Validate(v, n)
+}
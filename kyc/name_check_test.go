@@ -0,0 +1,55 @@
+package kyc
+
+import (
+	"testing"
+
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameCheckRequestValidation(t *testing.T) {
+	v := utils.NewValidator()
+	valid := func() NameCheckRequest {
+		return NameCheckRequest{
+			InitiatorName:            "testapi",
+			SecurityCredential:       "security-credential",
+			PartyA:                   "600000",
+			Msisdn:                   "251712345678",
+			OriginatorConversationID: "kyc-1",
+		}
+	}
+	tests := []struct {
+		name    string
+		edit    func(r *NameCheckRequest)
+		wantErr bool
+	}{
+		{"Valid Input", func(r *NameCheckRequest) {}, false},
+		{"Missing Initiator", func(r *NameCheckRequest) { r.InitiatorName = "" }, true},
+		{"Invalid Short Code", func(r *NameCheckRequest) { r.PartyA = "60a000" }, true},
+		{"Invalid Msisdn", func(r *NameCheckRequest) { r.Msisdn = "12345" }, true},
+		{"Missing OriginatorConversationID", func(r *NameCheckRequest) { r.OriginatorConversationID = "" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.edit(&req)
+			err := req.Validate(v)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNameCheckRequestDefaults(t *testing.T) {
+	req := NameCheckRequest{Msisdn: "0712345678", InitiatorName: "operator"}
+	req.ApplyDefaults(types.Defaults{ShortCode: "600000", InitiatorName: "testapi", SecurityCredential: "credential"})
+	req.Normalize()
+	assert.Equal(t, "operator", req.InitiatorName)
+	assert.Equal(t, "credential", req.SecurityCredential)
+	assert.Equal(t, "600000", req.PartyA)
+	assert.Equal(t, "251712345678", req.Msisdn)
+}
@@ -0,0 +1,363 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/mpesatest"
+	"github.com/coleYab/mpesagosdk/transaction"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a manual time source for the deadlines.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// recorder collects the events of a tracker.
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) transitions(id string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, e := range r.events {
+		if e.Payment.ID == id {
+			out = append(out, string(e.From)+">"+string(e.To)+":"+string(e.Source))
+		}
+	}
+	return out
+}
+
+// newTracker: a tracker of an app talking to srv, receiving its callbacks.
+func newTracker(t *testing.T, srv *mpesatest.Server) (*Tracker, *clock, *recorder) {
+	tracker := New(nil)
+	clk := &clock{now: time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)}
+	rec := &recorder{}
+	tracker.Now, tracker.OnTransition = clk.Now, rec.record
+
+	callbacks := httptest.NewServer(callback.Handlers{
+		OnResult: tracker.HandleResult,
+		OnSTK:    tracker.HandleSTKCallback,
+	})
+	t.Cleanup(callbacks.Close)
+
+	app, err := mpesagosdk.New(append(srv.Options(),
+		mpesagosdk.WithShortCode("600000"),
+		mpesagosdk.WithInitiator("testapi", "security-credential"),
+		mpesagosdk.WithPassKey(srv.PassKey),
+		mpesagosdk.WithResultURL(callbacks.URL+"/result"),
+		mpesagosdk.WithQueueTimeOutURL(callbacks.URL+"/timeout"),
+		mpesagosdk.WithCallBackURL(callbacks.URL+"/stk"),
+	)...)
+	require.NoError(t, err)
+	tracker.Client = app
+	return tracker, clk, rec
+}
+
+func ussdRequest(id string) c2b.USSDPaymentRequest {
+	return c2b.USSDPaymentRequest{
+		MerchantRequestID: id,
+		TransactionType:   types.TransactionType("CustomerPayBillOnline"),
+		Amount:            money.Birr(20),
+		PartyA:            "251712345678",
+		PartyB:            "600000",
+		PhoneNumber:       "251712345678",
+		AccountReference:  "invoice-1",
+		TransactionDesc:   "payment",
+	}
+}
+
+func b2cRequest(id string, amount money.Amount) b2c.B2CRequest {
+	return b2c.B2CRequest{
+		CommandID:                types.BusinessPaymentCommand,
+		Amount:                   amount,
+		PartyB:                   251712345678,
+		Remarks:                  "salary",
+		Occasion:                 "october",
+		OriginatorConversationID: id,
+	}
+}
+
+func waitFor(t *testing.T, tracker *Tracker, id string) Payment {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := tracker.Wait(ctx, id)
+	require.NoError(t, err)
+	return p
+}
+
+func TestUSSDPayment_Callback(t *testing.T) {
+	srv := mpesatest.NewServer()
+	srv.PassKey = "test-pass-key"
+	defer srv.Close()
+	tracker, _, rec := newTracker(t, srv)
+
+	p, err := tracker.USSDPayment(ussdRequest("merchant-1"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, p.CheckoutRequestID)
+
+	p = waitFor(t, tracker, "merchant-1")
+	assert.Equal(t, StateSucceeded, p.State)
+	assert.NotEmpty(t, p.TransactionID)
+	assert.Equal(t, "0", p.ResultCode)
+	assert.Equal(t, []string{">submitted:request", "submitted>acknowledged:request", "acknowledged>succeeded:callback"},
+		rec.transitions("merchant-1"))
+}
+
+func TestUSSDPayment_QueryFallback(t *testing.T) {
+	srv := mpesatest.NewServer()
+	srv.PassKey = "test-pass-key"
+	defer srv.Close()
+	cancelled := mpesatest.STKCancelled()
+	cancelled.DropCallback = true
+	srv.AddRule(cancelled)
+	tracker, clk, rec := newTracker(t, srv)
+
+	_, err := tracker.USSDPayment(ussdRequest("merchant-2"))
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+
+	tracker.Poll(context.Background()) // before the deadline
+	p, _ := tracker.Get("merchant-2")
+	assert.Equal(t, StateAcknowledged, p.State)
+	assert.Zero(t, p.Polls)
+
+	clk.Advance(DefaultDeadline)
+	tracker.Poll(context.Background())
+	p, _ = tracker.Get("merchant-2")
+	assert.Equal(t, StateFailed, p.State)
+	assert.Equal(t, mpesatest.ResultSTKCancelled, p.ResultCode)
+	assert.Equal(t, 1, p.Polls)
+	assert.Equal(t, "acknowledged>failed:query", rec.transitions("merchant-2")[2])
+}
+
+func TestB2CPayment(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.SetBalance(money.Birr(500))
+	srv.AddRule(mpesatest.DropCallback().OnEndpoint(mpesatest.EndpointB2C).ForAmount(money.Birr(100)))
+	tracker, clk, rec := newTracker(t, srv)
+
+	// the callback is dropped, the status query finds the payment
+	_, err := tracker.B2CPayment(b2cRequest("payroll-1", money.Birr(100)))
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	clk.Advance(DefaultDeadline)
+	tracker.Poll(context.Background())
+	p := waitFor(t, tracker, "payroll-1")
+	assert.Equal(t, StateSucceeded, p.State)
+	assert.NotEmpty(t, p.TransactionID)
+	assert.Equal(t, "acknowledged>succeeded:query", rec.transitions("payroll-1")[2])
+
+	// the callback reports the failure
+	_, err = tracker.B2CPayment(b2cRequest("payroll-2", money.Birr(1000)))
+	require.NoError(t, err)
+	p = waitFor(t, tracker, "payroll-2")
+	assert.Equal(t, StateFailed, p.State)
+	assert.Equal(t, mpesatest.ResultInsufficientFunds, p.ResultCode)
+
+	_, err = tracker.B2CPayment(b2cRequest("payroll-2", money.Birr(10)))
+	assert.EqualError(t, err, `b2c_payment "payroll-2" is already tracked`)
+	_, err = tracker.B2CPayment(b2cRequest("", money.Birr(10)))
+	assert.Error(t, err)
+}
+
+func TestPoll_TimedOut(t *testing.T) {
+	fake := mpesatest.NewFakeClient()
+	fake.USSDQueryFunc = func(c2b.USSDQueryRequest) (*c2b.USSDQueryResponse, error) {
+		return nil, &types.MpesaErrorResponse{ErrorCode: c2b.USSDQueryPending, ErrorMessage: "The transaction is being processed"}
+	}
+	clk := &clock{now: time.Now()}
+	rec := &recorder{}
+	tracker := &Tracker{Client: fake, MaxPolls: 2, Now: clk.Now, OnTransition: rec.record}
+
+	p, err := tracker.USSDPayment(ussdRequest("merchant-3"))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		clk.Advance(DefaultDeadline)
+		tracker.Poll(context.Background())
+	}
+	p, _ = tracker.Get("merchant-3")
+	assert.Equal(t, StateTimedOut, p.State)
+	assert.Equal(t, 2, p.Polls)
+	assert.Len(t, fake.CallsTo(mpesatest.OperationUSSDQuery), 2)
+	assert.Equal(t, "acknowledged>timed_out:deadline", rec.transitions("merchant-3")[2])
+
+	// a late callback still concludes the payment
+	cb := &callback.STKCallback{}
+	cb.Body.StkCallback.CheckoutRequestID = p.CheckoutRequestID
+	cb.Body.StkCallback.ResultCode = callback.Success
+	cb.SetMetadata("MpesaReceiptNumber", callback.StringValue("RKT0000001"))
+	require.NoError(t, tracker.HandleSTKCallback(context.Background(), cb))
+	p, _ = tracker.Get("merchant-3")
+	assert.Equal(t, StateSucceeded, p.State)
+	assert.Equal(t, "RKT0000001", p.TransactionID)
+
+	// a duplicate callback is ignored
+	require.NoError(t, tracker.HandleSTKCallback(context.Background(), cb))
+	assert.Len(t, rec.transitions("merchant-3"), 4)
+}
+
+func TestSubmit_Errors(t *testing.T) {
+	fake := mpesatest.NewFakeClient()
+	fake.B2CPaymentFunc = func(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
+		if req.OriginatorConversationID == "refused" {
+			return nil, &types.MpesaErrorResponse{ErrorCode: "401.002.01", ErrorMessage: "Error Occurred - Invalid Access Token", StatusCode: 401}
+		}
+		return nil, errors.New("connection reset by peer")
+	}
+	tracker := New(fake)
+
+	p, err := tracker.B2CPayment(b2cRequest("refused", money.Birr(10)))
+	assert.Error(t, err)
+	assert.Equal(t, StateFailed, p.State)
+	assert.Contains(t, p.Error, "Invalid Access Token")
+
+	p, err = tracker.B2CPayment(b2cRequest("unknown", money.Birr(10)))
+	assert.Error(t, err)
+	assert.Equal(t, StateUnconfirmed, p.State, "a failed request may still have been accepted")
+
+	// an early result is applied after the acknowledgement
+	fake.B2CPaymentFunc = func(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
+		res := &callback.Result{}
+		res.Result.OriginatorConversationID = req.OriginatorConversationID
+		res.Result.ResultCode = callback.Success
+		res.Result.TransactionID = "RKT0000002"
+		require.NoError(t, tracker.HandleResult(context.Background(), res))
+		return &b2c.B2CSuccessResponse{ConversationID: "AG_1", ResponseCode: "0"}, nil
+	}
+	p, err = tracker.B2CPayment(b2cRequest("early", money.Birr(10)))
+	require.NoError(t, err)
+	assert.Equal(t, StateSucceeded, p.State)
+	assert.Equal(t, "RKT0000002", p.TransactionID)
+	assert.Equal(t, "AG_1", p.ConversationID)
+}
+
+func TestSubmit_UnconfirmedIsQueried(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	// M-Pesa accepts the payment, but the acknowledgement is lost
+	srv.AddTransaction(mpesatest.Transaction{TransactionID: "RKT0000003", OriginatorConversationID: "payroll-3",
+		Amount: money.Birr(10), DebitParty: "600000", CreditParty: "251712345678"})
+	tracker, clk, rec := newTracker(t, srv)
+	app := tracker.Client
+	fake := mpesatest.NewFakeClient()
+	fake.B2CPaymentFunc = func(b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
+		return nil, context.DeadlineExceeded
+	}
+	fake.StatusFunc = app.MakeTransactionStatusQuery
+	tracker.Client = fake
+
+	p, err := tracker.B2CPayment(b2cRequest("payroll-3", money.Birr(10)))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, StateUnconfirmed, p.State)
+
+	tracker.Poll(context.Background()) // before the deadline
+	assert.Empty(t, fake.CallsTo(mpesatest.OperationStatus))
+
+	clk.Advance(DefaultDeadline)
+	tracker.Poll(context.Background())
+	calls := fake.CallsTo(mpesatest.OperationStatus)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "payroll-3", calls[0].Request.(transaction.TransactionStatusRequest).OriginalConversationID)
+
+	p = waitFor(t, tracker, "payroll-3")
+	assert.Equal(t, StateSucceeded, p.State)
+	assert.Equal(t, "RKT0000003", p.TransactionID)
+	assert.Equal(t, []string{">submitted:request", "submitted>unconfirmed:request", "unconfirmed>succeeded:query"},
+		rec.transitions("payroll-3"))
+}
+
+func TestRetention(t *testing.T) {
+	fake := mpesatest.NewFakeClient()
+	clk := &clock{now: time.Now()}
+	tracker := &Tracker{Client: fake, Now: clk.Now}
+
+	_, err := tracker.B2CPayment(b2cRequest("payroll-1", money.Birr(10)))
+	require.NoError(t, err)
+	_, err = tracker.B2CPayment(b2cRequest("payroll-2", money.Birr(10)))
+	require.NoError(t, err)
+	assert.False(t, tracker.Forget("payroll-1"), "a payment in progress is kept")
+
+	for _, id := range []string{"payroll-1", "payroll-2"} {
+		res := &callback.Result{}
+		res.Result.OriginatorConversationID = id
+		res.Result.ResultCode = callback.Success
+		require.NoError(t, tracker.HandleResult(context.Background(), res))
+	}
+	assert.True(t, tracker.Forget("payroll-1"))
+	_, ok := tracker.Get("payroll-1")
+	assert.False(t, ok)
+
+	clk.Advance(DefaultRetention - time.Second)
+	tracker.Poll(context.Background())
+	_, ok = tracker.Get("payroll-2")
+	assert.True(t, ok)
+
+	clk.Advance(time.Second)
+	tracker.Poll(context.Background())
+	_, ok = tracker.Get("payroll-2")
+	assert.False(t, ok, "a final payment is forgotten after the retention")
+	assert.Empty(t, tracker.payments)
+	assert.Empty(t, tracker.keys)
+}
+
+func TestStateCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to State
+		want     bool
+	}{
+		{"", StateSubmitted, true},
+		{StateSubmitted, StateAcknowledged, true},
+		{StateSubmitted, StateSucceeded, false},
+		{StateSubmitted, StateTimedOut, false},
+		{StateSubmitted, StateUnconfirmed, true},
+		{StateUnconfirmed, StateSucceeded, true},
+		{StateUnconfirmed, StateTimedOut, true},
+		{StateAcknowledged, StateSucceeded, true},
+		{StateAcknowledged, StateTimedOut, true},
+		{StateTimedOut, StateSucceeded, true},
+		{StateTimedOut, StateAcknowledged, false},
+		{StateSucceeded, StateFailed, false},
+		{StateFailed, StateSucceeded, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+">"+string(tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.from.CanTransition(tt.to))
+		})
+	}
+}
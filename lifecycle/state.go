@@ -0,0 +1,122 @@
+package lifecycle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/money"
+)
+
+// State is the progress of a tracked payment.
+type State string
+
+const (
+	// StateSubmitted is a payment whose request is being sent.
+	StateSubmitted State = "submitted"
+	// StateAcknowledged is a payment accepted by M-Pesa, waiting for its outcome.
+	StateAcknowledged State = "acknowledged"
+	// StateUnconfirmed is a payment whose request failed without proof that M-Pesa refused
+	// it, such as a timeout. M-Pesa may have accepted it, so it waits for its callback and
+	// is queried like an acknowledged payment before it times out.
+	StateUnconfirmed State = "unconfirmed"
+	// StateSucceeded is a payment M-Pesa reported as completed.
+	StateSucceeded State = "succeeded"
+	// StateFailed is a payment refused or reported as failed, nobody was paid.
+	StateFailed State = "failed"
+	// StateTimedOut is a payment whose outcome is unknown: no callback and no conclusive
+	// query before the deadline. A late callback still moves it to StateSucceeded or StateFailed.
+	StateTimedOut State = "timed_out"
+)
+
+// transitions: the states a payment can move to from each state.
+var transitions = map[State][]State{
+	"":                {StateSubmitted},
+	StateSubmitted:    {StateAcknowledged, StateUnconfirmed, StateFailed},
+	StateAcknowledged: {StateSucceeded, StateFailed, StateTimedOut},
+	StateUnconfirmed:  {StateSucceeded, StateFailed, StateTimedOut},
+	StateTimedOut:     {StateSucceeded, StateFailed},
+}
+
+// CanTransition reports whether a payment can move from s to next.
+func (s State) CanTransition(next State) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Final reports whether the state is an outcome, StateTimedOut included.
+func (s State) Final() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateTimedOut
+}
+
+// Kind is the operation of a tracked payment.
+type Kind string
+
+const (
+	// KindUSSD is a USSD push payment (USSDPaymentRequest), tracked by its MerchantRequestID.
+	KindUSSD Kind = "ussd_push"
+	// KindB2C is a B2C payment (MakeB2CPaymentRequest), tracked by its OriginatorConversationID.
+	KindB2C Kind = "b2c_payment"
+	// KindReversal is a reversal (MakeTransactionReversalRequest), tracked by its OriginatorConversationID.
+	KindReversal Kind = "transaction_reversal"
+)
+
+// Source is what caused a transition.
+type Source string
+
+const (
+	// SourceRequest is the request and its synchronous acknowledgement.
+	SourceRequest Source = "request"
+	// SourceCallback is the callback of the payment.
+	SourceCallback Source = "callback"
+	// SourceQuery is a status query sent because the callback did not arrive in time.
+	SourceQuery Source = "query"
+	// SourceDeadline is the expiry of the last status query.
+	SourceDeadline Source = "deadline"
+)
+
+// Payment is the state of a tracked payment.
+//
+// Fields:
+//   - ID: The MerchantRequestID of a USSD push, the OriginatorConversationID otherwise.
+//   - Kind, State: The operation and its progress.
+//   - Amount, Party: The amount and the customer of the payment.
+//   - CheckoutRequestID, ConversationID: The identifiers returned by the acknowledgement.
+//   - TransactionID: The M-Pesa receipt, once the payment succeeded.
+//   - ResultCode, ResultDesc: The outcome reported by the callback or the query.
+//   - Error: The error of the request, for a payment that failed or is unconfirmed when submitted.
+//   - SubmittedAt, UpdatedAt: When the payment was submitted and last changed.
+//   - Polls: The number of status queries sent.
+type Payment struct {
+	ID                string       `json:"id"`
+	Kind              Kind         `json:"kind"`
+	State             State        `json:"state"`
+	Amount            money.Amount `json:"amount"`
+	Party             string       `json:"party,omitempty"`
+	CheckoutRequestID string       `json:"checkout_request_id,omitempty"`
+	ConversationID    string       `json:"conversation_id,omitempty"`
+	TransactionID     string       `json:"transaction_id,omitempty"`
+	ResultCode        string       `json:"result_code,omitempty"`
+	ResultDesc        string       `json:"result_desc,omitempty"`
+	Error             string       `json:"error,omitempty"`
+	SubmittedAt       time.Time    `json:"submitted_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	Polls             int          `json:"polls,omitempty"`
+}
+
+// Event is a state change of a payment, the first event of a payment has an empty From.
+type Event struct {
+	From    State     `json:"from"`
+	To      State     `json:"to"`
+	Source  Source    `json:"source"`
+	At      time.Time `json:"at"`
+	Payment Payment   `json:"payment"`
+}
+
+// String describes the event, "b2c_payment payroll-1: acknowledged -> succeeded (callback)".
+func (e Event) String() string {
+	return fmt.Sprintf("%v %v: %v -> %v (%v)", e.Payment.Kind, e.Payment.ID, e.From, e.To, e.Source)
+}
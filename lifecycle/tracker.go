@@ -0,0 +1,518 @@
+// Package lifecycle tracks asynchronous payments from their request to their outcome.
+//
+// USSD push payments, B2C payments and reversals share the same lifecycle: the request
+// is submitted, M-Pesa acknowledges it, then the payment succeeds, fails or times out.
+// The Tracker moves every payment through these states (see State.CanTransition). It is
+// driven by the callbacks and falls back to status queries (an STK query for USSD push
+// payments, a transaction status query otherwise) when no callback arrives before the
+// deadline. A request that fails without proof that M-Pesa refused it, such as a timeout,
+// is StateUnconfirmed and is queried the same way before it is concluded. Every state
+// change is emitted as an Event, and the final payments are forgotten after Retention.
+//
+// Example usage:
+//
+//	tracker := lifecycle.New(app)
+//	tracker.OnTransition = func(e lifecycle.Event) { log.Println(e) }
+//	http.Handle("/mpesa/callbacks", callback.Handlers{
+//		OnResult: tracker.HandleResult,
+//		OnSTK:    tracker.HandleSTKCallback,
+//	})
+//	go tracker.Run(ctx)
+//
+//	p, err := tracker.USSDPayment(req)
+//	if err != nil {
+//		return err
+//	}
+//	p, err = tracker.Wait(ctx, p.ID)
+//	fmt.Println(p.State, p.TransactionID)
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/transaction"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+const (
+	// DefaultDeadline is how long a callback is waited for when Tracker.Deadline is not set.
+	DefaultDeadline = time.Minute
+	// DefaultPollInterval is the time between two status queries when Tracker.PollInterval is not set.
+	DefaultPollInterval = 30 * time.Second
+	// DefaultMaxPolls is the number of status queries when Tracker.MaxPolls is not set.
+	DefaultMaxPolls = 3
+	// DefaultRetention is how long a final payment is kept when Tracker.Retention is not set.
+	DefaultRetention = 24 * time.Hour
+)
+
+// Tracker tracks payments, see the package documentation.
+type Tracker struct {
+	// Client sends the payments and the status queries, usually an *mpesagosdk.App.
+	Client mpesagosdk.Client
+	// Deadline is how long the callback is waited for after the acknowledgement before
+	// the payment is queried, DefaultDeadline when not positive.
+	Deadline time.Duration
+	// PollInterval is the time between two status queries, DefaultPollInterval when not positive.
+	PollInterval time.Duration
+	// MaxPolls is the number of status queries sent before the payment times out,
+	// DefaultMaxPolls when not positive.
+	MaxPolls int
+	// Retention is how long a final payment is kept after its last change, so that Get,
+	// Wait and late callbacks still find it, DefaultRetention when not positive. Poll
+	// forgets the older ones, see also Forget.
+	Retention time.Duration
+	// Query is the template of the transaction status queries of B2C payments and
+	// reversals, such as their ResultURL. The App fills the fields left empty.
+	Query transaction.TransactionStatusRequest
+	// OnTransition is called with every state change, in order. It must not call the Tracker.
+	OnTransition func(Event)
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	payments map[string]*tracked
+	keys     map[string]string
+	queue    []Event
+	changed  chan struct{}
+	emitMu   sync.Mutex
+}
+
+// tracked: a payment and the bookkeeping of the tracker.
+type tracked struct {
+	Payment
+	nextPoll time.Time
+	// early is an outcome received before the acknowledgement.
+	early *outcome
+}
+
+// outcome: the conclusion of a callback or a query.
+type outcome struct {
+	state         State
+	source        Source
+	transactionID string
+	code, desc    string
+}
+
+// New creates a tracker sending the requests with client.
+func New(client mpesagosdk.Client) *Tracker {
+	return &Tracker{Client: client}
+}
+
+// USSDPayment sends a USSD push payment and tracks it by its MerchantRequestID.
+//
+// Returns:
+//   - Payment: The payment, acknowledged, failed when M-Pesa refused it or unconfirmed
+//     when the outcome of the request is unknown.
+//   - error: The error of the request.
+func (t *Tracker) USSDPayment(req c2b.USSDPaymentRequest) (Payment, error) {
+	return t.submit(KindUSSD, req.MerchantRequestID, req.Amount, req.PhoneNumber, func(p *Payment) error {
+		res, err := t.Client.USSDPaymentRequest(req)
+		if err == nil {
+			p.CheckoutRequestID = res.CheckoutRequestID
+		}
+		return err
+	})
+}
+
+// B2CPayment sends a B2C payment and tracks it by its OriginatorConversationID, see USSDPayment.
+func (t *Tracker) B2CPayment(req b2c.B2CRequest) (Payment, error) {
+	return t.submit(KindB2C, req.OriginatorConversationID, req.Amount, fmt.Sprint(req.PartyB), func(p *Payment) error {
+		res, err := t.Client.MakeB2CPaymentRequest(req)
+		if err == nil {
+			p.ConversationID = res.ConversationID
+		}
+		return err
+	})
+}
+
+// Reversal sends a reversal and tracks it by its OriginatorConversationID, see USSDPayment.
+func (t *Tracker) Reversal(req transaction.TransactionReversalRequest) (Payment, error) {
+	return t.submit(KindReversal, req.OriginatorConversationID, req.Amount, req.PartyA, func(p *Payment) error {
+		res, err := t.Client.MakeTransactionReversalRequest(req)
+		if err == nil {
+			p.ConversationID = res.ConversationID
+		}
+		return err
+	})
+}
+
+// submit: registers a payment, sends its request and records the acknowledgement.
+func (t *Tracker) submit(kind Kind, id string, amount money.Amount, party string, send func(p *Payment) error) (Payment, error) {
+	if id == "" {
+		return Payment{}, fmt.Errorf("a tracked %v needs an identifier", kind)
+	}
+
+	t.mu.Lock()
+	if t.payments == nil {
+		t.payments, t.keys = map[string]*tracked{}, map[string]string{}
+	}
+	if _, ok := t.payments[id]; ok {
+		t.mu.Unlock()
+		return Payment{}, fmt.Errorf("%v %q is already tracked", kind, id)
+	}
+	now := t.now()
+	p := &tracked{Payment: Payment{ID: id, Kind: kind, Amount: amount, Party: party, SubmittedAt: now}}
+	t.payments[id] = p
+	t.transition(p, StateSubmitted, SourceRequest)
+	t.mu.Unlock()
+	t.emit()
+
+	ack := Payment{}
+	err := send(&ack)
+
+	t.mu.Lock()
+	switch {
+	case err == nil:
+		p.CheckoutRequestID, p.ConversationID = ack.CheckoutRequestID, ack.ConversationID
+		if p.CheckoutRequestID != "" {
+			t.keys[p.CheckoutRequestID] = id
+		}
+		p.nextPoll = t.now().Add(orDefault(t.Deadline, DefaultDeadline))
+		t.transition(p, StateAcknowledged, SourceRequest)
+		if p.early != nil {
+			t.conclude(p, *p.early)
+		}
+	case types.Refused(err):
+		p.Error = err.Error()
+		t.transition(p, StateFailed, SourceRequest)
+	default:
+		// M-Pesa may have accepted the payment, its callback or a query concludes it
+		p.Error = err.Error()
+		p.nextPoll = t.now().Add(orDefault(t.Deadline, DefaultDeadline))
+		t.transition(p, StateUnconfirmed, SourceRequest)
+		if p.early != nil {
+			t.conclude(p, *p.early)
+		}
+	}
+	payment := p.Payment
+	t.mu.Unlock()
+	t.emit()
+	return payment, err
+}
+
+// HandleResult records the result of a B2C payment, of a reversal or of the status query
+// of one of them, its signature matches callback.ResultHandler. Other results are ignored.
+func (t *Tracker) HandleResult(_ context.Context, res *callback.Result) error {
+	t.mu.Lock()
+	key := res.Result.OriginatorConversationID
+	if p, ok := t.payments[key]; ok && p.Kind != KindUSSD {
+		o := outcome{state: StateFailed, source: SourceCallback, transactionID: res.Result.TransactionID,
+			code: string(res.Result.ResultCode), desc: res.Result.ResultDesc}
+		if res.Succeeded() {
+			o.state = StateSucceeded
+		}
+		t.receive(p, o)
+	} else if id, ok := t.keys[key]; ok {
+		if o, ok := queryOutcome(res); ok {
+			t.receive(t.payments[id], o)
+		}
+	}
+	t.mu.Unlock()
+	t.emit()
+	return nil
+}
+
+// queryOutcome: concludes the result of a transaction status query, it returns false
+// when the query is not conclusive, such as a transaction not found yet.
+func queryOutcome(res *callback.Result) (outcome, bool) {
+	if !res.Succeeded() {
+		return outcome{}, false
+	}
+	status, _ := res.Parameter("TransactionStatus")
+	o := outcome{source: SourceQuery, code: string(res.Result.ResultCode), desc: res.Result.ResultDesc}
+	if receipt, ok := res.Parameter("ReceiptNo"); ok {
+		o.transactionID = receipt.String()
+	}
+	switch status.String() {
+	case "Completed":
+		o.state = StateSucceeded
+	case "Failed", "Cancelled", "Declined":
+		o.state = StateFailed
+	default:
+		return outcome{}, false
+	}
+	return o, true
+}
+
+// HandleSTKCallback records the callback of a USSD push payment, its signature matches
+// callback.STKHandler. Callbacks of payments not tracked are ignored.
+func (t *Tracker) HandleSTKCallback(_ context.Context, cb *callback.STKCallback) error {
+	body := cb.Body.StkCallback
+	t.mu.Lock()
+	id, ok := t.keys[body.CheckoutRequestID]
+	if !ok {
+		id = body.MerchantRequestID
+	}
+	if p, ok := t.payments[id]; ok && p.Kind == KindUSSD {
+		o := outcome{state: StateFailed, source: SourceCallback, code: string(body.ResultCode), desc: body.ResultDesc}
+		if cb.Succeeded() {
+			o.state = StateSucceeded
+			if receipt, ok := cb.Metadata("MpesaReceiptNumber"); ok {
+				o.transactionID = receipt.String()
+			}
+		}
+		t.receive(p, o)
+	}
+	t.mu.Unlock()
+	t.emit()
+	return nil
+}
+
+// receive: applies an outcome, or keeps it until the acknowledgement.
+func (t *Tracker) receive(p *tracked, o outcome) {
+	if p.State == StateSubmitted {
+		p.early = &o
+		return
+	}
+	t.conclude(p, o)
+}
+
+// conclude: moves a payment to the state of an outcome, duplicate callbacks and
+// outcomes of finished payments are ignored.
+func (t *Tracker) conclude(p *tracked, o outcome) {
+	if !p.State.CanTransition(o.state) {
+		return
+	}
+	p.TransactionID = orDefaultString(o.transactionID, p.TransactionID)
+	p.ResultCode, p.ResultDesc = o.code, o.desc
+	t.transition(p, o.state, o.source)
+}
+
+// Poll sends the status queries of the acknowledged and unconfirmed payments whose deadline
+// passed, times out the payments that reached MaxPolls and forgets the final payments older
+// than Retention. Run calls it periodically.
+//
+// An unconfirmed USSD push payment has no CheckoutRequestID to query, only its callback
+// can conclude it before it times out.
+func (t *Tracker) Poll(ctx context.Context) {
+	maxPolls := t.MaxPolls
+	if maxPolls <= 0 {
+		maxPolls = DefaultMaxPolls
+	}
+
+	t.mu.Lock()
+	now := t.now()
+	t.evict(now.Add(-orDefault(t.Retention, DefaultRetention)))
+	var due []Payment
+	for _, p := range t.payments {
+		if (p.State != StateAcknowledged && p.State != StateUnconfirmed) || now.Before(p.nextPoll) {
+			continue
+		}
+		if p.Polls >= maxPolls {
+			t.transition(p, StateTimedOut, SourceDeadline)
+			continue
+		}
+		p.Polls++
+		p.nextPoll = now.Add(orDefault(t.PollInterval, DefaultPollInterval))
+		if p.Kind != KindUSSD {
+			t.keys[fmt.Sprintf("%v-status-%d", p.ID, p.Polls)] = p.ID
+		}
+		due = append(due, p.Payment)
+	}
+	t.mu.Unlock()
+	t.emit()
+
+	for _, p := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		if p.Kind == KindUSSD {
+			if p.CheckoutRequestID != "" {
+				t.queryUSSD(p)
+			}
+			continue
+		}
+		query := t.Query
+		query.CommandID = types.TransactionStatusCommand
+		query.OriginatorConversationID = fmt.Sprintf("%v-status-%d", p.ID, p.Polls)
+		query.OriginalConversationID = p.ID
+		query.TransactionID = ""
+		if query.IdentifierType == "" {
+			query.IdentifierType = types.ShortCodeIdentifierType
+		}
+		query.Occasion = types.OrDefault(query.Occasion, "Payment status")
+		query.Remarks = types.OrDefault(query.Remarks, "Status of "+p.ID)
+		// the result arrives through HandleResult, a refused query is retried at the next poll
+		_, _ = t.Client.MakeTransactionStatusQuery(query)
+	}
+}
+
+// queryUSSD: sends the STK query of a USSD push payment and applies its outcome.
+func (t *Tracker) queryUSSD(p Payment) {
+	res, err := t.Client.USSDPaymentQuery(c2b.USSDQueryRequest{CheckoutRequestID: p.CheckoutRequestID})
+	if err != nil {
+		return // still pending or not answered, retried at the next poll
+	}
+	o := outcome{state: StateFailed, source: SourceQuery, code: res.ResultCode, desc: res.ResultDesc}
+	if res.ResultCode == string(callback.Success) {
+		o.state = StateSucceeded
+	}
+
+	t.mu.Lock()
+	t.conclude(t.payments[p.ID], o)
+	t.mu.Unlock()
+	t.emit()
+}
+
+// Run polls the payments until ctx is done, see Poll.
+func (t *Tracker) Run(ctx context.Context) error {
+	tick := time.Second
+	for _, d := range []time.Duration{t.Deadline, t.PollInterval} {
+		if d > 0 && d < tick {
+			tick = d
+		}
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			t.Poll(ctx)
+		}
+	}
+}
+
+// Get returns a tracked payment.
+func (t *Tracker) Get(id string) (Payment, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.payments[id]
+	if !ok {
+		return Payment{}, false
+	}
+	return p.Payment, true
+}
+
+// Forget stops tracking a payment in a final state, once its outcome is stored elsewhere.
+// It returns false when the payment is not tracked or is still in progress.
+func (t *Tracker) Forget(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.payments[id]
+	if !ok || !p.State.Final() {
+		return false
+	}
+	t.forget(id)
+	return true
+}
+
+// evict: forgets the final payments that did not change after before, the caller must
+// hold the lock.
+func (t *Tracker) evict(before time.Time) {
+	for id, p := range t.payments {
+		if p.State.Final() && !p.UpdatedAt.After(before) {
+			t.forget(id)
+		}
+	}
+}
+
+// forget: removes a payment and its keys, the caller must hold the lock.
+func (t *Tracker) forget(id string) {
+	delete(t.payments, id)
+	for key, target := range t.keys {
+		if target == id {
+			delete(t.keys, key)
+		}
+	}
+}
+
+// Wait blocks until a payment reaches a final state or ctx is done.
+func (t *Tracker) Wait(ctx context.Context, id string) (Payment, error) {
+	for {
+		t.mu.Lock()
+		p, ok := t.payments[id]
+		if !ok {
+			t.mu.Unlock()
+			return Payment{}, fmt.Errorf("payment %q is not tracked", id)
+		}
+		if p.State.Final() {
+			payment := p.Payment
+			t.mu.Unlock()
+			return payment, nil
+		}
+		if t.changed == nil {
+			t.changed = make(chan struct{})
+		}
+		changed := t.changed
+		payment := p.Payment
+		t.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return payment, ctx.Err()
+		}
+	}
+}
+
+// transition: changes the state of a payment and queues its event, the caller must
+// hold the lock and call emit once it is released.
+func (t *Tracker) transition(p *tracked, to State, source Source) {
+	from := p.State
+	if !from.CanTransition(to) {
+		panic(errors.New("lifecycle: invalid transition from " + string(from) + " to " + string(to)))
+	}
+	now := t.now()
+	p.State, p.UpdatedAt = to, now
+	t.queue = append(t.queue, Event{From: from, To: to, Source: source, At: now, Payment: p.Payment})
+	if t.changed != nil {
+		close(t.changed)
+		t.changed = nil
+	}
+}
+
+// emit: passes the queued events to OnTransition, in order.
+func (t *Tracker) emit() {
+	t.emitMu.Lock()
+	defer t.emitMu.Unlock()
+	for {
+		t.mu.Lock()
+		events := t.queue
+		t.queue = nil
+		t.mu.Unlock()
+		if len(events) == 0 {
+			return
+		}
+		if t.OnTransition == nil {
+			continue
+		}
+		for _, e := range events {
+			t.OnTransition(e)
+		}
+	}
+}
+
+// now: returns the current time of the tracker.
+func (t *Tracker) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+// orDefault: returns d, or def when d is not positive.
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// orDefaultString: returns s, or def when s is empty.
+func orDefaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
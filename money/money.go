@@ -0,0 +1,277 @@
+// Package money represents ETB amounts exactly, in santim (the minor unit, 1 birr = 100 santim).
+//
+// Amounts are parsed from and formatted to the decimal form used by M-Pesa ("120", "120.50"),
+// are encoded in JSON as numbers in birr, as the M-Pesa requests expect, and accept both numbers
+// and strings when decoded since the callbacks send both. Arithmetic is overflow checked.
+//
+// Amount is a struct so that a bare number cannot be mistaken for an amount: it is built with
+// Birr, Santim or Parse.
+//
+// Example usage:
+//
+//	fee := money.Birr(5)
+//	amount, err := money.Parse("120.50")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	total, err := amount.Add(fee)
+//	fmt.Println(total) // 125.50
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency is the ISO 4217 code of the amounts.
+const Currency = "ETB"
+
+// SantimPerBirr is the number of minor units in a birr.
+const SantimPerBirr = 100
+
+var (
+	// ErrInvalid is returned when a text is not a valid amount.
+	ErrInvalid = errors.New("invalid amount")
+	// ErrOverflow is returned when an operation does not fit in an Amount.
+	ErrOverflow = errors.New("amount overflow")
+)
+
+// Amount is an exact amount of ETB, the zero value is 0.00 ETB.
+type Amount struct {
+	santim int64
+}
+
+// Zero is the 0.00 ETB amount.
+var Zero = Amount{}
+
+// Birr returns an amount of whole birr. It panics when n birr do not fit in an Amount.
+func Birr(n int64) Amount {
+	if n > math.MaxInt64/SantimPerBirr || n < math.MinInt64/SantimPerBirr {
+		panic(fmt.Sprintf("money: %v birr overflows", n))
+	}
+	return Amount{santim: n * SantimPerBirr}
+}
+
+// Santim returns an amount of minor units.
+func Santim(n int64) Amount {
+	return Amount{santim: n}
+}
+
+// Parse parses a decimal amount in birr such as "120", "120.5", "120.50", "-3.25" or
+// "1,200.00", an optional "ETB" prefix or suffix is accepted. More than two decimals
+// are rejected rather than rounded.
+func Parse(s string) (Amount, error) {
+	text := strings.TrimSpace(s)
+	text = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, Currency), Currency))
+	text = strings.ReplaceAll(text, ",", "")
+
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "-"), "+")
+
+	whole, frac, hasFrac := strings.Cut(text, ".")
+	if whole == "" || (hasFrac && frac == "") || len(frac) > 2 || !digits(whole) || !digits(frac) {
+		return Zero, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	birr, err := strconv.ParseInt(whole, 10, 64)
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+	if err != nil || birr > math.MaxInt64/SantimPerBirr || birr*SantimPerBirr > math.MaxInt64-cents {
+		return Zero, fmt.Errorf("%w: %q", ErrOverflow, s)
+	}
+
+	a := Amount{santim: birr*SantimPerBirr + cents}
+	if negative {
+		a.santim = -a.santim
+	}
+	return a, nil
+}
+
+// MustParse is like Parse but panics when s is not a valid amount, it is meant for constants.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Santim returns the amount in minor units.
+func (a Amount) Santim() int64 {
+	return a.santim
+}
+
+// Birr returns the whole birr of the amount, truncated toward zero.
+func (a Amount) Birr() int64 {
+	return a.santim / SantimPerBirr
+}
+
+// Float64 returns the amount in birr as a float, for display and comparisons only.
+func (a Amount) Float64() float64 {
+	return float64(a.santim) / SantimPerBirr
+}
+
+// IsZero reports whether the amount is 0.00.
+func (a Amount) IsZero() bool {
+	return a.santim == 0
+}
+
+// IsWhole reports whether the amount has no santim.
+func (a Amount) IsWhole() bool {
+	return a.santim%SantimPerBirr == 0
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of the amount.
+func (a Amount) Sign() int {
+	return a.Cmp(Zero)
+}
+
+// Cmp compares two amounts and returns -1, 0 or +1.
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a.santim < b.santim:
+		return -1
+	case a.santim > b.santim:
+		return 1
+	}
+	return 0
+}
+
+// Add returns a + b or ErrOverflow.
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum := a.santim + b.santim
+	if (b.santim > 0 && sum < a.santim) || (b.santim < 0 && sum > a.santim) {
+		return Zero, fmt.Errorf("%w: %v + %v", ErrOverflow, a, b)
+	}
+	return Amount{santim: sum}, nil
+}
+
+// Sub returns a - b or ErrOverflow.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	diff := a.santim - b.santim
+	if (b.santim > 0 && diff > a.santim) || (b.santim < 0 && diff < a.santim) {
+		return Zero, fmt.Errorf("%w: %v - %v", ErrOverflow, a, b)
+	}
+	return Amount{santim: diff}, nil
+}
+
+// Mul returns a * n or ErrOverflow.
+func (a Amount) Mul(n int64) (Amount, error) {
+	if a.santim == 0 || n == 0 {
+		return Zero, nil
+	}
+	product := a.santim * n
+	if product/n != a.santim || (a.santim == -1 && n == math.MinInt64) || (n == -1 && a.santim == math.MinInt64) {
+		return Zero, fmt.Errorf("%w: %v * %v", ErrOverflow, a, n)
+	}
+	return Amount{santim: product}, nil
+}
+
+// String formats the amount with two decimals, "120.50".
+func (a Amount) String() string {
+	sign := ""
+	santim := a.santim
+	if santim < 0 {
+		sign = "-"
+	}
+	whole := santim / SantimPerBirr
+	frac := santim % SantimPerBirr
+	if whole < 0 {
+		whole = -whole
+	}
+	if frac < 0 {
+		frac = -frac
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, whole, frac)
+}
+
+// Format formats the amount for people, "ETB 1,200.50".
+func (a Amount) Format() string {
+	s := a.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return Currency + " " + sign + b.String() + "." + frac
+}
+
+// Decimal formats the amount the way M-Pesa expects it in requests: whole amounts
+// without decimals ("120") and the other ones with two decimals ("120.50").
+func (a Amount) Decimal() string {
+	if a.IsWhole() {
+		return strconv.FormatInt(a.Birr(), 10)
+	}
+	return a.String()
+}
+
+// MarshalJSON encodes the amount as a JSON number in birr, see Decimal.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.Decimal()), nil
+}
+
+// UnmarshalJSON decodes a JSON number or string in birr, an empty string or null is 0.00.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		if strings.TrimSpace(text) == "" {
+			*a = Zero
+			return nil
+		}
+	}
+
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MarshalText encodes the amount with two decimals, it is used for map keys, CSV and YAML.
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText parses the amount, see Parse.
+func (a *Amount) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// digits: reports whether s only holds ASCII digits.
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
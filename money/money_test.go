@@ -0,0 +1,119 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Amount
+		err      error
+	}{
+		{"Whole", "120", Birr(120), nil},
+		{"One decimal", "120.5", Santim(12050), nil},
+		{"Two decimals", "120.50", Santim(12050), nil},
+		{"Santim only", "0.07", Santim(7), nil},
+		{"Negative", "-3.25", Santim(-325), nil},
+		{"Grouped", "1,200.00", Birr(1200), nil},
+		{"Currency prefix", "ETB 15", Birr(15), nil},
+		{"Currency suffix", "15.10 ETB", Santim(1510), nil},
+		{"Too many decimals", "1.005", Zero, ErrInvalid},
+		{"Trailing dot", "1.", Zero, ErrInvalid},
+		{"Letters", "12a", Zero, ErrInvalid},
+		{"Empty", "", Zero, ErrInvalid},
+		{"Overflow", "999999999999999999999", Zero, ErrOverflow},
+		{"Largest", "92233720368547758.07", Santim(math.MaxInt64), nil},
+		{"Overflow in santim", "92233720368547758.99", Zero, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := Parse(tt.input)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "expected %v, got %v", tt.err, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, a)
+		})
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	a := Santim(123450)
+	assert.Equal(t, "1234.50", a.String())
+	assert.Equal(t, "ETB 1,234.50", a.Format())
+	assert.Equal(t, "1234.50", a.Decimal())
+	assert.Equal(t, "1234", Birr(1234).Decimal())
+	assert.Equal(t, "-0.05", Santim(-5).String())
+	assert.Equal(t, "ETB -1,000,000.00", Birr(-1000000).Format())
+	assert.Equal(t, int64(1234), a.Birr())
+	assert.Equal(t, 1234.5, a.Float64())
+}
+
+func TestArithmetic(t *testing.T) {
+	sum, err := Birr(10).Add(Santim(50))
+	require.NoError(t, err)
+	assert.Equal(t, Santim(1050), sum)
+
+	diff, err := Birr(10).Sub(Birr(15))
+	require.NoError(t, err)
+	assert.Equal(t, Birr(-5), diff)
+
+	product, err := Santim(250).Mul(3)
+	require.NoError(t, err)
+	assert.Equal(t, Santim(750), product)
+
+	_, err = Santim(math.MaxInt64).Add(Santim(1))
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = Santim(math.MinInt64).Sub(Santim(1))
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = Santim(math.MaxInt64 / 2).Mul(3)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	assert.Equal(t, -1, Birr(1).Cmp(Birr(2)))
+	assert.Equal(t, 0, Birr(2).Cmp(Santim(200)))
+	assert.Panics(t, func() { Birr(math.MaxInt64) })
+}
+
+func TestJSON(t *testing.T) {
+	type payload struct {
+		Amount Amount `json:"Amount"`
+	}
+
+	data, err := json.Marshal(payload{Amount: Birr(100)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Amount":100}`, string(data))
+
+	data, err = json.Marshal(payload{Amount: Santim(10050)})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Amount":100.50}`, string(data))
+
+	tests := []struct {
+		input    string
+		expected Amount
+	}{
+		{`{"Amount":120}`, Birr(120)},
+		{`{"Amount":120.5}`, Santim(12050)},
+		{`{"Amount":"120.50"}`, Santim(12050)},
+		{`{"Amount":""}`, Zero},
+		{`{"Amount":null}`, Zero},
+	}
+	for _, tt := range tests {
+		var p payload
+		require.NoError(t, json.Unmarshal([]byte(tt.input), &p), tt.input)
+		assert.Equal(t, tt.expected, p.Amount, tt.input)
+	}
+
+	var p payload
+	assert.Error(t, json.Unmarshal([]byte(`{"Amount":1.234}`), &p))
+	assert.Error(t, json.Unmarshal([]byte(`{"Amount":true}`), &p))
+}
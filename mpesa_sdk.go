@@ -10,20 +10,30 @@
 package mpesagosdk
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/coleYab/mpesagosdk/account"
 	"github.com/coleYab/mpesagosdk/b2c"
 	"github.com/coleYab/mpesagosdk/c2b"
 	"github.com/coleYab/mpesagosdk/config"
+	"github.com/coleYab/mpesagosdk/dedupe"
 	"github.com/coleYab/mpesagosdk/internal/auth"
 	"github.com/coleYab/mpesagosdk/internal/client"
 	"github.com/coleYab/mpesagosdk/internal/logger"
+	"github.com/coleYab/mpesagosdk/internal/policy"
 	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/kyc"
+	"github.com/coleYab/mpesagosdk/redact"
+	"github.com/coleYab/mpesagosdk/store"
 	"github.com/coleYab/mpesagosdk/transaction"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 )
 
 // App: represents an instance of the M-Pesa application SDK.
@@ -37,6 +47,9 @@ import (
 //	- `client`: The HTTP client used to make requests to the M-Pesa API.
 //	- `validator`: A validator instance that ensures requests conform to the expected structure.
 //	- `logger`: A logger instance that logs relevant information and errors for monitoring and debugging.
+//	- `policy`: The transaction limits checked before a transfer is sent (see types.Limits).
+//	- `guard`: The duplicate payout guard, nil when it is disabled (see the dedupe package).
+//	- `redactor`: The redaction rules of the logs and of the records of the store.
 //
 // Example Usage:
 //
@@ -51,7 +64,10 @@ import (
 //	}
 //
 //	// Create a new instance of the App struct
-//	app := mpesagosdk.New(cfg)
+//	app, err := mpesagosdk.New(mpesagosdk.WithConfig(cfg))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
 //
 //	// Now you can use the app to interact with M-Pesa API, for example:
 //	res, err := app.MakeB2CPaymentRequest(someB2CPaymentRequest)
@@ -60,73 +76,236 @@ import (
 type App struct {
 	cfg       *config.Config
 	client    *client.HttpClient
-	validator *validator.Validate
+	validator *types.Validator
 	logger    *logger.Logger
+	policy    *policy.Policy
+	guard     *dedupe.Guard
+	redactor  *redact.Redactor
 }
 
 // New: Creates a new instance of the M-Pesa App.
-// The New function initializes a new App instance by accepting a Config struct, which contains the necessary configuration data such as the ConsumerKey, ConsumerSecret, LogLevel, and environment settings. It then creates and returns an instance of App with all necessary components, such as:
+// The New function starts from config.Default() and applies the given options in order, the
+// options set the credentials, environment, timeouts, retries, HTTP client, log level and the
+// default party and callback settings (see Option). The resulting configuration is validated
+// and every problem is reported at once. It then creates and returns an instance of App with
+// all necessary components, such as:
 //
 //	- A newly initialized HTTP client (client.HttpClient) to interact with the M-Pesa API.
-//	- A newly initialized validator.Validate instance for validating requests.
-//	- A logger (logger.Logger) to track the SDK's activities at the specified log level.
+//	- A newly initialized types.Validator instance for validating requests.
+//	- A logger (logger.Logger) to track the SDK's activities at the specified log level, or
+//	  the caller supplied one (see WithLogger and WithLogHandler). Every line goes through the
+//	  configured redaction rules so phone numbers and secrets never reach the logs.
 //
 // Parameters:
-//	- cfg: A pointer to a config.Config struct containing the required configuration data for the M-Pesa SDK.
+//	- opts: The options used to configure the SDK, use WithConfig to start from an existing config.Config.
 //
 // Returns:
 //	- A pointer to an App instance, which is ready to make requests to the M-Pesa API.
-func New(cfg *config.Config) *App {
+//	- An error if the resulting configuration is invalid.
+func New(opts ...Option) (*App, error) {
+	cfg := config.Default()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	c := client.New(cfg)
-	v := validator.New()
+	v := utils.NewValidator()
 	l := logger.NewLogger(logger.ParseLevel(cfg.LogLevel))
-	return &App{cfg: cfg, client: c, validator: v, logger: l}
+	if cfg.Logger != nil {
+		l = logger.New(cfg.Logger)
+	}
+	redactor := cfg.Redactor
+	if redactor == nil {
+		redactor = redact.Default()
+	}
+	l = l.Wrap(func(h slog.Handler) slog.Handler { return redact.Handler(h, redactor) })
+	app := &App{cfg: cfg, client: c, validator: v, logger: l, policy: policy.New(cfg.Limits), redactor: redactor}
+	if cfg.DuplicateWindow > 0 {
+		app.guard = dedupe.New(cfg.DuplicateWindow, cfg.DuplicateStore)
+	}
+	return app, nil
 }
 
 // executeRequest: this is a function that will act as an orchestrator that can help us in determinig what
-// to do with the request. It has three main steps.
+// to do with the request. It has these main steps.
+//	0. ApplyDefaults: it fills empty party and callback fields from the configured types.Defaults
+//	   and Normalize rewrites phone numbers to the 2517XXXXXXXX form (see types.Normalizer)
 //	1. Validation: here it will use the validation is defined at the types.MpesaRequest struct
 // 	2. FillDefault: it will fill the default data that is unique and default to each request
-// 	3. Api request: then it will utilize the clients ability to send ApiRequest and sends an api request
+// 	   and the transfers are checked against the configured limits (see types.Limits), a
+// 	   refused transfer returns a *types.PolicyError without any network call, then the payouts
+// 	   are checked by the duplicate guard when it is enabled (*types.DuplicateError). The daily
+// 	   cap reservation and the duplicate claim are only released when M-Pesa refused the
+// 	   request (see types.Refused). Only then the payouts naming their expected recipient (see
+// 	   types.RecipientCheck) look up the registered name of the recipient, a billable request,
+// 	   and a mismatch returns a *types.NameCheckError
+// 	3. Api request: then it will utilize the clients ability to send ApiRequest and sends an api request,
+// 	   the transfers are sent once (ApiRequestOnce) because a timed out transfer may have gone through
 // 	4. DecodeResponse: finally it will decode the response that comes from the mpesa.
 //
+// When a store is configured (see WithStore) the request is recorded before it is sent and
+// its response or error once it is known, a record that cannot be saved is only logged.
+//
+// Every log line of the request carries the operation name, the masked endpoint, the correlation
+// identifiers of the request and, once known, the latency and the ResponseCode.
+//
 // Returns:
 // 	- T: generic type that has to be specified on success
 // 	- error: on failure.
-func executeRequest[T any](m *App, req types.MpesaRequest, endpoint, method string, authType string) (*T, error) {
-	masked := utils.MaskEndpoint(endpoint)
-	m.logger.Info("making request", "method", method, "endpoint", masked)
+func executeRequest[T any](m *App, operation string, req types.MpesaRequest, endpoint, method string, authType string) (*T, error) {
+	log := m.logger.With("operation", operation, "method", method, "endpoint", utils.MaskEndpoint(endpoint))
+	if d, ok := req.(types.DefaultsApplier); ok {
+		d.ApplyDefaults(m.cfg.Defaults)
+	}
+	if n, ok := req.(types.Normalizer); ok {
+		n.Normalize()
+	}
+	log = log.With(logger.CorrelationAttrs(req)...)
+	log.Debug("making request")
+
 	if err := req.Validate(m.validator); err != nil {
-		m.logger.Info("validation failed", "error", err.Error())
+		log.Info("validation failed", "error", err.Error())
 		return nil, err
 	}
 
 	req.FillDefaults()
 
-	response, err := m.client.ApiRequest(m.cfg.Enviroment, endpoint, method, req, authType)
+	releasePolicy := func() {}
+	if t, ok := req.(types.Transferer); ok {
+		var err error
+		if releasePolicy, err = m.policy.Reserve(t.Transfer()); err != nil {
+			log.Info("refused by policy", "error", err.Error())
+			return nil, err
+		}
+	}
+	releaseGuard := func() {}
+	if p, ok := req.(types.Payout); ok && m.guard != nil {
+		var err error
+		if releaseGuard, err = m.guard.Claim(context.Background(), p); err != nil {
+			releasePolicy()
+			log.Warn("refused by the duplicate guard", "error", err.Error())
+			return nil, err
+		}
+	}
+	// release: frees the reservations of a request M-Pesa refused, they are kept when the
+	// outcome is unknown because a timed out transfer may have gone through.
+	release := func(err error) {
+		if types.Refused(err) {
+			releasePolicy()
+			releaseGuard()
+		}
+	}
+
+	// the name check is a billable request, it runs after the local checks
+	if r, ok := req.(types.RecipientCheck); ok {
+		if err := m.checkRecipient(log, r); err != nil {
+			release(err)
+			return nil, err
+		}
+	}
+
+	keys, _ := store.KeysOf(req)
+	m.record(log, &store.Record{Kind: store.KindRequest, Operation: operation, Keys: keys}, req)
+
+	send := m.client.ApiRequest
+	if _, ok := req.(types.Transferer); ok {
+		// a timed out transfer may have been processed, retrying it could pay twice
+		send = m.client.ApiRequestOnce
+	}
+	start := time.Now()
+	response, err := send(log, m.cfg.Enviroment, endpoint, method, req, authType)
 	if err != nil {
-		m.logger.Info("request failed", "error", err.Error())
+		release(err)
+		log.Error("request failed", "latency", time.Since(start), "error", err.Error())
+		m.record(log, &store.Record{Kind: store.KindResponse, Operation: operation, Keys: keys, Error: err.Error()}, nil)
 		return nil, err
 	}
 	defer response.Body.Close()
 
 	// Decode the response and type assert the response failing is impossible
 	res, err := req.DecodeResponse(response)
+	latency := time.Since(start)
 	if err != nil {
-		m.logger.Info("request failed", "error", err.Error())
+		var mpesaErr *types.MpesaErrorResponse
+		if errors.As(err, &mpesaErr) {
+			mpesaErr.StatusCode = response.StatusCode
+			log.Warn("request rejected", "latency", latency, "status", response.StatusCode,
+				"ResponseCode", mpesaErr.ErrorCode, "requestId", mpesaErr.RequestId, "error", mpesaErr.ErrorMessage)
+			m.record(log, &store.Record{Kind: store.KindResponse, Operation: operation, Keys: keys,
+				Code: mpesaErr.ErrorCode, Error: mpesaErr.ErrorMessage}, mpesaErr)
+		} else {
+			log.Error("request failed", "latency", latency, "status", response.StatusCode, "error", err.Error())
+			m.record(log, &store.Record{Kind: store.KindResponse, Operation: operation, Keys: keys, Error: err.Error()}, nil)
+		}
+		release(err)
 		return nil, err
 	}
 
 	resC, ok := res.(T)
 	if !ok {
-		m.logger.Info("unable to decode the response")
+		log.Error("unable to decode the response", "latency", latency)
 		return nil, fmt.Errorf("unable to decode success message")
 	}
 
-	m.logger.Info("request succeded", "method", method, "endpoint", masked)
+	log.Info("request succeded", append([]interface{}{"latency", latency}, logger.CorrelationAttrs(resC)...)...)
+	resKeys, code := store.KeysOf(resC)
+	resKeys.Merge(keys)
+	m.record(log, &store.Record{Kind: store.KindResponse, Operation: operation, Keys: resKeys, Code: code}, resC)
 	return &resC, nil
 }
 
+// record: saves a record with the redacted JSON of body in the configured store, if any.
+func (m *App) record(log *logger.Logger, r *store.Record, body interface{}) {
+	if m.cfg.Store == nil {
+		return
+	}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			log.Warn("unable to encode the record", "kind", r.Kind, "error", err.Error())
+			return
+		}
+		r.Body = m.redactor.JSON(data)
+	}
+	if err := m.cfg.Store.Save(context.Background(), r); err != nil {
+		log.Warn("unable to save the record", "kind", r.Kind, "error", err.Error())
+	}
+}
+
+// checkRecipient: looks up the name registered for the recipient of a payout and compares it
+// with the expected one, the check is skipped when the request expects no name.
+//
+// Returns:
+//	- A *types.NameCheckError when the names do not match or the lookup fails, nil otherwise.
+func (m *App) checkRecipient(log *logger.Logger, r types.RecipientCheck) error {
+	recipient, expected := r.ExpectedRecipient()
+	if expected == "" {
+		return nil
+	}
+	threshold := m.cfg.NameMatchThreshold
+	if threshold == 0 {
+		threshold = kyc.DefaultThreshold
+	}
+
+	res, err := m.CheckCustomerName(kyc.NameCheckRequest{Msisdn: recipient, OriginatorConversationID: uuid.NewString()})
+	if err != nil {
+		log.Warn("refused by the name check", "error", err.Error())
+		return &types.NameCheckError{Msisdn: recipient, Expected: expected, Threshold: threshold, Err: err}
+	}
+	score := kyc.Similarity(expected, res.CustomerName)
+	if score < threshold {
+		err := &types.NameCheckError{Msisdn: recipient, Expected: expected, Registered: res.CustomerName, Score: score, Threshold: threshold}
+		log.Warn("refused by the name check", "error", err.Error())
+		return err
+	}
+	log.Debug("name check passed", "score", score)
+	return nil
+}
+
 // MakeAccountBalanceQuery: Sends a request to the M-Pesa API to query the balance
 // of an account. It uses the `AccountBalanceRequest` struct to specify the necessary
 // parameters and returns the response in the form of `AccountBalanceSuccessResponse`.
@@ -143,7 +322,7 @@ func executeRequest[T any](m *App, req types.MpesaRequest, endpoint, method stri
 //	- An error if the request fails or is invalid.
 func (m *App) MakeAccountBalanceQuery(req account.AccountBalanceRequest) (*account.AccountBalanceSuccessResponse, error) {
 	endpoint := "/mpesa/accountbalance/v1/query"
-	return executeRequest[account.AccountBalanceSuccessResponse](m, &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
+	return executeRequest[account.AccountBalanceSuccessResponse](m, "account_balance", &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
 }
 
 // MakeB2CPaymentRequest: Sends a request to the M-Pesa API to initiate a B2C (Business
@@ -162,7 +341,7 @@ func (m *App) MakeAccountBalanceQuery(req account.AccountBalanceRequest) (*accou
 //	- An error if the request fails or is invalid.
 func (m *App) MakeB2CPaymentRequest(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
 	endpoint := "/mpesa/b2c/v2/paymentrequest"
-	return executeRequest[b2c.B2CSuccessResponse](m, &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
+	return executeRequest[b2c.B2CSuccessResponse](m, "b2c_payment", &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
 }
 
 // MakeTransactionReversalRequest: Sends a request to the M-Pesa API to reverse a previously
@@ -182,7 +361,7 @@ func (m *App) MakeB2CPaymentRequest(req b2c.B2CRequest) (*b2c.B2CSuccessResponse
 //	- An error if the request fails or is invalid.
 func (m *App) MakeTransactionReversalRequest(req transaction.TransactionReversalRequest) (*transaction.TransactionReversalResponse, error) {
 	endpoint := "/mpesa/reversal/v1/request"
-	return executeRequest[transaction.TransactionReversalResponse](m, &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
+	return executeRequest[transaction.TransactionReversalResponse](m, "transaction_reversal", &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
 }
 
 // MakeTransactionStatusQuery: Sends a request to the M-Pesa API to check the status of
@@ -201,7 +380,7 @@ func (m *App) MakeTransactionReversalRequest(req transaction.TransactionReversal
 // 	- An error if the request fails or is invalid.
 func (m *App) MakeTransactionStatusQuery(req transaction.TransactionStatusRequest) (*transaction.TransactionStatusResponse, error) {
 	endpoint := "/mpesa/transactionstatus/v1/query"
-	return executeRequest[transaction.TransactionStatusResponse](m, &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
+	return executeRequest[transaction.TransactionStatusResponse](m, "transaction_status", &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
 }
 
 // USSDPaymentRequest: Sends a request to the M-Pesa API to initiate a USSD (Unstructured
@@ -220,7 +399,47 @@ func (m *App) MakeTransactionStatusQuery(req transaction.TransactionStatusReques
 // 	- An error if the request fails or is invalid
 func (m *App) USSDPaymentRequest(req c2b.USSDPaymentRequest) (*c2b.USSDSuccessResponse, error) {
 	endpoint := "/mpesa/stkpush/v3/processrequest"
-	return executeRequest[c2b.USSDSuccessResponse](m, &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
+	return executeRequest[c2b.USSDSuccessResponse](m, "ussd_push", &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
+}
+
+// USSDPaymentQuery: Sends a request to the M-Pesa API to query the outcome of a USSD
+// payment (STK query). It uses the `USSDQueryRequest` struct to specify the CheckoutRequestID
+// of the payment and returns the response in the form of `USSDQueryResponse`.
+//
+// This function performs a POST request to the "/mpesa/stkpushquery/v1/query" endpoint
+// using the Bearer token for authentication.
+//
+// Parameters:
+// 	- `req`: The `USSDQueryRequest` struct containing the CheckoutRequestID returned by
+//     USSDPaymentRequest, the Password is generated when a pass key is configured.
+//
+// Returns:
+// 	- A pointer to the `USSDQueryResponse` struct, its ResultCode is the outcome of the payment.
+// 	- An error if the request fails or is invalid, a `*types.MpesaErrorResponse` with the
+//     c2b.USSDQueryPending code while the customer has not answered.
+func (m *App) USSDPaymentQuery(req c2b.USSDQueryRequest) (*c2b.USSDQueryResponse, error) {
+	endpoint := "/mpesa/stkpushquery/v1/query"
+	return executeRequest[c2b.USSDQueryResponse](m, "ussd_query", &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
+}
+
+// GenerateDynamicQR: Sends a request to the M-Pesa API to generate a QR code the customer
+// scans with the M-Pesa app to pay a till or a paybill, the amount and the reference are
+// filled in for them. It uses the `DynamicQRRequest` struct to specify the payment and
+// returns the image in the form of `DynamicQRResponse`.
+//
+// This function performs a POST request to the "/mpesa/qrcode/v1/generate" endpoint
+// using the Bearer token for authentication.
+//
+// Parameters:
+// 	- `req`: The `DynamicQRRequest` struct containing the payment, the CPI is the configured
+//     short code when empty.
+//
+// Returns:
+// 	- A pointer to the `DynamicQRResponse` struct, see its PNG and Image methods.
+// 	- An error if the request fails or is invalid.
+func (m *App) GenerateDynamicQR(req c2b.DynamicQRRequest) (*c2b.DynamicQRResponse, error) {
+	endpoint := "/mpesa/qrcode/v1/generate"
+	return executeRequest[c2b.DynamicQRResponse](m, "dynamic_qr", &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
 }
 
 // SimulateCustomerInitiatedPayment: Sends a request to the M-Pesa API to simulate
@@ -244,7 +463,7 @@ func (m *App) USSDPaymentRequest(req c2b.USSDPaymentRequest) (*c2b.USSDSuccessRe
 // 	- An error if the request fails or is invalid.
 func (m *App) SimulateCustomerInitiatedPayment(req c2b.SimulateCustomerInititatedPayment) (*c2b.SimulatePaymentSuccessResponse, error) {
 	endpoint := "/mpesa/b2c/simulatetransaction/v1/request"
-	return executeRequest[c2b.SimulatePaymentSuccessResponse](m, &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
+	return executeRequest[c2b.SimulatePaymentSuccessResponse](m, "c2b_simulate", &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
 }
 
 // RegisterNewURL: Sends a request to the M-Pesa API to register a new callback URL for
@@ -264,5 +483,39 @@ func (m *App) SimulateCustomerInitiatedPayment(req c2b.SimulateCustomerInititate
 //	- An error if the request fails or is invalid.
 func (m *App) RegisterNewURL(req c2b.RegisterC2BURLRequest) (*c2b.RegisterURLResponse, error) {
 	endpoint := "/v1/c2b-register-url/register?apikey=" + m.cfg.ConsumerKey
-	return executeRequest[c2b.RegisterURLResponse](m, &req, endpoint, http.MethodPost, auth.AuthTypeNone)
+	return executeRequest[c2b.RegisterURLResponse](m, "c2b_register_url", &req, endpoint, http.MethodPost, auth.AuthTypeNone)
+}
+
+// CheckCustomerName: Sends a request to the M-Pesa API to look up the name a customer
+// registered their MSISDN with, so that a payout can be checked before it is sent (see
+// the kyc package and b2c.B2CRequest.ExpectedName).
+//
+// This function performs a POST request to the configured name check endpoint (see
+// WithNameCheckEndpoint), using the Bearer token for authentication. The API has no
+// public path, kyc.ErrNoEndpoint is returned until one is configured.
+//
+// Parameters:
+//	- `req`: The `NameCheckRequest` struct with the checked MSISDN.
+//
+// Returns:
+//	- A pointer to the `NameCheckResponse` struct with the registered name on a successful request.
+//	- An error if the request fails or is invalid, such as an unknown customer.
+func (m *App) CheckCustomerName(req kyc.NameCheckRequest) (*kyc.NameCheckResponse, error) {
+	endpoint := m.cfg.NameCheckEndpoint
+	if endpoint == "" {
+		return nil, kyc.ErrNoEndpoint
+	}
+	return executeRequest[kyc.NameCheckResponse](m, "customer_name_check", &req, endpoint, http.MethodPost, auth.AuthTypeBearer)
+}
+
+// AccessToken: returns the authorization header value ("Bearer <token>") sent with the
+// API requests, generating a token with the consumer key and secret when none is cached
+// or the cached one is about to expire. It is meant for troubleshooting, such as
+// checking credentials, the SDK methods authenticate on their own.
+//
+// Returns:
+//	- The authorization header value.
+//	- An error if the token can not be generated.
+func (m *App) AccessToken() (string, error) {
+	return m.client.Token(m.cfg.Enviroment)
 }
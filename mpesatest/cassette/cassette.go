@@ -0,0 +1,422 @@
+// Package cassette records the HTTP interactions of the SDK with M-Pesa into a
+// cassette file and replays them, so that integration tests written against the
+// sandbox run deterministically and offline in CI.
+//
+// A Recorder is an http.RoundTripper, it is plugged into the SDK with
+// mpesagosdk.WithHTTPClient. Tokens, credentials and the other secret fields
+// are scrubbed before anything is written to the cassette. Requests are matched
+// by method, path and normalized JSON body, ignoring the volatile fields listed
+// in DefaultIgnoredFields (Timestamp, Password, OriginatorConversationID...).
+//
+// Example usage:
+//
+//	rec, err := cassette.New("testdata/b2c.json", cassette.ModeRecordMissing)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer rec.Close() // writes the new interactions
+//
+//	app, err := mpesagosdk.New(
+//		mpesagosdk.WithConfig(cfg),
+//		mpesagosdk.WithHTTPClient(rec.Client()),
+//	)
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/coleYab/mpesagosdk/redact"
+)
+
+// Version is the version of the cassette file format.
+const Version = 1
+
+// Mode selects how a Recorder uses the cassette and the network.
+type Mode int
+
+const (
+	// ModeReplayOnly serves every request from the cassette and never uses the
+	// network, requests without a recorded interaction fail with ErrNoInteraction.
+	ModeReplayOnly Mode = iota
+	// ModeRecord sends every request to the network and replaces the cassette content.
+	ModeRecord
+	// ModeRecordMissing serves the recorded requests from the cassette and records
+	// the other ones.
+	ModeRecordMissing
+)
+
+// String returns the name of the mode as accepted by ParseMode.
+func (m Mode) String() string {
+	switch m {
+	case ModeReplayOnly:
+		return "replay"
+	case ModeRecord:
+		return "record"
+	case ModeRecordMissing:
+		return "record-missing"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode parses "replay", "record" or "record-missing", which makes it easy to
+// select the mode from an environment variable in tests.
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "replay", "replay-only":
+		return ModeReplayOnly, nil
+	case "record":
+		return ModeRecord, nil
+	case "record-missing":
+		return ModeRecordMissing, nil
+	}
+	return ModeReplayOnly, fmt.Errorf("unknown cassette mode: %v", s)
+}
+
+// ErrNoInteraction is returned in ModeReplayOnly for requests without a recorded interaction.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction")
+
+// DefaultIgnoredFields are the JSON fields ignored when requests are matched, they
+// change on every run.
+var DefaultIgnoredFields = []string{
+	"Timestamp",
+	"Password",
+	"OriginatorConversationID",
+	"MerchantRequestID",
+	"SecurityCredential",
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a recorded response. Scrubbed is set when secrets (such as an
+// access token) were masked in the body, the response can be replayed but
+// its secrets cannot be used against the network.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Scrubbed   bool        `json:"scrubbed,omitempty"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper that records and replays interactions.
+// It is safe for concurrent use.
+type Recorder struct {
+	// Transport sends the requests that are recorded, http.DefaultTransport when nil.
+	Transport http.RoundTripper
+	// IgnoredFields are the JSON fields ignored when matching requests, at any depth.
+	IgnoredFields []string
+	// Redactor scrubs the recorded headers, urls and bodies. The default one masks
+	// redact.DefaultSecretFields, bearer tokens and api keys and keeps the phone numbers.
+	Redactor *redact.Redactor
+
+	path string
+	mode Mode
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+	dirty    bool
+}
+
+// New creates a Recorder for the cassette at path. The cassette is loaded when it
+// exists, it must exist in ModeReplayOnly.
+func New(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		IgnoredFields: DefaultIgnoredFields,
+		Redactor:      redact.New(redact.Rules{KeepPhoneNumbers: true}),
+		path:          path,
+		mode:          mode,
+		cassette:      Cassette{Version: Version},
+	}
+
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && mode == ModeRecordMissing:
+		return r, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("cassette %v: %w", path, err)
+	}
+	if r.cassette.Version != Version {
+		return nil, fmt.Errorf("cassette %v: unsupported version %v", path, r.cassette.Version)
+	}
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// Mode returns the mode of the recorder.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an http.Client using the recorder as transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Interactions returns the interactions of the cassette.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.cassette.Interactions...)
+}
+
+// RoundTrip replays the request from the cassette or sends and records it, depending on the mode.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = data
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	key := r.matchKey(req.Method, req.URL.Path, body)
+
+	if r.mode != ModeRecord {
+		recorded, ok := r.replay(key)
+		switch {
+		case ok && (r.mode == ModeReplayOnly || !recorded.Scrubbed):
+			return recorded.httpResponse(req), nil
+		case ok:
+			// requests recorded after this one need the live secrets, such as
+			// the access token, so it is sent again but not recorded twice
+			return r.transport().RoundTrip(req)
+		case r.mode == ModeReplayOnly:
+			return nil, fmt.Errorf("%w for %v %v", ErrNoInteraction, req.Method, req.URL.Path)
+		}
+	}
+
+	return r.record(req, body)
+}
+
+// transport: returns the transport used to reach the network.
+func (r *Recorder) transport() http.RoundTripper {
+	if r.Transport == nil {
+		return http.DefaultTransport
+	}
+	return r.Transport
+}
+
+// Save writes the cassette when interactions were recorded since it was loaded.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	r.dirty = false
+	return nil
+}
+
+// Close saves the cassette, see Save.
+func (r *Recorder) Close() error {
+	return r.Save()
+}
+
+// replay: returns the response of the first unused interaction matching key, or of
+// the last used one when they were all replayed already (tokens, repeated queries).
+func (r *Recorder) replay(key string) (Response, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := -1
+	for i, in := range r.cassette.Interactions {
+		if r.matchKey(in.Request.Method, requestPath(in.Request.URL), []byte(in.Request.Body)) != key {
+			continue
+		}
+		found = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return Response{}, false
+	}
+	r.used[found] = true
+	return r.cassette.Interactions[found].Response, true
+}
+
+// httpResponse: builds the replayed response of req.
+func (in Response) httpResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.StatusCode, http.StatusText(in.StatusCode)),
+		StatusCode:    in.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(in.Body)),
+		ContentLength: int64(len(in.Body)),
+		Request:       req,
+	}
+}
+
+// record: sends the request and appends the scrubbed interaction to the cassette.
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	res, err := r.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+
+	reqBody, _ := r.scrub(body)
+	scrubbedBody, scrubbed := r.scrub(resBody)
+	in := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    r.Redactor.String(req.URL.String()),
+			Header: r.Redactor.Header(req.Header),
+			Body:   reqBody,
+		},
+		Response: Response{
+			StatusCode: res.StatusCode,
+			Header:     r.Redactor.Header(res.Header),
+			Body:       scrubbedBody,
+			Scrubbed:   scrubbed,
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == ModeRecord && !r.dirty {
+		r.cassette.Interactions = nil
+		r.used = nil
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	r.used = append(r.used, true)
+	r.dirty = true
+	return res, nil
+}
+
+// scrub: masks the secrets of a body and reports whether anything was masked, JSON
+// bodies keep their original bytes when there is nothing to mask.
+func (r *Recorder) scrub(body []byte) (string, bool) {
+	if len(body) == 0 {
+		return "", false
+	}
+	if !json.Valid(body) {
+		masked := r.Redactor.String(string(body))
+		return masked, masked != string(body)
+	}
+
+	var original, masked interface{}
+	_ = json.Unmarshal(body, &original)
+	scrubbed := r.Redactor.JSON(body)
+	_ = json.Unmarshal(scrubbed, &masked)
+	a, _ := json.Marshal(original)
+	b, _ := json.Marshal(masked)
+	if bytes.Equal(a, b) {
+		return string(body), false
+	}
+	return string(scrubbed), true
+}
+
+// matchKey: builds the key requests are matched on, the method, the path and the
+// body scrubbed and stripped of the ignored fields, with sorted JSON keys.
+func (r *Recorder) matchKey(method, path string, body []byte) string {
+	normalized, _ := r.scrub(body)
+	var doc interface{}
+	if err := json.Unmarshal([]byte(normalized), &doc); err == nil {
+		data, _ := json.Marshal(r.strip(doc))
+		normalized = string(data)
+	}
+	return method + " " + path + "\n" + normalized
+}
+
+// strip: removes the ignored fields from a decoded JSON value.
+func (r *Recorder) strip(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, item := range t {
+			if r.ignored(k) {
+				delete(t, k)
+				continue
+			}
+			t[k] = r.strip(item)
+		}
+	case []interface{}:
+		for i, item := range t {
+			t[i] = r.strip(item)
+		}
+	}
+	return v
+}
+
+// ignored: reports whether a JSON field is ignored when matching.
+func (r *Recorder) ignored(field string) bool {
+	for _, f := range r.IgnoredFields {
+		if strings.EqualFold(f, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestPath: returns the path of a recorded url.
+func requestPath(rawURL string) string {
+	path := rawURL
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+		if j := strings.Index(path, "/"); j >= 0 {
+			path = path[j:]
+		} else {
+			path = "/"
+		}
+	}
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
@@ -0,0 +1,131 @@
+package cassette
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/mpesatest"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newApp(t *testing.T, srv *mpesatest.Server, rec *Recorder) *mpesagosdk.App {
+	app, err := mpesagosdk.New(append(srv.Options(),
+		mpesagosdk.WithHTTPClient(rec.Client()),
+		mpesagosdk.WithShortCode("600000"),
+		mpesagosdk.WithInitiator("testapi", "super-secret-credential"),
+		mpesagosdk.WithResultURL("https://example.com/result"),
+		mpesagosdk.WithQueueTimeOutURL("https://example.com/timeout"),
+	)...)
+	require.NoError(t, err)
+	return app
+}
+
+func payment(amount money.Amount, id string) b2c.B2CRequest {
+	return b2c.B2CRequest{
+		CommandID:                types.BusinessPaymentCommand,
+		Amount:                   amount,
+		PartyB:                   251712345678,
+		Remarks:                  "salary",
+		Occasion:                 "october",
+		OriginatorConversationID: id,
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "b2c.json")
+
+	srv := mpesatest.NewServer()
+	rec, err := New(path, ModeRecord)
+	require.NoError(t, err)
+	recorded, err := newApp(t, srv, rec).MakeB2CPaymentRequest(payment(money.Birr(100), "occ-recorded"))
+	require.NoError(t, err)
+	require.NoError(t, rec.Close())
+	srv.Close()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content := string(data)
+	assert.NotContains(t, content, "super-secret-credential")
+	assert.NotContains(t, content, mpesatest.ConsumerKey)
+	assert.NotContains(t, content, srv.Requests()[1].Header.Get("Authorization")[len("Bearer "):])
+	assert.Len(t, rec.Interactions(), 2)
+
+	// the server is closed, the replay must not touch the network
+	replay, err := New(path, ModeReplayOnly)
+	require.NoError(t, err)
+	app := newApp(t, srv, replay)
+
+	res, err := app.MakeB2CPaymentRequest(payment(money.Birr(100), "occ-replayed"))
+	require.NoError(t, err)
+	assert.Equal(t, recorded.ConversationID, res.ConversationID)
+
+	_, err = app.MakeB2CPaymentRequest(payment(money.Birr(200), "occ-other"))
+	assert.True(t, errors.Is(err, ErrNoInteraction), err)
+}
+
+func TestRecordMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "b2c.json")
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	for i, amount := range []money.Amount{money.Birr(100), money.Birr(100), money.Birr(200)} {
+		rec, err := New(path, ModeRecordMissing)
+		require.NoError(t, err)
+		_, err = newApp(t, srv, rec).MakeB2CPaymentRequest(payment(amount, "occ"))
+		require.NoError(t, err)
+		require.NoError(t, rec.Close(), "run %d", i)
+	}
+
+	rec, err := New(path, ModeReplayOnly)
+	require.NoError(t, err)
+	// token + the 100 payment recorded once + the 200 payment
+	assert.Len(t, rec.Interactions(), 3)
+	assert.Equal(t, 2, strings.Count(payloadPaths(rec), "/mpesa/b2c/v2/paymentrequest"))
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Mode
+		wantErr  bool
+	}{
+		{"", ModeReplayOnly, false},
+		{"replay", ModeReplayOnly, false},
+		{"RECORD", ModeRecord, false},
+		{"record-missing", ModeRecordMissing, false},
+		{"rewind", ModeReplayOnly, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			mode, err := ParseMode(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, mode)
+		})
+	}
+}
+
+func TestRequestPath(t *testing.T) {
+	assert.Equal(t, "/v1/c2b-register-url/register", requestPath("https://api.example.com/v1/c2b-register-url/register?apikey=[REDACTED]"))
+	assert.Equal(t, "/", requestPath("http://127.0.0.1:8080"))
+}
+
+func payloadPaths(rec *Recorder) string {
+	var paths []string
+	for _, in := range rec.Interactions() {
+		paths = append(paths, requestPath(in.Request.URL))
+	}
+	return strings.Join(paths, " ")
+}
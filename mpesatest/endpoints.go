@@ -0,0 +1,571 @@
+package mpesatest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/account"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/kyc"
+	"github.com/coleYab/mpesagosdk/qr"
+	"github.com/coleYab/mpesagosdk/transaction"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+// Result codes used by the fake server in asynchronous results.
+const (
+	ResultSuccess            = "0"
+	ResultInsufficientFunds  = "1"
+	ResultInvalidInitiator   = "2001"
+	ResultAlreadyReversed    = "R000001"
+	ResultInvalidTransaction = "R000002"
+	ResultSTKCancelled       = "1032"
+	ResultSTKTimeout         = "1037"
+)
+
+// Endpoint names, as recorded in Request.Endpoint and used by scenario rules.
+const (
+	EndpointToken       = "token"
+	EndpointSTKPush     = "stk_push"
+	EndpointSTKQuery    = "stk_query"
+	EndpointRegisterURL = "register_url"
+	EndpointSimulate    = "simulate"
+	EndpointB2C         = "b2c"
+	EndpointReversal    = "reversal"
+	EndpointStatus      = "transaction_status"
+	EndpointBalance     = "account_balance"
+	EndpointNameCheck   = "name_check"
+	EndpointDynamicQR   = "dynamic_qr"
+)
+
+// NameCheckPath is the path the fake server answers the name checks at, the name check API
+// has no public path and Server.Options configures this one.
+const NameCheckPath = "/mpesa/namecheck/v1/query"
+
+type authScheme int
+
+const (
+	authBasic authScheme = iota
+	authBearer
+	authAPIKey
+)
+
+type endpoint struct {
+	name   string
+	method string
+	auth   authScheme
+	handle func(s *Server, w http.ResponseWriter, r *http.Request, body []byte)
+}
+
+// endpoints are the routes of the fake server keyed by path.
+var endpoints = map[string]endpoint{
+	"/v1/token/generate":                        {EndpointToken, http.MethodGet, authBasic, (*Server).handleToken},
+	"/mpesa/stkpush/v3/processrequest":          {EndpointSTKPush, http.MethodPost, authBearer, (*Server).handleSTKPush},
+	"/mpesa/stkpushquery/v1/query":              {EndpointSTKQuery, http.MethodPost, authBearer, (*Server).handleSTKQuery},
+	"/v1/c2b-register-url/register":             {EndpointRegisterURL, http.MethodPost, authAPIKey, (*Server).handleRegisterURL},
+	"/mpesa/b2c/simulatetransaction/v1/request": {EndpointSimulate, http.MethodPost, authBearer, (*Server).handleSimulate},
+	"/mpesa/b2c/v2/paymentrequest":              {EndpointB2C, http.MethodPost, authBearer, (*Server).handleB2C},
+	"/mpesa/reversal/v1/request":                {EndpointReversal, http.MethodPost, authBearer, (*Server).handleReversal},
+	"/mpesa/transactionstatus/v1/query":         {EndpointStatus, http.MethodPost, authBearer, (*Server).handleStatus},
+	"/mpesa/accountbalance/v1/query":            {EndpointBalance, http.MethodPost, authBearer, (*Server).handleBalance},
+	NameCheckPath:                               {EndpointNameCheck, http.MethodPost, authBearer, (*Server).handleNameCheck},
+	"/mpesa/qrcode/v1/generate":                 {EndpointDynamicQR, http.MethodPost, authBearer, (*Server).handleDynamicQR},
+}
+
+// decodeRequest: decodes and validates a request body like M-Pesa does, writing the
+// error response and returning false when the request is rejected.
+func (s *Server) decodeRequest(w http.ResponseWriter, body []byte, req types.MpesaRequest) bool {
+	if err := json.Unmarshal(body, req); err != nil {
+		writeError(w, http.StatusBadRequest, "400.002.01", "Bad Request - Invalid JSON payload")
+		return false
+	}
+
+	if err := req.Validate(s.validator); err != nil {
+		var verr *types.ValidationError
+		if errors.As(err, &verr) && len(verr.Fields) > 0 {
+			writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid "+verr.Fields[0].Field)
+		} else {
+			writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - "+err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// commonResponse: writes the synchronous acknowledgement shared by most endpoints.
+func commonResponse(w http.ResponseWriter, conversationID, originatorConversationID string) {
+	writeJSON(w, http.StatusOK, types.MpesaCommonResponse{
+		ConversationID:          conversationID,
+		OriginatorConversatonId: originatorConversationID,
+		ResponseCode:            "0",
+		ResponseDescription:     "Accept the service request successfully.",
+	})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request, _ []byte) {
+	if r.URL.Query().Get("grant_type") != "client_credentials" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"resultCode": "999992",
+			"resultDesc": "Invalid grant type passed",
+		})
+		return
+	}
+
+	token := randomHex(16)
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(time.Hour)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   "3599",
+	})
+}
+
+func (s *Server) handleSTKPush(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := c2b.USSDPaymentRequest{}
+	if !s.decodeRequest(w, body, &req) {
+		return
+	}
+	if s.PassKey != "" && req.Password != c2b.GeneratePassword(req.BusinessShortCode, s.PassKey, req.Timestamp) {
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid Password")
+		return
+	}
+
+	checkoutID := fmt.Sprintf("ws_CO_%v_%v", time.Now().Format("02012006150405"), s.nextID())
+	writeJSON(w, http.StatusOK, c2b.USSDSuccessResponse{
+		MerchantRequestID:   req.MerchantRequestID,
+		CheckoutRequestID:   checkoutID,
+		ResponseCode:        "0",
+		ResponseDescription: "Success. Request accepted for processing",
+		CustomerMessage:     "Success. Request accepted for processing",
+	})
+
+	if code, desc, ok := scriptedFailure(r); ok {
+		s.recordCheckout(checkoutID, req.MerchantRequestID, code, desc)
+		cb := &callback.STKCallback{}
+		cb.Body.StkCallback = callback.STKCallbackBody{
+			MerchantRequestID: req.MerchantRequestID,
+			CheckoutRequestID: checkoutID,
+			ResultCode:        callback.Code(code),
+			ResultDesc:        desc,
+		}
+		s.deliver(r, req.CallBackURL, cb)
+		return
+	}
+
+	receipt := s.transactionID()
+	amount := req.Amount
+	s.AddTransaction(Transaction{
+		TransactionID:            receipt,
+		ConversationID:           checkoutID,
+		OriginatorConversationID: req.MerchantRequestID,
+		CommandID:                string(req.TransactionType),
+		Amount:                   amount,
+		DebitParty:               req.PhoneNumber,
+		CreditParty:              req.BusinessShortCode,
+	})
+	s.mu.Lock()
+	s.balance, _ = s.balance.Add(amount)
+	s.mu.Unlock()
+
+	s.recordCheckout(checkoutID, req.MerchantRequestID, ResultSuccess, "The service request is processed successfully.")
+	cb := &callback.STKCallback{}
+	cb.Body.StkCallback = callback.STKCallbackBody{
+		MerchantRequestID: req.MerchantRequestID,
+		CheckoutRequestID: checkoutID,
+		ResultCode:        ResultSuccess,
+		ResultDesc:        "The service request is processed successfully.",
+	}
+	phone, _ := strconv.ParseFloat(req.PhoneNumber, 64)
+	cb.SetMetadata("Amount", callback.AmountValue(amount))
+	cb.SetMetadata("MpesaReceiptNumber", callback.StringValue(receipt))
+	cb.SetMetadata("TransactionDate", callback.Value(time.Now().Format(c2b.TimestampLayout)))
+	cb.SetMetadata("PhoneNumber", callback.NumberValue(phone))
+	s.deliver(r, req.CallBackURL, cb)
+}
+
+func (s *Server) handleSTKQuery(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := c2b.USSDQueryRequest{}
+	if !s.decodeRequest(w, body, &req) {
+		return
+	}
+	if s.PassKey != "" && req.Password != c2b.GeneratePassword(req.BusinessShortCode, s.PassKey, req.Timestamp) {
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid Password")
+		return
+	}
+
+	s.mu.Lock()
+	outcome, found := s.checkouts[req.CheckoutRequestID]
+	s.mu.Unlock()
+	if !found {
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid CheckoutRequestID")
+		return
+	}
+	writeJSON(w, http.StatusOK, c2b.USSDQueryResponse{
+		ResponseCode:        "0",
+		ResponseDescription: "The service request has been accepted successfully",
+		MerchantRequestID:   outcome.merchantRequestID,
+		CheckoutRequestID:   req.CheckoutRequestID,
+		ResultCode:          outcome.code,
+		ResultDesc:          outcome.desc,
+	})
+}
+
+// recordCheckout: records the outcome of a USSD push for the STK query endpoint.
+func (s *Server) recordCheckout(checkoutID, merchantRequestID, code, desc string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkouts[checkoutID] = checkout{merchantRequestID: merchantRequestID, code: code, desc: desc}
+}
+
+func (s *Server) handleRegisterURL(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := c2b.RegisterC2BURLRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, registerURLResponse(400, "Invalid JSON payload"))
+		return
+	}
+	if err := req.Validate(s.validator); err != nil {
+		writeJSON(w, http.StatusBadRequest, registerURLResponse(400, err.Error()))
+		return
+	}
+
+	s.mu.Lock()
+	s.registered[req.ShortCode] = req
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, registerURLResponse(200, "Request processed successfully"))
+}
+
+// registerURLResponse: builds the response format of the register url endpoint.
+func registerURLResponse(code int, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"header": map[string]interface{}{
+			"responseCode":    code,
+			"responseMessage": message,
+			"customerMessage": message,
+			"timestamp":       time.Now().Format(time.RFC3339),
+		},
+	}
+}
+
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := c2b.SimulateCustomerInititatedPayment{}
+	if !s.decodeRequest(w, body, &req) {
+		return
+	}
+
+	conversationID := s.conversationID()
+	originatorID := randomHex(8)
+	commonResponse(w, conversationID, originatorID)
+
+	receipt := s.transactionID()
+	amount := req.Amount
+	s.AddTransaction(Transaction{
+		TransactionID:            receipt,
+		ConversationID:           conversationID,
+		OriginatorConversationID: originatorID,
+		CommandID:                string(req.CommandID),
+		Amount:                   amount,
+		DebitParty:               req.Msisdn,
+		CreditParty:              req.ShortCode,
+	})
+
+	s.mu.Lock()
+	s.balance, _ = s.balance.Add(amount)
+	balance := s.balance
+	registered, ok := s.registered[req.ShortCode]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	transactionType := "Pay Bill"
+	if req.CommandID == types.CustomerBuyGoodsOnlineCommand {
+		transactionType = "Buy Goods"
+	}
+	s.deliver(r, registered.ConfirmationURL, &callback.C2BConfirmation{
+		TransactionType:   transactionType,
+		TransID:           receipt,
+		TransTime:         time.Now().Format(c2b.TimestampLayout),
+		TransAmount:       amount,
+		BusinessShortCode: req.ShortCode,
+		BillRefNumber:     req.BillRefNumber,
+		OrgAccountBalance: balance,
+		MSISDN:            req.Msisdn,
+		FirstName:         s.customerName(req.Msisdn),
+	})
+}
+
+func (s *Server) handleB2C(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := b2c.B2CRequest{}
+	if !s.decodeRequest(w, body, &req) {
+		return
+	}
+
+	conversationID := s.conversationID()
+	commonResponse(w, conversationID, req.OriginatorConversationID)
+	if s.failResult(r, req.ResultURL, req.OriginatorConversationID, conversationID, req.QueueTimeOutURL) {
+		return
+	}
+
+	amount := req.Amount
+	recipient := fmt.Sprint(req.PartyB)
+
+	s.mu.Lock()
+	funded := s.balance.Cmp(amount) >= 0
+	if funded {
+		s.balance, _ = s.balance.Sub(amount)
+	}
+	balance := s.balance
+	s.mu.Unlock()
+
+	if !funded {
+		res := s.result(ResultInsufficientFunds, "The balance is insufficient for the transaction.",
+			req.OriginatorConversationID, conversationID, s.transactionID(), req.QueueTimeOutURL)
+		s.deliver(r, req.ResultURL, res)
+		return
+	}
+
+	receipt := s.transactionID()
+	now := time.Now()
+	s.AddTransaction(Transaction{
+		TransactionID:            receipt,
+		ConversationID:           conversationID,
+		OriginatorConversationID: req.OriginatorConversationID,
+		CommandID:                string(req.CommandID),
+		Amount:                   amount,
+		DebitParty:               fmt.Sprint(req.PartyA),
+		CreditParty:              recipient,
+		Completed:                now,
+	})
+
+	res := s.result(ResultSuccess, "The service request is processed successfully.",
+		req.OriginatorConversationID, conversationID, receipt, req.QueueTimeOutURL)
+	res.SetParameter("TransactionAmount", callback.AmountValue(amount))
+	res.SetParameter("TransactionReceipt", callback.StringValue(receipt))
+	res.SetParameter("B2CRecipientIsRegisteredCustomer", callback.StringValue("Y"))
+	res.SetParameter("B2CChargesPaidAccountAvailableFunds", callback.NumberValue(0))
+	res.SetParameter("ReceiverPartyPublicName", callback.StringValue(recipient+" - "+s.customerName(recipient)))
+	res.SetParameter("TransactionCompletedDateTime", callback.StringValue(now.Format("02.01.2006 15:04:05")))
+	res.SetParameter("B2CUtilityAccountAvailableFunds", callback.AmountValue(balance))
+	res.SetParameter("B2CWorkingAccountAvailableFunds", callback.AmountValue(balance))
+	s.deliver(r, req.ResultURL, res)
+}
+
+func (s *Server) handleReversal(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := transaction.TransactionReversalRequest{}
+	if !s.decodeRequest(w, body, &req) {
+		return
+	}
+
+	conversationID := s.conversationID()
+	commonResponse(w, conversationID, req.OriginatorConversationID)
+	if s.failResult(r, req.ResultURL, req.OriginatorConversationID, conversationID, req.QueueTimeOutURL) {
+		return
+	}
+
+	s.mu.Lock()
+	original, found := s.transactions[req.TransactionID]
+	reversed := found && original.Reversed
+	if found && !reversed {
+		original.Reversed = true
+		s.balance, _ = s.balance.Add(original.Amount)
+	}
+	balance := s.balance
+	s.mu.Unlock()
+
+	receipt := s.transactionID()
+	switch {
+	case !found:
+		s.deliver(r, req.ResultURL, s.result(ResultInvalidTransaction, "The OriginalTransactionID is invalid.",
+			req.OriginatorConversationID, conversationID, receipt, req.QueueTimeOutURL))
+		return
+	case reversed:
+		s.deliver(r, req.ResultURL, s.result(ResultAlreadyReversed, "The transaction has already been reversed.",
+			req.OriginatorConversationID, conversationID, receipt, req.QueueTimeOutURL))
+		return
+	}
+
+	s.AddTransaction(Transaction{
+		TransactionID:            receipt,
+		ConversationID:           conversationID,
+		OriginatorConversationID: req.OriginatorConversationID,
+		CommandID:                string(req.CommandID),
+		Amount:                   original.Amount,
+		DebitParty:               original.CreditParty,
+		CreditParty:              original.DebitParty,
+	})
+	res := s.result(ResultSuccess, "The service request is processed successfully.",
+		req.OriginatorConversationID, conversationID, receipt, req.QueueTimeOutURL)
+	res.SetParameter("DebitAccountBalance", callback.StringValue(fmt.Sprintf("Utility Account|ETB|%s|%s|0.00|0.00", balance, balance)))
+	res.SetParameter("Amount", callback.AmountValue(original.Amount))
+	res.SetParameter("TransCompletedTime", callback.Value(time.Now().Format(c2b.TimestampLayout)))
+	res.SetParameter("OriginalTransactionID", callback.StringValue(original.TransactionID))
+	res.SetParameter("Charge", callback.NumberValue(0))
+	res.SetParameter("CreditPartyPublicName", callback.StringValue(original.DebitParty+" - "+s.customerName(original.DebitParty)))
+	res.SetParameter("DebitPartyPublicName", callback.StringValue(original.CreditParty))
+	s.deliver(r, req.ResultURL, res)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := transaction.TransactionStatusRequest{}
+	if !s.decodeRequest(w, body, &req) {
+		return
+	}
+
+	conversationID := s.conversationID()
+	commonResponse(w, conversationID, req.OriginatorConversationID)
+	if s.failResult(r, req.ResultURL, req.OriginatorConversationID, conversationID, req.QueueTimeOutURL) {
+		return
+	}
+
+	t, found := s.Transaction(req.TransactionID)
+	if req.TransactionID == "" {
+		t, found = s.transactionByOriginator(req.OriginalConversationID)
+	}
+	if !found {
+		s.deliver(r, req.ResultURL, s.result(ResultInvalidTransaction, "The transaction receipt number does not exist.",
+			req.OriginatorConversationID, conversationID, req.TransactionID, req.QueueTimeOutURL))
+		return
+	}
+
+	status := "Completed"
+	if t.Reversed {
+		status = "Reversed"
+	}
+	res := s.result(ResultSuccess, "The service request is processed successfully.",
+		req.OriginatorConversationID, conversationID, t.TransactionID, req.QueueTimeOutURL)
+	res.SetParameter("ReceiptNo", callback.StringValue(t.TransactionID))
+	res.SetParameter("ConversationID", callback.StringValue(t.ConversationID))
+	res.SetParameter("OriginatorConversationID", callback.StringValue(t.OriginatorConversationID))
+	res.SetParameter("FinalisedTime", callback.Value(t.Completed.Format(c2b.TimestampLayout)))
+	res.SetParameter("Amount", callback.AmountValue(t.Amount))
+	res.SetParameter("TransactionStatus", callback.StringValue(status))
+	res.SetParameter("ReasonType", callback.StringValue(t.CommandID))
+	res.SetParameter("DebitPartyName", callback.StringValue(t.DebitParty))
+	res.SetParameter("CreditPartyName", callback.StringValue(t.CreditParty))
+	s.deliver(r, req.ResultURL, res)
+}
+
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := account.AccountBalanceRequest{}
+	if !s.decodeRequest(w, body, &req) {
+		return
+	}
+
+	conversationID := s.conversationID()
+	commonResponse(w, conversationID, req.OriginatorConversationID)
+	if s.failResult(r, req.ResultURL, req.OriginatorConversationID, conversationID, req.QueueTimeOutURL) {
+		return
+	}
+
+	balance := s.Balance()
+	res := s.result(ResultSuccess, "The service request is processed successfully.",
+		req.OriginatorConversationID, conversationID, s.transactionID(), req.QueueTimeOutURL)
+	res.SetParameter("AccountBalance", callback.StringValue(fmt.Sprintf(
+		"Working Account|ETB|%s|%s|0.00|0.00&Utility Account|ETB|%s|%s|0.00|0.00", balance, balance, balance, balance)))
+	res.SetParameter("BOCompletedTime", callback.Value(time.Now().Format(c2b.TimestampLayout)))
+	s.deliver(r, req.ResultURL, res)
+}
+
+func (s *Server) handleNameCheck(w http.ResponseWriter, _ *http.Request, body []byte) {
+	req := kyc.NameCheckRequest{}
+	if !s.decodeRequest(w, body, &req) {
+		return
+	}
+	writeJSON(w, http.StatusOK, kyc.NameCheckResponse{
+		ConversationID:           s.conversationID(),
+		OriginatorConversationID: req.OriginatorConversationID,
+		ResponseCode:             "0",
+		ResponseDescription:      "Accept the service request successfully.",
+		Msisdn:                   req.Msisdn,
+		CustomerName:             s.customerName(req.Msisdn),
+	})
+}
+
+func (s *Server) handleDynamicQR(w http.ResponseWriter, _ *http.Request, body []byte) {
+	req := c2b.DynamicQRRequest{}
+	if !s.decodeRequest(w, body, &req) {
+		return
+	}
+	qrCode, err := renderQR(req)
+	if errors.Is(err, errQRSize) {
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid Size")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "500.003.01", "Internal Server Error - "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, c2b.DynamicQRResponse{
+		ResponseCode:        s.conversationID(),
+		RequestID:           randomHex(8),
+		ResponseDescription: "QR Code Successfully Generated.",
+		QRCode:              qrCode,
+	})
+}
+
+// maxQRSize is the largest image, in pixels, the fake server renders for a dynamic QR request.
+const maxQRSize = 1000
+
+// errQRSize is returned by renderQR for a size above maxQRSize.
+var errQRSize = fmt.Errorf("mpesatest: the QR code size is above %v pixels", maxQRSize)
+
+// renderQR: renders the base64 PNG returned for a dynamic QR request, of about the
+// requested size. The code holds the fields of the request separated by "|", it is not
+// the payload of the real API and only scans as text.
+func renderQR(req c2b.DynamicQRRequest) (string, error) {
+	size, _ := strconv.Atoi(req.Size)
+	if size > maxQRSize {
+		return "", errQRSize
+	}
+	code, err := qr.Encode(strings.Join([]string{
+		string(req.TrxCode), req.CPI, req.Amount.Decimal(), req.RefNo, req.MerchantName,
+	}, "|"), qr.Medium)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := code.WritePNG(&buf, size/(code.Size()+2*qr.QuietZone)); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// failResult: delivers the failed result scripted for the request by a Rule, it
+// returns false when no failure is scripted.
+func (s *Server) failResult(r *http.Request, resultURL, originatorConversationID, conversationID, queueTimeOutURL string) bool {
+	code, desc, ok := scriptedFailure(r)
+	if !ok {
+		return false
+	}
+	s.deliver(r, resultURL, s.result(code, desc, originatorConversationID, conversationID, s.transactionID(), queueTimeOutURL))
+	return true
+}
+
+// result: builds a Result callback without parameters.
+func (s *Server) result(code, desc, originatorConversationID, conversationID, transactionID, queueTimeOutURL string) *callback.Result {
+	res := &callback.Result{}
+	res.Result = callback.ResultBody{
+		ResultType:               0,
+		ResultCode:               callback.Code(code),
+		ResultDesc:               desc,
+		OriginatorConversationID: originatorConversationID,
+		ConversationID:           conversationID,
+		TransactionID:            transactionID,
+		ReferenceData: &callback.ReferenceData{
+			ReferenceItem: callback.Parameter{Key: "QueueTimeoutURL", Value: callback.StringValue(queueTimeOutURL)},
+		},
+	}
+	return res
+}
@@ -0,0 +1,303 @@
+package mpesatest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/account"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/kyc"
+	"github.com/coleYab/mpesagosdk/transaction"
+)
+
+// Operation names recorded by FakeClient, they match the `operation` attribute of the SDK logs.
+const (
+	OperationAccountBalance = "account_balance"
+	OperationB2CPayment     = "b2c_payment"
+	OperationReversal       = "transaction_reversal"
+	OperationStatus         = "transaction_status"
+	OperationUSSDPush       = "ussd_push"
+	OperationUSSDQuery      = "ussd_query"
+	OperationSimulate       = "c2b_simulate"
+	OperationRegisterURL    = "c2b_register_url"
+	OperationNameCheck      = "customer_name_check"
+	OperationDynamicQR      = "dynamic_qr"
+)
+
+// Call is an operation recorded by FakeClient.
+type Call struct {
+	Operation string
+	Request   interface{}
+	Time      time.Time
+}
+
+// FakeClient is an in-memory mpesagosdk.Client for unit tests of code that depends on
+// the Client interface. Every call is recorded, and the responses are programmed with
+// the Func fields; operations without a function succeed with a ResponseCode "0"
+// acknowledgement that echoes the request identifiers.
+//
+// Example usage:
+//
+//	fake := mpesatest.NewFakeClient()
+//	fake.B2CPaymentFunc = func(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
+//		return nil, &types.MpesaErrorResponse{ErrorCode: "500.003.02", ErrorMessage: "System is busy"}
+//	}
+//
+//	svc := NewPayoutService(fake)
+//	svc.Pay(...)
+//
+//	calls := fake.CallsTo(mpesatest.OperationB2CPayment)
+type FakeClient struct {
+	AccountBalanceFunc func(req account.AccountBalanceRequest) (*account.AccountBalanceSuccessResponse, error)
+	B2CPaymentFunc     func(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error)
+	ReversalFunc       func(req transaction.TransactionReversalRequest) (*transaction.TransactionReversalResponse, error)
+	StatusFunc         func(req transaction.TransactionStatusRequest) (*transaction.TransactionStatusResponse, error)
+	USSDPushFunc       func(req c2b.USSDPaymentRequest) (*c2b.USSDSuccessResponse, error)
+	USSDQueryFunc      func(req c2b.USSDQueryRequest) (*c2b.USSDQueryResponse, error)
+	SimulateFunc       func(req c2b.SimulateCustomerInititatedPayment) (*c2b.SimulatePaymentSuccessResponse, error)
+	RegisterURLFunc    func(req c2b.RegisterC2BURLRequest) (*c2b.RegisterURLResponse, error)
+	NameCheckFunc      func(req kyc.NameCheckRequest) (*kyc.NameCheckResponse, error)
+	DynamicQRFunc      func(req c2b.DynamicQRRequest) (*c2b.DynamicQRResponse, error)
+
+	mu    sync.Mutex
+	seq   int
+	calls []Call
+	errs  map[string]error
+}
+
+var _ mpesagosdk.Client = (*FakeClient)(nil)
+
+// NewFakeClient returns a FakeClient where every operation succeeds.
+func NewFakeClient() *FakeClient {
+	return &FakeClient{errs: map[string]error{}}
+}
+
+// FailWith makes every following call of an operation without a Func return err,
+// a nil err makes the operation succeed again.
+func (f *FakeClient) FailWith(operation string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.errs == nil {
+		f.errs = map[string]error{}
+	}
+	f.errs[operation] = err
+}
+
+// Calls returns every call recorded so far.
+func (f *FakeClient) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallsTo returns the calls recorded so far for an operation.
+func (f *FakeClient) CallsTo(operation string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []Call
+	for _, c := range f.calls {
+		if c.Operation == operation {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls and the errors set with FailWith.
+func (f *FakeClient) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+	f.errs = map[string]error{}
+}
+
+// MakeAccountBalanceQuery records the call and returns the programmed response.
+func (f *FakeClient) MakeAccountBalanceQuery(req account.AccountBalanceRequest) (*account.AccountBalanceSuccessResponse, error) {
+	conversationID, err := f.record(OperationAccountBalance, req)
+	if f.AccountBalanceFunc != nil {
+		return f.AccountBalanceFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account.AccountBalanceSuccessResponse{
+		ConversationID:          conversationID,
+		OriginatorConversatonId: req.OriginatorConversationID,
+		ResponseCode:            "0",
+		ResponseDescription:     "Accept the service request successfully.",
+	}, nil
+}
+
+// MakeB2CPaymentRequest records the call and returns the programmed response.
+func (f *FakeClient) MakeB2CPaymentRequest(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
+	conversationID, err := f.record(OperationB2CPayment, req)
+	if f.B2CPaymentFunc != nil {
+		return f.B2CPaymentFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b2c.B2CSuccessResponse{
+		ConversationID:          conversationID,
+		OriginatorConversatonId: req.OriginatorConversationID,
+		ResponseCode:            "0",
+		ResponseDescription:     "Accept the service request successfully.",
+	}, nil
+}
+
+// MakeTransactionReversalRequest records the call and returns the programmed response.
+func (f *FakeClient) MakeTransactionReversalRequest(req transaction.TransactionReversalRequest) (*transaction.TransactionReversalResponse, error) {
+	conversationID, err := f.record(OperationReversal, req)
+	if f.ReversalFunc != nil {
+		return f.ReversalFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &transaction.TransactionReversalResponse{
+		ConversationID:          conversationID,
+		OriginatorConversatonId: req.OriginatorConversationID,
+		ResponseCode:            "0",
+		ResponseDescription:     "Accept the service request successfully.",
+	}, nil
+}
+
+// MakeTransactionStatusQuery records the call and returns the programmed response.
+func (f *FakeClient) MakeTransactionStatusQuery(req transaction.TransactionStatusRequest) (*transaction.TransactionStatusResponse, error) {
+	conversationID, err := f.record(OperationStatus, req)
+	if f.StatusFunc != nil {
+		return f.StatusFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &transaction.TransactionStatusResponse{
+		ConversationID:          conversationID,
+		OriginatorConversatonId: req.OriginatorConversationID,
+		ResponseCode:            "0",
+		ResponseDescription:     "Accept the service request successfully.",
+	}, nil
+}
+
+// USSDPaymentRequest records the call and returns the programmed response.
+func (f *FakeClient) USSDPaymentRequest(req c2b.USSDPaymentRequest) (*c2b.USSDSuccessResponse, error) {
+	conversationID, err := f.record(OperationUSSDPush, req)
+	if f.USSDPushFunc != nil {
+		return f.USSDPushFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c2b.USSDSuccessResponse{
+		MerchantRequestID:   req.MerchantRequestID,
+		CheckoutRequestID:   "ws_CO_" + conversationID,
+		ResponseCode:        "0",
+		ResponseDescription: "Success. Request accepted for processing",
+		CustomerMessage:     "Success. Request accepted for processing",
+	}, nil
+}
+
+// USSDPaymentQuery records the call and returns the programmed response, a completed
+// payment by default.
+func (f *FakeClient) USSDPaymentQuery(req c2b.USSDQueryRequest) (*c2b.USSDQueryResponse, error) {
+	_, err := f.record(OperationUSSDQuery, req)
+	if f.USSDQueryFunc != nil {
+		return f.USSDQueryFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c2b.USSDQueryResponse{
+		ResponseCode:        "0",
+		ResponseDescription: "The service request has been accepted successfully",
+		CheckoutRequestID:   req.CheckoutRequestID,
+		ResultCode:          "0",
+		ResultDesc:          "The service request is processed successfully.",
+	}, nil
+}
+
+// GenerateDynamicQR records the call and returns the programmed response, by default a
+// readable code of the request fields, as the fake server renders it.
+func (f *FakeClient) GenerateDynamicQR(req c2b.DynamicQRRequest) (*c2b.DynamicQRResponse, error) {
+	conversationID, err := f.record(OperationDynamicQR, req)
+	if f.DynamicQRFunc != nil {
+		return f.DynamicQRFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.FillDefaults()
+	qrCode, err := renderQR(req)
+	if err != nil {
+		return nil, err
+	}
+	return &c2b.DynamicQRResponse{
+		ResponseCode:        conversationID,
+		RequestID:           conversationID,
+		ResponseDescription: "QR Code Successfully Generated.",
+		QRCode:              qrCode,
+	}, nil
+}
+
+// SimulateCustomerInitiatedPayment records the call and returns the programmed response.
+func (f *FakeClient) SimulateCustomerInitiatedPayment(req c2b.SimulateCustomerInititatedPayment) (*c2b.SimulatePaymentSuccessResponse, error) {
+	conversationID, err := f.record(OperationSimulate, req)
+	if f.SimulateFunc != nil {
+		return f.SimulateFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c2b.SimulatePaymentSuccessResponse{
+		ConversationID:      conversationID,
+		ResponseCode:        "0",
+		ResponseDescription: "Accept the service request successfully.",
+	}, nil
+}
+
+// RegisterNewURL records the call and returns the programmed response.
+func (f *FakeClient) RegisterNewURL(req c2b.RegisterC2BURLRequest) (*c2b.RegisterURLResponse, error) {
+	_, err := f.record(OperationRegisterURL, req)
+	if f.RegisterURLFunc != nil {
+		return f.RegisterURLFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c2b.RegisterURLResponse{
+		ResponseCode:        "200",
+		ResponseDescription: "Request processed successfully",
+	}, nil
+}
+
+// CheckCustomerName records the call and returns the programmed response, a customer
+// registered as DefaultCustomerName by default.
+func (f *FakeClient) CheckCustomerName(req kyc.NameCheckRequest) (*kyc.NameCheckResponse, error) {
+	conversationID, err := f.record(OperationNameCheck, req)
+	if f.NameCheckFunc != nil {
+		return f.NameCheckFunc(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &kyc.NameCheckResponse{
+		ConversationID:           conversationID,
+		OriginatorConversationID: req.OriginatorConversationID,
+		ResponseCode:             "0",
+		ResponseDescription:      "Accept the service request successfully.",
+		Msisdn:                   req.Msisdn,
+		CustomerName:             DefaultCustomerName,
+	}, nil
+}
+
+// record: records a call and returns a new conversation id and the error set with FailWith.
+func (f *FakeClient) record(operation string, req interface{}) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	f.calls = append(f.calls, Call{Operation: operation, Request: req, Time: time.Now()})
+	return fmt.Sprintf("AG_FAKE_%08d", f.seq), f.errs[operation]
+}
@@ -0,0 +1,61 @@
+package mpesatest
+
+import (
+	"testing"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// payout is a consumer of the Client interface, as service code would be.
+func payout(client mpesagosdk.Client, phone uint, amount money.Amount) (string, error) {
+	res, err := client.MakeB2CPaymentRequest(b2c.B2CRequest{PartyB: phone, Amount: amount, OriginatorConversationID: "occ-1"})
+	if err != nil {
+		return "", err
+	}
+	return res.ConversationID, nil
+}
+
+func TestFakeClient(t *testing.T) {
+	fake := NewFakeClient()
+
+	id, err := payout(fake, 251712345678, money.Birr(100))
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	calls := fake.CallsTo(OperationB2CPayment)
+	require.Len(t, calls, 1)
+	assert.Equal(t, money.Birr(100), calls[0].Request.(b2c.B2CRequest).Amount)
+
+	busy := &types.MpesaErrorResponse{ErrorCode: "500.003.02", ErrorMessage: "System is busy"}
+	fake.FailWith(OperationB2CPayment, busy)
+	_, err = payout(fake, 251712345678, money.Birr(100))
+	assert.Equal(t, busy, err)
+
+	fake.B2CPaymentFunc = func(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
+		return &b2c.B2CSuccessResponse{ConversationID: "AG_PROGRAMMED", ResponseCode: "0"}, nil
+	}
+	id, err = payout(fake, 251712345678, money.Birr(100))
+	require.NoError(t, err)
+	assert.Equal(t, "AG_PROGRAMMED", id)
+
+	_, err = fake.USSDPaymentRequest(c2b.USSDPaymentRequest{MerchantRequestID: "merchant-1"})
+	require.NoError(t, err)
+	assert.Len(t, fake.Calls(), 4)
+
+	fake.Reset()
+	assert.Empty(t, fake.Calls())
+
+	qr, err := fake.GenerateDynamicQR(c2b.DynamicQRRequest{TrxCode: types.BuyGoodsQRCode, CPI: "373132", Amount: money.Birr(20)})
+	require.NoError(t, err)
+	_, err = qr.Image()
+	assert.NoError(t, err)
+
+	_, err = fake.GenerateDynamicQR(c2b.DynamicQRRequest{TrxCode: types.BuyGoodsQRCode, CPI: "373132", Amount: money.Birr(20), Size: "100000"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,271 @@
+package mpesatest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
+)
+
+// Rule scripts a failure of the fake server. A rule matches requests by endpoint,
+// MSISDN and amount, and changes how the matched requests are answered and how
+// their callbacks are delivered. Rules are evaluated in the order they were added
+// and the first matching rule applies.
+//
+// Example usage:
+//
+//	srv.AddRule(mpesatest.InsufficientFunds().ForMSISDN("251712345678"))
+//	srv.AddRule(mpesatest.Throttled().OnEndpoint(mpesatest.EndpointB2C).Limit(2))
+//	srv.AddRule(mpesatest.DuplicateCallback(1).ForAmount(money.Birr(500)))
+type Rule struct {
+	// Endpoint restricts the rule to an endpoint (EndpointB2C, EndpointSTKPush...), empty
+	// matches all but EndpointToken, which only the rules naming it match.
+	Endpoint string
+	// MSISDN restricts the rule to requests where one of PartyA, PartyB, PhoneNumber,
+	// Msisdn or ReceiverParty is this number, in any form such as 0712345678 or
+	// +251712345678, empty matches all.
+	MSISDN string
+	// MinAmount and MaxAmount restrict the rule to requests with an Amount in the
+	// inclusive range, zero leaves the bound open.
+	MinAmount money.Amount
+	MaxAmount money.Amount
+	// Times is the number of requests the rule applies to, zero applies it forever.
+	Times int
+
+	// Delay is waited before the request is answered, even when the client gave up.
+	Delay time.Duration
+	// StatusCode, Body and Header replace the synchronous response when StatusCode is set.
+	StatusCode int
+	Body       string
+	Header     http.Header
+	// ResultCode and ResultDesc turn the asynchronous result of an accepted request into a failure.
+	ResultCode string
+	ResultDesc string
+	// DropCallback accepts the request but never delivers its callback.
+	DropCallback bool
+	// Duplicates is the number of extra copies of the callback to deliver.
+	Duplicates int
+	// CallbackDelay is added to the server CallbackDelay before the callback is delivered.
+	CallbackDelay time.Duration
+}
+
+// InsufficientFunds: fails the matched payments with result code 1.
+func InsufficientFunds() Rule {
+	return Rule{ResultCode: ResultInsufficientFunds, ResultDesc: "The balance is insufficient for the transaction."}
+}
+
+// InvalidInitiator: fails the matched requests with result code 2001.
+func InvalidInitiator() Rule {
+	return Rule{ResultCode: ResultInvalidInitiator, ResultDesc: "The initiator information is invalid."}
+}
+
+// STKCancelled: makes the matched USSD push requests fail as cancelled by the customer.
+func STKCancelled() Rule {
+	return Rule{Endpoint: EndpointSTKPush, ResultCode: ResultSTKCancelled, ResultDesc: "Request cancelled by user"}
+}
+
+// Throttled: answers the matched requests with the gateway 429 response.
+func Throttled() Rule {
+	body, _ := json.Marshal(map[string]string{
+		"requestId":    "",
+		"errorCode":    "429.001.01",
+		"errorMessage": "Too Many Requests - Spike arrest violation",
+	})
+	return Rule{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       string(body),
+		Header:     http.Header{"Content-Type": {"application/json"}, "Retry-After": {"1"}},
+	}
+}
+
+// BadGateway: answers the matched requests with the HTML 502 page of the gateway.
+func BadGateway() Rule {
+	return Rule{
+		StatusCode: http.StatusBadGateway,
+		Body:       "<html><head><title>502 Bad Gateway</title></head><body><center><h1>502 Bad Gateway</h1></center></body></html>",
+		Header:     http.Header{"Content-Type": {"text/html"}},
+	}
+}
+
+// Slow: answers the matched requests normally after d. Like M-Pesa, the server still
+// processes a request whose client timed out, only the answer is lost.
+func Slow(d time.Duration) Rule {
+	return Rule{Delay: d}
+}
+
+// DropCallback: accepts the matched requests but never delivers their callbacks.
+func DropCallback() Rule {
+	return Rule{DropCallback: true}
+}
+
+// DuplicateCallback: delivers the callbacks of the matched requests n extra times.
+func DuplicateCallback(n int) Rule {
+	return Rule{Duplicates: n}
+}
+
+// LateCallback: delivers the callbacks of the matched requests d later than usual.
+func LateCallback(d time.Duration) Rule {
+	return Rule{CallbackDelay: d}
+}
+
+// OnEndpoint: returns a copy of the rule restricted to an endpoint.
+func (r Rule) OnEndpoint(endpoint string) Rule {
+	r.Endpoint = endpoint
+	return r
+}
+
+// ForMSISDN: returns a copy of the rule restricted to an MSISDN.
+func (r Rule) ForMSISDN(msisdn string) Rule {
+	r.MSISDN = msisdn
+	return r
+}
+
+// ForAmount: returns a copy of the rule restricted to an exact amount.
+func (r Rule) ForAmount(amount money.Amount) Rule {
+	r.MinAmount, r.MaxAmount = amount, amount
+	return r
+}
+
+// ForAmountRange: returns a copy of the rule restricted to an inclusive amount range.
+func (r Rule) ForAmountRange(min, max money.Amount) Rule {
+	r.MinAmount, r.MaxAmount = min, max
+	return r
+}
+
+// Limit: returns a copy of the rule that applies to the next n matched requests only.
+func (r Rule) Limit(n int) Rule {
+	r.Times = n
+	return r
+}
+
+// scriptedRule: a rule with the number of requests it was applied to.
+type scriptedRule struct {
+	Rule
+	used int
+}
+
+// AddRule adds a failure scenario, see Rule.
+func (s *Server) AddRule(r Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, &scriptedRule{Rule: r})
+}
+
+// ClearRules removes every failure scenario.
+func (s *Server) ClearRules() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = nil
+}
+
+// matchRule: returns the first rule matching the request and counts its use.
+func (s *Server) matchRule(endpoint string, body []byte) *Rule {
+	msisdns, amount := requestFacts(body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rules {
+		if r.Times > 0 && r.used >= r.Times {
+			continue
+		}
+		if (r.Endpoint != "" || endpoint == EndpointToken) && r.Endpoint != endpoint {
+			continue
+		}
+		if r.MSISDN != "" && !containsMSISDN(msisdns, r.MSISDN) {
+			continue
+		}
+		if (!r.MinAmount.IsZero() && amount.Cmp(r.MinAmount) < 0) || (!r.MaxAmount.IsZero() && amount.Cmp(r.MaxAmount) > 0) {
+			continue
+		}
+		r.used++
+		rule := r.Rule
+		return &rule
+	}
+	return nil
+}
+
+// requestFacts: extracts the parties and the amount a rule can match on from a request body.
+func requestFacts(body []byte) ([]string, money.Amount) {
+	var fields map[string]callback.Value
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, money.Zero
+	}
+
+	var msisdns []string
+	for _, key := range []string{"PartyA", "PartyB", "PhoneNumber", "Msisdn", "ReceiverParty"} {
+		if v, ok := fields[key]; ok {
+			msisdns = append(msisdns, v.String())
+		}
+	}
+	amount, _ := fields["Amount"].Amount()
+	return msisdns, amount
+}
+
+// containsMSISDN: reports whether msisdn is one of the parties, both are compared in
+// the 2517XXXXXXXX form.
+func containsMSISDN(parties []string, msisdn string) bool {
+	msisdn = normalizeMSISDN(msisdn)
+	for _, p := range parties {
+		if normalizeMSISDN(p) == msisdn {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeMSISDN: rewrites a phone number to the 2517XXXXXXXX form, short codes and
+// other values are only stripped of a leading +.
+func normalizeMSISDN(s string) string {
+	if normalized, err := msisdn.Normalize(s); err == nil {
+		return normalized
+	}
+	return strings.TrimPrefix(strings.TrimSpace(s), "+")
+}
+
+type ruleKey struct{}
+
+// ruleFrom: returns the rule applied to a request, nil when none matched.
+func ruleFrom(r *http.Request) *Rule {
+	rule, _ := r.Context().Value(ruleKey{}).(*Rule)
+	return rule
+}
+
+// applyRule: matches the request against the rules, waits for the scripted delay and
+// writes the scripted response. It returns the request carrying the matched rule and
+// false when the response was already written.
+func (s *Server) applyRule(w http.ResponseWriter, r *http.Request, endpoint string, body []byte) (*http.Request, bool) {
+	rule := s.matchRule(endpoint, body)
+	if rule == nil {
+		return r, true
+	}
+
+	if rule.Delay > 0 {
+		time.Sleep(rule.Delay)
+		r = r.WithContext(context.WithoutCancel(r.Context()))
+	}
+
+	if rule.StatusCode != 0 {
+		for key, values := range rule.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rule.StatusCode)
+		_, _ = w.Write([]byte(rule.Body))
+		return r, false
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), ruleKey{}, rule)), true
+}
+
+// scriptedFailure: returns the result code and description a rule forces on the request.
+func scriptedFailure(r *http.Request) (code, desc string, ok bool) {
+	rule := ruleFrom(r)
+	if rule == nil || rule.ResultCode == "" {
+		return "", "", false
+	}
+	return rule.ResultCode, rule.ResultDesc, true
+}
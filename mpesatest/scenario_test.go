@@ -0,0 +1,495 @@
+package mpesatest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/account"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/kyc"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/store"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func payment(partyB uint, amount money.Amount, id string) b2c.B2CRequest {
+	return b2c.B2CRequest{
+		CommandID:                types.BusinessPaymentCommand,
+		Amount:                   amount,
+		PartyB:                   partyB,
+		Remarks:                  "salary",
+		Occasion:                 "october",
+		OriginatorConversationID: id,
+	}
+}
+
+func TestResultRules(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddRule(InsufficientFunds().ForMSISDN("251711111111"))
+	srv.AddRule(InvalidInitiator().ForAmountRange(money.Birr(1000), money.Birr(2000)))
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	tests := []struct {
+		name     string
+		req      b2c.B2CRequest
+		expected callback.Code
+	}{
+		{"Matched MSISDN", payment(251711111111, money.Birr(10), "occ-1"), callback.Code(ResultInsufficientFunds)},
+		{"Matched amount", payment(251722222222, money.Birr(1500), "occ-2"), callback.Code(ResultInvalidInitiator)},
+		{"No rule", payment(251722222222, money.Birr(10), "occ-3"), callback.Success},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := app.MakeB2CPaymentRequest(tt.req)
+			require.NoError(t, err)
+			srv.WaitForCallbacks()
+			assert.Equal(t, tt.expected, rc.lastResult(t).Result.ResultCode)
+		})
+	}
+}
+
+func TestGatewayRules(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddRule(Throttled().OnEndpoint(EndpointB2C).Limit(1))
+	srv.AddRule(BadGateway().ForMSISDN("251733333333"))
+	srv.AddRule(Rule{StatusCode: http.StatusGatewayTimeout, Body: `{"requestId":"","errorMessage":"Gateway Timeout"}`}.
+		ForMSISDN("251744444444"))
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	_, err := app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-1"))
+	var mpesaErr *types.MpesaErrorResponse
+	require.ErrorAs(t, err, &mpesaErr)
+	assert.Equal(t, http.StatusTooManyRequests, mpesaErr.StatusCode)
+	assert.True(t, types.Refused(err))
+
+	_, err = app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-2"))
+	assert.NoError(t, err, "the throttling rule is limited to one request")
+
+	_, err = app.MakeB2CPaymentRequest(payment(251733333333, money.Birr(10), "occ-3"))
+	assert.Error(t, err)
+	assert.False(t, types.Refused(err))
+
+	_, err = app.MakeB2CPaymentRequest(payment(251744444444, money.Birr(10), "occ-4"))
+	require.ErrorAs(t, err, &mpesaErr)
+	assert.Equal(t, http.StatusGatewayTimeout, mpesaErr.StatusCode)
+	assert.False(t, types.Refused(err), "a gateway error without errorCode does not prove a refusal")
+}
+
+func TestRuleMatching(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddRule(Throttled().Limit(1))
+	srv.AddRule(InsufficientFunds().ForMSISDN("+251 733 333 333"))
+	srv.AddRule(InsufficientFunds().ForMSISDN("0744444444"))
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	// the first request of the app also fetches a token, the rule is spent on the payment
+	_, err := app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-1"))
+	var mpesaErr *types.MpesaErrorResponse
+	require.ErrorAs(t, err, &mpesaErr)
+	assert.Equal(t, http.StatusTooManyRequests, mpesaErr.StatusCode)
+	_, err = app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-2"))
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	assert.True(t, rc.lastResult(t).Succeeded())
+
+	for _, party := range []uint{251733333333, 251744444444} {
+		_, err = app.MakeB2CPaymentRequest(payment(party, money.Birr(10), fmt.Sprint("occ-", party)))
+		require.NoError(t, err)
+		srv.WaitForCallbacks()
+		assert.Equal(t, callback.Code(ResultInsufficientFunds), rc.lastResult(t).Result.ResultCode,
+			"the MSISDN of the rule matches in any form")
+	}
+
+	srv.ClearRules()
+	srv.AddRule(BadGateway().OnEndpoint(EndpointToken).Limit(1))
+	_, err = newApp(t, srv, rc).MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-3"))
+	assert.Error(t, err, "a rule naming the token endpoint applies to it")
+}
+
+func TestPolicyLimits(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddRule(Throttled().OnEndpoint(EndpointB2C).Limit(1))
+	srv.AddRule(BadGateway().ForMSISDN("251755555555").Limit(1))
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc, mpesagosdk.WithLimits(types.Limits{
+		Commands: map[types.CommandId]types.AmountLimits{types.BusinessPaymentCommand: {Max: money.Birr(100)}},
+		DailyCap: money.Birr(15),
+	}))
+
+	_, err := app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-1"))
+	assert.Error(t, err, "throttled")
+	_, err = app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-2"))
+	assert.NoError(t, err, "the throttled payment does not count in the daily cap")
+
+	_, err = app.MakeB2CPaymentRequest(payment(251755555555, money.Birr(10), "occ-5"))
+	assert.Error(t, err, "bad gateway")
+	_, err = app.MakeB2CPaymentRequest(payment(251755555555, money.Birr(10), "occ-6"))
+	var perr *types.PolicyError
+	require.ErrorAs(t, err, &perr, "a payment that may have gone through counts in the daily cap")
+	assert.Equal(t, money.Birr(10), perr.Used)
+
+	tests := []struct {
+		name string
+		req  b2c.B2CRequest
+		rule string
+	}{
+		{"Above maximum", payment(251722222222, money.Birr(150), "occ-3"), types.PolicyMaxAmount},
+		{"Daily cap", payment(251712345678, money.Birr(10), "occ-4"), types.PolicyDailyCap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := app.MakeB2CPaymentRequest(tt.req)
+			var perr *types.PolicyError
+			require.True(t, errors.As(err, &perr), err)
+			assert.Equal(t, tt.rule, perr.Rule)
+		})
+	}
+
+	var payouts int
+	for _, r := range srv.Requests() {
+		if r.Endpoint == EndpointB2C {
+			payouts++
+		}
+	}
+	assert.Equal(t, 3, payouts, "refused payments never reach M-Pesa")
+}
+
+func TestDuplicateGuard(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddRule(Throttled().ForMSISDN("251733333333").Limit(1))
+	srv.AddRule(BadGateway().ForMSISDN("251744444444").Limit(1))
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc, mpesagosdk.WithDuplicateGuard(time.Hour, nil))
+
+	_, err := app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-1"))
+	require.NoError(t, err)
+
+	_, err = app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-2"))
+	var derr *types.DuplicateError
+	require.True(t, errors.As(err, &derr), err)
+
+	override := payment(251712345678, money.Birr(10), "occ-3")
+	override.AllowDuplicate = true
+	_, err = app.MakeB2CPaymentRequest(override)
+	assert.NoError(t, err)
+
+	_, err = app.MakeB2CPaymentRequest(payment(251733333333, money.Birr(10), "occ-4"))
+	assert.Error(t, err, "throttled")
+	_, err = app.MakeB2CPaymentRequest(payment(251733333333, money.Birr(10), "occ-5"))
+	assert.NoError(t, err, "a refused payout is not a duplicate")
+
+	_, err = app.MakeB2CPaymentRequest(payment(251744444444, money.Birr(10), "occ-6"))
+	assert.Error(t, err, "bad gateway")
+	_, err = app.MakeB2CPaymentRequest(payment(251744444444, money.Birr(10), "occ-7"))
+	assert.ErrorAs(t, err, &derr, "M-Pesa may have paid the payout behind the gateway error")
+}
+
+func TestDuplicateGuard_TimeoutThenRetry(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetBalance(money.Birr(500))
+	srv.AddRule(Slow(300 * time.Millisecond).OnEndpoint(EndpointB2C).Limit(1))
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc, mpesagosdk.WithDuplicateGuard(time.Hour, nil), mpesagosdk.WithTimeout(100*time.Millisecond))
+
+	_, err := app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-1"))
+	require.Error(t, err)
+	assert.False(t, types.Refused(err))
+
+	// the timed out payout went through, the re-run of the job must not pay it again
+	srv.WaitForCallbacks()
+	_, err = app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-2"))
+	var derr *types.DuplicateError
+	require.ErrorAs(t, err, &derr)
+	assert.Equal(t, money.Birr(490), srv.Balance(), "the payout is paid once")
+}
+
+func TestNameCheck(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddCustomer("251712345678", "Abebe Kebede Tesfaye")
+	srv.AddRule(BadGateway().OnEndpoint(EndpointNameCheck).ForMSISDN("251733333333"))
+	srv.AddRule(Rule{
+		Endpoint:   EndpointNameCheck,
+		MSISDN:     "251744444444",
+		StatusCode: http.StatusInternalServerError,
+		Body:       `{"requestId":"","errorCode":"500.003.02","errorMessage":"System is busy"}`,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+	})
+	srv.AddRule(Rule{
+		Endpoint:   EndpointNameCheck,
+		MSISDN:     "251755555555",
+		StatusCode: http.StatusOK,
+		Body:       `{"ResponseCode":"2001","ResponseDescription":"The customer is not registered"}`,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+	})
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	res, err := app.CheckCustomerName(kyc.NameCheckRequest{Msisdn: "0712345678", OriginatorConversationID: "kyc-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "251712345678", res.Msisdn)
+	assert.Equal(t, "Abebe Kebede Tesfaye", res.CustomerName)
+
+	match := payment(251712345678, money.Birr(10), "occ-1")
+	match.ExpectedName = "KEBEDE, Abebe"
+	_, err = app.MakeB2CPaymentRequest(match)
+	require.NoError(t, err)
+
+	mismatch := payment(251712345678, money.Birr(10), "occ-2")
+	mismatch.ExpectedName = "Almaz Tesfaye"
+	_, err = app.MakeB2CPaymentRequest(mismatch)
+	var nerr *types.NameCheckError
+	require.True(t, errors.As(err, &nerr), err)
+	assert.NoError(t, nerr.Err)
+	assert.Equal(t, "Abebe Kebede Tesfaye", nerr.Registered)
+	assert.Less(t, nerr.Score, kyc.DefaultThreshold)
+	assert.True(t, types.Refused(err))
+
+	// a failed lookup refuses the payout and frees its claim, the retry is not a duplicate
+	guarded := newApp(t, srv, rc, mpesagosdk.WithDuplicateGuard(time.Hour, nil))
+	for i, party := range []uint{251733333333, 251744444444, 251755555555} {
+		failed := payment(party, money.Birr(10), fmt.Sprintf("occ-failed-%d", i))
+		failed.ExpectedName = "Almaz Tesfaye"
+		for attempt := 0; attempt < 2; attempt++ {
+			_, err = guarded.MakeB2CPaymentRequest(failed)
+			require.True(t, errors.As(err, &nerr), "%v: %v", party, err)
+			assert.Error(t, nerr.Err, party)
+			assert.True(t, types.Refused(err), party)
+			var derr *types.DuplicateError
+			assert.False(t, errors.As(err, &derr), party)
+		}
+	}
+
+	lenient := newApp(t, srv, rc, mpesagosdk.WithNameMatchThreshold(0.3))
+	_, err = lenient.MakeB2CPaymentRequest(mismatch)
+	assert.NoError(t, err)
+
+	var payouts []string
+	for _, r := range srv.Requests() {
+		if r.Endpoint == EndpointB2C {
+			var req b2c.B2CRequest
+			require.NoError(t, json.Unmarshal(r.Body, &req))
+			payouts = append(payouts, req.OriginatorConversationID)
+		}
+	}
+	assert.Equal(t, []string{"occ-1", "occ-2"}, payouts, "refused payments never reach M-Pesa")
+}
+
+func TestNameCheck_AfterLocalChecks(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddCustomer("251712345678", "Abebe Kebede")
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc, mpesagosdk.WithLimits(types.Limits{Deny: []string{"251722222222"}}),
+		mpesagosdk.WithDuplicateGuard(time.Hour, nil))
+	checks := func() int {
+		var n int
+		for _, r := range srv.Requests() {
+			if r.Endpoint == EndpointNameCheck {
+				n++
+			}
+		}
+		return n
+	}
+
+	denied := payment(251722222222, money.Birr(10), "occ-1")
+	denied.ExpectedName = "Almaz Tesfaye"
+	_, err := app.MakeB2CPaymentRequest(denied)
+	var perr *types.PolicyError
+	require.ErrorAs(t, err, &perr)
+	assert.Zero(t, checks(), "a payout refused by the limits costs no name check")
+
+	paid := payment(251712345678, money.Birr(10), "occ-2")
+	paid.ExpectedName = "Abebe Kebede"
+	_, err = app.MakeB2CPaymentRequest(paid)
+	require.NoError(t, err)
+	paid.OriginatorConversationID = "occ-3"
+	_, err = app.MakeB2CPaymentRequest(paid)
+	var derr *types.DuplicateError
+	require.ErrorAs(t, err, &derr)
+	assert.Equal(t, 1, checks(), "a duplicate payout costs no name check")
+
+	mismatch := payment(251712345678, money.Birr(20), "occ-4")
+	mismatch.ExpectedName = "Almaz Tesfaye"
+	_, err = app.MakeB2CPaymentRequest(mismatch)
+	var nerr *types.NameCheckError
+	require.ErrorAs(t, err, &nerr)
+	mismatch.ExpectedName, mismatch.OriginatorConversationID = "", "occ-5"
+	_, err = app.MakeB2CPaymentRequest(mismatch)
+	assert.NoError(t, err, "the claim of a payout refused by the name check is released")
+}
+
+func TestNameCheck_NoEndpoint(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc, mpesagosdk.WithNameCheckEndpoint(""))
+
+	_, err := app.CheckCustomerName(kyc.NameCheckRequest{Msisdn: "0712345678", OriginatorConversationID: "kyc-1"})
+	assert.ErrorIs(t, err, kyc.ErrNoEndpoint)
+
+	req := payment(251712345678, money.Birr(10), "occ-1")
+	req.ExpectedName = "Abebe Kebede"
+	_, err = app.MakeB2CPaymentRequest(req)
+	var nerr *types.NameCheckError
+	require.ErrorAs(t, err, &nerr)
+	assert.ErrorIs(t, err, kyc.ErrNoEndpoint)
+	for _, r := range srv.Requests() {
+		assert.NotEqual(t, EndpointB2C, r.Endpoint, "the payout is not sent")
+	}
+}
+
+func TestSlowRule(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddRule(Slow(300 * time.Millisecond).OnEndpoint(EndpointB2C))
+	srv.AddRule(Slow(300 * time.Millisecond).OnEndpoint(EndpointBalance).Limit(1))
+
+	rc := newReceiver(t)
+	app, err := mpesagosdk.New(append(srv.Options(),
+		mpesagosdk.WithInitiator("testapi", "security-credential"),
+		mpesagosdk.WithShortCode("600000"),
+		mpesagosdk.WithResultURL(rc.URL+"/result"),
+		mpesagosdk.WithQueueTimeOutURL(rc.URL+"/timeout"),
+		mpesagosdk.WithTimeout(50*time.Millisecond),
+		mpesagosdk.WithMaxRetries(1),
+	)...)
+	require.NoError(t, err)
+
+	_, err = app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-1"))
+	assert.Error(t, err)
+
+	_, err = app.MakeAccountBalanceQuery(account.AccountBalanceRequest{
+		CommandID:                types.AccountBalanceCommand,
+		IdentifierType:           types.ShortCodeIdentifierType,
+		OriginatorConversationID: "occ-balance",
+	})
+	assert.NoError(t, err, "a timed out query is retried")
+
+	sent := map[string]int{}
+	for _, req := range srv.Requests() {
+		sent[req.Endpoint]++
+	}
+	assert.Equal(t, 1, sent[EndpointB2C], "a timed out payment is never sent again")
+	assert.Equal(t, 2, sent[EndpointBalance])
+}
+
+func TestCallbackRules(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddRule(DropCallback().ForMSISDN("251711111111"))
+	srv.AddRule(DuplicateCallback(2).ForMSISDN("251722222222"))
+	srv.AddRule(LateCallback(100 * time.Millisecond).ForMSISDN("251733333333"))
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	_, err := app.MakeB2CPaymentRequest(payment(251711111111, money.Birr(10), "occ-drop"))
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	deliveries := srv.Deliveries()
+	require.Len(t, deliveries, 1)
+	assert.True(t, deliveries[0].Dropped)
+	assert.Empty(t, rc.results)
+
+	_, err = app.MakeB2CPaymentRequest(payment(251722222222, money.Birr(10), "occ-duplicate"))
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	assert.Len(t, rc.results, 3)
+	for _, res := range rc.results {
+		assert.Equal(t, "occ-duplicate", res.Result.OriginatorConversationID)
+	}
+
+	started := time.Now()
+	_, err = app.MakeB2CPaymentRequest(payment(251733333333, money.Birr(10), "occ-late"))
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	assert.Equal(t, "occ-late", rc.lastResult(t).Result.OriginatorConversationID)
+	assert.GreaterOrEqual(t, time.Since(started), 100*time.Millisecond)
+}
+
+func TestStore(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	records := store.NewMemoryStore()
+	rc := newReceiver(t)
+	callbacks := httptest.NewServer(store.Handler(records, nil, rc.Config.Handler))
+	defer callbacks.Close()
+	app := newApp(t, srv, rc, mpesagosdk.WithStore(records),
+		mpesagosdk.WithResultURL(callbacks.URL+"/result"))
+
+	res, err := app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), "occ-1"))
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+
+	history, err := records.Find(context.Background(), store.Query{Keys: store.Keys{OriginatorConversationID: "occ-1"}})
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, []store.Kind{store.KindRequest, store.KindResponse, store.KindCallback},
+		[]store.Kind{history[0].Kind, history[1].Kind, history[2].Kind})
+	assert.Equal(t, "b2c_payment", history[0].Operation)
+	assert.Contains(t, string(history[0].Body), `"SecurityCredential":"[REDACTED]"`)
+	assert.NotContains(t, string(history[0].Body), "251712345678")
+	assert.Equal(t, res.ConversationID, history[1].Keys.ConversationID)
+	assert.Equal(t, "0", history[1].Code)
+	assert.NotEmpty(t, history[2].Keys.TransactionID)
+
+	byReceipt, err := records.Find(context.Background(), store.Query{Keys: store.Keys{TransactionID: history[2].Keys.TransactionID}})
+	require.NoError(t, err)
+	assert.Len(t, byReceipt, 1)
+
+	_, err = app.MakeB2CPaymentRequest(payment(251712345678, money.Birr(10), ""))
+	require.Error(t, err)
+	invalid, _ := records.Find(context.Background(), store.Query{Kind: store.KindRequest})
+	assert.Len(t, invalid, 1, "requests refused before they are sent are not recorded")
+
+	srv.PassKey = "test-pass-key"
+	_, err = app.USSDPaymentRequest(c2b.USSDPaymentRequest{
+		MerchantRequestID: "merchant-1",
+		TransactionType:   types.TransactionType("CustomerPayBillOnline"),
+		Amount:            money.Birr(20),
+		PartyA:            "251712345678",
+		PartyB:            "600000",
+		PhoneNumber:       "251712345678",
+		AccountReference:  "invoice-1",
+		TransactionDesc:   "payment",
+		Password:          "wrong-password",
+		Timestamp:         "20240918055823",
+	})
+	require.Error(t, err)
+	rejected, _ := records.Find(context.Background(), store.Query{Keys: store.Keys{MerchantRequestID: "merchant-1"}, Kind: store.KindResponse})
+	require.Len(t, rejected, 1)
+	assert.Equal(t, "Bad Request - Invalid Password", rejected[0].Error)
+	assert.Equal(t, "400.002.02", rejected[0].Code)
+}
@@ -0,0 +1,413 @@
+// Package mpesatest provides an in-process fake of the M-Pesa API for tests.
+//
+// The fake is an httptest.Server that implements token generation and every
+// endpoint the SDK calls: USSD push, C2B url registration, C2B simulation, B2C
+// payments, reversals, transaction status, account balance, customer name queries
+// and dynamic QR codes. Requests are decoded into the SDK request types and
+// validated the way M-Pesa does, the responses use the M-Pesa success and error formats, and the asynchronous
+// results are delivered to the `ResultURL`, `CallBackURL` or registered
+// `ConfirmationURL` of the request, so complete payment flows run offline.
+//
+// Example usage:
+//
+//	srv := mpesatest.NewServer()
+//	defer srv.Close()
+//
+//	app, err := mpesagosdk.New(srv.Options()...)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//
+//	res, err := app.MakeB2CPaymentRequest(req) // the result is POSTed to req.ResultURL
+//	srv.WaitForCallbacks()
+package mpesatest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/config"
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+const (
+	// ConsumerKey is the consumer key accepted by a new Server.
+	ConsumerKey = "mpesatest-consumer-key"
+	// ConsumerSecret is the consumer secret accepted by a new Server.
+	ConsumerSecret = "mpesatest-consumer-secret"
+	// DefaultCustomerName is the registered name of customers added without one.
+	DefaultCustomerName = "Test Customer"
+)
+
+// Request is a request received by the fake server.
+type Request struct {
+	Method   string
+	Path     string
+	Endpoint string
+	Header   http.Header
+	Body     []byte
+	Received time.Time
+}
+
+// Delivery is a callback sent (or attempted) by the fake server. Callbacks
+// dropped by a Rule are recorded with Dropped set and are never sent.
+type Delivery struct {
+	URL        string
+	Body       []byte
+	StatusCode int
+	Err        error
+	Sent       time.Time
+	Dropped    bool
+}
+
+// Transaction is a money movement recorded by the fake server, it is what the
+// transaction status and reversal endpoints look up.
+type Transaction struct {
+	TransactionID            string
+	ConversationID           string
+	OriginatorConversationID string
+	CommandID                string
+	Amount                   money.Amount
+	DebitParty               string
+	CreditParty              string
+	Completed                time.Time
+	Reversed                 bool
+}
+
+// checkout: the outcome of a USSD push, answered by the STK query endpoint.
+type checkout struct {
+	merchantRequestID string
+	code, desc        string
+}
+
+// Server is the fake M-Pesa API.
+type Server struct {
+	*httptest.Server
+
+	// ConsumerKey and ConsumerSecret are the credentials accepted by the token endpoint.
+	ConsumerKey    string
+	ConsumerSecret string
+	// PassKey, when set, is used to verify the Password of USSD push requests.
+	PassKey string
+	// CallbackDelay is waited before every callback delivery.
+	CallbackDelay time.Duration
+	// CallbackClient delivers the callbacks, http.DefaultClient when nil.
+	CallbackClient *http.Client
+
+	validator *types.Validator
+	callbacks sync.WaitGroup
+
+	mu           sync.Mutex
+	seq          int
+	tokens       map[string]time.Time
+	balance      money.Amount
+	customers    map[string]string
+	registered   map[string]c2b.RegisterC2BURLRequest
+	transactions map[string]*Transaction
+	checkouts    map[string]checkout
+	rules        []*scriptedRule
+	requests     []Request
+	deliveries   []Delivery
+}
+
+// NewServer starts a fake server with the default credentials and a working
+// account balance of 1,000,000.00 ETB. The caller must call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		ConsumerKey:    ConsumerKey,
+		ConsumerSecret: ConsumerSecret,
+		validator:      utils.NewValidator(),
+		tokens:         map[string]time.Time{},
+		balance:        money.Birr(1_000_000),
+		customers:      map[string]string{},
+		registered:     map[string]c2b.RegisterC2BURLRequest{},
+		transactions:   map[string]*Transaction{},
+		checkouts:      map[string]checkout{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Options returns the SDK options that point an App to the fake server with valid credentials.
+func (s *Server) Options() []mpesagosdk.Option {
+	return []mpesagosdk.Option{
+		mpesagosdk.WithBaseURL(s.URL),
+		mpesagosdk.WithCredentials(s.ConsumerKey, s.ConsumerSecret),
+		mpesagosdk.WithEnvironment(config.Sandbox),
+		mpesagosdk.WithMaxRetries(0),
+		mpesagosdk.WithNameCheckEndpoint(NameCheckPath),
+	}
+}
+
+// Close waits for pending callbacks and shuts the server down.
+func (s *Server) Close() {
+	s.WaitForCallbacks()
+	s.Server.Close()
+}
+
+// WaitForCallbacks blocks until every callback scheduled so far was delivered.
+func (s *Server) WaitForCallbacks() {
+	s.callbacks.Wait()
+}
+
+// AddCustomer registers the public name of an MSISDN, it is used in results
+// such as ReceiverPartyPublicName and answered by the name check endpoint.
+func (s *Server) AddCustomer(msisdn, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.customers[msisdn] = name
+}
+
+// SetBalance sets the working account balance.
+func (s *Server) SetBalance(balance money.Amount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balance = balance
+}
+
+// Balance returns the working account balance.
+func (s *Server) Balance() money.Amount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.balance
+}
+
+// AddTransaction records a transaction so that it can be queried or reversed.
+func (s *Server) AddTransaction(t Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.Completed.IsZero() {
+		t.Completed = time.Now()
+	}
+	s.transactions[t.TransactionID] = &t
+}
+
+// Transaction returns a recorded transaction.
+func (s *Server) Transaction(id string) (Transaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.transactions[id]
+	if !ok {
+		return Transaction{}, false
+	}
+	return *t, true
+}
+
+// transactionByOriginator: returns the transaction created by the request with the
+// given OriginatorConversationID.
+func (s *Server) transactionByOriginator(id string) (Transaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.transactions {
+		if t.OriginatorConversationID == id {
+			return *t, true
+		}
+	}
+	return Transaction{}, false
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Deliveries returns the callbacks sent so far.
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+// serveHTTP: records the request, applies the scripted failures, checks the
+// authorization and routes it.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+
+	ep, ok := endpoints[r.URL.Path]
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Endpoint: ep.name,
+		Header:   r.Header.Clone(),
+		Body:     body,
+		Received: time.Now(),
+	})
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "404.001.01", "Resource not found")
+		return
+	}
+	if r.Method != ep.method {
+		writeError(w, http.StatusMethodNotAllowed, "405.001.01", "Method not allowed")
+		return
+	}
+
+	r, ok = s.applyRule(w, r, ep.name, body)
+	if !ok {
+		return
+	}
+
+	switch ep.auth {
+	case authBasic:
+		key, secret, ok := r.BasicAuth()
+		if !ok || key != s.ConsumerKey || secret != s.ConsumerSecret {
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"resultCode": "999991",
+				"resultDesc": "Invalid client id passed",
+			})
+			return
+		}
+	case authBearer:
+		if !s.validToken(r.Header.Get("Authorization")) {
+			writeError(w, http.StatusUnauthorized, "404.001.03", "Invalid Access Token")
+			return
+		}
+	case authAPIKey:
+		if r.URL.Query().Get("apikey") != s.ConsumerKey {
+			writeJSON(w, http.StatusUnauthorized, registerURLResponse(401, "Invalid API key"))
+			return
+		}
+	}
+
+	ep.handle(s, w, r, body)
+}
+
+// validToken: checks a bearer authorization header against the issued tokens.
+func (s *Server) validToken(header string) bool {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.tokens[token]
+	return ok && time.Now().Before(expires)
+}
+
+// nextID: returns a unique, increasing sequence number.
+func (s *Server) nextID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return s.seq
+}
+
+// conversationID: generates an M-Pesa style conversation id.
+func (s *Server) conversationID() string {
+	return fmt.Sprintf("AG_%v_%020x", time.Now().Format("20060102"), s.nextID())
+}
+
+// transactionID: generates an M-Pesa style 10 character receipt number.
+func (s *Server) transactionID() string {
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	n := s.nextID()
+	return fmt.Sprintf("%c%c%c%07d", letters[time.Now().Year()%26], letters[int(time.Now().Month())%26], letters[n%26], n)
+}
+
+// customerName: returns the registered public name of an MSISDN.
+func (s *Server) customerName(msisdn string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name, ok := s.customers[msisdn]; ok {
+		return name
+	}
+	return DefaultCustomerName
+}
+
+// deliver: POSTs the callback of request r to url in the background after
+// CallbackDelay and records the delivery, following the rule matched by r to
+// drop, delay or duplicate it. Empty urls are ignored.
+func (s *Server) deliver(r *http.Request, url string, payload interface{}) {
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	delay, copies := s.CallbackDelay, 1
+	if rule := ruleFrom(r); rule != nil {
+		if rule.DropCallback {
+			s.mu.Lock()
+			s.deliveries = append(s.deliveries, Delivery{URL: url, Body: body, Sent: time.Now(), Dropped: true})
+			s.mu.Unlock()
+			return
+		}
+		delay += rule.CallbackDelay
+		copies += rule.Duplicates
+	}
+
+	client := s.CallbackClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for i := 0; i < copies; i++ {
+		s.send(client, url, body, delay)
+	}
+}
+
+// send: POSTs a callback body in the background after delay.
+func (s *Server) send(client *http.Client, url string, body []byte, delay time.Duration) {
+	s.callbacks.Add(1)
+	go func() {
+		defer s.callbacks.Done()
+		time.Sleep(delay)
+
+		d := Delivery{URL: url, Body: body, Sent: time.Now()}
+		res, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			d.Err = err
+		} else {
+			d.StatusCode = res.StatusCode
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		s.mu.Lock()
+		s.deliveries = append(s.deliveries, d)
+		s.mu.Unlock()
+	}()
+}
+
+// randomHex: returns n random bytes hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// writeJSON: writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError: writes an M-Pesa error response.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{
+		"requestId":    randomHex(8),
+		"errorCode":    code,
+		"errorMessage": message,
+	})
+}
@@ -0,0 +1,324 @@
+package mpesatest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/account"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/transaction"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiver collects the callbacks delivered by the fake server.
+type receiver struct {
+	*httptest.Server
+	mu            sync.Mutex
+	results       []*callback.Result
+	stk           []*callback.STKCallback
+	confirmations []*callback.C2BConfirmation
+}
+
+func newReceiver(t *testing.T) *receiver {
+	rc := &receiver{}
+	rc.Server = httptest.NewServer(callback.Handlers{
+		OnResult: func(_ context.Context, res *callback.Result) error {
+			rc.mu.Lock()
+			defer rc.mu.Unlock()
+			rc.results = append(rc.results, res)
+			return nil
+		},
+		OnSTK: func(_ context.Context, cb *callback.STKCallback) error {
+			rc.mu.Lock()
+			defer rc.mu.Unlock()
+			rc.stk = append(rc.stk, cb)
+			return nil
+		},
+		OnConfirmation: func(_ context.Context, c *callback.C2BConfirmation) error {
+			rc.mu.Lock()
+			defer rc.mu.Unlock()
+			rc.confirmations = append(rc.confirmations, c)
+			return nil
+		},
+	})
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) lastResult(t *testing.T) *callback.Result {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	require.NotEmpty(t, rc.results)
+	return rc.results[len(rc.results)-1]
+}
+
+func newApp(t *testing.T, srv *Server, rc *receiver, extra ...mpesagosdk.Option) *mpesagosdk.App {
+	opts := append(srv.Options(),
+		mpesagosdk.WithShortCode("600000"),
+		mpesagosdk.WithInitiator("testapi", "security-credential"),
+		mpesagosdk.WithPassKey(srv.PassKey),
+		mpesagosdk.WithResultURL(rc.URL+"/result"),
+		mpesagosdk.WithQueueTimeOutURL(rc.URL+"/timeout"),
+		mpesagosdk.WithCallBackURL(rc.URL+"/stk"),
+	)
+	app, err := mpesagosdk.New(append(opts, extra...)...)
+	require.NoError(t, err)
+	return app
+}
+
+func TestB2CPaymentFlow(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetBalance(money.Birr(500))
+	srv.AddCustomer("251712345678", "Abebe Kebede")
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	res, err := app.MakeB2CPaymentRequest(b2c.B2CRequest{
+		CommandID:                types.BusinessPaymentCommand,
+		Amount:                   money.Birr(120),
+		PartyB:                   251712345678,
+		Remarks:                  "salary",
+		Occasion:                 "october",
+		OriginatorConversationID: "occ-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0", res.ResponseCode)
+	assert.Equal(t, "occ-1", res.OriginatorConversatonId)
+
+	srv.WaitForCallbacks()
+	result := rc.lastResult(t)
+	assert.True(t, result.Succeeded())
+	assert.Equal(t, res.ConversationID, result.Result.ConversationID)
+	name, _ := result.Parameter("ReceiverPartyPublicName")
+	assert.Equal(t, "251712345678 - Abebe Kebede", name.String())
+	assert.Equal(t, money.Birr(380), srv.Balance())
+
+	_, err = app.MakeB2CPaymentRequest(b2c.B2CRequest{
+		CommandID:                types.BusinessPaymentCommand,
+		Amount:                   money.Birr(1000),
+		PartyB:                   251712345678,
+		Remarks:                  "salary",
+		Occasion:                 "october",
+		OriginatorConversationID: "occ-2",
+	})
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	assert.Equal(t, callback.Code(ResultInsufficientFunds), rc.lastResult(t).Result.ResultCode)
+}
+
+func TestStatusAndReversalFlow(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddTransaction(Transaction{TransactionID: "RJT0000001", OriginatorConversationID: "occ-payment",
+		Amount: money.Birr(50), DebitParty: "251712345678", CreditParty: "600000"})
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	_, err := app.MakeTransactionStatusQuery(transaction.TransactionStatusRequest{
+		CommandID:                types.TransactionStatusCommand,
+		IdentifierType:           types.ShortCodeIdentifierType,
+		Occasion:                 "check",
+		OriginatorConversationID: "occ-status",
+		TransactionID:            "RJT0000001",
+	})
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	status, _ := rc.lastResult(t).Parameter("TransactionStatus")
+	assert.Equal(t, "Completed", status.String())
+
+	_, err = app.MakeTransactionStatusQuery(transaction.TransactionStatusRequest{
+		CommandID:              types.TransactionStatusCommand,
+		IdentifierType:         types.ShortCodeIdentifierType,
+		Occasion:               "check",
+		OriginalConversationID: "occ-payment",
+	})
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	receipt, _ := rc.lastResult(t).Parameter("ReceiptNo")
+	assert.Equal(t, "RJT0000001", receipt.String())
+
+	reversal := transaction.TransactionReversalRequest{
+		CommandID:                types.TransactionReversalCommand,
+		TransactionID:            "RJT0000001",
+		Amount:                   money.Birr(50),
+		IdentifierType:           types.ShortCodeIdentifierType,
+		OriginatorConversationID: "occ-reversal",
+	}
+	_, err = app.MakeTransactionReversalRequest(reversal)
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	assert.True(t, rc.lastResult(t).Succeeded())
+
+	_, err = app.MakeTransactionReversalRequest(reversal)
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	assert.Equal(t, callback.Code(ResultAlreadyReversed), rc.lastResult(t).Result.ResultCode)
+}
+
+func TestAccountBalance(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	_, err := app.MakeAccountBalanceQuery(account.AccountBalanceRequest{
+		CommandID:                types.AccountBalanceCommand,
+		IdentifierType:           types.ShortCodeIdentifierType,
+		OriginatorConversationID: "occ-balance",
+	})
+	require.NoError(t, err)
+	srv.WaitForCallbacks()
+	balance, ok := rc.lastResult(t).Parameter("AccountBalance")
+	assert.True(t, ok)
+	assert.Contains(t, balance.String(), "Working Account|ETB|1000000.00")
+}
+
+func TestDynamicQR(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	res, err := app.GenerateDynamicQR(c2b.DynamicQRRequest{
+		MerchantName: "Abebe Coffee",
+		RefNo:        "INV-001",
+		Amount:       money.Birr(150),
+		TrxCode:      types.PayBillQRCode,
+	})
+	require.NoError(t, err)
+	img, err := res.Image()
+	require.NoError(t, err)
+	assert.InDelta(t, 300, img.Bounds().Dx(), 40)
+	assert.Equal(t, img.Bounds().Dx(), img.Bounds().Dy())
+
+	_, err = app.GenerateDynamicQR(c2b.DynamicQRRequest{
+		MerchantName: "Abebe Coffee",
+		RefNo:        "INV-002",
+		Amount:       money.Birr(150),
+		TrxCode:      types.BuyGoodsQRCode,
+		CPI:          "0712345678",
+	})
+	var verr *types.ValidationError
+	require.ErrorAs(t, err, &verr)
+	_, ok := verr.Field("CPI")
+	assert.True(t, ok, err)
+
+	_, err = app.GenerateDynamicQR(c2b.DynamicQRRequest{
+		MerchantName: "Abebe Coffee",
+		RefNo:        "INV-003",
+		Amount:       money.Birr(150),
+		TrxCode:      types.BuyGoodsQRCode,
+		CPI:          "373132",
+		Size:         "100000",
+	})
+	var mpesaErr *types.MpesaErrorResponse
+	require.ErrorAs(t, err, &mpesaErr)
+	assert.Equal(t, http.StatusBadRequest, mpesaErr.StatusCode)
+	assert.Equal(t, "Bad Request - Invalid Size", mpesaErr.ErrorMessage)
+}
+
+func TestUSSDPushFlow(t *testing.T) {
+	srv := NewServer()
+	srv.PassKey = "test-pass-key"
+	defer srv.Close()
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	res, err := app.USSDPaymentRequest(c2b.USSDPaymentRequest{
+		MerchantRequestID: "merchant-1",
+		TransactionType:   types.TransactionType("CustomerPayBillOnline"),
+		Amount:            money.Birr(20),
+		PartyA:            "251712345678",
+		PartyB:            "600000",
+		PhoneNumber:       "0712345678", // normalized by the SDK
+		AccountReference:  "invoice-1",
+		TransactionDesc:   "payment",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "merchant-1", res.MerchantRequestID)
+
+	srv.WaitForCallbacks()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	require.Len(t, rc.stk, 1)
+	assert.True(t, rc.stk[0].Succeeded())
+	assert.Equal(t, res.CheckoutRequestID, rc.stk[0].Body.StkCallback.CheckoutRequestID)
+	amount, _ := rc.stk[0].Metadata("Amount")
+	assert.Equal(t, "20", amount.String())
+	phone, _ := rc.stk[0].Metadata("PhoneNumber")
+	assert.Equal(t, "251712345678", phone.String())
+
+	query, err := app.USSDPaymentQuery(c2b.USSDQueryRequest{CheckoutRequestID: res.CheckoutRequestID})
+	require.NoError(t, err)
+	assert.Equal(t, ResultSuccess, query.ResultCode)
+	assert.Equal(t, "merchant-1", query.MerchantRequestID)
+
+	_, err = app.USSDPaymentQuery(c2b.USSDQueryRequest{CheckoutRequestID: "ws_CO_unknown"})
+	var mpesaErr *types.MpesaErrorResponse
+	require.ErrorAs(t, err, &mpesaErr)
+	assert.Equal(t, "Bad Request - Invalid CheckoutRequestID", mpesaErr.ErrorMessage)
+}
+
+func TestC2BFlow(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	_, err := app.RegisterNewURL(c2b.RegisterC2BURLRequest{
+		CommandID:       types.RegisterURLCommand,
+		ResponseType:    types.CompletedResponse,
+		ConfirmationURL: rc.URL + "/confirmation",
+		ValidationURL:   rc.URL + "/validation",
+	})
+	require.NoError(t, err)
+
+	_, err = app.SimulateCustomerInitiatedPayment(c2b.SimulateCustomerInititatedPayment{
+		CommandID:     types.CustomerPayBillOnlineCommand,
+		Amount:        money.Birr(75),
+		Msisdn:        "251712345678",
+		BillRefNumber: "invoice-2",
+		ShortCode:     "600000",
+	})
+	require.NoError(t, err)
+
+	srv.WaitForCallbacks()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	require.Len(t, rc.confirmations, 1)
+	assert.Equal(t, money.Birr(75), rc.confirmations[0].TransAmount)
+	assert.Equal(t, "invoice-2", rc.confirmations[0].BillRefNumber)
+}
+
+func TestRejectsInvalidRequests(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	rc := newReceiver(t)
+	app := newApp(t, srv, rc)
+
+	_, err := app.MakeB2CPaymentRequest(b2c.B2CRequest{CommandID: types.BusinessPaymentCommand, PartyB: 251712345678})
+	assert.Error(t, err)
+
+	res, err := http.Post(srv.URL+"/mpesa/b2c/v2/paymentrequest", "application/json", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Empty(t, srv.Deliveries())
+}
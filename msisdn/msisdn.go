@@ -0,0 +1,119 @@
+// Package msisdn parses and normalizes Safaricom Ethiopia phone numbers.
+//
+// M-Pesa Ethiopia expects subscriber numbers in the international `2517XXXXXXXX`
+// form. Customers and upstream systems write the same number in many ways
+// (`0712345678`, `+251 712 345 678`, `712345678`...), Parse accepts all of them
+// and returns the normalized form. Numbers of other operators (`09...`, Ethio
+// telecom) are rejected with ErrOperator because M-Pesa cannot pay them.
+//
+// Example usage:
+//
+//	m, err := msisdn.Parse("+251 712-345-678")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	fmt.Println(m)         // 251712345678
+//	fmt.Println(m.Local()) // 0712345678
+package msisdn
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CountryCode is the Ethiopian country calling code.
+	CountryCode = "251"
+	// Prefix is the national prefix of Safaricom Ethiopia subscriber numbers.
+	Prefix = "7"
+	// Length is the number of digits of a normalized MSISDN.
+	Length = len(CountryCode) + 9
+)
+
+var (
+	// ErrInvalid is returned for values that are not Ethiopian mobile numbers.
+	ErrInvalid = errors.New("invalid Ethiopian MSISDN")
+	// ErrOperator is returned for Ethiopian mobile numbers of another operator.
+	ErrOperator = errors.New("MSISDN does not belong to Safaricom Ethiopia")
+)
+
+// MSISDN is a normalized Safaricom Ethiopia phone number, `2517XXXXXXXX`.
+type MSISDN string
+
+// Parse normalizes a phone number. Spaces, dashes, dots and parentheses are ignored
+// and the accepted forms are `2517XXXXXXXX`, `+2517XXXXXXXX`, `002517XXXXXXXX`,
+// `07XXXXXXXX` and `7XXXXXXXX`.
+func Parse(s string) (MSISDN, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits = digits[1:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	}
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	var national string
+	switch {
+	case len(digits) == Length && strings.HasPrefix(digits, CountryCode):
+		national = digits[len(CountryCode):]
+	case len(digits) == 10 && digits[0] == '0':
+		national = digits[1:]
+	case len(digits) == 9:
+		national = digits
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	switch national[:1] {
+	case Prefix:
+		return MSISDN(CountryCode + national), nil
+	case "9":
+		return "", fmt.Errorf("%w: %q", ErrOperator, s)
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalid, s)
+}
+
+// ParseUint normalizes a phone number held in an integer, such as B2CRequest.PartyB.
+func ParseUint(n uint64) (MSISDN, error) {
+	return Parse(strconv.FormatUint(n, 10))
+}
+
+// Normalize returns the normalized form of a phone number, see Parse.
+func Normalize(s string) (string, error) {
+	m, err := Parse(s)
+	return string(m), err
+}
+
+// Valid reports whether s is already a normalized Safaricom Ethiopia MSISDN.
+func Valid(s string) bool {
+	m, err := Parse(s)
+	return err == nil && string(m) == s
+}
+
+// String returns the normalized form, `2517XXXXXXXX`.
+func (m MSISDN) String() string {
+	return string(m)
+}
+
+// Local returns the national form, `07XXXXXXXX`.
+func (m MSISDN) Local() string {
+	return "0" + strings.TrimPrefix(string(m), CountryCode)
+}
+
+// Uint64 returns the number as an integer, for the request fields typed as numbers.
+func (m MSISDN) Uint64() uint64 {
+	n, _ := strconv.ParseUint(string(m), 10, 64)
+	return n
+}
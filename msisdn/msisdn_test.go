@@ -0,0 +1,55 @@
+package msisdn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected MSISDN
+		err      error
+	}{
+		{"Normalized", "251712345678", "251712345678", nil},
+		{"Plus prefixed", "+251712345678", "251712345678", nil},
+		{"International prefix", "00251712345678", "251712345678", nil},
+		{"Local", "0712345678", "251712345678", nil},
+		{"Without leading zero", "712345678", "251712345678", nil},
+		{"Formatted", "+251 (71) 234-56.78", "251712345678", nil},
+		{"Ethio telecom international", "251912345678", "", ErrOperator},
+		{"Ethio telecom local", "0912345678", "", ErrOperator},
+		{"Kenyan number", "254712345678", "", ErrInvalid},
+		{"Too short", "07123456", "", ErrInvalid},
+		{"Letters", "07123A5678", "", ErrInvalid},
+		{"Landline", "0111234567", "", ErrInvalid},
+		{"Empty", "", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.input)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "expected %v, got %v", tt.err, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, m)
+		})
+	}
+}
+
+func TestMSISDN(t *testing.T) {
+	m, err := ParseUint(712345678)
+	assert.NoError(t, err)
+	assert.Equal(t, "251712345678", m.String())
+	assert.Equal(t, "0712345678", m.Local())
+	assert.Equal(t, uint64(251712345678), m.Uint64())
+
+	assert.True(t, Valid("251712345678"))
+	assert.False(t, Valid("0712345678"))
+	assert.False(t, Valid("251912345678"))
+}
@@ -0,0 +1,219 @@
+package mpesagosdk
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/config"
+	"github.com/coleYab/mpesagosdk/dedupe"
+	"github.com/coleYab/mpesagosdk/redact"
+	"github.com/coleYab/mpesagosdk/store"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+// Option configures an App created with New. Options are applied in order on top
+// of config.Default(), so a later option overrides an earlier one.
+//
+// Example Usage:
+//
+//	app, err := mpesagosdk.New(
+//		mpesagosdk.WithCredentials("consumer-key", "consumer-secret"),
+//		mpesagosdk.WithEnvironment(config.Production),
+//		mpesagosdk.WithTimeout(10*time.Second),
+//		mpesagosdk.WithShortCode("600000"),
+//		mpesagosdk.WithResultURL("https://example.com/mpesa/result"),
+//	)
+type Option func(cfg *config.Config)
+
+// WithConfig: replaces the whole configuration with a copy of cfg. It is useful
+// together with config.NewFromEnv, options given after it still apply.
+func WithConfig(cfg *config.Config) Option {
+	return func(c *config.Config) {
+		*c = *cfg
+	}
+}
+
+// WithCredentials: sets the consumer key and secret used to generate access tokens.
+func WithCredentials(consumerKey, consumerSecret string) Option {
+	return func(c *config.Config) {
+		c.ConsumerKey = consumerKey
+		c.ConsumerSecret = consumerSecret
+	}
+}
+
+// WithEnvironment: selects the environment, either config.Sandbox or config.Production.
+func WithEnvironment(env string) Option {
+	return func(c *config.Config) {
+		c.Enviroment = env
+	}
+}
+
+// WithBaseURL: sends every request to the given base URL instead of the one of the
+// environment, e.g. a proxy or the mpesatest fake server.
+func WithBaseURL(url string) Option {
+	return func(c *config.Config) {
+		c.BaseURL = url
+	}
+}
+
+// WithTimeout: sets the timeout of a single request attempt.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config.Config) {
+		c.Timeout = timeout
+	}
+}
+
+// WithMaxRetries: sets how many times a timed out request is retried. Only the requests
+// that are safe to repeat, such as queries, are retried, the transfers (see types.Transferer)
+// are sent once because a timeout does not prove that M-Pesa did not process them.
+func WithMaxRetries(retries int) Option {
+	return func(c *config.Config) {
+		c.MaxRetries = retries
+	}
+}
+
+// WithMaxConcurrentConn: sets the maximum number of idle connections kept per host.
+// It has no effect when WithHTTPClient is used.
+func WithMaxConcurrentConn(conn int) Option {
+	return func(c *config.Config) {
+		c.MaxConcurrentConn = conn
+	}
+}
+
+// WithHTTPClient: makes the SDK send every request, including token generation,
+// through the given client instead of building its own.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config.Config) {
+		c.HTTPClient = client
+	}
+}
+
+// WithLogLevel: sets the log level ("DEBUG", "INFO", "WARN" or "ERROR") of the
+// default text logger.
+func WithLogLevel(level string) Option {
+	return func(c *config.Config) {
+		c.LogLevel = level
+	}
+}
+
+// WithLogger: sends every SDK log line to the given logger. The level, format and
+// destination are decided by its handler, WithLogLevel has no effect.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *config.Config) {
+		c.Logger = l
+	}
+}
+
+// WithLogHandler: sends every SDK log line to the given handler, it is a shortcut
+// for WithLogger(slog.New(h)).
+func WithLogHandler(h slog.Handler) Option {
+	return func(c *config.Config) {
+		c.Logger = slog.New(h)
+	}
+}
+
+// WithRedaction: configures how phone numbers and secrets are masked in logs and
+// wire dumps, for example redact.Rules{KeepPhoneDigits: 3}.
+func WithRedaction(rules redact.Rules) Option {
+	return func(c *config.Config) {
+		c.Redactor = redact.New(rules)
+	}
+}
+
+// WithWireDump: logs every HTTP request and response at DEBUG level. The dumps go
+// through the redaction rules so they are safe to keep enabled in staging.
+func WithWireDump(enabled bool) Option {
+	return func(c *config.Config) {
+		c.DumpWire = enabled
+	}
+}
+
+// WithShortCode: sets the default organization short code used as PartyA or
+// BusinessShortCode when a request does not set one.
+func WithShortCode(shortCode string) Option {
+	return func(c *config.Config) {
+		c.Defaults.ShortCode = shortCode
+	}
+}
+
+// WithInitiator: sets the default initiator name and its encrypted security credential.
+func WithInitiator(name, securityCredential string) Option {
+	return func(c *config.Config) {
+		c.Defaults.InitiatorName = name
+		c.Defaults.SecurityCredential = securityCredential
+	}
+}
+
+// WithPassKey: sets the USSD push pass key, USSD push requests without a Password
+// get their Timestamp and Password generated from it.
+func WithPassKey(passKey string) Option {
+	return func(c *config.Config) {
+		c.Defaults.PassKey = passKey
+	}
+}
+
+// WithResultURL: sets the default url that receives asynchronous results.
+func WithResultURL(url string) Option {
+	return func(c *config.Config) {
+		c.Defaults.ResultURL = url
+	}
+}
+
+// WithQueueTimeOutURL: sets the default url that receives queue timeout notifications.
+func WithQueueTimeOutURL(url string) Option {
+	return func(c *config.Config) {
+		c.Defaults.QueueTimeOutURL = url
+	}
+}
+
+// WithCallBackURL: sets the default url that receives USSD push callbacks.
+func WithCallBackURL(url string) Option {
+	return func(c *config.Config) {
+		c.Defaults.CallBackURL = url
+	}
+}
+
+// WithLimits: sets the transaction limits checked before a transfer is sent to M-Pesa,
+// a transfer breaking them fails with a *types.PolicyError. The daily totals are kept in
+// memory per App, they reset when the process restarts and are not shared between
+// replicas (see types.Limits).
+func WithLimits(limits types.Limits) Option {
+	return func(c *config.Config) {
+		c.Limits = limits
+	}
+}
+
+// WithDuplicateGuard: refuses B2C payouts repeating one sent within window with a
+// *types.DuplicateError, the fingerprints are kept in store or in memory when store is nil.
+func WithDuplicateGuard(window time.Duration, store dedupe.Store) Option {
+	return func(c *config.Config) {
+		c.DuplicateWindow = window
+		c.DuplicateStore = store
+	}
+}
+
+// WithStore: records every request sent to M-Pesa and its synchronous response or error in
+// s, redacted with the configured redaction rules. Use store.Handler to record the callbacks.
+func WithStore(s store.Store) Option {
+	return func(c *config.Config) {
+		c.Store = s
+	}
+}
+
+// WithNameCheckEndpoint: sets the path of the customer name check API used by
+// CheckCustomerName and by the B2C payments with an ExpectedName. The API is not public and
+// has no default path, the name checks fail with kyc.ErrNoEndpoint until it is set.
+func WithNameCheckEndpoint(path string) Option {
+	return func(c *config.Config) {
+		c.NameCheckEndpoint = path
+	}
+}
+
+// WithNameMatchThreshold: sets the minimum similarity, between 0 and 1, of the expected and
+// registered names of a B2C recipient, kyc.DefaultThreshold by default (see kyc.Similarity).
+func WithNameMatchThreshold(threshold float64) Option {
+	return func(c *config.Config) {
+		c.NameMatchThreshold = threshold
+	}
+}
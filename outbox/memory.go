@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store keeping the jobs in memory. It is not durable and is meant for
+// tests, use SQLStore to survive restarts.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryStore creates an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string]Job{}}
+}
+
+// Insert writes a new job.
+func (m *MemoryStore) Insert(_ context.Context, job *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[job.Key]; ok {
+		return ErrExists
+	}
+	m.jobs[job.Key] = copyJob(*job)
+	return nil
+}
+
+// Get returns the job of a key.
+func (m *MemoryStore) Get(_ context.Context, key string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	job = copyJob(job)
+	return &job, nil
+}
+
+// Claim moves the oldest pending job to StateDispatching.
+func (m *MemoryStore) Claim(_ context.Context, owner string, now time.Time, lease time.Duration) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := m.list(StatePending)
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	job := pending[0]
+	job.State, job.Owner, job.LeaseUntil, job.UpdatedAt = StateDispatching, owner, now.Add(lease), now
+	m.jobs[job.Key] = job
+	job = copyJob(job)
+	return &job, nil
+}
+
+// Update writes the job if it is still in the state from.
+func (m *MemoryStore) Update(_ context.Context, job *Job, from State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.jobs[job.Key]
+	if !ok {
+		return ErrNotFound
+	}
+	if current.State != from {
+		return ErrConflict
+	}
+	m.jobs[job.Key] = copyJob(*job)
+	return nil
+}
+
+// List returns the jobs in a state, oldest first.
+func (m *MemoryStore) List(_ context.Context, state State, limit int) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := m.list(state)
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	for i := range jobs {
+		jobs[i] = copyJob(jobs[i])
+	}
+	return jobs, nil
+}
+
+// list: returns the jobs in a state, oldest first, the caller must hold the lock.
+func (m *MemoryStore) list(state State) []Job {
+	var jobs []Job
+	for _, job := range m.jobs {
+		if job.State == state {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].Key < jobs[j].Key
+	})
+	return jobs
+}
+
+// copyJob: returns a job that does not share its payload.
+func copyJob(job Job) Job {
+	job.Payload = append([]byte(nil), job.Payload...)
+	return job
+}
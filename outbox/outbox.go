@@ -0,0 +1,467 @@
+// Package outbox makes money moving requests durable. A payout is first written to a
+// Store with its idempotency key, then a Dispatcher submits it to M-Pesa and updates
+// its state from the acknowledgement and from the result callback.
+//
+// A job is submitted at most once per idempotency key, even across restarts: a worker
+// claims a pending job with a lease before it calls M-Pesa, and a job whose lease expired
+// while it was being submitted (the process crashed or hung) is never sent again, it is
+// moved to StateUnknown instead. The App sends the payouts and reversals once whatever
+// its MaxRetries (see mpesagosdk.WithMaxRetries), so a timed out submission is not
+// repeated either, a Client used with the Dispatcher must do the same. Such jobs must be
+// checked, for example with a transaction status query for their
+// OriginatorConversationID (see the reconcile package), then settled with Resolve.
+//
+// Example usage:
+//
+//	jobs := outbox.NewSQLStore(db, store.Postgres)
+//	if err := jobs.Migrate(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	d := outbox.New(app, jobs)
+//	http.Handle("/mpesa/result", callback.ResultHandler(d.HandleResult))
+//	go d.Run(ctx)
+//
+//	// the idempotency key is used as OriginatorConversationID
+//	job, err := d.EnqueueB2C(ctx, "payroll-2024-10-emp-42", req)
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/transaction"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+const (
+	// DefaultLease is how long a worker may take to submit a job when Dispatcher.Lease is not set.
+	DefaultLease = 2 * time.Minute
+	// DefaultPollInterval is the time between two checks for pending jobs when
+	// Dispatcher.PollInterval is not set.
+	DefaultPollInterval = time.Second
+)
+
+var (
+	// ErrExists is returned by Store.Insert for a key already used.
+	ErrExists = errors.New("outbox: a job with this key exists")
+	// ErrNotFound is returned for a key without job.
+	ErrNotFound = errors.New("outbox: job not found")
+	// ErrConflict is returned by Store.Update when the job is no longer in the expected state.
+	ErrConflict = errors.New("outbox: the job changed state")
+	// ErrKeyReused is returned when a key is enqueued again with another request.
+	ErrKeyReused = errors.New("outbox: the key was used for another request")
+
+	// errInvalidPayload: a job that cannot be decoded, it is failed without being sent.
+	errInvalidPayload = errors.New("outbox: invalid payload")
+)
+
+// State is the progress of a job.
+type State string
+
+const (
+	// StatePending is a job written and not submitted yet.
+	StatePending State = "pending"
+	// StateDispatching is a job claimed by a worker, which is submitting it.
+	StateDispatching State = "dispatching"
+	// StateAcknowledged is a job accepted by M-Pesa, waiting for its result callback.
+	StateAcknowledged State = "acknowledged"
+	// StateSucceeded is a job M-Pesa completed.
+	StateSucceeded State = "succeeded"
+	// StateFailed is a job refused or failed, nothing was paid.
+	StateFailed State = "failed"
+	// StateUnknown is a job that may have been submitted: its lease expired while it was
+	// being submitted or the request failed without proof that M-Pesa refused it.
+	StateUnknown State = "unknown"
+)
+
+// Final reports whether the job is settled.
+func (s State) Final() bool {
+	return s == StateSucceeded || s == StateFailed
+}
+
+// Kind is the request of a job.
+type Kind string
+
+const (
+	// KindB2C is a B2C payment (MakeB2CPaymentRequest).
+	KindB2C Kind = "b2c_payment"
+	// KindReversal is a reversal (MakeTransactionReversalRequest).
+	KindReversal Kind = "transaction_reversal"
+)
+
+// Job is a request of the outbox.
+//
+// Fields:
+//   - Key: The idempotency key, also the OriginatorConversationID of the request.
+//   - Kind: The request.
+//   - Payload: The JSON of the request, as given to the Enqueue method. Credentials left
+//     empty are filled by the App when the job is submitted, credentials set on the request
+//     are stored as is.
+//   - State: The progress of the job.
+//   - Owner, LeaseUntil: The worker submitting the job and until when.
+//   - ConversationID: The ConversationID of the acknowledgement.
+//   - TransactionID, ResultCode, ResultDesc: The result of the callback.
+//   - Error: The error of the submission.
+//   - CreatedAt, UpdatedAt: When the job was written and last changed.
+type Job struct {
+	Key            string          `json:"key"`
+	Kind           Kind            `json:"kind"`
+	Payload        json.RawMessage `json:"payload"`
+	State          State           `json:"state"`
+	Owner          string          `json:"owner,omitempty"`
+	LeaseUntil     time.Time       `json:"lease_until,omitempty"`
+	ConversationID string          `json:"conversation_id,omitempty"`
+	TransactionID  string          `json:"transaction_id,omitempty"`
+	ResultCode     string          `json:"result_code,omitempty"`
+	ResultDesc     string          `json:"result_desc,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// Store keeps the jobs durably. Implementations must be safe for concurrent use, even
+// from several processes for a shared store, and Claim and Update must be atomic.
+type Store interface {
+	// Insert writes a new job, it returns ErrExists when its key is used.
+	Insert(ctx context.Context, job *Job) error
+	// Get returns the job of a key or ErrNotFound.
+	Get(ctx context.Context, key string) (*Job, error)
+	// Claim moves the oldest pending job to StateDispatching, owned by owner until
+	// now+lease, and returns it. It returns nil when there is no pending job.
+	Claim(ctx context.Context, owner string, now time.Time, lease time.Duration) (*Job, error)
+	// Update writes the job if it is still in the state from, ErrConflict otherwise.
+	Update(ctx context.Context, job *Job, from State) error
+	// List returns up to limit jobs in a state, oldest first, every one when limit is not positive.
+	List(ctx context.Context, state State, limit int) ([]Job, error)
+}
+
+// envelope: the payload of a job, with the request fields not encoded in JSON.
+type envelope struct {
+	Request        json.RawMessage `json:"request"`
+	AllowDuplicate bool            `json:"allow_duplicate,omitempty"`
+	ExpectedName   string          `json:"expected_name,omitempty"`
+}
+
+// Dispatcher submits the jobs of a store.
+type Dispatcher struct {
+	// Client submits the jobs, usually an *mpesagosdk.App.
+	Client mpesagosdk.Client
+	// Store keeps the jobs.
+	Store Store
+	// Owner identifies the dispatcher in the leases, the host name and process ID when empty.
+	Owner string
+	// Lease is how long a worker may take to submit a job before it is moved to
+	// StateUnknown, DefaultLease when not positive. It must exceed the longest submission:
+	// Timeout × (MaxRetries+1) of the App plus its retry backoff, for the name check of a
+	// payout with an ExpectedName, and one more Timeout for the payout, which is sent once.
+	Lease time.Duration
+	// Workers is the number of jobs submitted concurrently by Run, 1 when not positive.
+	Workers int
+	// PollInterval is the time between two checks for pending jobs, DefaultPollInterval when not positive.
+	PollInterval time.Duration
+	// OnChange is called with every job whose state changed, from the workers and from
+	// HandleResult, it must be safe for concurrent use.
+	OnChange func(Job)
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+// New creates a dispatcher submitting the jobs of s with client.
+func New(client mpesagosdk.Client, s Store) *Dispatcher {
+	return &Dispatcher{Client: client, Store: s}
+}
+
+// EnqueueB2C writes a B2C payment, its OriginatorConversationID is set to key. Enqueuing
+// the same request again with the same key returns the existing job.
+//
+// Returns:
+//   - *Job: The job, pending or further when the key was already enqueued.
+//   - error: ErrKeyReused when the key was used for another request, or the error of the store.
+func (d *Dispatcher) EnqueueB2C(ctx context.Context, key string, req b2c.B2CRequest) (*Job, error) {
+	req.OriginatorConversationID = key
+	return d.enqueue(ctx, key, KindB2C, req, envelope{AllowDuplicate: req.AllowDuplicate, ExpectedName: req.ExpectedName})
+}
+
+// EnqueueReversal writes a reversal, see EnqueueB2C.
+func (d *Dispatcher) EnqueueReversal(ctx context.Context, key string, req transaction.TransactionReversalRequest) (*Job, error) {
+	req.OriginatorConversationID = key
+	return d.enqueue(ctx, key, KindReversal, req, envelope{})
+}
+
+// enqueue: writes a job unless its key is used, env holds the request fields not encoded in JSON.
+func (d *Dispatcher) enqueue(ctx context.Context, key string, kind Kind, req interface{}, env envelope) (*Job, error) {
+	if key == "" {
+		return nil, errors.New("outbox: the idempotency key is empty")
+	}
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	env.Request = request
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+
+	now := d.now()
+	job := &Job{Key: key, Kind: kind, Payload: payload, State: StatePending, CreatedAt: now, UpdatedAt: now}
+	err = d.Store.Insert(ctx, job)
+	if errors.Is(err, ErrExists) {
+		existing, err := d.Store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if existing.Kind != kind || !bytes.Equal(existing.Payload, payload) {
+			return existing, fmt.Errorf("%w: %v", ErrKeyReused, key)
+		}
+		return existing, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.changed(*job)
+	return job, nil
+}
+
+// DispatchOne claims the oldest pending job and submits it.
+//
+// Returns:
+//   - bool: Whether a job was claimed.
+//   - error: The error of the store, the errors of the submission are recorded on the job.
+func (d *Dispatcher) DispatchOne(ctx context.Context) (bool, error) {
+	job, err := d.Store.Claim(ctx, d.owner(), d.now(), d.lease())
+	if err != nil || job == nil {
+		return false, err
+	}
+	d.changed(*job)
+
+	conversationID, err := d.submit(*job)
+	next := *job
+	next.UpdatedAt = d.now()
+	switch {
+	case err == nil:
+		next.State, next.ConversationID = StateAcknowledged, conversationID
+	case types.Refused(err), errors.Is(err, errInvalidPayload):
+		next.State, next.Error = StateFailed, err.Error()
+	default:
+		next.State, next.Error = StateUnknown, err.Error()
+	}
+	return true, d.update(ctx, &next, StateDispatching, StateUnknown)
+}
+
+// submit: sends the request of a job.
+func (d *Dispatcher) submit(job Job) (string, error) {
+	var env envelope
+	if err := json.Unmarshal(job.Payload, &env); err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidPayload, err)
+	}
+	switch job.Kind {
+	case KindB2C:
+		var req b2c.B2CRequest
+		if err := json.Unmarshal(env.Request, &req); err != nil {
+			return "", fmt.Errorf("%w: %v", errInvalidPayload, err)
+		}
+		req.AllowDuplicate, req.ExpectedName = env.AllowDuplicate, env.ExpectedName
+		res, err := d.Client.MakeB2CPaymentRequest(req)
+		if err != nil {
+			return "", err
+		}
+		return res.ConversationID, nil
+	case KindReversal:
+		var req transaction.TransactionReversalRequest
+		if err := json.Unmarshal(env.Request, &req); err != nil {
+			return "", fmt.Errorf("%w: %v", errInvalidPayload, err)
+		}
+		res, err := d.Client.MakeTransactionReversalRequest(req)
+		if err != nil {
+			return "", err
+		}
+		return res.ConversationID, nil
+	}
+	return "", fmt.Errorf("%w: unknown kind %q", errInvalidPayload, job.Kind)
+}
+
+// update: writes a job expected in one of the states from. A job already settled, for
+// example by an early callback, is left untouched.
+func (d *Dispatcher) update(ctx context.Context, job *Job, from ...State) error {
+	for _, state := range from {
+		err := d.Store.Update(ctx, job, state)
+		if err == nil {
+			d.changed(*job)
+			return nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expire moves the jobs whose lease expired while they were being submitted to StateUnknown.
+func (d *Dispatcher) Expire(ctx context.Context) error {
+	jobs, err := d.Store.List(ctx, StateDispatching, 0)
+	if err != nil {
+		return err
+	}
+	now := d.now()
+	for _, job := range jobs {
+		if now.Before(job.LeaseUntil) {
+			continue
+		}
+		job.State, job.Error, job.UpdatedAt = StateUnknown, "the lease of "+job.Owner+" expired during the submission", now
+		if err := d.update(ctx, &job, StateDispatching); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleResult settles a job from its result callback, its signature matches
+// callback.ResultHandler. Results of other requests are ignored.
+func (d *Dispatcher) HandleResult(ctx context.Context, res *callback.Result) error {
+	// the acknowledgement may be recorded concurrently, the job is read again on conflict
+	for attempt := 0; attempt < 3; attempt++ {
+		job, err := d.Store.Get(ctx, res.Result.OriginatorConversationID)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if job.State.Final() || job.State == StatePending {
+			return nil
+		}
+
+		next := *job
+		next.State = StateFailed
+		if res.Succeeded() {
+			next.State = StateSucceeded
+		}
+		next.ConversationID = types.OrDefault(next.ConversationID, res.Result.ConversationID)
+		next.TransactionID = res.Result.TransactionID
+		next.ResultCode, next.ResultDesc = string(res.Result.ResultCode), res.Result.ResultDesc
+		next.UpdatedAt = d.now()
+		err = d.Store.Update(ctx, &next, job.State)
+		if err == nil {
+			d.changed(next)
+			return nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrConflict, res.Result.OriginatorConversationID)
+}
+
+// Resolve settles a job in StateUnknown once its outcome is known, for example from a
+// transaction status query.
+func (d *Dispatcher) Resolve(ctx context.Context, key string, state State, transactionID, desc string) error {
+	if !state.Final() {
+		return fmt.Errorf("outbox: %v is not a final state", state)
+	}
+	job, err := d.Store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if job.State != StateUnknown {
+		return fmt.Errorf("%w: %v is %v", ErrConflict, key, job.State)
+	}
+	job.State, job.TransactionID, job.ResultDesc, job.UpdatedAt = state, transactionID, desc, d.now()
+	if err := d.Store.Update(ctx, job, StateUnknown); err != nil {
+		return err
+	}
+	d.changed(*job)
+	return nil
+}
+
+// Run submits the pending jobs and expires the leases until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	workers := d.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	interval := d.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, workers+1)
+	loop := func(step func() (bool, error)) {
+		defer wg.Done()
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			busy, err := step()
+			if err != nil && ctx.Err() == nil {
+				errs <- err
+				return
+			}
+			if busy {
+				timer.Reset(0)
+			} else {
+				timer.Reset(interval)
+			}
+		}
+	}
+
+	wg.Add(workers + 1)
+	go loop(func() (bool, error) { return false, d.Expire(ctx) })
+	for i := 0; i < workers; i++ {
+		go loop(func() (bool, error) { return d.DispatchOne(ctx) })
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-errs:
+		cancel()
+	}
+	wg.Wait()
+	return err
+}
+
+func (d *Dispatcher) changed(job Job) {
+	if d.OnChange != nil {
+		d.OnChange(job)
+	}
+}
+
+func (d *Dispatcher) owner() string {
+	if d.Owner != "" {
+		return d.Owner
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%v-%d", host, os.Getpid())
+}
+
+func (d *Dispatcher) lease() time.Duration {
+	if d.Lease <= 0 {
+		return DefaultLease
+	}
+	return d.Lease
+}
+
+func (d *Dispatcher) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+	return time.Now()
+}
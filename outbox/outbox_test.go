@@ -0,0 +1,353 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/mpesatest"
+	"github.com/coleYab/mpesagosdk/store"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "outbox.db")+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func openSQLite(t *testing.T, db *sql.DB) *SQLStore {
+	s := NewSQLStore(db, store.SQLite)
+	require.NoError(t, s.Migrate(context.Background()))
+	return s
+}
+
+func payout(amount int64) b2c.B2CRequest {
+	return b2c.B2CRequest{
+		CommandID: types.BusinessPaymentCommand,
+		Amount:    money.Birr(amount),
+		PartyB:    251712345678,
+		Remarks:   "salary",
+		Occasion:  "october",
+	}
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(*testing.T) Store { return NewMemoryStore() },
+		"sqlite": func(t *testing.T) Store { return openSQLite(t, openDB(t)) },
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open(t)
+			at := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+
+			for i := 1; i <= 10; i++ {
+				job := &Job{Key: fmt.Sprintf("job-%02d", i), Kind: KindB2C, Payload: []byte(`{"request":{}}`),
+					State: StatePending, CreatedAt: at.Add(time.Duration(i) * time.Second), UpdatedAt: at}
+				require.NoError(t, s.Insert(ctx, job))
+			}
+			assert.ErrorIs(t, s.Insert(ctx, &Job{Key: "job-01", State: StatePending}), ErrExists)
+			_, err := s.Get(ctx, "missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			claimed, err := s.Claim(ctx, "worker-1", at, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, "job-01", claimed.Key, "the oldest job is claimed first")
+			assert.Equal(t, StateDispatching, claimed.State)
+			assert.Equal(t, "worker-1", claimed.Owner)
+			assert.True(t, claimed.LeaseUntil.Equal(at.Add(time.Minute)))
+			assert.Equal(t, `{"request":{}}`, string(claimed.Payload))
+
+			// concurrent workers claim every job exactly once
+			var mu sync.Mutex
+			seen := map[string]int{}
+			var wg sync.WaitGroup
+			for w := 0; w < 5; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for {
+						job, err := s.Claim(ctx, fmt.Sprintf("worker-%d", w), at, time.Minute)
+						if !assert.NoError(t, err) || job == nil {
+							return
+						}
+						mu.Lock()
+						seen[job.Key]++
+						mu.Unlock()
+					}
+				}(w)
+			}
+			wg.Wait()
+			assert.Len(t, seen, 9)
+			for key, n := range seen {
+				assert.Equal(t, 1, n, key)
+			}
+			none, err := s.Claim(ctx, "worker-1", at, time.Minute)
+			require.NoError(t, err)
+			assert.Nil(t, none)
+
+			claimed.State, claimed.ConversationID = StateAcknowledged, "AG_1"
+			require.NoError(t, s.Update(ctx, claimed, StateDispatching))
+			assert.ErrorIs(t, s.Update(ctx, claimed, StateDispatching), ErrConflict)
+			assert.ErrorIs(t, s.Update(ctx, &Job{Key: "missing"}, StatePending), ErrNotFound)
+			got, err := s.Get(ctx, "job-01")
+			require.NoError(t, err)
+			assert.Equal(t, "AG_1", got.ConversationID)
+
+			dispatching, err := s.List(ctx, StateDispatching, 3)
+			require.NoError(t, err)
+			require.Len(t, dispatching, 3)
+			assert.Equal(t, "job-02", dispatching[0].Key)
+			acknowledged, err := s.List(ctx, StateAcknowledged, 0)
+			require.NoError(t, err)
+			assert.Len(t, acknowledged, 1)
+		})
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.SetBalance(money.Birr(500))
+
+	d := New(nil, NewMemoryStore())
+	var mu sync.Mutex
+	var changes []string
+	d.OnChange = func(j Job) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, j.Key+":"+string(j.State))
+	}
+	results := httptest.NewServer(callback.ResultHandler(d.HandleResult))
+	defer results.Close()
+	app, err := mpesagosdk.New(append(srv.Options(),
+		mpesagosdk.WithShortCode("600000"),
+		mpesagosdk.WithInitiator("testapi", "security-credential"),
+		mpesagosdk.WithResultURL(results.URL+"/result"),
+		mpesagosdk.WithQueueTimeOutURL(results.URL+"/timeout"),
+	)...)
+	require.NoError(t, err)
+	d.Client = app
+	ctx := context.Background()
+
+	job, err := d.EnqueueB2C(ctx, "payroll-1", payout(100))
+	require.NoError(t, err)
+	assert.Equal(t, StatePending, job.State)
+	_, err = d.EnqueueB2C(ctx, "payroll-2", payout(1000))
+	require.NoError(t, err)
+
+	again, err := d.EnqueueB2C(ctx, "payroll-1", payout(100))
+	require.NoError(t, err, "enqueuing the same request is idempotent")
+	assert.Equal(t, job.CreatedAt, again.CreatedAt)
+	_, err = d.EnqueueB2C(ctx, "payroll-1", payout(200))
+	assert.ErrorIs(t, err, ErrKeyReused)
+	_, err = d.EnqueueB2C(ctx, "", payout(200))
+	assert.Error(t, err)
+
+	for {
+		ok, err := d.DispatchOne(ctx)
+		require.NoError(t, err)
+		if !ok {
+			break
+		}
+	}
+	srv.WaitForCallbacks()
+
+	paid, err := d.Store.Get(ctx, "payroll-1")
+	require.NoError(t, err)
+	assert.Equal(t, StateSucceeded, paid.State)
+	assert.NotEmpty(t, paid.ConversationID)
+	assert.NotEmpty(t, paid.TransactionID)
+	unpaid, err := d.Store.Get(ctx, "payroll-2")
+	require.NoError(t, err)
+	assert.Equal(t, StateFailed, unpaid.State)
+	assert.Equal(t, mpesatest.ResultInsufficientFunds, unpaid.ResultCode)
+
+	assert.Len(t, srv.Requests(), 2+1, "one token and two payments")
+	mu.Lock()
+	assert.Contains(t, changes, "payroll-1:dispatching")
+	assert.Contains(t, changes, "payroll-1:succeeded")
+	mu.Unlock()
+
+	_, err = d.EnqueueB2C(ctx, "payroll-1", payout(100))
+	require.NoError(t, err)
+	ok, err := d.DispatchOne(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok, "a settled key is never submitted again")
+}
+
+func TestDispatcher_TimeoutIsNotResent(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.SetBalance(money.Birr(500))
+	srv.AddRule(mpesatest.Slow(300 * time.Millisecond).OnEndpoint(mpesatest.EndpointB2C).Limit(1))
+
+	results := httptest.NewServer(http.NotFoundHandler())
+	defer results.Close()
+	app, err := mpesagosdk.New(append(srv.Options(),
+		mpesagosdk.WithShortCode("600000"),
+		mpesagosdk.WithInitiator("testapi", "security-credential"),
+		mpesagosdk.WithResultURL(results.URL+"/result"),
+		mpesagosdk.WithQueueTimeOutURL(results.URL+"/timeout"),
+		mpesagosdk.WithTimeout(100*time.Millisecond),
+		mpesagosdk.WithMaxRetries(3),
+	)...)
+	require.NoError(t, err)
+	d := New(app, NewMemoryStore())
+	ctx := context.Background()
+
+	_, err = d.EnqueueB2C(ctx, "payroll-1", payout(100))
+	require.NoError(t, err)
+	ok, err := d.DispatchOne(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	srv.WaitForCallbacks()
+
+	job, err := d.Store.Get(ctx, "payroll-1")
+	require.NoError(t, err)
+	assert.Equal(t, StateUnknown, job.State)
+	var sent int
+	for _, r := range srv.Requests() {
+		if r.Endpoint == mpesatest.EndpointB2C {
+			sent++
+		}
+	}
+	assert.Equal(t, 1, sent, "a timed out payout is not retried by the App")
+	assert.Equal(t, money.Birr(400), srv.Balance())
+}
+
+func TestDispatcher_Restart(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	at := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return at }
+
+	// the first process enqueues two payouts and crashes while submitting the first one
+	first := New(nil, openSQLite(t, db))
+	first.Now = clock
+	override := payout(100)
+	override.AllowDuplicate = true
+	override.ExpectedName = "Abebe Kebede"
+	_, err := first.EnqueueB2C(ctx, "payroll-1", override)
+	require.NoError(t, err)
+	_, err = first.EnqueueB2C(ctx, "payroll-2", payout(200))
+	require.NoError(t, err)
+	claimed, err := first.Store.Claim(ctx, "crashed", at, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, "payroll-1", claimed.Key)
+
+	// the second process submits the pending payout only
+	fake := mpesatest.NewFakeClient()
+	second := New(fake, openSQLite(t, db))
+	second.Owner = "restarted"
+	second.Now = func() time.Time { return at.Add(2 * time.Minute) }
+	require.NoError(t, second.Expire(ctx))
+	for {
+		ok, err := second.DispatchOne(ctx)
+		require.NoError(t, err)
+		if !ok {
+			break
+		}
+	}
+
+	calls := fake.CallsTo(mpesatest.OperationB2CPayment)
+	require.Len(t, calls, 1)
+	req := calls[0].Request.(b2c.B2CRequest)
+	assert.Equal(t, "payroll-2", req.OriginatorConversationID)
+	assert.Equal(t, money.Birr(200), req.Amount)
+
+	crashed, err := second.Store.Get(ctx, "payroll-1")
+	require.NoError(t, err)
+	assert.Equal(t, StateUnknown, crashed.State)
+	assert.Contains(t, crashed.Error, "lease of crashed expired")
+
+	require.NoError(t, second.Resolve(ctx, "payroll-1", StateSucceeded, "RKT0000001", "found by a status query"))
+	resolved, err := second.Store.Get(ctx, "payroll-1")
+	require.NoError(t, err)
+	assert.Equal(t, StateSucceeded, resolved.State)
+	assert.Equal(t, "RKT0000001", resolved.TransactionID)
+	assert.ErrorIs(t, second.Resolve(ctx, "payroll-1", StateFailed, "", ""), ErrConflict)
+
+	// the payload keeps the fields that are not sent to M-Pesa
+	var env envelope
+	require.NoError(t, json.Unmarshal(crashed.Payload, &env))
+	assert.True(t, env.AllowDuplicate)
+	assert.Equal(t, "Abebe Kebede", env.ExpectedName)
+}
+
+func TestDispatcher_SubmissionErrors(t *testing.T) {
+	ctx := context.Background()
+	fake := mpesatest.NewFakeClient()
+	fake.B2CPaymentFunc = func(req b2c.B2CRequest) (*b2c.B2CSuccessResponse, error) {
+		if req.OriginatorConversationID == "refused" {
+			return nil, &types.MpesaErrorResponse{ErrorCode: "400.002.02", ErrorMessage: "Bad Request - Invalid PartyB", StatusCode: 400}
+		}
+		if req.OriginatorConversationID == "gateway" {
+			return nil, &types.MpesaErrorResponse{ErrorMessage: "Gateway Timeout", StatusCode: 504}
+		}
+		return nil, errors.New("connection reset by peer")
+	}
+	d := New(fake, NewMemoryStore())
+
+	for _, key := range []string{"refused", "reset", "gateway"} {
+		_, err := d.EnqueueB2C(ctx, key, payout(10))
+		require.NoError(t, err)
+		ok, err := d.DispatchOne(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	refused, _ := d.Store.Get(ctx, "refused")
+	assert.Equal(t, StateFailed, refused.State)
+	assert.Contains(t, refused.Error, "Invalid PartyB")
+	reset, _ := d.Store.Get(ctx, "reset")
+	assert.Equal(t, StateUnknown, reset.State, "the payment may have been sent")
+	gateway, _ := d.Store.Get(ctx, "gateway")
+	assert.Equal(t, StateUnknown, gateway.State, "a gateway error does not prove the payment was refused")
+}
+
+func TestDispatcher_Run(t *testing.T) {
+	fake := mpesatest.NewFakeClient()
+	d := New(fake, openSQLite(t, openDB(t)))
+	d.Workers, d.PollInterval = 3, 10*time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 10; i++ {
+		_, err := d.EnqueueB2C(ctx, fmt.Sprintf("payroll-%d", i), payout(10))
+		require.NoError(t, err)
+	}
+
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+	assert.Eventually(t, func() bool {
+		jobs, err := d.Store.List(ctx, StateAcknowledged, 0)
+		return err == nil && len(jobs) == 10
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	keys := map[string]bool{}
+	for _, call := range fake.CallsTo(mpesatest.OperationB2CPayment) {
+		keys[call.Request.(b2c.B2CRequest).OriginatorConversationID] = true
+	}
+	assert.Len(t, fake.CallsTo(mpesatest.OperationB2CPayment), 10)
+	assert.Len(t, keys, 10)
+}
@@ -0,0 +1,227 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/store"
+)
+
+// DefaultTable is the table of the jobs when SQLStore.Table is not set.
+const DefaultTable = "mpesa_outbox"
+
+// migrations: the schema changes of the jobs table, in order.
+var migrations = []store.Migration{
+	func(d store.Dialect, table string) []string {
+		return []string{
+			fmt.Sprintf(`CREATE TABLE %[1]s (
+	job_key VARCHAR(255) NOT NULL PRIMARY KEY,
+	kind VARCHAR(32) NOT NULL,
+	payload %[2]s NOT NULL,
+	state VARCHAR(16) NOT NULL,
+	owner VARCHAR(255) NOT NULL,
+	lease_until BIGINT NOT NULL,
+	conversation_id VARCHAR(255) NOT NULL,
+	transaction_id VARCHAR(255) NOT NULL,
+	result_code VARCHAR(64) NOT NULL,
+	result_desc %[2]s,
+	error %[2]s,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL
+)`, table, d.Text),
+			fmt.Sprintf("CREATE INDEX %[1]s_state ON %[1]s (state, created_at)", table),
+		}
+	},
+}
+
+// columns: the columns of a job, in the order of jobArgs and scanJob.
+var columns = []string{"job_key", "kind", "payload", "state", "owner", "lease_until", "conversation_id",
+	"transaction_id", "result_code", "result_desc", "error", "created_at", "updated_at"}
+
+// SQLStore is a Store keeping the jobs in a database/sql database, it is safe to share
+// between processes. Migrate must be called once before it is used.
+type SQLStore struct {
+	// DB is the database.
+	DB *sql.DB
+	// Dialect is the SQL dialect of the database.
+	Dialect store.Dialect
+	// Table is the table of the jobs, DefaultTable when empty. It is used as is in the
+	// statements and must be a valid identifier.
+	Table string
+}
+
+// NewSQLStore creates a store keeping the jobs in db.
+func NewSQLStore(db *sql.DB, dialect store.Dialect) *SQLStore {
+	return &SQLStore{DB: db, Dialect: dialect}
+}
+
+// table: returns the table of the jobs.
+func (s *SQLStore) table() string {
+	if s.Table == "" {
+		return DefaultTable
+	}
+	return s.Table
+}
+
+// Migrate creates or upgrades the table of the jobs, see store.ApplyMigrations.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	return store.ApplyMigrations(ctx, s.DB, s.Dialect, s.table(), migrations)
+}
+
+// placeholders: returns n bind parameters starting at the first.
+func (s *SQLStore) placeholders(first, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = s.Dialect.Placeholder(first + i)
+	}
+	return out
+}
+
+// Insert writes a new job.
+func (s *SQLStore) Insert(ctx context.Context, job *Job) error {
+	insert := fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)", s.table(),
+		strings.Join(columns, ", "), strings.Join(s.placeholders(1, len(columns)), ", "))
+	if _, err := s.DB.ExecContext(ctx, insert, jobArgs(job)...); err != nil {
+		// the constraint errors are not portable, the key is looked up instead
+		if _, getErr := s.Get(ctx, job.Key); getErr == nil {
+			return ErrExists
+		}
+		return fmt.Errorf("unable to insert the job: %w", err)
+	}
+	return nil
+}
+
+// Get returns the job of a key.
+func (s *SQLStore) Get(ctx context.Context, key string) (*Job, error) {
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE job_key = %v", strings.Join(columns, ", "), s.table(), s.Dialect.Placeholder(1))
+	job, err := scanJob(s.DB.QueryRowContext(ctx, query, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the job: %w", err)
+	}
+	return job, nil
+}
+
+// Claim moves the oldest pending job to StateDispatching. The job is selected then
+// updated only if it is still pending, another worker claiming it first is retried with
+// the next one.
+func (s *SQLStore) Claim(ctx context.Context, owner string, now time.Time, lease time.Duration) (*Job, error) {
+	selectPending := fmt.Sprintf("SELECT job_key FROM %v WHERE state = %v ORDER BY created_at, job_key LIMIT 1",
+		s.table(), s.Dialect.Placeholder(1))
+	p := s.placeholders(1, 6)
+	claim := fmt.Sprintf("UPDATE %v SET state = %v, owner = %v, lease_until = %v, updated_at = %v WHERE job_key = %v AND state = %v",
+		s.table(), p[0], p[1], p[2], p[3], p[4], s.Dialect.Placeholder(6))
+
+	for {
+		var key string
+		err := s.DB.QueryRowContext(ctx, selectPending, string(StatePending)).Scan(&key)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to find a pending job: %w", err)
+		}
+
+		res, err := s.DB.ExecContext(ctx, claim, string(StateDispatching), owner, now.Add(lease).UnixNano(), now.UnixNano(),
+			key, string(StatePending))
+		if err != nil {
+			return nil, fmt.Errorf("unable to claim the job: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("unable to claim the job: %w", err)
+		} else if n == 1 {
+			return s.Get(ctx, key)
+		}
+	}
+}
+
+// Update writes the job if it is still in the state from.
+func (s *SQLStore) Update(ctx context.Context, job *Job, from State) error {
+	set := make([]string, len(columns)-1)
+	for i, column := range columns[1:] {
+		set[i] = column + " = " + s.Dialect.Placeholder(i+1)
+	}
+	n := len(columns)
+	update := fmt.Sprintf("UPDATE %v SET %v WHERE job_key = %v AND state = %v", s.table(), strings.Join(set, ", "),
+		s.Dialect.Placeholder(n), s.Dialect.Placeholder(n+1))
+	args := append(jobArgs(job)[1:], job.Key, string(from))
+
+	res, err := s.DB.ExecContext(ctx, update, args...)
+	if err != nil {
+		return fmt.Errorf("unable to update the job: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unable to update the job: %w", err)
+	}
+	if affected == 0 {
+		if _, err := s.Get(ctx, job.Key); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+// List returns the jobs in a state, oldest first.
+func (s *SQLStore) List(ctx context.Context, state State, limit int) ([]Job, error) {
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE state = %v ORDER BY created_at, job_key",
+		strings.Join(columns, ", "), s.table(), s.Dialect.Placeholder(1))
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := s.DB.QueryContext(ctx, query, string(state))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read a job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list the jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// jobArgs: the values of the columns of a job.
+func jobArgs(job *Job) []interface{} {
+	var lease int64
+	if !job.LeaseUntil.IsZero() {
+		lease = job.LeaseUntil.UnixNano()
+	}
+	return []interface{}{job.Key, string(job.Kind), string(job.Payload), string(job.State), job.Owner, lease,
+		job.ConversationID, job.TransactionID, job.ResultCode, job.ResultDesc, job.Error,
+		job.CreatedAt.UnixNano(), job.UpdatedAt.UnixNano()}
+}
+
+// scanJob: reads the columns of a job.
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var job Job
+	var kind, payload, state string
+	var resultDesc, errText sql.NullString
+	var lease, created, updated int64
+	if err := row.Scan(&job.Key, &kind, &payload, &state, &job.Owner, &lease, &job.ConversationID,
+		&job.TransactionID, &job.ResultCode, &resultDesc, &errText, &created, &updated); err != nil {
+		return nil, err
+	}
+	job.Kind, job.Payload, job.State = Kind(kind), []byte(payload), State(state)
+	job.ResultDesc, job.Error = resultDesc.String, errText.String
+	if lease != 0 {
+		job.LeaseUntil = time.Unix(0, lease)
+	}
+	job.CreatedAt, job.UpdatedAt = time.Unix(0, created), time.Unix(0, updated)
+	return &job, nil
+}
@@ -0,0 +1,209 @@
+package qr
+
+// eccCodewordsPerBlock: the error correction codewords of each block, by level and version.
+var eccCodewordsPerBlock = [4][41]int{
+	{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// errorCorrectionBlocks: the number of blocks the codewords are split in, by level and version.
+var errorCorrectionBlocks = [4][41]int{
+	{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// rawCodewords: the number of codewords a version holds once its function patterns are drawn.
+func rawCodewords(version int) int {
+	modules := (16*version+128)*version + 64
+	if version >= 2 {
+		n := version/7 + 2
+		modules -= (25*n-10)*n - 55
+		if version >= 7 {
+			modules -= 36
+		}
+	}
+	return modules / 8
+}
+
+// dataCodewords: the number of data codewords of a version at a level.
+func dataCodewords(version int, level Level) int {
+	return rawCodewords(version) - eccCodewordsPerBlock[level][version]*errorCorrectionBlocks[level][version]
+}
+
+// segmentBits: the length of a byte mode segment of n bytes, its mode and character count included.
+func segmentBits(version, n int) int {
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	if n >= 1<<countBits {
+		return 1 << 30
+	}
+	return 4 + countBits + 8*n
+}
+
+// bitWriter: appends bits to a byte slice, most significant bit first.
+type bitWriter struct {
+	bytes []byte
+	n     int
+}
+
+func (w *bitWriter) write(value, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.bytes = append(w.bytes, 0)
+		}
+		if (value>>i)&1 != 0 {
+			w.bytes[w.n/8] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+// encodeData: builds the data codewords, the byte mode segment followed by the
+// terminator and the padding codewords.
+func encodeData(data []byte, version int, level Level) []byte {
+	capacity := dataCodewords(version, level) * 8
+	w := &bitWriter{}
+	w.write(0b0100, 4)
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	w.write(len(data), countBits)
+	for _, b := range data {
+		w.write(int(b), 8)
+	}
+	w.write(0, min(4, capacity-w.n))
+	w.write(0, (8-w.n%8)%8)
+	for pad := 0xEC; w.n < capacity; pad ^= 0xEC ^ 0x11 {
+		w.write(pad, 8)
+	}
+	return w.bytes
+}
+
+// addErrorCorrection: splits the data codewords in blocks, computes the error correction
+// codewords of each block and interleaves them. The first blocks are one codeword shorter
+// when the codewords can not be split evenly.
+func addErrorCorrection(data []byte, version int, level Level) []byte {
+	numBlocks := errorCorrectionBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	raw := rawCodewords(version)
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw/numBlocks - eccLen
+	generator := rsGenerator(eccLen)
+
+	blocks := make([][]byte, numBlocks)
+	eccs := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortLen
+		if i >= numShort {
+			n++
+		}
+		blocks[i] = data[k : k+n]
+		eccs[i] = rsRemainder(blocks[i], generator)
+		k += n
+	}
+
+	out := make([]byte, 0, raw)
+	for i := 0; i <= shortLen; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for _, e := range eccs {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// gfMul: multiplies two elements of GF(256) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(a, b byte) byte {
+	var p byte
+	for ; b != 0; b >>= 1 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1D
+		}
+	}
+	return p
+}
+
+// rsGenerator: the coefficients of the Reed-Solomon generator polynomial of a degree,
+// (x - a^0)(x - a^1)...(x - a^(degree-1)) with a = 2, highest power first without the
+// leading 1.
+func rsGenerator(degree int) []byte {
+	g := make([]byte, degree)
+	g[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			g[j] = gfMul(g[j], root)
+			if j+1 < degree {
+				g[j] ^= g[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return g
+}
+
+// rsRemainder: the Reed-Solomon error correction codewords of data.
+func rsRemainder(data, generator []byte) []byte {
+	r := make([]byte, len(generator))
+	for _, b := range data {
+		factor := b ^ r[0]
+		copy(r, r[1:])
+		r[len(r)-1] = 0
+		for i, g := range generator {
+			r[i] ^= gfMul(g, factor)
+		}
+	}
+	return r
+}
+
+// formatInformation: the 15 bits of the level and mask, protected by a BCH code and masked.
+func formatInformation(level Level, mask int) int {
+	data := level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionInformation: the 18 bits of a version, protected by a BCH code.
+func versionInformation(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// alignmentPositions: the rows and columns of the centers of the alignment patterns.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*8 + n*3 + 5) / (n*4 - 4) * 2
+	positions := make([]int, n)
+	positions[0] = 6
+	for i, pos := n-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
@@ -0,0 +1,415 @@
+// Package qr encodes QR codes (ISO/IEC 18004) and renders them as images, with the
+// standard library only.
+//
+// It is used to render payment QR codes locally, such as the codes printed at a till,
+// without calling the dynamic QR API of M-Pesa (see c2b.DynamicQRRequest). The text is
+// encoded in byte mode, in the smallest of the 40 versions that holds it at the requested
+// error correction level, with the mask of the lowest penalty.
+//
+// Example usage:
+//
+//	code, err := qr.Encode(payload, qr.Medium)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	f, _ := os.Create("till.png")
+//	defer f.Close()
+//	err = code.WritePNG(f, 8) // 8 pixels per module
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// Level is the error correction level of a code, the share of the code that can be
+// damaged or covered, by a logo for example, while it can still be read.
+type Level int
+
+const (
+	// Low restores about 7% of the code.
+	Low Level = iota
+	// Medium restores about 15% of the code.
+	Medium
+	// Quartile restores about 25% of the code.
+	Quartile
+	// High restores about 30% of the code.
+	High
+)
+
+// String returns the letter of the level, L, M, Q or H.
+func (l Level) String() string {
+	if l < Low || l > High {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return "LMQH"[l : l+1]
+}
+
+// formatBits: the bits of the level in the format information.
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// QuietZone is the number of light modules around a rendered code, as the standard requires.
+const QuietZone = 4
+
+// ErrTooLong is returned when the text does not fit in a version 40 code at the level.
+var ErrTooLong = errors.New("qr: the text is too long for a QR code")
+
+// Code is an encoded QR code.
+type Code struct {
+	version int
+	level   Level
+	mask    int
+	size    int
+	// modules are the dark modules, row by row
+	modules []bool
+	// function are the modules of the finder, timing and alignment patterns and of the
+	// format and version information, the data is not written on them
+	function []bool
+}
+
+// Encode encodes a text in byte mode.
+//
+// Parameters:
+//   - text: The encoded text, usually UTF-8.
+//   - level: The error correction level.
+//
+// Returns:
+//   - *Code: The code of the smallest version holding the text.
+//   - error: ErrTooLong when the text does not fit, or an error for an unknown level.
+func Encode(text string, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, fmt.Errorf("qr: unknown error correction level %v", level)
+	}
+	data := []byte(text)
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if segmentBits(v, len(data)) <= dataCodewords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	c := &Code{version: version, level: level, size: version*4 + 17}
+	c.modules = make([]bool, c.size*c.size)
+	c.function = make([]bool, c.size*c.size)
+	c.drawFunctionPatterns()
+	c.drawCodewords(addErrorCorrection(encodeData(data, version, level), version, level))
+	c.applyBestMask()
+	return c, nil
+}
+
+// Version returns the version of the code, from 1 (21x21 modules) to 40 (177x177).
+func (c *Code) Version() int { return c.version }
+
+// Level returns the error correction level of the code.
+func (c *Code) Level() Level { return c.level }
+
+// Mask returns the mask pattern applied to the data, from 0 to 7.
+func (c *Code) Mask() int { return c.mask }
+
+// Size returns the width and height of the code in modules, without the quiet zone.
+func (c *Code) Size() int { return c.size }
+
+// Dark reports whether the module at column x and row y is dark, the modules outside
+// the code, such as the ones of the quiet zone, are light.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.size || y >= c.size {
+		return false
+	}
+	return c.modules[y*c.size+x]
+}
+
+// Image renders the code with scale pixels per module and the quiet zone, black on white.
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	width := (c.size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+			x0, y0 := (x+QuietZone)*scale, (y+QuietZone)*scale
+			for py := y0; py < y0+scale; py++ {
+				for px := x0; px < x0+scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG writes the image of the code as a PNG, see Image.
+func (c *Code) WritePNG(w io.Writer, scale int) error {
+	return png.Encode(w, c.Image(scale))
+}
+
+// set: sets a module and marks it as part of a function pattern.
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y*c.size+x] = dark
+	c.function[y*c.size+x] = true
+}
+
+// drawFunctionPatterns: draws the finder, timing and alignment patterns and reserves the
+// format and version information, written by applyBestMask.
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.size-4, 3)
+	c.drawFinder(3, c.size-4)
+
+	positions := alignmentPositions(c.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// the corners of the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	c.drawFormat(0)
+	c.drawVersion()
+}
+
+// drawFinder: draws a finder pattern and its separator centered on x, y.
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= c.size || yy >= c.size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			c.set(xx, yy, d != 2 && d != 4)
+		}
+	}
+}
+
+// drawAlignment: draws an alignment pattern centered on x, y.
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormat: draws both copies of the format information of a mask, and the dark module.
+func (c *Code) drawFormat(mask int) {
+	bits := formatInformation(c.level, mask)
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	// around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	// under the top right finder and right of the bottom left one
+	for i := 0; i < 8; i++ {
+		c.set(c.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.size-15+i, bit(i))
+	}
+	c.set(8, c.size-8, true)
+}
+
+// drawVersion: draws both copies of the version information, from version 7.
+func (c *Code) drawVersion() {
+	if c.version < 7 {
+		return
+	}
+	bits := versionInformation(c.version)
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 != 0
+		a, b := c.size-11+i%3, i/3
+		c.set(a, b, dark)
+		c.set(b, a, dark)
+	}
+}
+
+// drawCodewords: writes the codewords in the two module wide columns going up and down
+// from the bottom right corner, skipping the function patterns. The remainder bits stay light.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// the vertical timing pattern
+			right = 5
+		}
+		for vert := 0; vert < c.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vert
+				}
+				if c.function[y*c.size+x] || i >= len(codewords)*8 {
+					continue
+				}
+				c.modules[y*c.size+x] = (codewords[i>>3]>>(7-(i&7)))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyBestMask: applies the mask of the lowest penalty and draws its format information.
+func (c *Code) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		// masks are their own inverse
+		c.applyMask(mask)
+	}
+	c.mask = best
+	c.applyMask(best)
+	c.drawFormat(best)
+}
+
+// applyMask: inverts the data modules selected by a mask pattern.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if !c.function[y*c.size+x] && masked(mask, x, y) {
+				c.modules[y*c.size+x] = !c.modules[y*c.size+x]
+			}
+		}
+	}
+}
+
+// masked: reports whether a mask pattern inverts the module at x, y.
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// penalty: scores how hard the code is to read, the four rules of the standard.
+func (c *Code) penalty() int {
+	p := 0
+	// runs of five or more modules of the same color, in rows then columns
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < c.size; a++ {
+			run := 0
+			var prev bool
+			for b := 0; b < c.size; b++ {
+				dark := c.Dark(b, a)
+				if vertical {
+					dark = c.Dark(a, b)
+				}
+				if b > 0 && dark == prev {
+					run++
+				} else {
+					run = 1
+				}
+				prev = dark
+				if run == 5 {
+					p += 3
+				} else if run > 5 {
+					p++
+				}
+			}
+		}
+	}
+
+	// blocks of 2x2 modules of the same color
+	for y := 0; y < c.size-1; y++ {
+		for x := 0; x < c.size-1; x++ {
+			dark := c.Dark(x, y)
+			if dark == c.Dark(x+1, y) && dark == c.Dark(x, y+1) && dark == c.Dark(x+1, y+1) {
+				p += 3
+			}
+		}
+	}
+
+	// patterns looking like a finder, 1:1:3:1:1 with four light modules on one side
+	finders := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < c.size; a++ {
+			for b := 0; b+11 <= c.size; b++ {
+				for _, pattern := range finders {
+					match := true
+					for k, dark := range pattern {
+						m := c.Dark(b+k, a)
+						if vertical {
+							m = c.Dark(a, b+k)
+						}
+						if m != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						p += 40
+					}
+				}
+			}
+		}
+	}
+
+	// the balance of dark and light modules, 10 points per 5% away from half
+	dark := 0
+	for _, m := range c.modules {
+		if m {
+			dark++
+		}
+	}
+	total := c.size * c.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return p + max(k, 0)*10
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
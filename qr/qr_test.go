@@ -0,0 +1,390 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tables below are copied from ISO/IEC 18004, they are not derived from the encoder.
+
+// standardFormats: the format information of each level and mask (table C.1), by level
+// in the L, M, Q, H order and then by mask.
+var standardFormats = [4][8]int{
+	{0b111011111000100, 0b111001011110011, 0b111110110101010, 0b111100010011101, 0b110011000101111, 0b110001100011000, 0b110110001000001, 0b110100101110110},
+	{0b101010000010010, 0b101000100100101, 0b101111001111100, 0b101101101001011, 0b100010111111001, 0b100000011001110, 0b100111110010111, 0b100101010100000},
+	{0b011010101011111, 0b011000001101000, 0b011111100110001, 0b011101000000110, 0b010010010110100, 0b010000110000011, 0b010111011011010, 0b010101111101101},
+	{0b001011010001001, 0b001001110111110, 0b001110011100111, 0b001100111010000, 0b000011101100010, 0b000001001010101, 0b000110100001100, 0b000100000111011},
+}
+
+// standardVersions: the version information of the versions used by the tests (table D.1).
+var standardVersions = map[int]int{7: 0x07C94, 8: 0x085BC, 15: 0x0F928, 40: 0x28C69}
+
+// standardAlignment: the rows and columns of the alignment patterns of each version (table E.1).
+var standardAlignment = [41][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50}, 11: {6, 30, 54}, 12: {6, 32, 58}, 13: {6, 34, 62},
+	14: {6, 26, 46, 66}, 15: {6, 26, 48, 70}, 16: {6, 26, 50, 74}, 17: {6, 30, 54, 78}, 18: {6, 30, 56, 82}, 19: {6, 30, 58, 86}, 20: {6, 34, 62, 90},
+	21: {6, 28, 50, 72, 94}, 22: {6, 26, 50, 74, 98}, 23: {6, 30, 54, 78, 102}, 24: {6, 28, 54, 80, 106}, 25: {6, 32, 58, 84, 110}, 26: {6, 30, 58, 86, 114}, 27: {6, 34, 62, 90, 118},
+	28: {6, 26, 50, 74, 98, 122}, 29: {6, 30, 54, 78, 102, 126}, 30: {6, 26, 52, 78, 104, 130}, 31: {6, 30, 56, 82, 108, 134}, 32: {6, 34, 60, 86, 112, 138}, 33: {6, 30, 58, 86, 114, 142}, 34: {6, 34, 62, 90, 118, 146},
+	35: {6, 30, 54, 78, 102, 126, 150}, 36: {6, 24, 50, 76, 102, 128, 154}, 37: {6, 28, 54, 80, 106, 132, 158}, 38: {6, 32, 58, 84, 110, 136, 162}, 39: {6, 26, 54, 82, 110, 138, 166}, 40: {6, 30, 58, 86, 114, 142, 170},
+}
+
+// standardMasks: the data mask patterns (table 10), i is the row and j the column.
+var standardMasks = [8]func(i, j int) bool{
+	func(i, j int) bool { return (i+j)%2 == 0 },
+	func(i, j int) bool { return i%2 == 0 },
+	func(i, j int) bool { return j%3 == 0 },
+	func(i, j int) bool { return (i+j)%3 == 0 },
+	func(i, j int) bool { return (i/2+j/3)%2 == 0 },
+	func(i, j int) bool { return (i*j)%2+(i*j)%3 == 0 },
+	func(i, j int) bool { return ((i*j)%2+(i*j)%3)%2 == 0 },
+	func(i, j int) bool { return ((i*j)%3+(i+j)%2)%2 == 0 },
+}
+
+// blockGroup: blocks of a version and level with the same length (table 9), count blocks
+// of total codewords holding data codewords.
+type blockGroup struct {
+	count, total, data int
+}
+
+func TestFormatInformation(t *testing.T) {
+	for l := Low; l <= High; l++ {
+		for mask := 0; mask < 8; mask++ {
+			assert.Equal(t, standardFormats[l][mask], formatInformation(l, mask), "%v-%v", l, mask)
+		}
+	}
+	for version, bits := range standardVersions {
+		assert.Equal(t, bits, versionInformation(version), "version %v", version)
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	assert.Nil(t, alignmentPositions(1))
+	for v := 2; v <= 40; v++ {
+		assert.Equal(t, standardAlignment[v], alignmentPositions(v), "version %v", v)
+	}
+}
+
+func TestErrorCorrection(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		ecc  []byte
+	}{
+		{
+			// the example of annex I, 01234567 in numeric mode
+			name: "01234567",
+			data: []byte{16, 32, 12, 86, 97, 128, 236, 17, 236, 17, 236, 17, 236, 17, 236, 17},
+			ecc:  []byte{165, 36, 212, 193, 237, 54, 199, 135, 44, 85},
+		},
+		{
+			name: "HELLO WORLD",
+			data: []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			ecc:  []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, append(append([]byte{}, tt.data...), tt.ecc...), addErrorCorrection(tt.data, 1, Medium))
+		})
+	}
+
+	for v := 1; v <= 40; v++ {
+		for l := Low; l <= High; l++ {
+			blocks := errorCorrectionBlocks[l][v]
+			assert.GreaterOrEqual(t, rawCodewords(v)/blocks-eccCodewordsPerBlock[l][v], 1, "%v-%v", v, l)
+		}
+	}
+	assert.Equal(t, 26, rawCodewords(1))
+	assert.Equal(t, 3706, rawCodewords(40))
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		level   Level
+		version int
+		blocks  []blockGroup
+	}{
+		{name: "empty", text: "", level: Low, version: 1, blocks: []blockGroup{{1, 26, 19}}},
+		{name: "version 1 full", text: strings.Repeat("a", 17), level: Low, version: 1, blocks: []blockGroup{{1, 26, 19}}},
+		{name: "version 2", text: strings.Repeat("a", 18), level: Low, version: 2, blocks: []blockGroup{{1, 44, 34}}},
+		{name: "payment", text: "https://pay.example.com/till/123456?amount=100&ref=INV-001", level: Medium, version: 4, blocks: []blockGroup{{2, 50, 32}}},
+		{name: "utf-8", text: "ክፍያ ለ ቡና ቤት", level: Quartile, version: 3, blocks: []blockGroup{{2, 35, 17}}},
+		{name: "multiple blocks", text: strings.Repeat("0123456789", 20), level: High, version: 15, blocks: []blockGroup{{11, 36, 12}, {7, 37, 13}}},
+		{name: "version information", text: strings.Repeat("x", 150), level: Medium, version: 8, blocks: []blockGroup{{2, 60, 38}, {2, 61, 39}}},
+		{name: "largest", text: strings.Repeat("z", 2953), level: Low, version: 40, blocks: []blockGroup{{19, 148, 118}, {6, 149, 119}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(tt.text, tt.level)
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, code.Version())
+			assert.Equal(t, tt.level, code.Level())
+			assert.Equal(t, tt.version*4+17, code.Size())
+
+			var buf bytes.Buffer
+			require.NoError(t, code.WritePNG(&buf, 1))
+			img, err := png.Decode(&buf)
+			require.NoError(t, err)
+			assert.Equal(t, tt.text, scan(t, img, tt.level, tt.blocks))
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	_, err := Encode(strings.Repeat("z", 2954), Low)
+	assert.ErrorIs(t, err, ErrTooLong)
+	_, err = Encode(strings.Repeat("z", 1274), High)
+	assert.ErrorIs(t, err, ErrTooLong)
+	_, err = Encode("text", Level(4))
+	assert.Error(t, err)
+}
+
+func TestWritePNG(t *testing.T) {
+	code, err := Encode("till 123456", Medium)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, code.WritePNG(&buf, 3))
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+
+	width := (code.Size() + 2*QuietZone) * 3
+	assert.Equal(t, width, img.Bounds().Dx())
+	assert.Equal(t, width, img.Bounds().Dy())
+	for _, m := range [][2]int{{0, 0}, {1, 1}, {3, 3}, {7, 0}, {8, 8}, {code.Size() - 1, 0}} {
+		r, _, _, _ := img.At((m[0]+QuietZone)*3+1, (m[1]+QuietZone)*3+1).RGBA()
+		assert.Equal(t, code.Dark(m[0], m[1]), r == 0, "module %v", m)
+	}
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.NotZero(t, r, "quiet zone")
+}
+
+// scan: reads the image of a code rendered with one pixel per module the way a scanner
+// would, with the tables of the standard only, and returns the text. It checks the
+// function patterns, both copies of the format information, the version information, the
+// Reed-Solomon syndromes of every block and the padding.
+func scan(t *testing.T, img image.Image, level Level, groups []blockGroup) string {
+	t.Helper()
+
+	size := img.Bounds().Dx() - 2*QuietZone
+	version := (size - 17) / 4
+	dark := func(row, col int) bool {
+		r, _, _, _ := img.At(col+QuietZone, row+QuietZone).RGBA()
+		return r == 0
+	}
+	bits := func(cells [][2]int) int {
+		v := 0
+		for i, cell := range cells {
+			if dark(cell[0], cell[1]) {
+				v |= 1 << i
+			}
+		}
+		return v
+	}
+
+	// the finder patterns and the timing patterns
+	for _, corner := range [][2]int{{0, 0}, {0, size - 7}, {size - 7, 0}} {
+		for i := 0; i < 7; i++ {
+			for j := 0; j < 7; j++ {
+				ring := max(abs(i-3), abs(j-3))
+				require.Equal(t, ring != 2, dark(corner[0]+i, corner[1]+j), "finder at %v", corner)
+			}
+		}
+	}
+	for i := 8; i < size-8; i++ {
+		require.Equal(t, i%2 == 0, dark(6, i), "horizontal timing")
+		require.Equal(t, i%2 == 0, dark(i, 6), "vertical timing")
+	}
+	require.True(t, dark(size-8, 8), "dark module")
+
+	// the format information, bit 0 first
+	var first, second [][2]int
+	for _, row := range []int{0, 1, 2, 3, 4, 5, 7, 8} {
+		first = append(first, [2]int{row, 8})
+	}
+	for _, col := range []int{7, 5, 4, 3, 2, 1, 0} {
+		first = append(first, [2]int{8, col})
+	}
+	for i := 0; i < 8; i++ {
+		second = append(second, [2]int{8, size - 1 - i})
+	}
+	for i := 0; i < 7; i++ {
+		second = append(second, [2]int{size - 7 + i, 8})
+	}
+	format := bits(first)
+	require.Equal(t, format, bits(second), "the copies of the format information")
+	mask := -1
+	for m, f := range standardFormats[level] {
+		if f == format {
+			mask = m
+		}
+	}
+	require.NotEqual(t, -1, mask, "format information %015b of level %v", format, level)
+
+	// the version information, in the 6x3 blocks next to the finders, bit 0 first
+	if version >= 7 {
+		var below, right [][2]int
+		for i := 0; i < 18; i++ {
+			below = append(below, [2]int{size - 11 + i%3, i / 3})
+			right = append(right, [2]int{i / 3, size - 11 + i%3})
+		}
+		require.Equal(t, standardVersions[version], bits(below), "version information")
+		require.Equal(t, standardVersions[version], bits(right), "version information")
+	}
+
+	reserved := func(row, col int) bool {
+		switch {
+		case row < 9 && col < 9, row < 9 && col >= size-8, row >= size-8 && col < 9:
+			return true
+		case row == 6 || col == 6:
+			return true
+		case version >= 7 && row < 6 && col >= size-11, version >= 7 && col < 6 && row >= size-11:
+			return true
+		}
+		centers := standardAlignment[version]
+		for a, ar := range centers {
+			for b, ac := range centers {
+				if (a == 0 && b == 0) || (a == 0 && b == len(centers)-1) || (a == len(centers)-1 && b == 0) {
+					continue
+				}
+				if abs(row-ar) <= 2 && abs(col-ac) <= 2 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	// the codewords, in pairs of columns from the right, upwards first
+	var codewords []byte
+	n := 0
+	upward := true
+	for col := size - 1; col > 0; col -= 2 {
+		if col == 6 {
+			col--
+		}
+		for k := 0; k < size; k++ {
+			row := k
+			if upward {
+				row = size - 1 - k
+			}
+			for _, c := range []int{col, col - 1} {
+				if reserved(row, c) {
+					continue
+				}
+				if n%8 == 0 {
+					codewords = append(codewords, 0)
+				}
+				if dark(row, c) != standardMasks[mask](row, c) {
+					codewords[n/8] |= 0x80 >> (n % 8)
+				}
+				n++
+			}
+		}
+		upward = !upward
+	}
+
+	// the blocks, the data codewords are interleaved first then the error correction ones
+	var blocks [][]byte
+	var dataLens []int
+	total := 0
+	for _, g := range groups {
+		for i := 0; i < g.count; i++ {
+			blocks = append(blocks, nil)
+			dataLens = append(dataLens, g.data)
+			total += g.total
+		}
+	}
+	eccLen := groups[0].total - groups[0].data
+	require.Equal(t, total, n/8, "the codewords of version %v", version)
+	k := 0
+	for i := 0; i < dataLens[len(dataLens)-1]; i++ {
+		for b := range blocks {
+			if i < dataLens[b] {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	var data []byte
+	for b := range blocks {
+		data = append(data, blocks[b]...)
+	}
+	for i := 0; i < eccLen; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[k])
+			k++
+		}
+	}
+	for b, block := range blocks {
+		for s := 0; s < eccLen; s++ {
+			require.Zero(t, syndrome(block, s), "syndrome %v of block %v", s, b)
+		}
+	}
+
+	// the byte mode segment, the terminator and the padding
+	bit := 0
+	read := func(n int) int {
+		v := 0
+		for ; n > 0; n-- {
+			v = v<<1 | int(data[bit/8]>>(7-bit%8))&1
+			bit++
+		}
+		return v
+	}
+	require.Equal(t, 0b0100, read(4), "byte mode")
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	text := make([]byte, read(countBits))
+	for i := range text {
+		text[i] = byte(read(8))
+	}
+	if rest := len(data)*8 - bit; rest > 0 {
+		require.Zero(t, read(min(rest, 4)), "terminator")
+		if bit%8 != 0 {
+			require.Zero(t, read(8-bit%8), "bit padding")
+		}
+		for pad := 0; bit < len(data)*8; pad++ {
+			require.Equal(t, []int{0xEC, 0x11}[pad%2], read(8), "pad codeword")
+		}
+	}
+	return string(text)
+}
+
+// syndrome: the value of a block at a^s in GF(256), zero for an undamaged block.
+func syndrome(block []byte, s int) byte {
+	exp := make([]byte, 255)
+	x := 1
+	for i := range exp {
+		exp[i] = byte(x)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	log := make([]int, 256)
+	for i, e := range exp {
+		log[e] = i
+	}
+
+	var sum byte
+	for i, c := range block {
+		if c == 0 {
+			continue
+		}
+		power := len(block) - 1 - i
+		sum ^= exp[(log[c]+s*power)%255]
+	}
+	return sum
+}
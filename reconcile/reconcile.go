@@ -0,0 +1,365 @@
+// Package reconcile checks the payments of a local ledger against M-Pesa.
+//
+// Every record of the ledger without a final result is queried with a transaction
+// status query, under a rate limit, and classified from the result of the query:
+// ClassMatched when M-Pesa completed the transaction with the same amount,
+// ClassMissing when M-Pesa has no such transaction or it failed (see FailedStatuses),
+// ClassAmountMismatch when the amounts differ and ClassUnknown when no answer could
+// be obtained or the transaction may still complete, such as a "Pending" one. The
+// Report lists every record and can be serialized as JSON.
+//
+// The results of the queries are sent to the ResultURL, pass them to HandleResult.
+//
+// Example usage:
+//
+//	r := reconcile.New(app, ledger)
+//	http.Handle("/mpesa/reconcile", callback.ResultHandler(r.HandleResult))
+//
+//	report, err := r.Run(ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	json.NewEncoder(os.Stdout).Encode(report.Discrepancies())
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/internal/ratelimit"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/transaction"
+	"github.com/coleYab/mpesagosdk/types"
+)
+
+const (
+	// DefaultRate is the number of queries sent per second when Reconciler.Rate is not set.
+	DefaultRate = 5
+	// DefaultTimeout is how long the results are waited for when Reconciler.Timeout is not set.
+	DefaultTimeout = 2 * time.Minute
+
+	// ResultTransactionNotFound is the result code of a query for a transaction M-Pesa does not know.
+	ResultTransactionNotFound callback.Code = "R000002"
+	// StatusCompleted is the `TransactionStatus` result parameter of a completed transaction.
+	StatusCompleted = "Completed"
+)
+
+// FailedStatuses are the `TransactionStatus` result parameters of the transactions that ended
+// without paying, they are classified ClassMissing. Any other status, such as "Pending", may
+// still complete and is classified ClassUnknown so that an in flight payment is not paid again.
+var FailedStatuses = []string{"Failed", "Cancelled", "Declined", "Reversed"}
+
+// Class is the outcome of the reconciliation of a record.
+type Class string
+
+const (
+	// ClassMatched is a record M-Pesa completed with the same amount.
+	ClassMatched Class = "matched"
+	// ClassMissing is a record M-Pesa has no transaction for, or one that failed (see
+	// FailedStatuses).
+	ClassMissing Class = "missing"
+	// ClassAmountMismatch is a record M-Pesa completed with another amount.
+	ClassAmountMismatch Class = "amount_mismatch"
+	// ClassUnknown is a record that could not be checked (query refused, no result in
+	// time, unexpected result), it should be checked again later.
+	ClassUnknown Class = "unknown"
+)
+
+// Record is a payment of the local ledger.
+//
+// Fields:
+//   - ID: The identifier of the record in the ledger.
+//   - TransactionID: The M-Pesa receipt of the payment, when known.
+//   - OriginatorConversationID: The OriginatorConversationID of the request that made the
+//     payment, used to find the transaction when the receipt is not known.
+//   - Amount: The amount recorded in the ledger.
+//   - Party: The other party of the payment, only reported.
+type Record struct {
+	ID                       string       `json:"id"`
+	TransactionID            string       `json:"transaction_id,omitempty"`
+	OriginatorConversationID string       `json:"originator_conversation_id,omitempty"`
+	Amount                   money.Amount `json:"amount"`
+	Party                    string       `json:"party,omitempty"`
+}
+
+// Ledger is the local record of the payments.
+type Ledger interface {
+	// Unsettled returns the records that have no final result yet.
+	Unsettled(ctx context.Context) ([]Record, error)
+}
+
+// Outcome is the reconciliation of a record.
+//
+// Fields:
+//   - Record: The record of the ledger.
+//   - Class: The outcome.
+//   - MpesaTransactionID, MpesaAmount, MpesaStatus: The transaction found by M-Pesa.
+//   - ResultCode, ResultDesc: The result of the status query.
+//   - Detail: Why the record is not matched.
+type Outcome struct {
+	Record             Record        `json:"record"`
+	Class              Class         `json:"class"`
+	MpesaTransactionID string        `json:"mpesa_transaction_id,omitempty"`
+	MpesaAmount        *money.Amount `json:"mpesa_amount,omitempty"`
+	MpesaStatus        string        `json:"mpesa_status,omitempty"`
+	ResultCode         string        `json:"result_code,omitempty"`
+	ResultDesc         string        `json:"result_desc,omitempty"`
+	Detail             string        `json:"detail,omitempty"`
+}
+
+// Report is the result of a reconciliation run.
+type Report struct {
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Counts   map[Class]int `json:"counts"`
+	Outcomes []Outcome     `json:"outcomes"`
+}
+
+// Discrepancies returns the outcomes of the records that are not matched.
+func (r *Report) Discrepancies() []Outcome {
+	var out []Outcome
+	for _, o := range r.Outcomes {
+		if o.Class != ClassMatched {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// Reconciler checks the unsettled records of a ledger.
+type Reconciler struct {
+	// Client sends the status queries, usually an *mpesagosdk.App.
+	Client mpesagosdk.Client
+	// Ledger provides the records.
+	Ledger Ledger
+	// Rate is the maximum number of queries sent per second, DefaultRate when not positive.
+	Rate float64
+	// Timeout is how long the results are waited for, DefaultTimeout when not positive.
+	Timeout time.Duration
+	// Query is the template of the status queries, such as their ResultURL. The App fills
+	// the initiator, short code and URLs left empty, IdentifierType defaults to a short code.
+	Query transaction.TransactionStatusRequest
+
+	mu      sync.Mutex
+	pending map[string]*Outcome
+	changed chan struct{}
+	runs    int
+}
+
+// New creates a reconciler querying the records of ledger with client.
+func New(client mpesagosdk.Client, ledger Ledger) *Reconciler {
+	return &Reconciler{Client: client, Ledger: ledger}
+}
+
+// Run queries the status of every unsettled record of the ledger and waits for the
+// results, the records without result after Timeout are reported as ClassUnknown.
+//
+// Parameters:
+//   - ctx: Stops the run, the records not checked yet are reported as ClassUnknown.
+//
+// Returns:
+//   - *Report: The outcome of every record, in the order of the ledger.
+//   - error: The error of the ledger.
+func (r *Reconciler) Run(ctx context.Context) (*Report, error) {
+	records, err := r.Ledger.Unsettled(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the unsettled records: %w", err)
+	}
+
+	report := &Report{Started: time.Now(), Counts: map[Class]int{}}
+	outcomes := make([]*Outcome, len(records))
+	r.mu.Lock()
+	r.runs++
+	run := r.runs
+	if r.pending == nil {
+		r.pending = map[string]*Outcome{}
+	}
+	r.mu.Unlock()
+
+	rate := r.Rate
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+	limiter := ratelimit.New(rate, 1)
+	var queryIDs []string
+	for i, record := range records {
+		outcomes[i] = &Outcome{Record: record}
+		if record.TransactionID == "" && record.OriginatorConversationID == "" {
+			r.resolve(outcomes[i], ClassUnknown, "the record has no TransactionID nor OriginatorConversationID")
+			continue
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			r.resolve(outcomes[i], ClassUnknown, err.Error())
+			continue
+		}
+
+		id := fmt.Sprintf("reconcile-%d-%d-%d", report.Started.Unix(), run, i+1)
+		r.mu.Lock()
+		r.pending[id] = outcomes[i]
+		r.mu.Unlock()
+		queryIDs = append(queryIDs, id)
+		if _, err := r.Client.MakeTransactionStatusQuery(r.query(id, record)); err != nil {
+			r.mu.Lock()
+			delete(r.pending, id)
+			r.mu.Unlock()
+			r.resolve(outcomes[i], ClassUnknown, "query refused: "+err.Error())
+		}
+	}
+
+	r.wait(ctx, queryIDs)
+
+	r.mu.Lock()
+	for _, id := range queryIDs {
+		if o, ok := r.pending[id]; ok {
+			delete(r.pending, id)
+			o.Class, o.Detail = ClassUnknown, "no result before the timeout"
+		}
+	}
+	for _, o := range outcomes {
+		report.Outcomes = append(report.Outcomes, *o)
+		report.Counts[o.Class]++
+	}
+	r.mu.Unlock()
+	report.Finished = time.Now()
+	return report, nil
+}
+
+// query: builds the status query of a record.
+func (r *Reconciler) query(id string, record Record) transaction.TransactionStatusRequest {
+	req := r.Query
+	req.CommandID = types.TransactionStatusCommand
+	req.OriginatorConversationID = id
+	req.TransactionID = record.TransactionID
+	if record.TransactionID == "" {
+		req.OriginalConversationID = record.OriginatorConversationID
+	}
+	if req.IdentifierType == "" {
+		req.IdentifierType = types.ShortCodeIdentifierType
+	}
+	req.Occasion = types.OrDefault(req.Occasion, "Reconciliation")
+	req.Remarks = types.OrDefault(req.Remarks, "Reconciliation of "+record.ID)
+	return req
+}
+
+// resolve: sets the class of an outcome not queried.
+func (r *Reconciler) resolve(o *Outcome, class Class, detail string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o.Class, o.Detail = class, detail
+}
+
+// wait: blocks until every query has a result, ctx is done or the timeout expires.
+func (r *Reconciler) wait(ctx context.Context, ids []string) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		r.mu.Lock()
+		pending := false
+		for _, id := range ids {
+			if _, ok := r.pending[id]; ok {
+				pending = true
+				break
+			}
+		}
+		if !pending {
+			r.mu.Unlock()
+			return
+		}
+		if r.changed == nil {
+			r.changed = make(chan struct{})
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// HandleResult classifies a record from the result of its status query, its signature
+// matches callback.ResultHandler. Results of other requests are ignored.
+func (r *Reconciler) HandleResult(_ context.Context, res *callback.Result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.pending[res.Result.OriginatorConversationID]
+	if !ok {
+		return nil
+	}
+	delete(r.pending, res.Result.OriginatorConversationID)
+	classify(o, res)
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+	return nil
+}
+
+// Classify classifies a record from the result of a transaction status query for it,
+// or from an equivalent result such as statement.Entry.StatusResult.
+func Classify(record Record, res *callback.Result) Outcome {
+	o := Outcome{Record: record}
+	classify(&o, res)
+	return o
+}
+
+// classify: sets the class of an outcome from the result of its status query.
+func classify(o *Outcome, res *callback.Result) {
+	o.ResultCode = string(res.Result.ResultCode)
+	o.ResultDesc = res.Result.ResultDesc
+
+	switch {
+	case res.Result.ResultCode == ResultTransactionNotFound:
+		o.Class, o.Detail = ClassMissing, "M-Pesa has no such transaction"
+		return
+	case !res.Succeeded():
+		o.Class, o.Detail = ClassUnknown, "the status query failed"
+		return
+	}
+
+	if receipt, ok := res.Parameter("ReceiptNo"); ok {
+		o.MpesaTransactionID = receipt.String()
+	}
+	if status, ok := res.Parameter("TransactionStatus"); ok {
+		o.MpesaStatus = status.String()
+	}
+	value, ok := res.Parameter("Amount")
+	if !ok {
+		o.Class, o.Detail = ClassUnknown, "the result has no Amount"
+		return
+	}
+	amount, err := value.Amount()
+	if err != nil {
+		o.Class, o.Detail = ClassUnknown, "the result has an invalid Amount: "+err.Error()
+		return
+	}
+	o.MpesaAmount = &amount
+
+	switch {
+	case slices.ContainsFunc(FailedStatuses, func(s string) bool { return strings.EqualFold(s, o.MpesaStatus) }):
+		o.Class, o.Detail = ClassMissing, "the transaction is "+strconv.Quote(o.MpesaStatus)
+	case o.MpesaStatus != StatusCompleted:
+		o.Class, o.Detail = ClassUnknown, "the transaction is "+strconv.Quote(o.MpesaStatus)+", it may still complete"
+	case amount.Cmp(o.Record.Amount) != 0:
+		o.Class = ClassAmountMismatch
+		o.Detail = fmt.Sprintf("the ledger has %v, M-Pesa has %v", o.Record.Amount.Format(), amount.Format())
+	default:
+		o.Class = ClassMatched
+	}
+}
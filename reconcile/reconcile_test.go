@@ -0,0 +1,157 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mpesagosdk "github.com/coleYab/mpesagosdk"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/mpesatest"
+	"github.com/coleYab/mpesagosdk/transaction"
+	"github.com/coleYab/mpesagosdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ledger []Record
+
+func (l ledger) Unsettled(context.Context) ([]Record, error) {
+	return l, nil
+}
+
+func TestRun(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.AddTransaction(mpesatest.Transaction{TransactionID: "RKA0000001", Amount: money.Birr(100)})
+	srv.AddTransaction(mpesatest.Transaction{TransactionID: "RKA0000002", OriginatorConversationID: "payroll-emp-02", Amount: money.Birr(200)})
+	srv.AddTransaction(mpesatest.Transaction{TransactionID: "RKA0000003", Amount: money.Santim(29950)})
+	srv.AddTransaction(mpesatest.Transaction{TransactionID: "RKA0000005", Amount: money.Birr(500), Reversed: true})
+
+	r := New(nil, ledger{
+		{ID: "1", TransactionID: "RKA0000001", Amount: money.Birr(100)},
+		{ID: "2", OriginatorConversationID: "payroll-emp-02", Amount: money.Birr(200)},
+		{ID: "3", TransactionID: "RKA0000003", Amount: money.Birr(300)},
+		{ID: "4", TransactionID: "RKA0000004", Amount: money.Birr(400)},
+		{ID: "5", TransactionID: "RKA0000005", Amount: money.Birr(500)},
+		{ID: "6", Amount: money.Birr(600)},
+	})
+	results := httptest.NewServer(callback.ResultHandler(r.HandleResult))
+	defer results.Close()
+
+	app, err := mpesagosdk.New(append(srv.Options(),
+		mpesagosdk.WithShortCode("600000"),
+		mpesagosdk.WithInitiator("testapi", "security-credential"),
+		mpesagosdk.WithResultURL(results.URL+"/result"),
+		mpesagosdk.WithQueueTimeOutURL(results.URL+"/timeout"),
+	)...)
+	require.NoError(t, err)
+	r.Client = app
+	r.Rate = 100
+	r.Timeout = 5 * time.Second
+
+	report, err := r.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report.Outcomes, 6)
+
+	classes := make([]Class, len(report.Outcomes))
+	for i, o := range report.Outcomes {
+		classes[i] = o.Class
+	}
+	assert.Equal(t, []Class{ClassMatched, ClassMatched, ClassAmountMismatch, ClassMissing, ClassMissing, ClassUnknown}, classes)
+	assert.Equal(t, map[Class]int{ClassMatched: 2, ClassAmountMismatch: 1, ClassMissing: 2, ClassUnknown: 1}, report.Counts)
+
+	assert.Equal(t, "RKA0000002", report.Outcomes[1].MpesaTransactionID)
+	assert.Equal(t, "the ledger has ETB 300.00, M-Pesa has ETB 299.50", report.Outcomes[2].Detail)
+	assert.Equal(t, string(ResultTransactionNotFound), report.Outcomes[3].ResultCode)
+	assert.Equal(t, "Reversed", report.Outcomes[4].MpesaStatus)
+	assert.Len(t, report.Discrepancies(), 4)
+
+	data, err := json.Marshal(report.Discrepancies()[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"record":{"id":"3","transaction_id":"RKA0000003","amount":300},"class":"amount_mismatch",
+		"mpesa_transaction_id":"RKA0000003","mpesa_amount":299.5,"mpesa_status":"Completed","result_code":"0",
+		"result_desc":"The service request is processed successfully.","detail":"the ledger has ETB 300.00, M-Pesa has ETB 299.50"}`, string(data))
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     callback.Code
+		status   string
+		expected Class
+	}{
+		{"Completed", callback.Success, "Completed", ClassMatched},
+		{"Not found", ResultTransactionNotFound, "", ClassMissing},
+		{"Failed", callback.Success, "Failed", ClassMissing},
+		{"Cancelled", callback.Success, "Cancelled", ClassMissing},
+		{"Declined", callback.Success, "declined", ClassMissing},
+		{"Reversed", callback.Success, "Reversed", ClassMissing},
+		{"Pending", callback.Success, "Pending", ClassUnknown},
+		{"Processing", callback.Success, "Processing", ClassUnknown},
+		{"No status", callback.Success, "", ClassUnknown},
+		{"Query failed", "2001", "", ClassUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &callback.Result{}
+			res.Result.ResultCode = tt.code
+			res.SetParameter("Amount", callback.AmountValue(money.Birr(100)))
+			if tt.status != "" {
+				res.SetParameter("TransactionStatus", callback.StringValue(tt.status))
+			}
+
+			o := Classify(Record{ID: "1", Amount: money.Birr(100)}, res)
+			assert.Equal(t, tt.expected, o.Class, o.Detail)
+		})
+	}
+}
+
+func TestRun_NoResult(t *testing.T) {
+	fake := mpesatest.NewFakeClient()
+	fake.StatusFunc = func(req transaction.TransactionStatusRequest) (*transaction.TransactionStatusResponse, error) {
+		if req.TransactionID == "RKA0000002" {
+			return nil, &types.MpesaErrorResponse{ErrorCode: "500.003.02", ErrorMessage: "System is busy"}
+		}
+		return &transaction.TransactionStatusResponse{ResponseCode: "0"}, nil
+	}
+
+	r := New(fake, ledger{
+		{ID: "1", TransactionID: "RKA0000001", Amount: money.Birr(100)},
+		{ID: "2", TransactionID: "RKA0000002", Amount: money.Birr(200)},
+	})
+	r.Timeout = 20 * time.Millisecond
+	report, err := r.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.Counts[ClassUnknown])
+	assert.Equal(t, "no result before the timeout", report.Outcomes[0].Detail)
+	assert.Contains(t, report.Outcomes[1].Detail, "System is busy")
+
+	calls := fake.CallsTo(mpesatest.OperationStatus)
+	require.Len(t, calls, 2)
+	query := calls[0].Request.(transaction.TransactionStatusRequest)
+	assert.Equal(t, types.ShortCodeIdentifierType, query.IdentifierType)
+	assert.Equal(t, "Reconciliation of 1", query.Remarks)
+
+	// a late result is ignored
+	res := &callback.Result{}
+	res.Result.OriginatorConversationID = query.OriginatorConversationID
+	assert.NoError(t, r.HandleResult(context.Background(), res))
+}
+
+type failingLedger struct{}
+
+func (failingLedger) Unsettled(context.Context) ([]Record, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRun_LedgerError(t *testing.T) {
+	_, err := New(mpesatest.NewFakeClient(), failingLedger{}).Run(context.Background())
+	assert.ErrorContains(t, err, "connection refused")
+}
@@ -0,0 +1,260 @@
+// Package redact masks personal data and secrets before they reach logs, debug
+// dumps or storage. It knows the shapes the M-Pesa API uses:
+//	- MSISDNs / phone numbers anywhere in text, JSON strings or JSON numbers
+//	  (251712345678, +251712345678, 0712345678), with a configurable number of
+//	  trailing digits left visible.
+//	- Secret JSON fields such as `SecurityCredential`, the USSD push `Password`,
+//	  `access_token` and the consumer secret.
+//	- Bearer tokens and basic auth credentials in headers and text.
+//	- `apikey=` style query parameters.
+//
+// Example usage:
+//
+//	r := redact.New(redact.Rules{KeepPhoneDigits: 3})
+//	fmt.Println(r.String("paying 251712345678 with Bearer abc.def"))
+//
+// Output: paying *********678 with Bearer [REDACTED]
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mask is the replacement used for secrets.
+const Mask = "[REDACTED]"
+
+// DefaultSecretFields are the JSON keys whose values are always fully masked.
+var DefaultSecretFields = []string{
+	"SecurityCredential",
+	"Password",
+	"PassKey",
+	"access_token",
+	"ConsumerSecret",
+	"consumer_secret",
+	"Authorization",
+	"InitiatorPassword",
+}
+
+// Rules configures a Redactor.
+type Rules struct {
+	// KeepPhoneDigits is the number of trailing digits of a phone number left visible,
+	// 0 masks the whole number.
+	KeepPhoneDigits int
+	// SecretFields are the JSON keys (compared case insensitively) whose values are
+	// fully masked, DefaultSecretFields is used when it is empty.
+	SecretFields []string
+	// KeepPhoneNumbers disables phone number masking, secrets are still masked.
+	KeepPhoneNumbers bool
+}
+
+// DefaultRules keeps the last 3 digits of phone numbers and masks DefaultSecretFields.
+func DefaultRules() Rules {
+	return Rules{KeepPhoneDigits: 3}
+}
+
+// Redactor applies a set of Rules. It is safe for concurrent use.
+type Redactor struct {
+	rules   Rules
+	secrets map[string]bool
+	params  *regexp.Regexp
+}
+
+var (
+	phonePattern  = regexp.MustCompile(`(?:\+251|\b251|\b0|\b)[79]\d{8}\b`)
+	authPattern   = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`)
+	phoneExactly  = regexp.MustCompile(`^(?:\+?251|0)?[79]\d{8}$`)
+	defaultRedact = New(DefaultRules())
+)
+
+// Default returns the Redactor built from DefaultRules.
+func Default() *Redactor {
+	return defaultRedact
+}
+
+// New creates a Redactor from the given rules.
+func New(rules Rules) *Redactor {
+	fields := rules.SecretFields
+	if len(fields) == 0 {
+		fields = DefaultSecretFields
+	}
+
+	secrets := make(map[string]bool, len(fields))
+	quoted := make([]string, 0, len(fields)+1)
+	for _, f := range fields {
+		secrets[strings.ToLower(f)] = true
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+	quoted = append(quoted, "apikey")
+
+	return &Redactor{
+		rules:   rules,
+		secrets: secrets,
+		params:  regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)=[^&\s]+`),
+	}
+}
+
+// Phone masks a single phone number keeping the configured trailing digits.
+func (r *Redactor) Phone(number string) string {
+	if r.rules.KeepPhoneNumbers {
+		return number
+	}
+	keep := r.rules.KeepPhoneDigits
+	if keep < 0 || keep > len(number) {
+		keep = 0
+	}
+	return strings.Repeat("*", len(number)-keep) + number[len(number)-keep:]
+}
+
+// String masks phone numbers, bearer/basic credentials and secret `key=value`
+// parameters found in free text.
+func (r *Redactor) String(s string) string {
+	s = authPattern.ReplaceAllString(s, "$1 "+Mask)
+	s = r.params.ReplaceAllString(s, "$1="+Mask)
+	if !r.rules.KeepPhoneNumbers {
+		s = phonePattern.ReplaceAllStringFunc(s, r.Phone)
+	}
+	return s
+}
+
+// IsSecretField reports whether the values of the JSON key are fully masked.
+func (r *Redactor) IsSecretField(key string) bool {
+	return r.secrets[strings.ToLower(key)]
+}
+
+// JSON masks a JSON document: secret fields are replaced by Mask and phone numbers
+// in any string or number are masked. Documents that are not valid JSON are
+// redacted as text with String.
+func (r *Redactor) JSON(data []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return []byte(r.String(string(data)))
+	}
+
+	out, err := json.Marshal(r.value("", doc))
+	if err != nil {
+		return []byte(r.String(string(data)))
+	}
+	return out
+}
+
+// Value masks a value decoded from JSON (maps, slices, strings, json.Number...)
+// and returns the masked copy, see JSON.
+func (r *Redactor) Value(v interface{}) interface{} {
+	return r.value("", v)
+}
+
+// value: walks a decoded JSON value, key is the name of the field holding v.
+func (r *Redactor) value(key string, v interface{}) interface{} {
+	if key != "" && r.IsSecretField(key) {
+		if v == nil || v == "" {
+			return v
+		}
+		return Mask
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			out[k] = r.value(k, item)
+		}
+		// M-Pesa result parameters are {"Key": ..., "Value": ...} pairs
+		if name, ok := t["Key"].(string); ok && r.IsSecretField(name) {
+			if _, has := t["Value"]; has {
+				out["Value"] = Mask
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = r.value("", item)
+		}
+		return out
+	case string:
+		return r.String(t)
+	case json.Number:
+		if !r.rules.KeepPhoneNumbers && phoneExactly.MatchString(t.String()) {
+			return r.Phone(t.String())
+		}
+		return t
+	}
+	return v
+}
+
+// Header returns a copy of the headers with the Authorization header masked and
+// the other values redacted as text.
+func (r *Redactor) Header(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, values := range h {
+		masked := make([]string, len(values))
+		for i, v := range values {
+			if strings.EqualFold(k, "Authorization") || r.IsSecretField(k) {
+				scheme, _, found := strings.Cut(v, " ")
+				if found {
+					masked[i] = scheme + " " + Mask
+				} else {
+					masked[i] = Mask
+				}
+				continue
+			}
+			masked[i] = r.String(v)
+		}
+		out[k] = masked
+	}
+	return out
+}
+
+// DumpRequest renders an outgoing request with its body in a wire like format,
+// with the url, headers and body redacted.
+func (r *Redactor) DumpRequest(req *http.Request, body []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %v\n", req.Method, r.String(req.URL.String()))
+	r.writeHeaders(&b, req.Header)
+	r.writeBody(&b, body)
+	return b.String()
+}
+
+// DumpResponse renders a response with its body in a wire like format, with the
+// headers and body redacted.
+func (r *Redactor) DumpResponse(res *http.Response, body []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %v\n", res.Proto, res.Status)
+	r.writeHeaders(&b, res.Header)
+	r.writeBody(&b, body)
+	return b.String()
+}
+
+// writeHeaders: writes the redacted headers sorted by name.
+func (r *Redactor) writeHeaders(b *strings.Builder, h http.Header) {
+	masked := r.Header(h)
+	names := make([]string, 0, len(masked))
+	for k := range masked {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		for _, v := range masked[k] {
+			fmt.Fprintf(b, "%v: %v\n", k, v)
+		}
+	}
+}
+
+// writeBody: writes the redacted body after a blank line.
+func (r *Redactor) writeBody(b *strings.Builder, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	b.WriteString("\n")
+	b.Write(r.JSON(body))
+	b.WriteString("\n")
+}
@@ -0,0 +1,79 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString(t *testing.T) {
+	r := New(Rules{KeepPhoneDigits: 3})
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"International MSISDN", "pay 251712345678 now", "pay *********678 now"},
+		{"Plus prefixed MSISDN", "pay +251712345678", "pay **********678"},
+		{"Local MSISDN", "call 0712345678", "call *******678"},
+		{"Short code untouched", "PartyA 600000", "PartyA 600000"},
+		{"Bearer token", "Authorization: Bearer abc.DEF-123", "Authorization: Bearer " + Mask},
+		{"Basic auth", "Basic dXNlcjpwYXNz", "Basic " + Mask},
+		{"Api key", "/v1/register?apikey=12345abcd&x=1", "/v1/register?apikey=" + Mask + "&x=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, r.String(tt.input))
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	r := New(Rules{KeepPhoneDigits: 3})
+	body := []byte(`{"SecurityCredential":"secret","Password":"pw","PartyA":600000,"PartyB":251712345678,
+		"PhoneNumber":"251712345678","Remarks":"ok","ResultParameter":[{"Key":"ReceiverPartyPublicName","Value":"251712345678 - John"}]}`)
+
+	var out map[string]interface{}
+	assert.NoError(t, json.Unmarshal(r.JSON(body), &out))
+	assert.Equal(t, Mask, out["SecurityCredential"])
+	assert.Equal(t, Mask, out["Password"])
+	assert.Equal(t, float64(600000), out["PartyA"])
+	assert.Equal(t, "*********678", out["PartyB"])
+	assert.Equal(t, "*********678", out["PhoneNumber"])
+	assert.Equal(t, "ok", out["Remarks"])
+	params := out["ResultParameter"].([]interface{})
+	assert.Equal(t, "*********678 - John", params[0].(map[string]interface{})["Value"])
+
+	assert.Equal(t, "not json 0712345678", string(New(Rules{KeepPhoneDigits: 10}).JSON([]byte("not json 0712345678"))))
+}
+
+func TestDumpRequest(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/v1/register?apikey=abc", nil)
+	req.Header.Set("Authorization", "Bearer token-value")
+
+	dump := Default().DumpRequest(req, []byte(`{"Password":"pw"}`))
+	assert.Contains(t, dump, "POST https://example.com/v1/register?apikey="+Mask)
+	assert.Contains(t, dump, "Authorization: Bearer "+Mask)
+	assert.NotContains(t, dump, "token-value")
+	assert.NotContains(t, dump, `"pw"`)
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(Handler(slog.NewJSONHandler(&buf, nil), Default()))
+
+	log.With("SecurityCredential", "secret").Info("paying 251712345678",
+		slog.Group("request", "PhoneNumber", "0712345678"))
+
+	line := buf.String()
+	assert.False(t, strings.Contains(line, "secret"), line)
+	assert.False(t, strings.Contains(line, "12345678"), line)
+	assert.Contains(t, line, "*********678")
+}
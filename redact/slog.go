@@ -0,0 +1,65 @@
+package redact
+
+import (
+	"context"
+	"log/slog"
+)
+
+// handler is a slog.Handler that redacts the message and the attributes of every
+// record before passing it to the wrapped handler.
+type handler struct {
+	next slog.Handler
+	r    *Redactor
+}
+
+// Handler wraps next so that every message, string attribute and attribute named
+// after a secret field is redacted with r before it is written.
+func Handler(next slog.Handler, r *Redactor) slog.Handler {
+	return &handler{next: next, r: r}
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	out := slog.NewRecord(record.Time, record.Level, h.r.String(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = h.attr(a)
+	}
+	return &handler{next: h.next.WithAttrs(masked), r: h.r}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), r: h.r}
+}
+
+// attr: redacts a single attribute, groups are walked recursively.
+func (h *handler) attr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if h.r.IsSecretField(a.Key) && !a.Value.Equal(slog.StringValue("")) {
+		return slog.String(a.Key, Mask)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.r.String(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		masked := make([]slog.Attr, len(group))
+		for i, g := range group {
+			masked[i] = h.attr(g)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(masked...)}
+	}
+	return a
+}
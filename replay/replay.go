@@ -0,0 +1,337 @@
+// Package replay sends stored callbacks again, for example after a bug in a callback
+// consumer dropped events.
+//
+// The callbacks are loaded from a store.Store, recorded with store.RawHandler, or from
+// files holding one raw payload each, such as the ones saved by `mpesa listen -save`.
+// Every payload is decoded with the callback package and the bytes M-Pesa sent (see the
+// Raw methods) are delivered unchanged to an http.Handler, such as a callback.Handlers,
+// or to a URL. A Filter selects the callbacks by time range, operation and ResultCode,
+// and a dry run lists what would be sent without sending anything.
+//
+// Example usage:
+//
+//	callbacks, err := replay.FromStore(ctx, records, replay.Filter{
+//		Since:       time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+//		Operations:  []string{"b2c_payment"},
+//		ResultCodes: []string{"0"},
+//	})
+//	if err != nil {
+//		log.Println(err) // the records that cannot be replayed
+//	}
+//	r := &replay.Replayer{Handler: callback.Handlers{OnResult: onResult}}
+//	outcomes, err := r.Replay(ctx, callbacks)
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/store"
+)
+
+// ErrNoRawPayload is reported for the stored callbacks recorded without their raw bytes,
+// by store.Handler instead of store.RawHandler, they cannot be replayed.
+var ErrNoRawPayload = errors.New("the callback was recorded without its raw payload")
+
+// Payload is a decoded callback: a *callback.Result, *callback.STKCallback or
+// *callback.C2BConfirmation. Raw returns the bytes that are replayed.
+type Payload interface {
+	Raw() []byte
+}
+
+// Callback is a callback to replay.
+//
+// Fields:
+//   - Source: Where the callback was loaded from, "store:<ID>" or the path of its file.
+//   - Kind: The kind of the callback.
+//   - Operation: The operation of the request it answers (b2c_payment, ussd_push...), when
+//     the store has the request.
+//   - Code: The ResultCode of the callback, empty for C2B confirmations.
+//   - Keys: The correlation identifiers of the callback.
+//   - ReceivedAt: When the callback was recorded, the modification time of a file.
+//   - Payload: The decoded callback.
+type Callback struct {
+	Source     string        `json:"source"`
+	Kind       callback.Kind `json:"kind"`
+	Operation  string        `json:"operation,omitempty"`
+	Code       string        `json:"code,omitempty"`
+	Keys       store.Keys    `json:"keys"`
+	ReceivedAt time.Time     `json:"received_at"`
+	Payload    Payload       `json:"-"`
+}
+
+// Parse decodes a raw callback payload with the callback package.
+func Parse(raw []byte) (*Callback, error) {
+	rec, err := store.CallbackRecord(raw, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &Callback{Kind: callback.Kind(rec.Operation), Code: rec.Code, Keys: rec.Keys}
+	switch c.Kind {
+	case callback.KindResult:
+		c.Payload, err = callback.ParseResult(bytes.NewReader(raw))
+	case callback.KindSTK:
+		c.Payload, err = callback.ParseSTKCallback(bytes.NewReader(raw))
+	case callback.KindConfirmation:
+		c.Payload, err = callback.ParseC2BConfirmation(bytes.NewReader(raw))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Filter selects the callbacks to replay, its zero value selects every callback.
+//
+// Fields:
+//   - Since: The oldest reception time, when not zero.
+//   - Until: The reception time the callbacks must be older than, when not zero.
+//   - Operations: The callback kinds (result, stk, confirmation) or request operations
+//     (b2c_payment, transaction_reversal...) to replay, any when empty.
+//   - ResultCodes: The ResultCodes to replay, any when empty.
+type Filter struct {
+	Since       time.Time
+	Until       time.Time
+	Operations  []string
+	ResultCodes []string
+}
+
+// Match reports whether the filter selects a callback.
+func (f Filter) Match(c *Callback) bool {
+	return (f.Since.IsZero() || !c.ReceivedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || c.ReceivedAt.Before(f.Until)) &&
+		(len(f.Operations) == 0 || slices.Contains(f.Operations, string(c.Kind)) ||
+			(c.Operation != "" && slices.Contains(f.Operations, c.Operation))) &&
+		(len(f.ResultCodes) == 0 || slices.Contains(f.ResultCodes, c.Code))
+}
+
+// FromStore loads the callbacks of a store selected by the filter, oldest first. The
+// operation of each callback is the one of the request record sharing its identifiers.
+// The records that cannot be replayed, such as the ones without a raw payload (see
+// ErrNoRawPayload), are reported in the error and the other callbacks are returned.
+func FromStore(ctx context.Context, s store.Store, f Filter) ([]*Callback, error) {
+	records, err := s.Find(ctx, store.Query{Kind: store.KindCallback, Since: f.Since, Until: f.Until})
+	if err != nil {
+		return nil, err
+	}
+
+	var callbacks []*Callback
+	var errs []error
+	for _, rec := range records {
+		source := "store:" + strconv.FormatInt(rec.ID, 10)
+		if len(rec.Raw) == 0 {
+			errs = append(errs, fmt.Errorf("%v: %w", source, ErrNoRawPayload))
+			continue
+		}
+		c, err := Parse(rec.Raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", source, err))
+			continue
+		}
+		c.Source, c.ReceivedAt = source, rec.CreatedAt
+		if c.Operation, err = operation(ctx, s, c.Keys); err != nil {
+			return nil, err
+		}
+		if f.Match(c) {
+			callbacks = append(callbacks, c)
+		}
+	}
+	return callbacks, errors.Join(errs...)
+}
+
+// operation: returns the operation of the request record sharing an identifier with keys.
+func operation(ctx context.Context, s store.Store, keys store.Keys) (string, error) {
+	for _, key := range []store.Keys{
+		{OriginatorConversationID: keys.OriginatorConversationID},
+		{MerchantRequestID: keys.MerchantRequestID},
+		{CheckoutRequestID: keys.CheckoutRequestID},
+	} {
+		if key == (store.Keys{}) {
+			continue
+		}
+		found, err := s.Find(ctx, store.Query{Keys: key, Kind: store.KindRequest, Limit: 1})
+		if err != nil {
+			return "", err
+		}
+		if len(found) > 0 {
+			return found[0].Operation, nil
+		}
+	}
+	return "", nil
+}
+
+// FromFiles loads the callbacks of files holding one raw payload each, selected by the
+// filter and sorted by reception time, the modification time of the files. A directory
+// stands for its .json files. The files that are not callbacks are reported in the
+// error and the other callbacks are returned.
+func FromFiles(f Filter, paths ...string) ([]*Callback, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	var callbacks []*Callback
+	var errs []error
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		c, err := Parse(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", file, err))
+			continue
+		}
+		c.Source, c.ReceivedAt = file, info.ModTime()
+		if f.Match(c) {
+			callbacks = append(callbacks, c)
+		}
+	}
+	sort.SliceStable(callbacks, func(i, j int) bool {
+		if !callbacks[i].ReceivedAt.Equal(callbacks[j].ReceivedAt) {
+			return callbacks[i].ReceivedAt.Before(callbacks[j].ReceivedAt)
+		}
+		return callbacks[i].Source < callbacks[j].Source
+	})
+	return callbacks, errors.Join(errs...)
+}
+
+// Outcome is the result of the replay of a callback.
+//
+// Fields:
+//   - Callback: The replayed callback.
+//   - Status: The HTTP status answered by the handler or the URL, 0 when not sent.
+//   - Error: Why the callback was not delivered or was refused.
+//   - DryRun: Whether the callback was only listed.
+type Outcome struct {
+	Callback *Callback `json:"callback"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	DryRun   bool      `json:"dry_run,omitempty"`
+}
+
+// Delivered reports whether the callback was accepted, with a 2xx status.
+func (o Outcome) Delivered() bool {
+	return o.Status >= 200 && o.Status < 300
+}
+
+// Replayer sends callbacks to a handler or a URL.
+//
+// Fields:
+//   - Handler: Receives the callbacks when set, such as a callback.Handlers.
+//   - URL: Receives the callbacks with a POST when Handler is nil.
+//   - Client: Sends the callbacks to URL, http.DefaultClient when nil.
+//   - DryRun: Lists the callbacks without sending them.
+type Replayer struct {
+	Handler http.Handler
+	URL     string
+	Client  *http.Client
+	DryRun  bool
+}
+
+// Replay sends the callbacks in order and returns the outcome of each. A callback that
+// is refused does not stop the replay, the error is only returned when the replayer has
+// no target or ctx is done.
+func (r *Replayer) Replay(ctx context.Context, callbacks []*Callback) ([]Outcome, error) {
+	if !r.DryRun && r.Handler == nil && r.URL == "" {
+		return nil, errors.New("replay: no handler or url to send the callbacks to")
+	}
+
+	outcomes := make([]Outcome, 0, len(callbacks))
+	for _, c := range callbacks {
+		if err := ctx.Err(); err != nil {
+			return outcomes, err
+		}
+		o := Outcome{Callback: c, DryRun: r.DryRun}
+		if !r.DryRun {
+			var err error
+			if o.Status, err = r.send(ctx, c.Payload.Raw()); err != nil {
+				o.Error = err.Error()
+			} else if !o.Delivered() {
+				o.Error = fmt.Sprintf("refused with status %d", o.Status)
+			}
+		}
+		outcomes = append(outcomes, o)
+	}
+	return outcomes, nil
+}
+
+// send: posts a raw payload to the handler or the URL and returns the HTTP status.
+func (r *Replayer) send(ctx context.Context, raw []byte) (int, error) {
+	target := r.URL
+	if r.Handler != nil {
+		target = "/"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(raw))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if r.Handler != nil {
+		w := &recorder{header: http.Header{}}
+		r.Handler.ServeHTTP(w, req)
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		return w.status, nil
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+// recorder: the http.ResponseWriter given to a Handler, only the status is kept.
+type recorder struct {
+	header http.Header
+	status int
+}
+
+func (w *recorder) Header() http.Header { return w.header }
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *recorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
@@ -0,0 +1,201 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the payloads keep the spacing and key order of M-Pesa, a replay must not change them
+const (
+	b2cResult = `{"Result":{"ResultType":0,"ResultCode":0,"ResultDesc":"The service request is processed successfully.",
+  "OriginatorConversationID":"occ-1","ConversationID":"AG_1","TransactionID":"RKT0000001",
+  "ResultParameters":{"ResultParameter":[{"Key":"ReceiverPartyPublicName","Value":"251712345678 - Abebe Kebede"}]}}}`
+	reversalResult = `{"Result":{"ResultType":0,"ResultCode":2001,"ResultDesc":"The initiator information is invalid.",
+  "OriginatorConversationID":"occ-2","ConversationID":"AG_2","TransactionID":"RKT0000002"}}`
+	stkCallback = `{"Body":{"stkCallback":{"MerchantRequestID":"m-1","CheckoutRequestID":"ws_CO_1","ResultCode":1032,
+  "ResultDesc":"Request cancelled by user"}}}`
+)
+
+var at = time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+
+// seed: records the requests and, with store.RawHandler, the callbacks one second apart.
+func seed(t *testing.T) store.Store {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	require.NoError(t, s.Save(ctx, &store.Record{Kind: store.KindRequest, Operation: "b2c_payment",
+		Keys: store.Keys{OriginatorConversationID: "occ-1"}, CreatedAt: at.Add(-time.Minute)}))
+	require.NoError(t, s.Save(ctx, &store.Record{Kind: store.KindRequest, Operation: "transaction_reversal",
+		Keys: store.Keys{OriginatorConversationID: "occ-2"}, CreatedAt: at.Add(-time.Minute)}))
+
+	for i, raw := range []string{b2cResult, reversalResult, stkCallback} {
+		rec, err := store.CallbackRecord([]byte(raw), nil)
+		require.NoError(t, err)
+		rec.Raw, rec.CreatedAt = []byte(raw), at.Add(time.Duration(i)*time.Second)
+		require.NoError(t, s.Save(ctx, rec))
+	}
+	return s
+}
+
+func sources(callbacks []*Callback) []string {
+	var out []string
+	for _, c := range callbacks {
+		out = append(out, c.Source)
+	}
+	return out
+}
+
+func TestFromStore(t *testing.T) {
+	s := seed(t)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all", Filter{}, []string{"store:3", "store:4", "store:5"}},
+		{"since", Filter{Since: at.Add(time.Second)}, []string{"store:4", "store:5"}},
+		{"until", Filter{Until: at.Add(time.Second)}, []string{"store:3"}},
+		{"request operation", Filter{Operations: []string{"transaction_reversal"}}, []string{"store:4"}},
+		{"callback kind", Filter{Operations: []string{"stk"}}, []string{"store:5"}},
+		{"result code", Filter{ResultCodes: []string{"0", "1032"}}, []string{"store:3", "store:5"}},
+		{"every condition", Filter{Operations: []string{"result"}, ResultCodes: []string{"0"}, Since: at}, []string{"store:3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callbacks, err := FromStore(context.Background(), s, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sources(callbacks))
+		})
+	}
+
+	callbacks, err := FromStore(context.Background(), s, Filter{Operations: []string{"b2c_payment"}})
+	require.NoError(t, err)
+	require.Len(t, callbacks, 1)
+	c := callbacks[0]
+	assert.Equal(t, callback.KindResult, c.Kind)
+	assert.Equal(t, "b2c_payment", c.Operation)
+	assert.Equal(t, "0", c.Code)
+	assert.Equal(t, store.Keys{OriginatorConversationID: "occ-1", ConversationID: "AG_1", TransactionID: "RKT0000001"}, c.Keys)
+	assert.True(t, at.Equal(c.ReceivedAt))
+	assert.IsType(t, &callback.Result{}, c.Payload)
+
+	t.Run("redacted records", func(t *testing.T) {
+		redacted := store.NewMemoryStore()
+		rec := httptest.NewRecorder()
+		store.Handler(redacted, nil, callback.Handlers{}).ServeHTTP(rec,
+			httptest.NewRequest(http.MethodPost, "/result", strings.NewReader(b2cResult)))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		callbacks, err := FromStore(context.Background(), redacted, Filter{})
+		assert.ErrorIs(t, err, ErrNoRawPayload)
+		assert.Empty(t, callbacks)
+	})
+}
+
+func TestFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i, raw := range []string{stkCallback, b2cResult, `{"hello":"world"}`} {
+		path := filepath.Join(dir, []string{"a.json", "b.json", "c.json"}[i])
+		require.NoError(t, os.WriteFile(path, []byte(raw), 0o600))
+		// b.json was received first
+		mtime := at.Add(time.Duration(1-i) * time.Second)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a callback"), 0o600))
+
+	callbacks, err := FromFiles(Filter{}, dir)
+	assert.ErrorContains(t, err, "c.json", "the other payloads are reported")
+	assert.Equal(t, []string{filepath.Join(dir, "b.json"), filepath.Join(dir, "a.json")}, sources(callbacks))
+
+	callbacks, err = FromFiles(Filter{ResultCodes: []string{"1032"}}, filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "a.json")}, sources(callbacks))
+
+	_, err = FromFiles(Filter{}, filepath.Join(dir, "missing.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReplayer(t *testing.T) {
+	callbacks, err := FromStore(context.Background(), seed(t), Filter{})
+	require.NoError(t, err)
+
+	t.Run("handler", func(t *testing.T) {
+		var received [][]byte
+		r := &Replayer{Handler: callback.Handlers{
+			OnResult: func(_ context.Context, res *callback.Result) error {
+				received = append(received, res.Raw())
+				if res.Result.ResultCode != callback.Success {
+					return errors.New("consumer bug")
+				}
+				return nil
+			},
+			OnSTK: func(_ context.Context, cb *callback.STKCallback) error {
+				received = append(received, cb.Raw())
+				return nil
+			},
+		}}
+		outcomes, err := r.Replay(context.Background(), callbacks)
+		require.NoError(t, err)
+		require.Len(t, outcomes, 3)
+		assert.Equal(t, [][]byte{[]byte(b2cResult), []byte(reversalResult), []byte(stkCallback)}, received, "the bytes are unchanged")
+		assert.True(t, outcomes[0].Delivered())
+		assert.Equal(t, http.StatusInternalServerError, outcomes[1].Status)
+		assert.Equal(t, "refused with status 500", outcomes[1].Error)
+		assert.True(t, outcomes[2].Delivered())
+	})
+
+	t.Run("url", func(t *testing.T) {
+		var mu sync.Mutex
+		var bodies []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			bodies = append(bodies, string(body))
+			mu.Unlock()
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		}))
+		defer srv.Close()
+
+		outcomes, err := (&Replayer{URL: srv.URL + "/mpesa/callbacks"}).Replay(context.Background(), callbacks)
+		require.NoError(t, err)
+		for _, o := range outcomes {
+			assert.Equal(t, http.StatusOK, o.Status)
+		}
+		assert.Equal(t, []string{b2cResult, reversalResult, stkCallback}, bodies)
+
+		srv.Close()
+		outcomes, err = (&Replayer{URL: srv.URL}).Replay(context.Background(), callbacks[:1])
+		require.NoError(t, err)
+		assert.False(t, outcomes[0].Delivered())
+		assert.NotEmpty(t, outcomes[0].Error)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		called := false
+		r := &Replayer{DryRun: true, Handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true })}
+		outcomes, err := r.Replay(context.Background(), callbacks)
+		require.NoError(t, err)
+		require.Len(t, outcomes, 3)
+		assert.True(t, outcomes[0].DryRun)
+		assert.Zero(t, outcomes[0].Status)
+		assert.False(t, called)
+	})
+
+	t.Run("no target", func(t *testing.T) {
+		_, err := (&Replayer{}).Replay(context.Background(), callbacks)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,402 @@
+// Package statement parses the transaction statements exported as CSV by the M-Pesa
+// organization portal.
+//
+// A statement starts with a few lines describing the organization (`Organization Name`,
+// `Short Code`...) followed by a table with a line per transaction: `Receipt No.`,
+// `Completion Time`, `Details`, `Transaction Status`, `Paid In`, `Withdrawn`, `Balance`,
+// `Other Party Info`... The entries convert to the types of the callback package, so a
+// statement can replace the C2B confirmations that never arrived or answer a
+// reconciliation without a status query.
+//
+// Example usage:
+//
+//	f, _ := os.Open("statement.csv")
+//	st, err := statement.Parse(f)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	for _, confirmation := range st.Confirmations() {
+//		if !seen(confirmation.TransID) {
+//			handleConfirmation(ctx, confirmation)
+//		}
+//	}
+package statement
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/c2b"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
+)
+
+// StatusCompleted is the status of a completed transaction.
+const StatusCompleted = "Completed"
+
+// timeLayouts: the layouts of the times of a statement, depending on the export.
+var timeLayouts = []string{
+	"02-01-2006 15:04:05",
+	"2006-01-02 15:04:05",
+	"02/01/2006 15:04:05",
+	"2006/01/02 15:04:05",
+	"02-01-2006 15:04",
+	"2006-01-02 15:04",
+	"20060102150405",
+}
+
+// columns: the columns of the transaction table, keyed by their lowercase header
+// without the trailing period.
+var columns = map[string]string{
+	"receipt no":            "ReceiptNo",
+	"completion time":       "CompletionTime",
+	"initiation time":       "InitiationTime",
+	"details":               "Details",
+	"transaction status":    "Status",
+	"paid in":               "PaidIn",
+	"withdrawn":             "Withdrawn",
+	"balance":               "Balance",
+	"balance confirmed":     "BalanceConfirmed",
+	"reason type":           "ReasonType",
+	"other party info":      "OtherParty",
+	"linked transaction id": "LinkedTransactionID",
+	"a/c no":                "AccountNo",
+}
+
+// Entry is a transaction of a statement.
+//
+// Fields:
+//   - ReceiptNo: The M-Pesa receipt, the TransID of the C2B confirmation.
+//   - CompletionTime, InitiationTime: When the transaction completed and started.
+//   - Details: The description of the transaction, such as `Pay Bill from 2517... - NAME Acc. 123`.
+//   - Status: The status of the transaction, such as StatusCompleted.
+//   - PaidIn, Withdrawn: The amounts credited and debited, Withdrawn is positive even when
+//     the export writes it negative.
+//   - Balance: The balance of the organization account after the transaction.
+//   - BalanceConfirmed: Whether the portal marked the balance as confirmed.
+//   - ReasonType: The type of transaction, such as `Pay Bill Online` or `Salary Payment`.
+//   - OtherParty: The other party, `251712345678 - ABEBE KEBEDE` for customers.
+//   - LinkedTransactionID: The transaction this one relates to, such as a reversed transaction.
+//   - AccountNo: The account number entered by the customer.
+type Entry struct {
+	ReceiptNo           string       `json:"receipt_no"`
+	CompletionTime      time.Time    `json:"completion_time"`
+	InitiationTime      time.Time    `json:"initiation_time,omitempty"`
+	Details             string       `json:"details,omitempty"`
+	Status              string       `json:"status,omitempty"`
+	PaidIn              money.Amount `json:"paid_in"`
+	Withdrawn           money.Amount `json:"withdrawn"`
+	Balance             money.Amount `json:"balance"`
+	BalanceConfirmed    bool         `json:"balance_confirmed,omitempty"`
+	ReasonType          string       `json:"reason_type,omitempty"`
+	OtherParty          string       `json:"other_party,omitempty"`
+	LinkedTransactionID string       `json:"linked_transaction_id,omitempty"`
+	AccountNo           string       `json:"account_no,omitempty"`
+}
+
+// Completed reports whether the transaction completed.
+func (e Entry) Completed() bool {
+	return strings.EqualFold(e.Status, StatusCompleted)
+}
+
+// Amount returns the amount of the transaction, PaidIn for a credit and Withdrawn for a debit.
+func (e Entry) Amount() money.Amount {
+	if !e.PaidIn.IsZero() {
+		return e.PaidIn
+	}
+	return e.Withdrawn
+}
+
+// Party splits OtherParty into the normalized phone number of a customer and its name.
+// The number is empty when the other party is not a customer, such as an organization.
+func (e Entry) Party() (number, name string) {
+	id, rest, found := strings.Cut(e.OtherParty, " - ")
+	if !found {
+		return "", strings.TrimSpace(e.OtherParty)
+	}
+	if m, err := msisdn.Normalize(id); err == nil {
+		return m, strings.TrimSpace(rest)
+	}
+	return "", strings.TrimSpace(e.OtherParty)
+}
+
+// Confirmation converts a completed credit to the C2B confirmation M-Pesa sends for it,
+// it returns false for the other entries. The customer name is split on spaces into
+// FirstName, MiddleName and LastName.
+func (e Entry) Confirmation(shortCode string) (*callback.C2BConfirmation, bool) {
+	if !e.Completed() || e.PaidIn.Sign() <= 0 {
+		return nil, false
+	}
+	number, name := e.Party()
+	c := &callback.C2BConfirmation{
+		TransactionType:   e.ReasonType,
+		TransID:           e.ReceiptNo,
+		TransTime:         e.CompletionTime.Format(c2b.TimestampLayout),
+		TransAmount:       e.PaidIn,
+		BusinessShortCode: shortCode,
+		BillRefNumber:     e.AccountNo,
+		OrgAccountBalance: e.Balance,
+		MSISDN:            number,
+	}
+	names := strings.Fields(name)
+	switch {
+	case len(names) == 1:
+		c.FirstName = names[0]
+	case len(names) == 2:
+		c.FirstName, c.LastName = names[0], names[1]
+	case len(names) > 2:
+		c.FirstName, c.MiddleName, c.LastName = names[0], strings.Join(names[1:len(names)-1], " "), names[len(names)-1]
+	}
+	return c, true
+}
+
+// StatusResult converts the entry to the Result of a transaction status query for its
+// receipt, with the `ReceiptNo`, `Amount`, `TransactionStatus`, `FinalisedTime` and
+// `ReasonType` parameters, so that it can be checked like a queried transaction (see
+// reconcile.Classify).
+func (e Entry) StatusResult() *callback.Result {
+	res := &callback.Result{}
+	res.Result.ResultCode = callback.Success
+	res.Result.ResultDesc = "Statement entry"
+	res.Result.TransactionID = e.ReceiptNo
+	res.SetParameter("ReceiptNo", callback.StringValue(e.ReceiptNo))
+	res.SetParameter("Amount", callback.AmountValue(e.Amount()))
+	res.SetParameter("TransactionStatus", callback.StringValue(e.Status))
+	res.SetParameter("FinalisedTime", callback.StringValue(e.CompletionTime.Format(c2b.TimestampLayout)))
+	res.SetParameter("ReasonType", callback.StringValue(e.ReasonType))
+	if e.PaidIn.IsZero() {
+		res.SetParameter("CreditPartyName", callback.StringValue(e.OtherParty))
+	} else {
+		res.SetParameter("DebitPartyName", callback.StringValue(e.OtherParty))
+	}
+	return res
+}
+
+// Statement is a parsed statement.
+//
+// Fields:
+//   - Organization, ShortCode: The account holder, from the lines before the table.
+//   - Info: Every `key,value` line before the table, such as `Time Period`.
+//   - Entries: The transactions, in the order of the file.
+type Statement struct {
+	Organization string
+	ShortCode    string
+	Info         map[string]string
+	Entries      []Entry
+}
+
+// Find returns the entry of a receipt.
+func (s *Statement) Find(receiptNo string) (Entry, bool) {
+	for _, e := range s.Entries {
+		if e.ReceiptNo == receiptNo {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Confirmations returns the C2B confirmations of the completed credits, see Entry.Confirmation.
+func (s *Statement) Confirmations() []*callback.C2BConfirmation {
+	var out []*callback.C2BConfirmation
+	for _, e := range s.Entries {
+		if c, ok := e.Confirmation(s.ShortCode); ok {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Parser reads statements.
+//
+// Fields:
+//   - Comma: The separator of the file, a comma when zero.
+//   - Location: The time zone of the times of the file, East Africa Time when nil.
+type Parser struct {
+	Comma    rune
+	Location *time.Location
+}
+
+// Parse reads a statement with the default Parser.
+func Parse(r io.Reader) (*Statement, error) {
+	return Parser{}.Parse(r)
+}
+
+// Parse reads a statement.
+//
+// Parameters:
+//   - r: The exported file.
+//
+// Returns:
+//   - *Statement: The statement.
+//   - error: An error naming the line of an invalid entry, or when the file has no
+//     transaction table.
+func (p Parser) Parse(r io.Reader) (*Statement, error) {
+	cr := csv.NewReader(bufio.NewReader(r))
+	if p.Comma != 0 {
+		cr.Comma = p.Comma
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	loc := p.Location
+	if loc == nil {
+		loc = time.FixedZone("EAT", 3*60*60)
+	}
+
+	st := &Statement{Info: map[string]string{}}
+	var header map[string]int
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if blank(record) {
+			continue
+		}
+		if header == nil {
+			if header = tableHeader(record); header == nil {
+				st.info(record)
+			}
+			continue
+		}
+
+		entry, err := parseEntry(header, record, loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if entry.ReceiptNo == "" {
+			continue // a total or a footer
+		}
+		st.Entries = append(st.Entries, entry)
+	}
+	if header == nil {
+		return nil, errors.New("the statement has no transaction table, a `Receipt No.` column is expected")
+	}
+	return st, nil
+}
+
+// info: records a line before the table, such as `Short Code:,600000`.
+func (s *Statement) info(record []string) {
+	key := strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(record[0], "\uFEFF")), ":")
+	var value string
+	for _, cell := range record[1:] {
+		if cell = strings.TrimSpace(cell); cell != "" {
+			value = cell
+			break
+		}
+	}
+	if key == "" || value == "" {
+		return
+	}
+	s.Info[key] = value
+	switch strings.ToLower(key) {
+	case "short code", "shortcode", "organization short code", "organisation short code":
+		s.ShortCode = value
+	case "organization name", "organisation name", "account holder":
+		s.Organization = value
+	}
+}
+
+// tableHeader: returns the position of the known columns when record is the header of
+// the transaction table, nil otherwise.
+func tableHeader(record []string) map[string]int {
+	header := map[string]int{}
+	for i, cell := range record {
+		name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(cell, "\uFEFF")), "."))
+		if field, ok := columns[name]; ok {
+			header[field] = i
+		}
+	}
+	if _, ok := header["ReceiptNo"]; !ok {
+		return nil
+	}
+	return header
+}
+
+// parseEntry: reads a line of the transaction table.
+func parseEntry(header map[string]int, record []string, loc *time.Location) (Entry, error) {
+	cell := func(field string) string {
+		if i, ok := header[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	e := Entry{
+		ReceiptNo:           cell("ReceiptNo"),
+		Details:             cell("Details"),
+		Status:              cell("Status"),
+		ReasonType:          cell("ReasonType"),
+		OtherParty:          cell("OtherParty"),
+		LinkedTransactionID: cell("LinkedTransactionID"),
+		AccountNo:           cell("AccountNo"),
+	}
+	if e.ReceiptNo == "" {
+		return e, nil
+	}
+	switch strings.ToLower(cell("BalanceConfirmed")) {
+	case "true", "yes", "y", "1":
+		e.BalanceConfirmed = true
+	}
+
+	var err error
+	if e.CompletionTime, err = parseTime(cell("CompletionTime"), loc); err != nil {
+		return e, fmt.Errorf("Completion Time: %w", err)
+	}
+	if e.InitiationTime, err = parseTime(cell("InitiationTime"), loc); err != nil {
+		return e, fmt.Errorf("Initiation Time: %w", err)
+	}
+	if e.PaidIn, err = parseAmount(cell("PaidIn")); err != nil {
+		return e, fmt.Errorf("Paid In: %w", err)
+	}
+	if e.Withdrawn, err = parseAmount(cell("Withdrawn")); err != nil {
+		return e, fmt.Errorf("Withdrawn: %w", err)
+	}
+	if e.Withdrawn.Sign() < 0 {
+		e.Withdrawn, _ = money.Zero.Sub(e.Withdrawn)
+	}
+	if e.Balance, err = parseAmount(cell("Balance")); err != nil {
+		return e, fmt.Errorf("Balance: %w", err)
+	}
+	return e, nil
+}
+
+// parseTime: parses a time in one of the timeLayouts, an empty cell is the zero time.
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// parseAmount: parses an amount, an empty cell is zero.
+func parseAmount(s string) (money.Amount, error) {
+	if s == "" {
+		return money.Zero, nil
+	}
+	return money.Parse(s)
+}
+
+// blank: reports whether every cell of a record is empty.
+func blank(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package statement
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/reconcile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const export = "\uFEFFOrganization Name:,Addis Coffee PLC\n" +
+	"Short Code:,600000\n" +
+	"Time Period:,01-10-2024 - 31-10-2024\n" +
+	"\n" +
+	"Receipt No.,Completion Time,Initiation Time,Details,Transaction Status,Paid In,Withdrawn,Balance,Balance Confirmed,Reason Type,Other Party Info,Linked Transaction ID,A/C No.\n" +
+	"RJ51A2B3C4,05-10-2024 14:03:22,05-10-2024 14:03:20,Pay Bill from 251712345678 - ABEBE KEBEDE DEMISSIE Acc. INV-001,Completed,\"1,250.00\",,\"51,250.00\",true,Pay Bill Online,251712345678 - ABEBE KEBEDE DEMISSIE,,INV-001\n" +
+	"RJ51A2B3C5,05-10-2024 15:10:00,05-10-2024 15:09:58,Salary Payment to 251712345679 - ALMAZ TESFAYE,Completed,,-500.50,\"50,749.50\",true,Salary Payment,251712345679 - ALMAZ TESFAYE,,\n" +
+	"RJ51A2B3C6,06-10-2024 09:00:00,,Pay Bill from 251712345680 - SARA,Failed,300.00,,\"50,749.50\",false,Pay Bill Online,251712345680 - SARA,,INV-002\n" +
+	",,,Total,,\"1,550.00\",500.50,,,,,,\n"
+
+func TestParse(t *testing.T) {
+	st, err := Parse(strings.NewReader(export))
+	require.NoError(t, err)
+	assert.Equal(t, "Addis Coffee PLC", st.Organization)
+	assert.Equal(t, "600000", st.ShortCode)
+	assert.Equal(t, "01-10-2024 - 31-10-2024", st.Info["Time Period"])
+	require.Len(t, st.Entries, 3)
+
+	credit := st.Entries[0]
+	assert.Equal(t, "RJ51A2B3C4", credit.ReceiptNo)
+	assert.Equal(t, time.Date(2024, 10, 5, 11, 3, 22, 0, time.UTC), credit.CompletionTime.UTC())
+	assert.Equal(t, money.Birr(1250), credit.PaidIn)
+	assert.Equal(t, money.Zero, credit.Withdrawn)
+	assert.Equal(t, money.Birr(51250), credit.Balance)
+	assert.True(t, credit.BalanceConfirmed)
+	assert.True(t, credit.Completed())
+	assert.Equal(t, "INV-001", credit.AccountNo)
+
+	debit := st.Entries[1]
+	assert.Equal(t, money.Santim(50050), debit.Withdrawn)
+	assert.Equal(t, money.Santim(50050), debit.Amount())
+	number, name := debit.Party()
+	assert.Equal(t, "251712345679", number)
+	assert.Equal(t, "ALMAZ TESFAYE", name)
+
+	assert.True(t, st.Entries[2].InitiationTime.IsZero())
+	assert.False(t, st.Entries[2].Completed())
+
+	_, ok := st.Find("RJ51A2B3C5")
+	assert.True(t, ok)
+}
+
+func TestStatement_Confirmations(t *testing.T) {
+	st, err := Parse(strings.NewReader(export))
+	require.NoError(t, err)
+
+	confirmations := st.Confirmations()
+	require.Len(t, confirmations, 1, "only the completed credits")
+	assert.Equal(t, &callback.C2BConfirmation{
+		TransactionType:   "Pay Bill Online",
+		TransID:           "RJ51A2B3C4",
+		TransTime:         "20241005140322",
+		TransAmount:       money.Birr(1250),
+		BusinessShortCode: "600000",
+		BillRefNumber:     "INV-001",
+		OrgAccountBalance: money.Birr(51250),
+		MSISDN:            "251712345678",
+		FirstName:         "ABEBE",
+		MiddleName:        "KEBEDE",
+		LastName:          "DEMISSIE",
+	}, confirmations[0])
+}
+
+func TestEntry_StatusResult(t *testing.T) {
+	st, err := Parse(strings.NewReader(export))
+	require.NoError(t, err)
+
+	debit, _ := st.Find("RJ51A2B3C5")
+	outcome := reconcile.Classify(reconcile.Record{ID: "emp-02", TransactionID: "RJ51A2B3C5", Amount: money.Santim(50050)}, debit.StatusResult())
+	assert.Equal(t, reconcile.ClassMatched, outcome.Class)
+
+	failed, _ := st.Find("RJ51A2B3C6")
+	outcome = reconcile.Classify(reconcile.Record{ID: "inv-002", Amount: money.Birr(300)}, failed.StatusResult())
+	assert.Equal(t, reconcile.ClassMissing, outcome.Class)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"No table", "Short Code:,600000\n", "no transaction table"},
+		{"Invalid time", "Receipt No.,Completion Time,Paid In\nRJ1,yesterday,10\n", "line 2: Completion Time: invalid time"},
+		{"Invalid amount", "Receipt No.,Completion Time,Paid In\nRJ1,2024-10-05 14:03:22,ten\n", "line 2: Paid In: invalid amount"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.file))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/coleYab/mpesagosdk/redact"
+)
+
+// CallbackRecord builds the record of a raw callback payload, its body is redacted with
+// r (redact.Default() when nil).
+func CallbackRecord(raw []byte, r *redact.Redactor) (*Record, error) {
+	kind, err := callback.DetectKind(raw)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		r = redact.Default()
+	}
+
+	rec := &Record{Kind: KindCallback, Operation: string(kind), Body: r.JSON(raw)}
+	switch kind {
+	case callback.KindResult:
+		res, err := callback.ParseResult(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		rec.Keys = Keys{
+			OriginatorConversationID: res.Result.OriginatorConversationID,
+			ConversationID:           res.Result.ConversationID,
+			TransactionID:            res.Result.TransactionID,
+		}
+		rec.Code = string(res.Result.ResultCode)
+	case callback.KindSTK:
+		cb, err := callback.ParseSTKCallback(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		body := cb.Body.StkCallback
+		rec.Keys = Keys{MerchantRequestID: body.MerchantRequestID, CheckoutRequestID: body.CheckoutRequestID}
+		if receipt, ok := cb.Metadata("MpesaReceiptNumber"); ok {
+			rec.Keys.TransactionID = receipt.String()
+		}
+		rec.Code = string(body.ResultCode)
+	case callback.KindConfirmation:
+		c, err := callback.ParseC2BConfirmation(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		rec.Keys = Keys{TransactionID: c.TransID}
+	}
+	return rec, nil
+}
+
+// Handler records the callbacks in s before passing them to next, such as a
+// callback.Handlers. Payloads that are not callbacks are passed to next without being
+// recorded. A callback that cannot be saved is answered with a 500 so that M-Pesa sends
+// it again.
+//
+// Parameters:
+//   - s: The store of the callbacks.
+//   - r: The redactor of the payloads, redact.Default() when nil.
+//   - next: The handler of the callbacks.
+func Handler(s Store, r *redact.Redactor, next http.Handler) http.Handler {
+	return handler(s, r, false, next)
+}
+
+// RawHandler works like Handler but also keeps the exact bytes of every callback in
+// Record.Raw, so that the callbacks can be replayed as M-Pesa sent them (see the replay
+// package). The raw payloads are not redacted, the store must be protected accordingly.
+func RawHandler(s Store, r *redact.Redactor, next http.Handler) http.Handler {
+	return handler(s, r, true, next)
+}
+
+// handler: records the callbacks, with their raw bytes when keepRaw is set.
+func handler(s Store, r *redact.Redactor, keepRaw bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			next.ServeHTTP(w, req)
+			return
+		}
+		raw, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			http.Error(w, "unable to read the callback", http.StatusBadRequest)
+			return
+		}
+		if rec, err := CallbackRecord(raw, r); err == nil {
+			if keepRaw {
+				rec.Raw = raw
+			}
+			if err := s.Save(req.Context(), rec); err != nil {
+				writeRejected(w)
+				return
+			}
+		}
+		req.Body = io.NopCloser(bytes.NewReader(raw))
+		next.ServeHTTP(w, req)
+	})
+}
+
+// writeRejected: answers a callback that could not be recorded.
+func writeRejected(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = json.NewEncoder(w).Encode(callback.Acknowledgement{ResultCode: 1, ResultDesc: "Rejected"})
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store keeping the records in memory, for tests and single process
+// applications that do not need the records after a restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+// NewMemoryStore creates an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Save stores a copy of the record.
+func (m *MemoryStore) Save(_ context.Context, r *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.ID = int64(len(m.records) + 1)
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	saved := *r
+	saved.Body = append([]byte(nil), r.Body...)
+	saved.Raw = append([]byte(nil), r.Raw...)
+	m.records = append(m.records, saved)
+	return nil
+}
+
+// Find returns copies of the records selected by the query, oldest first.
+func (m *MemoryStore) Find(_ context.Context, q Query) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Record
+	for i := range m.records {
+		if q.matches(&m.records[i]) {
+			r := m.records[i]
+			r.Body = append([]byte(nil), r.Body...)
+			r.Raw = append([]byte(nil), r.Raw...)
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Dialect describes the SQL differences between databases.
+//
+// Fields:
+//   - Name: The name of the database, only informative.
+//   - Placeholder: Returns the n-th (from 1) bind parameter of a statement.
+//   - PrimaryKey: The definition of an auto incremented integer primary key column.
+//   - Text: The column type of unbounded text.
+//   - Returning: Whether the ID of an inserted row is read with RETURNING instead of LastInsertId.
+type Dialect struct {
+	Name        string
+	Placeholder func(n int) string
+	PrimaryKey  string
+	Text        string
+	Returning   bool
+}
+
+var (
+	// SQLite is the dialect of SQLite, such as modernc.org/sqlite or github.com/mattn/go-sqlite3.
+	SQLite = Dialect{Name: "sqlite", Placeholder: question, PrimaryKey: "INTEGER PRIMARY KEY AUTOINCREMENT", Text: "TEXT"}
+	// Postgres is the dialect of PostgreSQL, such as github.com/jackc/pgx or github.com/lib/pq.
+	Postgres = Dialect{Name: "postgres", Placeholder: dollar, PrimaryKey: "BIGSERIAL PRIMARY KEY", Text: "TEXT", Returning: true}
+	// MySQL is the dialect of MySQL and MariaDB, such as github.com/go-sql-driver/mysql.
+	MySQL = Dialect{Name: "mysql", Placeholder: question, PrimaryKey: "BIGINT AUTO_INCREMENT PRIMARY KEY", Text: "LONGTEXT"}
+)
+
+func question(int) string { return "?" }
+
+func dollar(n int) string { return fmt.Sprintf("$%d", n) }
+
+// DefaultTable is the table of the records when SQLStore.Table is not set.
+const DefaultTable = "mpesa_records"
+
+// migrations: the schema changes of the records table, in order.
+var migrations = []Migration{
+	func(d Dialect, table string) []string {
+		stmts := []string{fmt.Sprintf(`CREATE TABLE %[1]s (
+	id %[2]s,
+	kind VARCHAR(16) NOT NULL,
+	operation VARCHAR(64) NOT NULL,
+	originator_conversation_id VARCHAR(255) NOT NULL,
+	conversation_id VARCHAR(255) NOT NULL,
+	merchant_request_id VARCHAR(255) NOT NULL,
+	checkout_request_id VARCHAR(255) NOT NULL,
+	transaction_id VARCHAR(255) NOT NULL,
+	code VARCHAR(64) NOT NULL,
+	error %[3]s,
+	body %[3]s,
+	created_at BIGINT NOT NULL
+)`, table, d.PrimaryKey, d.Text)}
+		for _, column := range keyColumns {
+			stmts = append(stmts, fmt.Sprintf("CREATE INDEX %[1]s_%[2]s ON %[1]s (%[2]s)", table, column))
+		}
+		return append(stmts, fmt.Sprintf("CREATE INDEX %[1]s_created_at ON %[1]s (created_at)", table))
+	},
+	func(d Dialect, table string) []string {
+		return []string{fmt.Sprintf("ALTER TABLE %v ADD COLUMN raw %v", table, d.Text)}
+	},
+}
+
+// keyColumns: the columns of the Keys, in the order of the struct.
+var keyColumns = []string{"originator_conversation_id", "conversation_id", "merchant_request_id", "checkout_request_id", "transaction_id"}
+
+// SQLStore is a Store keeping the records in a database/sql database. Migrate must be
+// called once before it is used.
+type SQLStore struct {
+	// DB is the database.
+	DB *sql.DB
+	// Dialect is the SQL dialect of the database.
+	Dialect Dialect
+	// Table is the table of the records, DefaultTable when empty. It is used as is in the
+	// statements and must be a valid identifier.
+	Table string
+}
+
+// NewSQLStore creates a store keeping the records in db.
+func NewSQLStore(db *sql.DB, dialect Dialect) *SQLStore {
+	return &SQLStore{DB: db, Dialect: dialect}
+}
+
+// table: returns the table of the records.
+func (s *SQLStore) table() string {
+	if s.Table == "" {
+		return DefaultTable
+	}
+	return s.Table
+}
+
+// Migrate creates or upgrades the tables of the store, see ApplyMigrations.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	return ApplyMigrations(ctx, s.DB, s.Dialect, s.table(), migrations)
+}
+
+// Migration returns the statements of a schema change for a dialect and a table.
+type Migration func(d Dialect, table string) []string
+
+// ApplyMigrations applies the migrations not applied yet to a table, in order. The applied
+// versions are recorded in the table named after it with a "_migrations" suffix. Each
+// migration runs in its own transaction, on databases where DDL is not transactional
+// (MySQL) a migration that fails half way must be fixed by hand.
+func ApplyMigrations(ctx context.Context, db *sql.DB, d Dialect, table string, migrations []Migration) error {
+	versions := table + "_migrations"
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %v (version INTEGER PRIMARY KEY, applied_at BIGINT NOT NULL)", versions)); err != nil {
+		return fmt.Errorf("unable to create the migrations table: %w", err)
+	}
+
+	var current sql.NullInt64
+	if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(version) FROM %v", versions)).Scan(&current); err != nil {
+		return fmt.Errorf("unable to read the schema version: %w", err)
+	}
+
+	for i := int(current.Int64); i < len(migrations); i++ {
+		version := i + 1
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range migrations[i](d, table) {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("migration %d failed: %w", version, err)
+			}
+		}
+		insert := fmt.Sprintf("INSERT INTO %v (version, applied_at) VALUES (%v, %v)",
+			versions, d.Placeholder(1), d.Placeholder(2))
+		if _, err := tx.ExecContext(ctx, insert, version, time.Now().UnixNano()); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// Save inserts the record.
+func (s *SQLStore) Save(ctx context.Context, r *Record) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	columns := append([]string{"kind", "operation"}, keyColumns...)
+	columns = append(columns, "code", "error", "body", "raw", "created_at")
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = s.Dialect.Placeholder(i + 1)
+	}
+	insert := fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)", s.table(), strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	args := []interface{}{string(r.Kind), r.Operation,
+		r.Keys.OriginatorConversationID, r.Keys.ConversationID, r.Keys.MerchantRequestID, r.Keys.CheckoutRequestID, r.Keys.TransactionID,
+		r.Code, r.Error, string(r.Body), nullString(r.Raw), r.CreatedAt.UnixNano()}
+
+	if s.Dialect.Returning {
+		if err := s.DB.QueryRowContext(ctx, insert+" RETURNING id", args...).Scan(&r.ID); err != nil {
+			return fmt.Errorf("unable to save the record: %w", err)
+		}
+		return nil
+	}
+	res, err := s.DB.ExecContext(ctx, insert, args...)
+	if err != nil {
+		return fmt.Errorf("unable to save the record: %w", err)
+	}
+	if r.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("unable to read the ID of the record: %w", err)
+	}
+	return nil
+}
+
+// Find returns the records selected by the query, oldest first.
+func (s *SQLStore) Find(ctx context.Context, q Query) ([]Record, error) {
+	var where []string
+	var args []interface{}
+	add := func(column string, value interface{}) {
+		args = append(args, value)
+		where = append(where, column+" = "+s.Dialect.Placeholder(len(args)))
+	}
+	for i, value := range []string{q.Keys.OriginatorConversationID, q.Keys.ConversationID,
+		q.Keys.MerchantRequestID, q.Keys.CheckoutRequestID, q.Keys.TransactionID} {
+		if value != "" {
+			add(keyColumns[i], value)
+		}
+	}
+	if q.Kind != "" {
+		add("kind", string(q.Kind))
+	}
+	if q.Operation != "" {
+		add("operation", q.Operation)
+	}
+	if !q.Since.IsZero() {
+		args = append(args, q.Since.UnixNano())
+		where = append(where, "created_at >= "+s.Dialect.Placeholder(len(args)))
+	}
+	if !q.Until.IsZero() {
+		args = append(args, q.Until.UnixNano())
+		where = append(where, "created_at < "+s.Dialect.Placeholder(len(args)))
+	}
+
+	query := fmt.Sprintf("SELECT id, kind, operation, %v, code, error, body, raw, created_at FROM %v",
+		strings.Join(keyColumns, ", "), s.table())
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at, id"
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the records: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Record
+	for rows.Next() {
+		var r Record
+		var kind string
+		var errText, body, raw sql.NullString
+		var created int64
+		if err := rows.Scan(&r.ID, &kind, &r.Operation,
+			&r.Keys.OriginatorConversationID, &r.Keys.ConversationID, &r.Keys.MerchantRequestID, &r.Keys.CheckoutRequestID, &r.Keys.TransactionID,
+			&r.Code, &errText, &body, &raw, &created); err != nil {
+			return nil, fmt.Errorf("unable to read a record: %w", err)
+		}
+		r.Kind, r.Error, r.CreatedAt = Kind(kind), errText.String, time.Unix(0, created)
+		if body.String != "" {
+			r.Body = []byte(body.String)
+		}
+		if raw.Valid {
+			r.Raw = []byte(raw.String)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to find the records: %w", err)
+	}
+	return out, nil
+}
+
+// nullString: stores an empty payload as NULL.
+func nullString(b []byte) sql.NullString {
+	return sql.NullString{String: string(b), Valid: len(b) > 0}
+}
@@ -0,0 +1,165 @@
+// Package store persists what the SDK sends and receives: the outbound requests, their
+// synchronous responses and the inbound callbacks. Every record is keyed by the M-Pesa
+// correlation identifiers (OriginatorConversationID, ConversationID, MerchantRequestID,
+// CheckoutRequestID and TransactionID) so that the whole history of a payment can be
+// found from any of them. The bodies are redacted before they are stored.
+//
+// MemoryStore keeps the records in memory, SQLStore keeps them in any database/sql
+// database (SQLite, PostgreSQL, MySQL...).
+//
+// RawHandler also keeps the exact bytes of the callbacks, so that they can be replayed
+// with the replay package.
+//
+// Example usage:
+//
+//	db, err := sql.Open("sqlite", "mpesa.db")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	records := store.NewSQLStore(db, store.SQLite)
+//	if err := records.Migrate(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	app, err := mpesagosdk.New(mpesagosdk.WithConfig(cfg), mpesagosdk.WithStore(records))
+//	http.Handle("/mpesa/callbacks", store.Handler(records, nil, callback.Handlers{OnResult: onResult}))
+//
+//	history, err := records.Find(ctx, store.Query{Keys: store.Keys{TransactionID: "RKT0000001"}})
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/internal/logger"
+)
+
+// Kind is the direction of a record.
+type Kind string
+
+const (
+	// KindRequest is a request sent to M-Pesa.
+	KindRequest Kind = "request"
+	// KindResponse is the synchronous response of a request, or its error.
+	KindResponse Kind = "response"
+	// KindCallback is a callback received from M-Pesa.
+	KindCallback Kind = "callback"
+)
+
+// Keys are the correlation identifiers of a record, empty when unknown.
+type Keys struct {
+	OriginatorConversationID string `json:"originator_conversation_id,omitempty"`
+	ConversationID           string `json:"conversation_id,omitempty"`
+	MerchantRequestID        string `json:"merchant_request_id,omitempty"`
+	CheckoutRequestID        string `json:"checkout_request_id,omitempty"`
+	TransactionID            string `json:"transaction_id,omitempty"`
+}
+
+// KeysOf returns the correlation identifiers of a request or response struct, read from
+// the fields with their M-Pesa (json) name, and its ResponseCode.
+func KeysOf(v interface{}) (Keys, string) {
+	var k Keys
+	var code string
+	attrs := logger.CorrelationAttrs(v)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		value := attrs[i+1].(string)
+		switch attrs[i] {
+		case "OriginatorConversationID":
+			k.OriginatorConversationID = value
+		case "ConversationID":
+			k.ConversationID = value
+		case "MerchantRequestID":
+			k.MerchantRequestID = value
+		case "CheckoutRequestID":
+			k.CheckoutRequestID = value
+		case "TransactionID":
+			k.TransactionID = value
+		case "ResponseCode":
+			code = value
+		}
+	}
+	return k, code
+}
+
+// Merge fills the empty identifiers of k with the ones of other.
+func (k *Keys) Merge(other Keys) {
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&k.OriginatorConversationID, other.OriginatorConversationID)
+	fill(&k.ConversationID, other.ConversationID)
+	fill(&k.MerchantRequestID, other.MerchantRequestID)
+	fill(&k.CheckoutRequestID, other.CheckoutRequestID)
+	fill(&k.TransactionID, other.TransactionID)
+}
+
+// matches: reports whether every identifier set in q is the one of k.
+func (k Keys) matches(q Keys) bool {
+	match := func(value, want string) bool { return want == "" || value == want }
+	return match(k.OriginatorConversationID, q.OriginatorConversationID) &&
+		match(k.ConversationID, q.ConversationID) &&
+		match(k.MerchantRequestID, q.MerchantRequestID) &&
+		match(k.CheckoutRequestID, q.CheckoutRequestID) &&
+		match(k.TransactionID, q.TransactionID)
+}
+
+// Record is a request, a response or a callback.
+//
+// Fields:
+//   - ID: The identifier assigned by the store.
+//   - Kind: The direction of the record.
+//   - Operation: The operation of a request or response (b2c_payment, ussd_push...), the
+//     callback kind of a callback (result, stk, confirmation).
+//   - Keys: The correlation identifiers.
+//   - Code: The ResponseCode of a response, the ResultCode of a callback.
+//   - Error: The error of a failed request.
+//   - Body: The redacted JSON payload.
+//   - Raw: The exact bytes of a callback, not redacted, only kept by RawHandler so that
+//     the callback can be replayed byte for byte (see the replay package).
+//   - CreatedAt: When the record was saved, set by the store when zero.
+type Record struct {
+	ID        int64     `json:"id"`
+	Kind      Kind      `json:"kind"`
+	Operation string    `json:"operation"`
+	Keys      Keys      `json:"keys"`
+	Code      string    `json:"code,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Body      []byte    `json:"body,omitempty"`
+	Raw       []byte    `json:"raw,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Query selects records, its zero value selects every record.
+//
+// Fields:
+//   - Keys: The identifiers the records must have, the empty ones are not checked.
+//   - Kind, Operation: The kind and operation of the records, when not empty.
+//   - Since: The oldest creation time, when not zero.
+//   - Until: The creation time the records must be older than, when not zero.
+//   - Limit: The maximum number of records, no limit when not positive.
+type Query struct {
+	Keys      Keys
+	Kind      Kind
+	Operation string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// matches: reports whether a record is selected by the query.
+func (q Query) matches(r *Record) bool {
+	return r.Keys.matches(q.Keys) &&
+		(q.Kind == "" || r.Kind == q.Kind) &&
+		(q.Operation == "" || r.Operation == q.Operation) &&
+		(q.Since.IsZero() || !r.CreatedAt.Before(q.Since)) &&
+		(q.Until.IsZero() || r.CreatedAt.Before(q.Until))
+}
+
+// Store keeps the records. Implementations must be safe for concurrent use.
+type Store interface {
+	// Save stores a record, it sets its ID and, when zero, its CreatedAt.
+	Save(ctx context.Context, r *Record) error
+	// Find returns the records selected by the query, oldest first.
+	Find(ctx context.Context, q Query) ([]Record, error)
+}
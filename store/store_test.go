@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/b2c"
+	"github.com/coleYab/mpesagosdk/callback"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func openSQLite(t *testing.T) *SQLStore {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "mpesa.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	s := NewSQLStore(db, SQLite)
+	require.NoError(t, s.Migrate(context.Background()))
+	return s
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(*testing.T) Store { return NewMemoryStore() },
+		"sqlite": func(t *testing.T) Store { return openSQLite(t) },
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open(t)
+			at := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+
+			records := []*Record{
+				{Kind: KindRequest, Operation: "b2c_payment", Keys: Keys{OriginatorConversationID: "occ-1"},
+					Body: []byte(`{"Amount":100}`), CreatedAt: at},
+				{Kind: KindResponse, Operation: "b2c_payment", Keys: Keys{OriginatorConversationID: "occ-1", ConversationID: "AG_1"},
+					Code: "0", CreatedAt: at.Add(time.Second)},
+				{Kind: KindCallback, Operation: "result", Keys: Keys{OriginatorConversationID: "occ-1", ConversationID: "AG_1",
+					TransactionID: "RKT0000001"}, Code: "0", Raw: []byte(`{"Result":{"ResultCode": 0}}`), CreatedAt: at.Add(2 * time.Second)},
+				{Kind: KindResponse, Operation: "ussd_push", Keys: Keys{MerchantRequestID: "m-1", CheckoutRequestID: "ws_CO_1"},
+					Error: "Bad Request - Invalid Password", CreatedAt: at.Add(3 * time.Second)},
+			}
+			for i, r := range records {
+				require.NoError(t, s.Save(ctx, r))
+				assert.Equal(t, int64(i+1), r.ID)
+			}
+
+			tests := []struct {
+				name  string
+				query Query
+				want  []int64
+			}{
+				{"all", Query{}, []int64{1, 2, 3, 4}},
+				{"originator", Query{Keys: Keys{OriginatorConversationID: "occ-1"}}, []int64{1, 2, 3}},
+				{"conversation", Query{Keys: Keys{ConversationID: "AG_1"}}, []int64{2, 3}},
+				{"transaction", Query{Keys: Keys{TransactionID: "RKT0000001"}}, []int64{3}},
+				{"checkout", Query{Keys: Keys{CheckoutRequestID: "ws_CO_1"}}, []int64{4}},
+				{"kind", Query{Kind: KindResponse}, []int64{2, 4}},
+				{"operation and kind", Query{Kind: KindResponse, Operation: "b2c_payment"}, []int64{2}},
+				{"since", Query{Since: at.Add(2 * time.Second)}, []int64{3, 4}},
+				{"until", Query{Until: at.Add(2 * time.Second)}, []int64{1, 2}},
+				{"time range", Query{Since: at.Add(time.Second), Until: at.Add(3 * time.Second)}, []int64{2, 3}},
+				{"limit", Query{Keys: Keys{OriginatorConversationID: "occ-1"}, Limit: 2}, []int64{1, 2}},
+				{"none", Query{Keys: Keys{OriginatorConversationID: "occ-1", CheckoutRequestID: "ws_CO_1"}}, nil},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					found, err := s.Find(ctx, tt.query)
+					require.NoError(t, err)
+					var ids []int64
+					for _, r := range found {
+						ids = append(ids, r.ID)
+					}
+					assert.Equal(t, tt.want, ids)
+				})
+			}
+
+			found, err := s.Find(ctx, Query{Keys: Keys{OriginatorConversationID: "occ-1"}, Limit: 1})
+			require.NoError(t, err)
+			first := *records[0]
+			assert.Equal(t, first.Body, found[0].Body)
+			assert.True(t, first.CreatedAt.Equal(found[0].CreatedAt))
+			assert.Nil(t, found[0].Raw)
+			found, err = s.Find(ctx, Query{Kind: KindCallback})
+			require.NoError(t, err)
+			assert.Equal(t, `{"Result":{"ResultCode": 0}}`, string(found[0].Raw), "the raw payload is kept as is")
+			found, err = s.Find(ctx, Query{Kind: KindResponse, Operation: "ussd_push"})
+			require.NoError(t, err)
+			assert.Equal(t, "Bad Request - Invalid Password", found[0].Error)
+			assert.Nil(t, found[0].Body)
+		})
+	}
+}
+
+func TestSQLStore_Migrate(t *testing.T) {
+	s := openSQLite(t)
+	require.NoError(t, s.Migrate(context.Background()), "applied migrations are skipped")
+
+	var version int
+	require.NoError(t, s.DB.QueryRow("SELECT MAX(version) FROM mpesa_records_migrations").Scan(&version))
+	assert.Equal(t, len(migrations), version)
+
+	other := NewSQLStore(s.DB, SQLite)
+	other.Table = "payments_log"
+	require.NoError(t, other.Migrate(context.Background()))
+	require.NoError(t, other.Save(context.Background(), &Record{Kind: KindRequest, Operation: "b2c_payment"}))
+	found, err := s.Find(context.Background(), Query{})
+	require.NoError(t, err)
+	assert.Empty(t, found, "the tables are separate")
+}
+
+func TestKeysOf(t *testing.T) {
+	keys, code := KeysOf(b2c.B2CSuccessResponse{ConversationID: "AG_1", OriginatorConversatonId: "occ-1", ResponseCode: "0"})
+	assert.Equal(t, Keys{ConversationID: "AG_1", OriginatorConversationID: "occ-1"}, keys)
+	assert.Equal(t, "0", code)
+
+	keys.Merge(Keys{OriginatorConversationID: "other", TransactionID: "RKT0000001"})
+	assert.Equal(t, Keys{ConversationID: "AG_1", OriginatorConversationID: "occ-1", TransactionID: "RKT0000001"}, keys)
+}
+
+type failingStore struct{ MemoryStore }
+
+func (*failingStore) Save(context.Context, *Record) error { return errors.New("disk full") }
+
+func TestHandler(t *testing.T) {
+	records := NewMemoryStore()
+	var received []string
+	handler := Handler(records, nil, callback.Handlers{
+		OnSTK: func(_ context.Context, cb *callback.STKCallback) error {
+			received = append(received, cb.Body.StkCallback.CheckoutRequestID)
+			return nil
+		},
+	})
+
+	stk := `{"Body":{"stkCallback":{"MerchantRequestID":"m-1","CheckoutRequestID":"ws_CO_1","ResultCode":0,
+		"ResultDesc":"The service request is processed successfully.","CallbackMetadata":{"Item":[
+		{"Name":"MpesaReceiptNumber","Value":"RKT0000001"},{"Name":"PhoneNumber","Value":251712345678}]}}}}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stk", strings.NewReader(stk)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"ws_CO_1"}, received, "the callback is passed on")
+
+	found, err := records.Find(context.Background(), Query{Keys: Keys{TransactionID: "RKT0000001"}})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, KindCallback, found[0].Kind)
+	assert.Equal(t, "stk", found[0].Operation)
+	assert.Equal(t, Keys{MerchantRequestID: "m-1", CheckoutRequestID: "ws_CO_1", TransactionID: "RKT0000001"}, found[0].Keys)
+	assert.Equal(t, "0", found[0].Code)
+	assert.NotContains(t, string(found[0].Body), "251712345678", "the phone number is redacted")
+
+	confirmation := `{"TransactionType":"Pay Bill","TransID":"RKT0000002","TransAmount":"10.00","BusinessShortCode":"600000"}`
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/c2b", strings.NewReader(confirmation)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	found, _ = records.Find(context.Background(), Query{Kind: KindCallback, Operation: "confirmation"})
+	require.Len(t, found, 1)
+	assert.Equal(t, "RKT0000002", found[0].Keys.TransactionID)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stk", strings.NewReader(`{"unknown":true}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "invalid payloads are refused by the next handler")
+
+	raw := NewMemoryStore()
+	rec = httptest.NewRecorder()
+	RawHandler(raw, nil, callback.Handlers{}).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stk", strings.NewReader(stk)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	found, _ = raw.Find(context.Background(), Query{})
+	require.Len(t, found, 1)
+	assert.Equal(t, stk, string(found[0].Raw))
+	assert.NotContains(t, string(found[0].Body), "251712345678", "the body is still redacted")
+	assert.Nil(t, records.records[0].Raw, "Handler does not keep the raw payloads")
+
+	rec = httptest.NewRecorder()
+	Handler(&failingStore{}, nil, callback.Handlers{}).ServeHTTP(rec,
+		httptest.NewRequest(http.MethodPost, "/stk", strings.NewReader(stk)))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "M-Pesa retries the callbacks not recorded")
+}
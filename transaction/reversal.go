@@ -6,8 +6,9 @@ import (
 	"net/http"
 
 	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
+	"github.com/coleYab/mpesagosdk/msisdn"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 type TransactionReversalRequest struct {
@@ -15,8 +16,8 @@ type TransactionReversalRequest struct {
 	SecurityCredential       string               `json:"SecurityCredential" validate:"required"`
 	CommandID                types.CommandId      `json:"CommandID" validate:"required"`
 	TransactionID            string               `json:"TransactionID" validate:"required,min=10,max=100"`
-	Amount                   uint64               `json:"Amount" validate:"required,gte=1"`
-	PartyA                   string               `json:"ReceiverParty" validate:"required,min=3,max=50"`
+	Amount                   money.Amount         `json:"Amount" validate:"required,gte=1"`
+	PartyA                   string               `json:"ReceiverParty" validate:"required,shortcode|msisdn_et"`
 	IdentifierType           types.IdentifierType `json:"RecieverIdentifierType" validate:"required"`
 	QueueTimeOutURL          string               `json:"QueueTimeOutURL" validate:"required,url"`
 	ResultURL                string               `json:"ResultURL" validate:"required,url"`
@@ -52,6 +53,31 @@ func (a *TransactionReversalRequest) FillDefaults() {
 	a.CommandID = types.TransactionReversalCommand
 }
 
-func (a *TransactionReversalRequest) Validate(v *validator.Validate) error {
+// ApplyDefaults: fills the initiator, receiver party and callback urls from the
+// configured defaults when they are not set on the request.
+func (a *TransactionReversalRequest) ApplyDefaults(d types.Defaults) {
+	a.Initiator = types.OrDefault(a.Initiator, d.InitiatorName)
+	a.SecurityCredential = types.OrDefault(a.SecurityCredential, d.SecurityCredential)
+	a.PartyA = types.OrDefault(a.PartyA, d.ShortCode)
+	a.QueueTimeOutURL = types.OrDefault(a.QueueTimeOutURL, d.QueueTimeOutURL)
+	a.ResultURL = types.OrDefault(a.ResultURL, d.ResultURL)
+}
+
+// Normalize: rewrites the receiver party to the 2517XXXXXXXX form when it is an MSISDN.
+func (a *TransactionReversalRequest) Normalize() {
+	if a.IdentifierType != types.MsisdnIdentifierType {
+		return
+	}
+	if m, err := msisdn.Normalize(a.PartyA); err == nil {
+		a.PartyA = m
+	}
+}
+
+// Transfer: describes the reversal for the transaction limits.
+func (a *TransactionReversalRequest) Transfer() types.Transfer {
+	return types.Transfer{CommandID: a.CommandID, Party: a.PartyA, Amount: a.Amount}
+}
+
+func (a *TransactionReversalRequest) Validate(v *types.Validator) error {
 	return utils.Validate(v, a)
 }
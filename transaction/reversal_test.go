@@ -3,12 +3,13 @@ package transaction
 import (
 	"testing"
 
+	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/money"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 func TestTransactionReversalRequestValidation(t *testing.T) {
-	validate := validator.New()
+	validate := utils.NewValidator()
 
 	tests := []struct {
 		name    string
@@ -26,7 +27,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				CommandID:                types.TransactionReversalCommand,
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -44,7 +45,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				CommandID:                types.TransactionReversalCommand,
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -62,7 +63,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				CommandID:                types.TransactionReversalCommand,
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -80,7 +81,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				CommandID:                types.TransactionReversalCommand,
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -98,7 +99,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				CommandID:                types.TransactionReversalCommand,
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -116,7 +117,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				PartyA:                   "600000",
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -134,7 +135,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				PartyA:                   "600000",
 				CommandID:                types.TransactionReversalCommand,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -171,7 +172,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				CommandID:                types.TransactionReversalCommand,
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   0, // Invalid amount, should be greater than 0
+				Amount:                   money.Zero, // Invalid amount, should be greater than 0
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -190,7 +191,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				CommandID:                types.TransactionReversalCommand,
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "invalid-url", // Invalid URL format
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -209,7 +210,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				CommandID:                types.TransactionReversalCommand,
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  "Reversing transaction",
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "invalid-url", // Invalid URL format
@@ -228,7 +229,7 @@ func TestTransactionReversalRequestValidation(t *testing.T) {
 				CommandID:                types.TransactionReversalCommand,
 				IdentifierType:           types.ShortCodeIdentifierType,
 				OriginatorConversationID: "conv12345",
-				Amount:                   1000,
+				Amount:                   money.Birr(1000),
 				Remarks:                  string(make([]byte, 201)), // 201 characters, exceeds limit
 				ResultURL:                "https://yourdomain.com/result",
 				QueueTimeOutURL:          "https://yourdomain.com/timeout",
@@ -2,29 +2,31 @@ package transaction
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
-	"slices"
 
 	"github.com/coleYab/mpesagosdk/internal/utils"
+	"github.com/coleYab/mpesagosdk/msisdn"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 // TransactionStatusRequest represents the parameters for querying the transaction status.
+// The transaction is found by its TransactionID (the receipt number) or, when the receipt
+// is not known, by the OriginatorConversationID of the request that created it sent as
+// OriginalConversationID.
 type TransactionStatusRequest struct {
 	CommandID                types.CommandId      `json:"CommandID" validate:"required"`
-	IdentifierType           types.IdentifierType `json:"IdentifierType" validate:"required"`
+	IdentifierType           types.IdentifierType `json:"IdentifierType" validate:"required,oneof=1 2 4"`
 	Initiator                string               `json:"Initiator" validate:"required,min=1,max=255"`
 	Occasion                 string               `json:"Occasion" validate:"required,min=1,max=255"`
 	OriginatorConversationID string               `json:"OriginatorConversationID,omitempty" validate:"omitempty,min=1,max=255"`
-	PartyA                   string               `json:"PartyA" validate:"required,min=1,max=255"`
+	OriginalConversationID   string               `json:"OriginalConversationID,omitempty" validate:"omitempty,min=1,max=255"`
+	PartyA                   string               `json:"PartyA" validate:"required,shortcode|msisdn_et"`
 	QueueTimeOutURL          string               `json:"QueueTimeOutURL" validate:"required,url"`
 	Remarks                  string               `json:"Remarks" validate:"omitempty,max=500"`
 	ResultURL                string               `json:"ResultURL" validate:"required,url"`
 	SecurityCredential       string               `json:"SecurityCredential" validate:"required,min=8"`
-	TransactionID            string               `json:"TransactionID" validate:"required,min=1,max=255"`
+	TransactionID            string               `json:"TransactionID,omitempty" validate:"required_without=OriginalConversationID,max=255"`
 }
 
 type TransactionStatusResponse types.MpesaCommonResponse
@@ -54,11 +56,26 @@ func (a *TransactionStatusRequest) FillDefaults() {
 	a.CommandID = types.TransactionStatusCommand
 }
 
-func (a *TransactionStatusRequest) Validate(v *validator.Validate) error {
-	validIdentifiers := []types.IdentifierType{types.MsisdnIdentifierType, types.TillNumberIdentifierType, types.ShortCodeIdentifierType}
-	if !slices.Contains(validIdentifiers, a.IdentifierType) {
-		return fmt.Errorf("unkown identifier type %v", a.IdentifierType)
+// ApplyDefaults: fills the initiator, short code and callback urls from the
+// configured defaults when they are not set on the request.
+func (a *TransactionStatusRequest) ApplyDefaults(d types.Defaults) {
+	a.Initiator = types.OrDefault(a.Initiator, d.InitiatorName)
+	a.SecurityCredential = types.OrDefault(a.SecurityCredential, d.SecurityCredential)
+	a.PartyA = types.OrDefault(a.PartyA, d.ShortCode)
+	a.QueueTimeOutURL = types.OrDefault(a.QueueTimeOutURL, d.QueueTimeOutURL)
+	a.ResultURL = types.OrDefault(a.ResultURL, d.ResultURL)
+}
+
+// Normalize: rewrites the party to the 2517XXXXXXXX form when it is an MSISDN.
+func (a *TransactionStatusRequest) Normalize() {
+	if a.IdentifierType != types.MsisdnIdentifierType {
+		return
 	}
+	if m, err := msisdn.Normalize(a.PartyA); err == nil {
+		a.PartyA = m
+	}
+}
 
+func (a *TransactionStatusRequest) Validate(v *types.Validator) error {
 	return utils.Validate(v, a)
 }
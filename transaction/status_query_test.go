@@ -3,12 +3,12 @@ package transaction
 import (
 	"testing"
 
+	"github.com/coleYab/mpesagosdk/internal/utils"
 	"github.com/coleYab/mpesagosdk/types"
-	"github.com/go-playground/validator/v10"
 )
 
 func TestTransactionStatusRequestValidation(t *testing.T) {
-	validate := validator.New()
+	validate := utils.NewValidator()
 
 	tests := []struct {
 		name    string
@@ -106,7 +106,26 @@ func TestTransactionStatusRequestValidation(t *testing.T) {
 			wantErr: true,
 		},
 
-		// 6. Missing PartyA
+		// 6. OriginalConversationID instead of TransactionID
+		{
+			name: "OriginalConversationID instead of TransactionID",
+			req: TransactionStatusRequest{
+				Initiator:                "apitest",
+				SecurityCredential:       "lMhf0UqE4ydeEDwpUskmPgkNDZnA6NLi7z3T1TQuWCkH3/ScW8pRRnobq/AcwFvbC961+zDMgOEYGm8Oivb7L/7Y9ED3lhR7pJvnH8B1wYis5ifdeeWI6XE2NSq8X1Tc7QB9Dg8SlPEud3tgloB2DlT+JIv3ebIl/J/8ihGVrq499bt1pz/EA2nzkCtGeHRNbEDxkqkEnbioV0OM//0bv4K++XyV6jUFlIIgkDkmcK6aOU8mPBHs2um9aP+Y+nTJaa6uHDudRFg0+3G6gt1zRCPs8AYbts2IebseBGfZKv5K6Lqk9/W8657gEkrDZE8Mi78MVianqHdY/8d6D9KKhw==",
+				CommandID:                types.TransactionStatusCommand,
+				OriginalConversationID:   "payroll-emp-01",
+				OriginatorConversationID: "AG-20190826-0000777ab7d848b9e721",
+				PartyA:                   "1020",
+				IdentifierType:           types.IdentifierType("4"),
+				ResultURL:                "https://webhook.site/7ed4b055-fa4d-45f3-ae1f-328c52aa4d7d",
+				QueueTimeOutURL:          "https://webhook.site/7ed4b055-fa4d-45f3-ae1f-328c52aa4d7d",
+				Remarks:                  "Trans Status",
+				Occasion:                 "Query trans status",
+			},
+			wantErr: false,
+		},
+
+		// 7. Missing PartyA
 		{
 			name: "Missing PartyA",
 			req: TransactionStatusRequest{
@@ -124,7 +143,7 @@ func TestTransactionStatusRequestValidation(t *testing.T) {
 			wantErr: true,
 		},
 
-		// 7. Invalid ResultURL
+		// 8. Invalid ResultURL
 		{
 			name: "Invalid ResultURL",
 			req: TransactionStatusRequest{
@@ -143,7 +162,7 @@ func TestTransactionStatusRequestValidation(t *testing.T) {
 			wantErr: true,
 		},
 
-		// 8. Invalid QueueTimeOutURL
+		// 9. Invalid QueueTimeOutURL
 		{
 			name: "Invalid QueueTimeOutURL",
 			req: TransactionStatusRequest{
@@ -162,7 +181,7 @@ func TestTransactionStatusRequestValidation(t *testing.T) {
 			wantErr: true,
 		},
 
-		// 9. Remarks Too Long
+		// 10. Remarks Too Long
 		{
 			name: "Remarks Too Long",
 			req: TransactionStatusRequest{
@@ -0,0 +1,39 @@
+package types
+
+// Defaults holds the party and callback settings that are shared by most requests
+// sent on behalf of a single organization. When a request leaves one of these fields
+// empty the SDK fills it from the configured defaults before validating the request,
+// so callers only have to provide what actually changes between requests.
+//
+// Fields:
+//   - ShortCode: The organization short code used as PartyA / BusinessShortCode.
+//   - InitiatorName: The API operator username used as Initiator / InitiatorName.
+//   - SecurityCredential: The encrypted initiator password.
+//   - PassKey: The USSD push pass key, used to derive the request Password.
+//   - ResultURL: The URL that receives asynchronous results.
+//   - QueueTimeOutURL: The URL that receives queue timeout notifications.
+//   - CallBackURL: The URL that receives USSD push (STK) callbacks.
+type Defaults struct {
+	ShortCode          string
+	InitiatorName      string
+	SecurityCredential string
+	PassKey            string
+	ResultURL          string
+	QueueTimeOutURL    string
+	CallBackURL        string
+}
+
+// DefaultsApplier is implemented by requests that can inherit values from the
+// configured Defaults. ApplyDefaults must only fill fields that are still empty,
+// values set explicitly on the request always win.
+type DefaultsApplier interface {
+	ApplyDefaults(d Defaults)
+}
+
+// OrDefault: returns value when it is set, otherwise it returns fallback.
+func OrDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,9 @@
+package types
+
+// Normalizer is implemented by requests with fields that have several accepted
+// spellings, such as phone numbers. Normalize rewrites them to the form M-Pesa
+// expects and is called before the request is validated. Values that cannot be
+// normalized are left unchanged so that validation reports them.
+type Normalizer interface {
+	Normalize()
+}
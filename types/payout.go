@@ -0,0 +1,76 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coleYab/mpesagosdk/money"
+)
+
+// PayoutKey is what makes two payouts the same payment for the duplicate guard:
+// the same amount paid to the same recipient for the same reason.
+//
+// Fields:
+//   - Recipient: The paid party, in its normalized form.
+//   - Amount: The paid amount.
+//   - Remarks: The remarks of the payout, compared case insensitively.
+//   - Occasion: The occasion of the payout, compared case insensitively.
+type PayoutKey struct {
+	Recipient string
+	Amount    money.Amount
+	Remarks   string
+	Occasion  string
+}
+
+// Fingerprint returns a stable hash of the key, it is what the duplicate stores keep.
+func (k PayoutKey) Fingerprint() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s",
+		strings.TrimSpace(k.Recipient), k.Amount.Santim(), fold(k.Remarks), fold(k.Occasion))))
+	return hex.EncodeToString(sum[:])
+}
+
+// fold: lower cases a text and collapses its spaces.
+func fold(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// Payout is implemented by the requests paying money out of the organization that
+// are checked by the duplicate guard.
+type Payout interface {
+	// PayoutKey returns the key identifying the payout.
+	PayoutKey() PayoutKey
+	// DuplicateAllowed reports whether the caller explicitly allowed the payout to
+	// repeat a recent one.
+	DuplicateAllowed() bool
+}
+
+// DuplicateError is returned when a payout repeats one sent within the configured
+// window, the payout is not sent to M-Pesa. Set the override flag of the request
+// (AllowDuplicate on b2c.B2CRequest) to send it anyway.
+//
+// Example usage:
+//
+//	_, err := app.MakeB2CPaymentRequest(req)
+//	var derr *types.DuplicateError
+//	if errors.As(err, &derr) {
+//		fmt.Println("already paid at", derr.FirstSeen)
+//	}
+type DuplicateError struct {
+	// Payout is the refused payout.
+	Payout PayoutKey `json:"payout"`
+	// Fingerprint is the fingerprint of the payout, see PayoutKey.Fingerprint.
+	Fingerprint string `json:"fingerprint"`
+	// FirstSeen is when the same payout was sent.
+	FirstSeen time.Time `json:"first_seen"`
+	// Window is the configured duplicate window.
+	Window time.Duration `json:"window"`
+}
+
+// Error describes the duplicate.
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("duplicate payout: %v to %v was already sent at %v (window %v)",
+		e.Payout.Amount, e.Payout.Recipient, e.FirstSeen.Format(time.RFC3339), e.Window)
+}
@@ -0,0 +1,114 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/coleYab/mpesagosdk/money"
+)
+
+// Transfer describes the money moved by a request, it is what the transaction
+// limits are checked against.
+//
+// Fields:
+//   - CommandID: The command of the request, the TransactionType for USSD push payments.
+//   - Party: The customer side of the transfer: the payee of a B2C payment, the payer
+//     of a USSD push or C2B payment, the ReceiverParty of a reversal.
+//   - Amount: The amount of the transfer.
+type Transfer struct {
+	CommandID CommandId
+	Party     string
+	Amount    money.Amount
+}
+
+// Transferer is implemented by the requests that move money.
+type Transferer interface {
+	Transfer() Transfer
+}
+
+// AmountLimits is an inclusive amount range, a zero bound is not checked.
+type AmountLimits struct {
+	Min money.Amount `yaml:"min" json:"min"`
+	Max money.Amount `yaml:"max" json:"max"`
+}
+
+// Limits are the transaction limits checked before a request is sent to M-Pesa, so
+// that a transfer M-Pesa (or the business) would refuse fails early and without a
+// network call. The zero value checks nothing.
+//
+// The daily totals are kept in the memory of each App: they start from zero when the
+// process restarts and are not shared between processes or replicas, so several
+// replicas each allow up to the cap. Enforce a hard limit across processes in your
+// own storage, DailyCap is a per process safeguard.
+//
+// Fields:
+//   - Commands: The minimum and maximum amount of a single transfer per CommandID.
+//   - DailyCap: The total amount a single party can receive or pay in a day, zero is no cap.
+//   - PartyDailyCaps: Per party overrides of DailyCap, keyed by MSISDN or short code.
+//   - Allow: When not empty, the only parties transfers are allowed with.
+//   - Deny: The parties transfers are refused with, it wins over Allow.
+//
+// Example (YAML, in a configuration profile):
+//
+//	limits:
+//	  commands:
+//	    BusinessPayment: {min: 10, max: 150000}
+//	    CustomerPayBillOnline: {max: 75000}
+//	  daily_cap: 300000
+//	  party_daily_caps:
+//	    "251712345678": 1000000
+//	  deny: ["251799999999"]
+type Limits struct {
+	Commands       map[CommandId]AmountLimits `yaml:"commands" json:"commands"`
+	DailyCap       money.Amount               `yaml:"daily_cap" json:"daily_cap"`
+	PartyDailyCaps map[string]money.Amount    `yaml:"party_daily_caps" json:"party_daily_caps"`
+	Allow          []string                   `yaml:"allow" json:"allow"`
+	Deny           []string                   `yaml:"deny" json:"deny"`
+}
+
+// Policy rules reported by PolicyError.
+const (
+	PolicyMinAmount  = "min_amount"
+	PolicyMaxAmount  = "max_amount"
+	PolicyDailyCap   = "daily_cap"
+	PolicyDenied     = "denied"
+	PolicyNotAllowed = "not_allowed"
+)
+
+// PolicyError is returned when a request breaks one of the configured Limits, the
+// request is not sent to M-Pesa.
+//
+// Example usage:
+//
+//	_, err := app.MakeB2CPaymentRequest(req)
+//	var perr *types.PolicyError
+//	if errors.As(err, &perr) && perr.Rule == types.PolicyDailyCap {
+//		fmt.Println("try again tomorrow, already paid", perr.Used)
+//	}
+type PolicyError struct {
+	// Rule is the broken rule, one of the Policy constants.
+	Rule string `json:"rule"`
+	// Transfer is the refused transfer.
+	Transfer Transfer `json:"transfer"`
+	// Limit is the amount limit that was exceeded, for the amount and daily cap rules.
+	Limit money.Amount `json:"limit"`
+	// Used is what the party already transferred today, for the daily cap rule.
+	Used money.Amount `json:"used"`
+}
+
+// Error describes the broken rule.
+func (e *PolicyError) Error() string {
+	t := e.Transfer
+	switch e.Rule {
+	case PolicyMinAmount:
+		return fmt.Sprintf("policy: %v %v is below the minimum of %v", t.CommandID, t.Amount, e.Limit)
+	case PolicyMaxAmount:
+		return fmt.Sprintf("policy: %v %v is above the maximum of %v", t.CommandID, t.Amount, e.Limit)
+	case PolicyDailyCap:
+		return fmt.Sprintf("policy: %v with %v would exceed the daily cap of %v, %v already used", t.Amount, t.Party, e.Limit, e.Used)
+	case PolicyDenied:
+		return fmt.Sprintf("policy: %v is on the deny list", t.Party)
+	case PolicyNotAllowed:
+		return fmt.Sprintf("policy: %v is not on the allow list", t.Party)
+	}
+	return "policy: " + e.Rule
+}
@@ -0,0 +1,52 @@
+package types
+
+import "fmt"
+
+// RecipientCheck is implemented by the payout requests that can name the person expected
+// to receive the money, the SDK then compares the name registered for the recipient with
+// it before sending the payout (see the kyc package).
+type RecipientCheck interface {
+	// ExpectedRecipient returns the recipient MSISDN and its expected name, the check
+	// is skipped when the name is empty.
+	ExpectedRecipient() (msisdn, name string)
+}
+
+// NameCheckError is returned when the name registered for the recipient of a payout does
+// not match the expected one, or when it could not be looked up, the payout is not sent
+// to M-Pesa.
+//
+// Example usage:
+//
+//	_, err := app.MakeB2CPaymentRequest(req)
+//	var nerr *types.NameCheckError
+//	if errors.As(err, &nerr) && nerr.Err == nil {
+//		fmt.Printf("%v belongs to %v\n", nerr.Msisdn, nerr.Registered)
+//	}
+type NameCheckError struct {
+	// Msisdn is the recipient of the payout.
+	Msisdn string `json:"msisdn"`
+	// Expected is the name given with the payout.
+	Expected string `json:"expected"`
+	// Registered is the name M-Pesa has for the recipient, empty when the lookup failed.
+	Registered string `json:"registered,omitempty"`
+	// Score is the similarity of the names, see kyc.Similarity.
+	Score float64 `json:"score"`
+	// Threshold is the minimum similarity of the names.
+	Threshold float64 `json:"threshold"`
+	// Err is why the name could not be looked up, nil when the names do not match.
+	Err error `json:"-"`
+}
+
+// Error describes the mismatch or the failed lookup.
+func (e *NameCheckError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("name check: unable to look up %v: %v", e.Msisdn, e.Err)
+	}
+	return fmt.Sprintf("name check: %v is registered to %q, not %q (similarity %.2f below %.2f)",
+		e.Msisdn, e.Registered, e.Expected, e.Score, e.Threshold)
+}
+
+// Unwrap returns the error of the lookup.
+func (e *NameCheckError) Unwrap() error {
+	return e.Err
+}
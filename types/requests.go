@@ -11,10 +11,9 @@
 package types
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-
-	"github.com/go-playground/validator/v10"
 )
 
 // MpesaRequest defines the interface that must be implemented by all request types
@@ -71,7 +70,7 @@ import (
 //
 // This interface will improve consistency when adding a new feature to the sandbox.
 type MpesaRequest interface {
-	Validate(v *validator.Validate) error
+	Validate(v *Validator) error
 	DecodeResponse(res *http.Response) (MpesaResponse, error)
 	FillDefaults()
 }
@@ -82,16 +81,45 @@ type MpesaResponse interface{}
 // MpesaErrorResponse is a structure used to represent error responses from the M-Pesa API.
 // It contains information about the error, including the request ID, error code, and error message.
 // it implements the (error interface)[https://go.dev/wiki/Errors]
+//
+// StatusCode is the HTTP status of the response, it is set by the SDK and is not part of the body.
 type MpesaErrorResponse struct {
 	RequestId    string `json:"requestId"`
 	ErrorCode    string `json:"errorCode"`
 	ErrorMessage string `json:"errorMessage"`
+	StatusCode   int    `json:"-"`
 }
 
 func (e *MpesaErrorResponse) Error() string {
 	return fmt.Sprintf("request with id=%v failed with code=%v, due to %v", e.RequestId, e.ErrorCode, e.ErrorMessage)
 }
 
+// Refused reports whether the error of a request proves that M-Pesa did not accept it:
+// a validation, policy, duplicate payout or name check error raised before sending, or
+// an error response of M-Pesa with an errorCode and a 4xx HTTP status. Other errors, such
+// as a timeout or a 5xx response of a gateway, leave the outcome unknown. The local errors
+// are checked first, a name check error wrapping a failed lookup was never sent.
+func Refused(err error) bool {
+	var (
+		validationErr *ValidationError
+		policyErr     *PolicyError
+		duplicateErr  *DuplicateError
+		nameErr       *NameCheckError
+		mpesaErr      *MpesaErrorResponse
+	)
+	if errors.As(err, &validationErr) || errors.As(err, &policyErr) ||
+		errors.As(err, &duplicateErr) || errors.As(err, &nameErr) {
+		return true
+	}
+	return errors.As(err, &mpesaErr) && mpesaErr.Rejected()
+}
+
+// Rejected reports whether the response proves that M-Pesa refused the request, it has an
+// errorCode and a 4xx HTTP status.
+func (e *MpesaErrorResponse) Rejected() bool {
+	return e.ErrorCode != "" && e.StatusCode >= 400 && e.StatusCode < 500
+}
+
 type MpesaSuccessResponse struct{}
 
 // MpesaCommonResponse is a structure that holds fields common to all M-Pesa API responses.
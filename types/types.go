@@ -70,3 +70,22 @@ const (
 	CustomerPayBillOnlineTransaction  TransactionType = "CustomerPayBillOnline"
 	CustomerBuyGoodsOnlineTransaction TransactionType = "CustomerBuyGoodsOnline"
 )
+
+// QRTransactionCode represents the transaction a dynamic QR code starts when the customer
+// scans it, it decides what the CPI (the credit party identifier) of the code is.
+//
+// The following constants define the available QR transaction codes:
+//   - BuyGoodsQRCode: Pay a till, the CPI is the till number.
+//   - PayBillQRCode: Pay a paybill, the CPI is the business short code.
+//   - WithdrawCashQRCode: Withdraw cash at an agent, the CPI is the agent store number.
+//   - SendMoneyQRCode: Send money to a customer, the CPI is the customer MSISDN.
+//   - SendToBusinessQRCode: Send money to a business, the CPI is the business short code.
+type QRTransactionCode string
+
+const (
+	BuyGoodsQRCode       QRTransactionCode = "BG"
+	PayBillQRCode        QRTransactionCode = "PB"
+	WithdrawCashQRCode   QRTransactionCode = "WA"
+	SendMoneyQRCode      QRTransactionCode = "SM"
+	SendToBusinessQRCode QRTransactionCode = "SB"
+)
@@ -0,0 +1,101 @@
+package types
+
+import (
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator validates the requests, it is the go-playground validator with the SDK tags
+// registered and the translator of its error messages, see utils.NewValidator.
+//
+// Fields:
+//   - Validate: The validator, its methods are promoted.
+//   - Translator: The English and Amharic translators registered on Validate, nil when
+//     the errors only carry the default English messages.
+type Validator struct {
+	*validator.Validate
+	Translator *ut.UniversalTranslator
+}
+
+// Locales of the validation messages.
+const (
+	LocaleEnglish = "en"
+	LocaleAmharic = "am"
+)
+
+// FieldError describes why a single request field is invalid.
+//
+// Fields:
+//   - Field: The JSON name of the field, nested fields are written as `ReferenceData[0].Key`.
+//   - Tag: The failed validation rule, such as `required`, `max` or `msisdn_et`.
+//   - Param: The parameter of the rule, such as `200` for `max=200`.
+//   - Messages: A human readable message per locale (LocaleEnglish, LocaleAmharic).
+type FieldError struct {
+	Field    string            `json:"field"`
+	Tag      string            `json:"tag"`
+	Param    string            `json:"param,omitempty"`
+	Messages map[string]string `json:"messages"`
+}
+
+// Message: returns the message in the given locale, falling back to English.
+func (f FieldError) Message(locale string) string {
+	if msg, ok := f.Messages[locale]; ok {
+		return msg
+	}
+	return f.Messages[LocaleEnglish]
+}
+
+// Error returns the English message.
+func (f FieldError) Error() string {
+	return f.Message(LocaleEnglish)
+}
+
+// ValidationError is returned when a request fails validation, before anything is
+// sent to M-Pesa. It lists every invalid field and can be serialized as is to be
+// shown by a user interface.
+//
+// Example usage:
+//
+//	_, err := app.MakeB2CPaymentRequest(req)
+//	var verr *types.ValidationError
+//	if errors.As(err, &verr) {
+//		for field, msg := range verr.Messages(types.LocaleAmharic) {
+//			fmt.Println(field, msg)
+//		}
+//	}
+type ValidationError struct {
+	Request string       `json:"request"`
+	Fields  []FieldError `json:"fields"`
+}
+
+// Error returns the English messages of every field.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "invalid " + e.Request + ": " + strings.Join(msgs, "; ")
+}
+
+// Messages: returns the messages in the given locale keyed by the JSON field name.
+func (e *ValidationError) Messages(locale string) map[string]string {
+	out := make(map[string]string, len(e.Fields))
+	for _, f := range e.Fields {
+		if _, ok := out[f.Field]; !ok {
+			out[f.Field] = f.Message(locale)
+		}
+	}
+	return out
+}
+
+// Field: returns the error of a field by its JSON name.
+func (e *ValidationError) Field(name string) (FieldError, bool) {
+	for _, f := range e.Fields {
+		if f.Field == name {
+			return f, true
+		}
+	}
+	return FieldError{}, false
+}